@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// benchTests 是 bench 模式支持的测试，与 redis-benchmark -t 的名字一致。
+// 每个测试根据随机选出的键和 -d 大小的值生成一条命令
+var benchTests = map[string]func(key, value string) []string{
+	"set":    func(key, value string) []string { return []string{"SET", "key:" + key, value} },
+	"get":    func(key, value string) []string { return []string{"GET", "key:" + key} },
+	"lpush":  func(key, value string) []string { return []string{"LPUSH", "mylist:" + key, value} },
+	"rpush":  func(key, value string) []string { return []string{"RPUSH", "mylist:" + key, value} },
+	"lpop":   func(key, value string) []string { return []string{"LPOP", "mylist:" + key} },
+	"rpop":   func(key, value string) []string { return []string{"RPOP", "mylist:" + key} },
+	"lrange": func(key, value string) []string { return []string{"LRANGE", "mylist:" + key, "0", "99"} },
+	"sadd":   func(key, value string) []string { return []string{"SADD", "myset:" + key, "element:" + value} },
+	"hset":   func(key, value string) []string { return []string{"HSET", "myhash:" + key, "field", value} },
+	"lbadd": func(key, value string) []string {
+		return []string{"LBADD", "player:" + key, strconv.Itoa(rand.Intn(10001))}
+	},
+	"lbtop": func(key, value string) []string { return []string{"LBTOP", "10"} },
+	"del":   func(key, value string) []string { return []string{"DEL", "key:" + key} },
+}
+
+// benchDefaultTests 是没有指定 -t 时依次运行的测试
+const benchDefaultTests = "set,get,lpush,rpush,lpop,rpop,sadd,hset,lrange,lbadd,lbtop"
+
+// benchWeighted 是 -mix 中的一种命令及其权重
+type benchWeighted struct {
+	name   string
+	weight int
+}
+
+// benchOptions 是 bench 模式的参数
+type benchOptions struct {
+	addr     string
+	clients  int
+	requests int
+	pipeline int
+	keyspace int
+	dataSize int
+}
+
+// runBenchmark 实现 bench 模式：仿照 redis-benchmark，用 -c 个并发连接共发送 -n 条命令，
+// 输出每种测试的吞吐量和延迟分位数。-t 指定依次运行的测试，-mix 指定按权重混合的一组命令（例如 get:80,set:20）
+func runBenchmark(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	host := fs.String("h", "127.0.0.1", "server hostname")
+	port := fs.Int("p", 6379, "server port")
+	var opts benchOptions
+	fs.IntVar(&opts.clients, "c", 50, "number of parallel connections")
+	fs.IntVar(&opts.requests, "n", 100000, "total number of requests")
+	fs.IntVar(&opts.pipeline, "P", 1, "pipeline <numreq> requests")
+	fs.IntVar(&opts.keyspace, "r", 0, "use random keys in [0, keyspacelen), 0 means a single key")
+	fs.IntVar(&opts.dataSize, "d", 3, "data size of SET/GET value in bytes")
+	tests := fs.String("t", benchDefaultTests, "comma separated list of tests to run")
+	mix := fs.String("mix", "", "run a single weighted command mix instead of -t, e.g. get:80,set:20")
+	fs.Parse(args)
+	opts.addr = net.JoinHostPort(*host, strconv.Itoa(*port))
+	if opts.clients < 1 || opts.requests < 1 || opts.pipeline < 1 || opts.dataSize < 0 || opts.keyspace < 0 {
+		log.Fatal("bench: -c, -n and -P must be positive, -d and -r must not be negative")
+	}
+
+	if *mix != "" {
+		weights, err := parseBenchMix(*mix)
+		if err != nil {
+			log.Fatal("bench: ", err)
+		}
+		total := 0
+		for _, w := range weights {
+			total += w.weight
+		}
+		pick := func() string {
+			n := rand.Intn(total)
+			for _, w := range weights {
+				if n < w.weight {
+					return w.name
+				}
+				n -= w.weight
+			}
+			return weights[len(weights)-1].name
+		}
+		runBenchTest("MIX "+*mix, opts, pick)
+		return
+	}
+	for _, name := range strings.Split(strings.ToLower(*tests), ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := benchTests[name]; !ok {
+			log.Fatalf("bench: unknown test '%s'", name)
+		}
+		runBenchTest(strings.ToUpper(name), opts, func() string { return name })
+	}
+}
+
+// parseBenchMix 解析 -mix 参数，每一项为 命令:权重
+func parseBenchMix(s string) ([]benchWeighted, error) {
+	var weights []benchWeighted
+	for _, item := range strings.Split(strings.ToLower(s), ",") {
+		name, weightStr, ok := strings.Cut(strings.TrimSpace(item), ":")
+		weight, err := strconv.Atoi(weightStr)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("bad mix item '%s', expected command:weight", item)
+		}
+		if _, ok := benchTests[name]; !ok {
+			return nil, fmt.Errorf("unknown command '%s' in mix", name)
+		}
+		if weight > 0 {
+			weights = append(weights, benchWeighted{name, weight})
+		}
+	}
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("mix must contain at least one command with a positive weight")
+	}
+	return weights, nil
+}
+
+// runBenchTest 运行一轮测试并输出结果，pick 为每条请求选出要执行的测试名
+func runBenchTest(title string, opts benchOptions, pick func() string) {
+	value := strings.Repeat("x", opts.dataSize)
+	var next atomic.Int64 // 已经分配出去的请求数
+	var errors atomic.Int64
+	recorders := make([]*latencyRecorder, opts.clients)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < opts.clients; i++ {
+		rec := &latencyRecorder{}
+		recorders[i] = rec
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", opts.addr)
+			if err != nil {
+				log.Println("bench: connection error:", err)
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+			var buf []byte
+			for {
+				// 每次领取一批（最多 pipeline 条）请求，领完 -n 条后退出
+				end := next.Add(int64(opts.pipeline))
+				begin := end - int64(opts.pipeline)
+				if begin >= int64(opts.requests) {
+					return
+				}
+				batch := int(min(end, int64(opts.requests)) - begin)
+				buf = buf[:0]
+				for j := 0; j < batch; j++ {
+					key := "__rand_int__"
+					if opts.keyspace > 0 {
+						key = fmt.Sprintf("%012d", rng.Intn(opts.keyspace))
+					}
+					buf = append(buf, resp.EncodeCommand(benchTests[pick()](key, value))...)
+				}
+				sent := time.Now()
+				if _, err := conn.Write(buf); err != nil {
+					log.Println("bench: write error:", err)
+					return
+				}
+				for j := 0; j < batch; j++ {
+					_, err := resp.ReadValue(reader)
+					if _, ok := err.(resp.Error); ok {
+						errors.Add(1)
+					} else if err != nil {
+						log.Println("bench: read error:", err)
+						return
+					}
+					rec.add(time.Since(sent))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	all := &latencyRecorder{}
+	for _, rec := range recorders {
+		all.samples = append(all.samples, rec.samples...)
+	}
+	done := len(all.samples)
+	fmt.Printf("====== %s ======\n", title)
+	fmt.Printf("  %d requests completed in %.2f seconds\n", done, elapsed.Seconds())
+	fmt.Printf("  %d parallel clients, pipeline %d, %d bytes payload, keyspace %d\n", opts.clients, opts.pipeline, opts.dataSize, opts.keyspace)
+	if n := errors.Load(); n > 0 {
+		fmt.Printf("  %d error replies\n", n)
+	}
+	if done == 0 {
+		fmt.Println()
+		return
+	}
+	fmt.Printf("  throughput summary: %.2f requests per second\n", float64(done)/elapsed.Seconds())
+	s := all.summary()
+	fmt.Printf("  latency summary (msec):\n          avg       min       p50       p95       p99       max\n")
+	fmt.Printf("    %9.3f %9.3f %9.3f %9.3f %9.3f %9.3f\n\n",
+		msec(s.avg), msec(s.min), msec(s.p50), msec(s.p95), msec(s.p99), msec(s.max))
+}
+
+// latencyRecorder 记录每条请求的延迟，只被一个 goroutine 使用
+type latencyRecorder struct {
+	samples []time.Duration
+}
+
+func (r *latencyRecorder) add(d time.Duration) {
+	r.samples = append(r.samples, d)
+}
+
+// latencySummary 是一组延迟的统计结果
+type latencySummary struct {
+	avg, min, p50, p95, p99, max time.Duration
+}
+
+// summary 对记录的延迟排序并计算统计结果，没有记录时返回零值
+func (r *latencyRecorder) summary() latencySummary {
+	s := r.samples
+	if len(s) == 0 {
+		return latencySummary{}
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	var total time.Duration
+	for _, d := range s {
+		total += d
+	}
+	pct := func(p float64) time.Duration {
+		return s[min(int(p*float64(len(s))), len(s)-1)]
+	}
+	return latencySummary{
+		avg: total / time.Duration(len(s)),
+		min: s[0],
+		p50: pct(0.50),
+		p95: pct(0.95),
+		p99: pct(0.99),
+		max: s[len(s)-1],
+	}
+}
+
+func msec(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
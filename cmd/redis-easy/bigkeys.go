@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// runBigKeys 实现 cli -bigkeys / -memkeys：执行 MEMORY BIGKEYS 并按 redis-cli --bigkeys 的样式输出每种类型最大的 top 个键，
+// byBytes 为 true 时按估算字节数比较，否则按元素个数比较
+func runBigKeys(c *respClient, byBytes bool, top int) error {
+	by := "ELEMENTS"
+	if byBytes {
+		by = "BYTES"
+	}
+	fmt.Println("# Scanning the entire keyspace to find biggest keys")
+	v, err := c.do("MEMORY", "BIGKEYS", "COUNT", strconv.Itoa(top), "BY", by)
+	if err != nil {
+		return err
+	}
+	types, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected reply to MEMORY BIGKEYS: %v", v)
+	}
+	var summary []string
+	var total int64
+	for _, t := range types {
+		fields, ok := t.([]interface{})
+		if !ok || len(fields) != 4 {
+			return fmt.Errorf("unexpected reply to MEMORY BIGKEYS: %v", v)
+		}
+		typ, _ := fields[0].(string)
+		keys, _ := fields[1].(int64)
+		bytes, _ := fields[2].(int64)
+		biggest, _ := fields[3].([]interface{})
+		total += keys
+		fmt.Println()
+		for i, b := range biggest {
+			k, _ := b.([]interface{})
+			if len(k) != 3 {
+				continue
+			}
+			key, _ := k[0].(string)
+			elements, _ := k[1].(int64)
+			size, _ := k[2].(int64)
+			unit := elementUnit(typ)
+			if i == 0 {
+				fmt.Printf("Biggest %-10s found %s has %d %s (%d bytes)\n", typ, strconv.Quote(key), elements, unit, size)
+			} else {
+				fmt.Printf("        %-10s       %s has %d %s (%d bytes)\n", "", strconv.Quote(key), elements, unit, size)
+			}
+		}
+		summary = append(summary, fmt.Sprintf("%d %ss with %d bytes in total", keys, typ, bytes))
+	}
+	fmt.Println()
+	fmt.Printf("-------- summary -------\n\n")
+	fmt.Printf("Sampled %d keys in the keyspace!\n", total)
+	for _, s := range summary {
+		fmt.Println(s)
+	}
+	return nil
+}
+
+// elementUnit 返回 MEMORY BIGKEYS 中各类型元素个数的单位
+func elementUnit(typ string) string {
+	switch typ {
+	case "string":
+		return "bytes"
+	case "list", "queue":
+		return "items"
+	case "set":
+		return "members"
+	case "hash":
+		return "fields"
+	case "timeseries":
+		return "samples"
+	}
+	return "elements"
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// cliHistoryLimit 是历史文件最多保留的命令数
+const cliHistoryLimit = 1000
+
+// runCLI 实现 cli 模式：redis-easy cli [-h host] [-p port] [-inline] [-bigkeys|-memkeys [-top n]] [command args...]。
+// 带有命令参数时执行这一条命令后退出，-bigkeys / -memkeys 输出每种类型最大的键后退出（见 bigkeys.go），否则进入交互模式
+func runCLI(args []string) {
+	fs := flag.NewFlagSet("cli", flag.ExitOnError)
+	host := fs.String("h", "127.0.0.1", "server hostname")
+	port := fs.Int("p", 6379, "server port")
+	inline := fs.Bool("inline", false, "send commands in inline format instead of RESP arrays")
+	bigkeys := fs.Bool("bigkeys", false, "find the keys with the most elements of each type")
+	memkeys := fs.Bool("memkeys", false, "find the keys using the most memory of each type")
+	top := fs.Int("top", 1, "number of keys of each type reported by -bigkeys and -memkeys")
+	fs.Parse(args)
+
+	c := &respClient{addr: net.JoinHostPort(*host, strconv.Itoa(*port))}
+	defer c.close()
+	if *bigkeys || *memkeys {
+		if err := runBigKeys(c, *memkeys, *top); err != nil {
+			fmt.Println(formatCLIReply(nil, err))
+			os.Exit(1)
+		}
+		return
+	}
+	// send 发送一条命令并读取回复，inline 模式下按 inline 命令的格式发送原始的一行
+	send := func(line string, args []string) (interface{}, error) {
+		if *inline {
+			return c.doRaw([]byte(line + "\r\n"))
+		}
+		return c.do(args...)
+	}
+	if fs.NArg() > 0 {
+		v, err := send(strings.Join(fs.Args(), " "), fs.Args())
+		fmt.Println(formatCLIReply(v, err))
+		if _, ok := err.(resp.Error); err != nil && !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	historyPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyPath = filepath.Join(home, ".rediseasy_cli_history")
+	}
+	history := loadCLIHistory(historyPath)
+	if err := c.connect(); err != nil {
+		fmt.Printf("Could not connect to %s: %v\n", c.addr, err)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for {
+		fmt.Printf("%s> ", c.addr)
+		if !scanner.Scan() {
+			fmt.Println()
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		// !N 重新执行历史中的第 N 条命令
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(history) {
+				fmt.Println("(error) no such history entry")
+				continue
+			}
+			line = history[n-1]
+			fmt.Println(line)
+		}
+		history = appendCLIHistory(historyPath, history, line)
+
+		switch strings.ToLower(line) {
+		case "quit", "exit":
+			return
+		case "help":
+			fmt.Println("Type a command to send it to the server, e.g. SET key value. Arguments may be quoted like in redis-cli.")
+			fmt.Println("Local commands: history (list previous commands), !N (run history entry N), help, quit / exit")
+			continue
+		case "history":
+			for i, h := range history {
+				fmt.Printf("%5d  %s\n", i+1, h)
+			}
+			continue
+		}
+		cmdArgs, err := resp.SplitInlineArgs([]byte(line))
+		if err != nil {
+			fmt.Println("Invalid argument(s)")
+			continue
+		}
+		v, err := send(line, cmdArgs)
+		if _, ok := err.(resp.Error); err != nil && !ok {
+			fmt.Printf("Could not connect to %s: %v\n", c.addr, err)
+			continue
+		}
+		fmt.Println(formatCLIReply(v, err))
+	}
+}
+
+// formatCLIReply 按 redis-cli 的样式格式化回复
+func formatCLIReply(v interface{}, err error) string {
+	if e, ok := err.(resp.Error); ok {
+		return "(error) " + string(e)
+	}
+	if err != nil {
+		return "(error) " + err.Error()
+	}
+	return formatCLIValue(v, "")
+}
+
+// formatCLIValue 格式化单个值，indent 是数组元素续行需要的缩进
+func formatCLIValue(v interface{}, indent string) string {
+	switch v := v.(type) {
+	case nil:
+		return "(nil)"
+	case resp.Status:
+		return string(v)
+	case resp.Error:
+		return "(error) " + string(v)
+	case int64:
+		return "(integer) " + strconv.FormatInt(v, 10)
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return "(empty array)"
+		}
+		var b strings.Builder
+		width := len(strconv.Itoa(len(v)))
+		for i, item := range v {
+			prefix := fmt.Sprintf("%*d) ", width, i+1)
+			if i > 0 {
+				b.WriteString("\n" + indent)
+			}
+			b.WriteString(prefix)
+			b.WriteString(formatCLIValue(item, indent+strings.Repeat(" ", len(prefix))))
+		}
+		return b.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// loadCLIHistory 读取历史文件，文件不存在时返回空历史
+func loadCLIHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
+
+// appendCLIHistory 把一条命令加入历史并写回历史文件，超过 cliHistoryLimit 时丢弃最早的记录
+func appendCLIHistory(path string, history []string, line string) []string {
+	history = append(history, line)
+	if len(history) > cliHistoryLimit {
+		history = history[len(history)-cliHistoryLimit:]
+	}
+	if path != "" {
+		os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+	}
+	return history
+}
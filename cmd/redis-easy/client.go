@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// respClient 是 cli、migrate 等模式使用的一条 RESP 连接，连接断开后在下一条命令时自动重连
+type respClient struct {
+	addr   string
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *respClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, 3*time.Second)
+	if err != nil {
+		return err
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	return nil
+}
+
+func (c *respClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// do 以 RESP 数组发送一条命令并读取回复，错误回复以 resp.Error 返回
+func (c *respClient) do(args ...string) (interface{}, error) {
+	return c.doRaw(resp.EncodeCommand(args))
+}
+
+// doRaw 发送已经编码好的一条请求并读取回复。出现网络错误时关闭连接
+func (c *respClient) doRaw(req []byte) (interface{}, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := c.conn.Write(req); err != nil {
+		c.close()
+		return nil, err
+	}
+	v, err := resp.ReadValue(c.reader)
+	if _, ok := err.(resp.Error); !ok && err != nil {
+		c.close()
+	}
+	return v, err
+}
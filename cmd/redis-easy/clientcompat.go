@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/server"
+)
+
+// clientsDefaultProfiles 是没有指定时运行的客户端库流量记录
+const clientsDefaultProfiles = "cmd/redis-easy/testdata/clients/*.txt"
+
+// runClients 实现 clients 模式：redis-easy clients [-target host:port] [profile ...]。
+// 每个 profile 是按某个客户端库（go-redis、redigo、rueidis）在连接、执行普通命令、管道等场景下发出的命令
+// 手工整理的命令序列，按原样回放并检查回复，可以对运行中的实例快速检查这些命令是否仍然可用。
+// 回放不经过客户端库本身，发现不了客户端库在握手、管道和解析回复上的问题，真正使用这些库的测试在 compat 模块中。
+// 没有指定 -target 时在进程内启动一个监听随机端口的实例，回放结束后关闭。
+//
+// profile 每行一条命令，格式与 inline 命令相同，# 开头的行是注释。命令的回复不能是错误回复，
+// 以 ! 开头的命令必须返回错误回复（客户端库会容忍这个错误，例如 HELLO 3 失败后退回 RESP2）。
+// PIPELINE 与 END 之间的命令一次写出后再依次读取回复，与客户端库的管道相同。
+// 命令之后可以用 " => " 写上期望的回复（按 cli 模式的格式，例如 (integer) 3、"hello"，只用于单行的回复），
+// 回复必须与之完全相同，用来检查管道中的回复是否按命令的顺序返回（见 ordering.txt）。
+// 每个 profile 使用一条新连接；应该只使用 clients: 前缀的键，并在开头用 DEL 清理
+func runClients(args []string) {
+	fs := flag.NewFlagSet("clients", flag.ExitOnError)
+	targetAddr := fs.String("target", "", "address of a running redis-easy server, empty to start one in-process")
+	fs.Parse(args)
+	profiles := fs.Args()
+	if len(profiles) == 0 {
+		profiles, _ = filepath.Glob(clientsDefaultProfiles)
+		if len(profiles) == 0 {
+			log.Fatalf("clients: no profiles given and none found in %s", clientsDefaultProfiles)
+		}
+	}
+
+	addr := *targetAddr
+	if addr == "" {
+		srv := server.New(server.Options{Addr: "127.0.0.1:0", Logger: log.New(io.Discard, "", 0)})
+		if err := srv.Start(context.Background()); err != nil {
+			log.Fatal("clients: ", err)
+		}
+		defer srv.Stop()
+		addr = srv.Addr()
+	}
+
+	total, failed := 0, 0
+	for _, profile := range profiles {
+		n, failures, err := runClientProfile(profile, addr)
+		if err != nil {
+			log.Fatalf("clients: %s: %v", profile, err)
+		}
+		total += n
+		failed += failures
+	}
+	fmt.Printf("%d commands in %d profiles, %d failures\n", total, len(profiles), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// clientCommand 是 profile 中的一条命令
+type clientCommand struct {
+	line      int
+	text      string
+	args      []string
+	wantError bool
+	// want 不为空时是期望的回复，格式与 formatCLIReply 相同
+	want string
+}
+
+// runClientProfile 在一条新连接上回放一个 profile，返回执行的命令数和回复不符合预期的命令数
+func runClientProfile(path, addr string) (commands, failures int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	c := &respClient{addr: addr}
+	defer c.close()
+
+	var pipeline []clientCommand
+	inPipeline := false
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case line == "PIPELINE":
+			inPipeline = true
+			continue
+		case line == "END":
+			n, err := runClientBatch(path, c, pipeline)
+			if err != nil {
+				return commands, failures, err
+			}
+			commands += len(pipeline)
+			failures += n
+			pipeline, inPipeline = nil, false
+			continue
+		}
+		cmd := clientCommand{line: lineNo, text: line, wantError: strings.HasPrefix(line, "!")}
+		command, want, _ := strings.Cut(line, " => ")
+		cmd.want = strings.TrimSpace(want)
+		cmd.args, err = resp.SplitInlineArgs([]byte(strings.TrimPrefix(command, "!")))
+		if err != nil || len(cmd.args) == 0 {
+			return commands, failures, fmt.Errorf("line %d: bad command: %s", lineNo, line)
+		}
+		if inPipeline {
+			pipeline = append(pipeline, cmd)
+			continue
+		}
+		n, err := runClientBatch(path, c, []clientCommand{cmd})
+		if err != nil {
+			return commands, failures, err
+		}
+		commands++
+		failures += n
+	}
+	if inPipeline {
+		return commands, failures, fmt.Errorf("PIPELINE without END")
+	}
+	return commands, failures, scanner.Err()
+}
+
+// runClientBatch 一次写出 batch 中的所有命令，再依次读取并检查回复，返回不符合预期的回复数
+func runClientBatch(path string, c *respClient, batch []clientCommand) (int, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return 0, err
+		}
+	}
+	var req bytes.Buffer
+	for _, cmd := range batch {
+		req.Write(resp.EncodeCommand(cmd.args))
+	}
+	if _, err := c.conn.Write(req.Bytes()); err != nil {
+		return 0, err
+	}
+	failures := 0
+	for _, cmd := range batch {
+		v, err := resp.ReadValue(c.reader)
+		_, isError := err.(resp.Error)
+		if err != nil && !isError {
+			return failures, fmt.Errorf("line %d: %v", cmd.line, err)
+		}
+		if isError != cmd.wantError {
+			failures++
+			got := encodeCompatValue(v)
+			if isError {
+				got = encodeCompatValue(err)
+			}
+			fmt.Printf("%s:%d: %s\n  unexpected reply: %s\n", path, cmd.line, cmd.text, strings.TrimSpace(got))
+		} else if got := formatCLIReply(v, err); cmd.want != "" && got != cmd.want {
+			failures++
+			fmt.Printf("%s:%d: %s\n  unexpected reply: %s\n", path, cmd.line, cmd.text, got)
+		}
+	}
+	return failures, nil
+}
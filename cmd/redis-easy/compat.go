@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// compatDefaultScripts 是没有指定脚本时运行的兼容性脚本，相对于仓库根目录
+const compatDefaultScripts = "cmd/redis-easy/testdata/compat/*.txt"
+
+// findCompatScripts 在当前目录和可执行文件所在的目录（在仓库根目录下 go build 时就是仓库根目录）下查找默认的脚本
+func findCompatScripts() []string {
+	dirs := []string{"."}
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, dir := range dirs {
+		if scripts, _ := filepath.Glob(filepath.Join(dir, compatDefaultScripts)); len(scripts) > 0 {
+			return scripts
+		}
+	}
+	return nil
+}
+
+// runCompat 实现 compat 模式：redis-easy compat [-redis host:port] [-target host:port] [script ...]。
+// 把脚本中的每条命令依次发给真实的 Redis 和 redis-easy，逐条比较两边的回复，输出所有不一致的地方，
+// 有不一致时以状态码 1 退出。
+//
+// 脚本每行一条命令，格式与 inline 命令相同（支持引号和转义），# 开头的行是注释。
+// 以 ~ 开头的命令的回复按无序集合比较（例如 SMEMBERS），数组元素排序后再比较。
+// 脚本应该只使用 compat: 前缀的键，并在开头用 DEL 清理，两个实例上的其他数据不受影响
+func runCompat(args []string) {
+	fs := flag.NewFlagSet("compat", flag.ExitOnError)
+	redisAddr := fs.String("redis", "127.0.0.1:6379", "address of the reference Redis server")
+	targetAddr := fs.String("target", "127.0.0.1:6380", "address of the redis-easy server under test")
+	fs.Parse(args)
+	scripts := fs.Args()
+	if len(scripts) == 0 {
+		scripts = findCompatScripts()
+		if len(scripts) == 0 {
+			log.Fatalf("compat: no scripts given and %s was not found in the current directory or next to the executable; "+
+				"run from the repository root or pass script paths: redis-easy compat [flags] script.txt ...", compatDefaultScripts)
+		}
+	}
+
+	ref := &respClient{addr: *redisAddr}
+	target := &respClient{addr: *targetAddr}
+	defer ref.close()
+	defer target.close()
+	total, failed := 0, 0
+	for _, script := range scripts {
+		n, mismatches, err := runCompatScript(script, ref, target)
+		if err != nil {
+			log.Fatalf("compat: %s: %v", script, err)
+		}
+		total += n
+		failed += mismatches
+	}
+	fmt.Printf("%d commands in %d scripts, %d mismatches\n", total, len(scripts), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runCompatScript 运行一个脚本，返回执行的命令数和不一致的回复数。连接失败等无法继续比较的情况返回错误
+func runCompatScript(path string, ref, target *respClient) (commands, mismatches int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		unordered := strings.HasPrefix(line, "~")
+		args, err := resp.SplitInlineArgs([]byte(strings.TrimPrefix(line, "~")))
+		if err != nil || len(args) == 0 {
+			return commands, mismatches, fmt.Errorf("line %d: bad command: %s", lineNo, line)
+		}
+		commands++
+		want, err := compatReply(ref, args, unordered)
+		if err != nil {
+			return commands, mismatches, fmt.Errorf("line %d: reference server: %v", lineNo, err)
+		}
+		got, err := compatReply(target, args, unordered)
+		if err != nil {
+			return commands, mismatches, fmt.Errorf("line %d: target server: %v", lineNo, err)
+		}
+		if want != got {
+			mismatches++
+			fmt.Printf("%s:%d: %s\n  redis:      %s\n  redis-easy: %s\n",
+				path, lineNo, line, strconv.Quote(want), strconv.Quote(got))
+		}
+	}
+	return commands, mismatches, scanner.Err()
+}
+
+// compatReply 执行一条命令并把回复重新编码为 RESP，用于逐字节比较。只有网络错误返回 error，错误回复作为回复的一部分
+func compatReply(c *respClient, args []string, unordered bool) (string, error) {
+	v, err := c.do(args...)
+	if e, ok := err.(resp.Error); ok {
+		return "-" + string(e) + "\r\n", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if arr, ok := v.([]interface{}); ok && unordered {
+		items := make([]string, len(arr))
+		for i, item := range arr {
+			items[i] = encodeCompatValue(item)
+		}
+		sort.Strings(items)
+		return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, ""), nil
+	}
+	return encodeCompatValue(v), nil
+}
+
+// encodeCompatValue 把 resp.ReadValue 读出的值编码回 RESP
+func encodeCompatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "$-1\r\n"
+	case resp.Status:
+		return "+" + string(v) + "\r\n"
+	case resp.Error:
+		return "-" + string(v) + "\r\n"
+	case int64:
+		return ":" + strconv.FormatInt(v, 10) + "\r\n"
+	case string:
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case []interface{}:
+		var b strings.Builder
+		b.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			b.WriteString(encodeCompatValue(item))
+		}
+		return b.String()
+	}
+	return fmt.Sprintf("?%v\r\n", v)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// 守护进程模式，用于传统的 init 脚本部署：
+//
+//	daemonize yes   在后台重新启动本进程（脱离终端，新的会话，标准输入输出指向 /dev/null），
+//	                前台进程等后台进程开始接受连接并写好 pidfile 之后退出，退出码 0 表示启动成功
+//	pidfile path    开始接受连接后把进程号写入 path，正常退出时删除
+//
+// Go 程序不能在运行时安全地 fork，因此不是传统的两次 fork，而是以相同的命令行参数重新执行可执行文件。
+// 后台进程没有配置 logfile（或 syslog）时日志被丢弃，启动失败的原因也看不到，守护进程模式下应当配置 logfile。
+// 由 systemd 等进程管理器启动时不需要守护进程模式，使用 daemonize no 和 Type=simple 即可；
+// 一定要用 daemonize yes 时对应 Type=forking 和 PIDFile=。
+// SIGUSR2 不停机升级时新进程继承后台进程的环境，不会再次转入后台，它启动后把自己的进程号写入 pidfile
+
+const (
+	// envDaemonized 表示本进程已经是后台进程
+	envDaemonized = "REDIS_EASY_DAEMONIZED"
+	// envDaemonReadyFD 是后台进程启动完成后写入一个字节通知前台进程的管道 fd
+	envDaemonReadyFD = "REDIS_EASY_DAEMON_READY_FD"
+)
+
+// writePidFile 把本进程的进程号写入 path
+func writePidFile(path string) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// removePidFile 删除 path，其中已经是其他进程的进程号（例如升级后的新进程）时保留
+func removePidFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || string(bytes.TrimSpace(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	os.Remove(path)
+}
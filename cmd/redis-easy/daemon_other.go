@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// daemonize 在不支持新建会话的平台上返回错误，请使用平台的服务管理器在后台运行
+func daemonize() (ready func(), err error) {
+	return nil, errors.New("daemonize is not supported on this platform")
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// daemonize 在前台进程中启动后台进程，等它启动完成后以退出码 0 退出，启动失败时返回错误；
+// 在后台进程中返回启动完成后调用的 ready
+func daemonize() (ready func(), err error) {
+	if os.Getenv(envDaemonized) != "" {
+		ready = func() {}
+		if fd, err := strconv.Atoi(os.Getenv(envDaemonReadyFD)); err == nil && fd >= 3 {
+			// 清除环境变量，SIGUSR2 升级启动的新进程不会误用这个 fd
+			os.Unsetenv(envDaemonReadyFD)
+			f := os.NewFile(uintptr(fd), "daemon ready pipe")
+			ready = func() {
+				f.Write([]byte{1})
+				f.Close()
+			}
+		}
+		return ready, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer null.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = null, null, null
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), envDaemonized+"=1", envDaemonReadyFD+"=3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+		return nil, errors.New("background process exited before it was ready, see logfile for details")
+	}
+	os.Exit(0)
+	return nil, nil
+}
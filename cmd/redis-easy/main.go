@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/logfile"
+	"github.com/LikiosSedo/redis_easy/server"
+)
+
+func main() {
+	// 根据命令行参数选择不同的运行模式
+	if len(os.Args) > 1 {
+		if os.Args[1] == "--version" || os.Args[1] == "-v" {
+			fmt.Println(server.VersionString())
+			return
+		}
+		if os.Args[1] == "stress" {
+			runAdvancedStressTest(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "leaderboard" {
+			runLeaderboardTest()
+			return
+		}
+		if os.Args[1] == "bench" {
+			runBenchmark(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "migrate" {
+			runMigrate(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "inspect" {
+			runInspect(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "dump" {
+			runDump(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "load" {
+			runLoad(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "replay" {
+			runReplay(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "compat" {
+			runCompat(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "clients" {
+			runClients(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "cli" {
+			runCLI(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "ping" {
+			runPing(os.Args[2:])
+			return
+		}
+		if os.Args[1] == "service" {
+			runService(os.Args[2:])
+			return
+		}
+	}
+
+	// 收到 SIGINT / SIGTERM 时关闭所有连接并保存快照后退出
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	runServer(ctx, os.Args[1:], nil)
+}
+
+// runServer 按 args（可选的配置文件路径，以及覆盖配置文件的 --name value 参数）加载配置并运行服务端，
+// ctx 被取消时停止实例并返回。started 不为 nil 时在开始接受连接后调用
+func runServer(ctx context.Context, args []string, started func()) {
+	if err := config.Load(args); err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+
+	// daemonize yes 时转入后台运行，前台进程等后台进程启动完成后退出
+	daemonReady := func() {}
+	if config.Get().Daemonize == "yes" {
+		ready, err := daemonize()
+		if err != nil {
+			log.Fatal("Error daemonizing: ", err)
+		}
+		daemonReady = ready
+	}
+
+	// 运行日志按 logfile 的配置写入文件并轮转，没有配置时仍然写到标准错误
+	logWriter := &logfile.Writer{}
+	log.SetOutput(logWriter)
+	defer logWriter.Close()
+	log.Println("Starting", server.VersionString())
+
+	// 载入 loadmodule 指定的扩展模块，模块注册的自定义命令需要在开始服务之前就位
+	if err := server.LoadModules(strings.Fields(config.Get().LoadModule)); err != nil {
+		log.Fatal("Error loading modules: ", err)
+	}
+
+	// 载入上次保存的快照并在配置的端口（默认 6379）上开始接受连接
+	srv := server.New(server.Options{Persistence: true})
+	if err := srv.Start(ctx); err != nil {
+		log.Fatal("Error starting server: ", err)
+	}
+
+	if pidfile := config.Get().PidFile; pidfile != "" {
+		if err := writePidFile(pidfile); err != nil {
+			log.Println("Error writing pidfile:", err)
+		}
+		defer removePidFile(pidfile)
+	}
+	daemonReady()
+	sdReady()
+	if started != nil {
+		started()
+	}
+	startSdWatchdog(srv, ctx.Done())
+
+	httpServers := startHTTPServers(srv)
+
+	// 收到 SIGUSR2 时以磁盘上的可执行文件启动新进程，把监听 socket 和数据集交给它之后退出；
+	// 收到 SIGHUP 时重新载入配置文件并重新打开日志文件（配合 logrotate 等外部工具）
+	upgrade, reload := notifyUpgrade(), notifyReload()
+	for {
+		select {
+		case <-reload:
+			logWriter.Reopen()
+			log.Println("Received SIGHUP, reloading config file")
+			srv.ReloadConfig()
+		case <-ctx.Done():
+			sdNotify("STOPPING=1")
+			if err := srv.Stop(); err != nil {
+				log.Fatal("Error saving snapshot on shutdown: ", err)
+			}
+			return
+		case <-upgrade:
+			log.Println("Received SIGUSR2, upgrading")
+			closed := false
+			err := srv.Upgrade(func() {
+				// 新进程启动完成后要绑定同样的 HTTP 端口
+				shutdownHTTPServers(httpServers)
+				closed = true
+			})
+			if err == nil {
+				srv.Stop()
+				return
+			}
+			log.Println("Upgrade failed:", err)
+			if closed {
+				httpServers = startHTTPServers(srv)
+			}
+		}
+	}
+}
+
+// startHTTPServers 启动 pprof 服务（监听 :6060）和排行榜快照 HTTP 服务（监听 :8080）。
+// HTTPHandler 使用独立的 mux，pprof 注册在默认 mux 上的调试接口不会暴露在 :8080
+func startHTTPServers(srv *server.Server) []*http.Server {
+	pprof := &http.Server{Addr: "localhost:6060"}
+	snapshot := &http.Server{Addr: ":8080", Handler: srv.HTTPHandler()}
+	go func() {
+		log.Println("pprof server listening on :6060")
+		log.Println(pprof.ListenAndServe())
+	}()
+	go func() {
+		log.Println("Snapshot server listening on :8080")
+		if err := snapshot.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return []*http.Server{pprof, snapshot}
+}
+
+// shutdownHTTPServers 关闭 HTTP 服务，最多等待 5 秒让进行中的请求完成
+func shutdownHTTPServers(servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		s.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/server"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// runMigrate 实现 migrate 模式：redis-easy migrate --from host:port [选项] [-- [配置文件] [--name value ...]]。
+// 用 SCAN 遍历源 Redis 的键，按类型读出字符串、列表、集合和哈希（连同剩余的过期时间）写入本地数据集，
+// 最后保存为 dir/dbfilename 快照，之后正常启动 redis-easy 即可载入。其他类型（有序集合、流等）会被跳过并计数。
+//
+// 每处理完 --checkpoint 个键保存一次快照，并把 SCAN 游标写入 --cursor-file；中断后用同样的参数重新运行，
+// 会载入已保存的快照并从游标处继续。SCAN 保证迁移期间一直存在的键至少被遍历一次，迁移期间被修改的键以读到时的内容为准
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "source Redis address, host:port")
+	password := fs.String("a", "", "password for AUTH on the source")
+	match := fs.String("match", "*", "only migrate keys matching this glob pattern")
+	count := fs.Int("count", 1000, "COUNT hint for each SCAN call")
+	checkpoint := fs.Int("checkpoint", 100000, "save the snapshot and the cursor after this many keys")
+	cursorFile := fs.String("cursor-file", "migrate.cursor", "file storing the SCAN cursor for resuming")
+	fs.Parse(args)
+	if *from == "" {
+		log.Fatal("migrate: --from host:port is required")
+	}
+	// -- 之后的参数与启动服务端时相同，用于指定快照保存的位置
+	if err := config.Load(fs.Args()); err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+
+	srv := server.New(server.Options{})
+	cursor := "0"
+	if data, err := os.ReadFile(*cursorFile); err == nil {
+		cursor = strings.TrimSpace(string(data))
+		if err := srv.LoadSnapshot(); err != nil {
+			log.Fatal("Error loading snapshot: ", err)
+		}
+		log.Printf("Resuming migration from cursor %s\n", cursor)
+	}
+
+	src := &respClient{addr: *from}
+	defer src.close()
+	if *password != "" {
+		if _, err := src.do("AUTH", *password); err != nil {
+			log.Fatal("migrate: AUTH failed: ", err)
+		}
+	}
+
+	m := &migration{src: src, dst: srv.Store(), skipped: make(map[string]int)}
+	start := time.Now()
+	sinceCheckpoint := 0
+	for {
+		v, err := src.do("SCAN", cursor, "MATCH", *match, "COUNT", strconv.Itoa(*count))
+		if err != nil {
+			log.Fatal("migrate: SCAN failed: ", err)
+		}
+		reply, ok := v.([]interface{})
+		if !ok || len(reply) != 2 {
+			log.Fatal("migrate: unexpected SCAN reply")
+		}
+		next, _ := reply[0].(string)
+		keys, _ := reply[1].([]interface{})
+		for _, k := range keys {
+			key, _ := k.(string)
+			if err := m.migrateKey(key); err != nil {
+				log.Fatalf("migrate: key %q: %v", key, err)
+			}
+		}
+		sinceCheckpoint += len(keys)
+		cursor = next
+		log.Printf("Migrated %d keys (%d skipped), cursor %s, %v elapsed\n", m.migrated, m.skippedTotal(), cursor, time.Since(start).Round(time.Second))
+		if cursor == "0" {
+			break
+		}
+		if sinceCheckpoint >= *checkpoint {
+			if err := saveMigrationCheckpoint(srv, *cursorFile, cursor); err != nil {
+				log.Fatal("migrate: ", err)
+			}
+			sinceCheckpoint = 0
+		}
+	}
+	if err := srv.SaveSnapshot(); err != nil {
+		log.Fatal("migrate: ", err)
+	}
+	os.Remove(*cursorFile)
+	log.Printf("Migration completed: %d keys in %v\n", m.migrated, time.Since(start))
+	for t, n := range m.skipped {
+		log.Printf("Skipped %d keys of unsupported type %s\n", n, t)
+	}
+}
+
+// saveMigrationCheckpoint 先保存快照再写游标，保证游标之前遍历到的键都已经在快照里
+func saveMigrationCheckpoint(srv *server.Server, cursorFile, cursor string) error {
+	if err := srv.SaveSnapshot(); err != nil {
+		return err
+	}
+	return os.WriteFile(cursorFile, []byte(cursor+"\n"), 0644)
+}
+
+// migration 是一次迁移的状态
+type migration struct {
+	src      *respClient
+	dst      *store.Store
+	migrated int
+	skipped  map[string]int // 按类型统计跳过的键
+}
+
+func (m *migration) skippedTotal() int {
+	n := 0
+	for _, c := range m.skipped {
+		n += c
+	}
+	return n
+}
+
+// migrateKey 读出一个键的值和剩余过期时间并写入本地。读取期间键被删除或已经过期时直接跳过
+func (m *migration) migrateKey(key string) error {
+	v, err := m.src.do("TYPE", key)
+	if err != nil {
+		return err
+	}
+	typ, _ := v.(resp.Status)
+	var read []string
+	switch typ {
+	case "none":
+		return nil
+	case "string":
+		read = []string{"GET", key}
+	case "list":
+		read = []string{"LRANGE", key, "0", "-1"}
+	case "set":
+		read = []string{"SMEMBERS", key}
+	case "hash":
+		read = []string{"HGETALL", key}
+	default:
+		m.skipped[string(typ)]++
+		return nil
+	}
+	if v, err = m.src.do(read...); err != nil {
+		return err
+	}
+	ttlReply, err := m.src.do("PTTL", key)
+	if err != nil {
+		return err
+	}
+	pttl, _ := ttlReply.(int64)
+	if pttl == -2 || v == nil {
+		return nil
+	}
+
+	m.dst.Del(key)
+	switch typ {
+	case "string":
+		s, _ := v.(string)
+		m.dst.Set(key, s, 0)
+	case "list", "set", "hash":
+		items, err := migrationStrings(v)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		switch typ {
+		case "list":
+			_, err = m.dst.RPush(key, items...)
+		case "set":
+			_, err = m.dst.SAdd(key, items...)
+		case "hash":
+			for i := 0; i+1 < len(items) && err == nil; i += 2 {
+				_, err = m.dst.HSet(key, items[i], items[i+1])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if pttl > 0 {
+		m.dst.Expire(key, time.Duration(pttl)*time.Millisecond)
+	}
+	m.migrated++
+	return nil
+}
+
+// migrationStrings 把数组回复转换为字符串切片
+func migrationStrings(v interface{}) ([]string, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected reply type")
+	}
+	items := make([]string, len(arr))
+	for i, item := range arr {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected element %v", item)
+		}
+		items[i] = s
+	}
+	return items, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// runPing 实现 ping 模式：redis-easy ping [-addr host:port] [-timeout d] [-ready]，用作 Docker HEALTHCHECK
+// 或 Kubernetes exec 探针，镜像中不需要 redis-cli。在 timeout 内收到 PONG 时以状态码 0 退出，否则输出原因并以 1 退出。
+// 载入快照期间 PING 也会返回 PONG（存活探针）；-ready 另外要求快照已经载入完、实例没有暂停接受新连接（就绪探针）
+func runPing(args []string) {
+	fs := flag.NewFlagSet("ping", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:6379", "server address")
+	timeout := fs.Duration("timeout", 2*time.Second, "maximum time for the whole check")
+	ready := fs.Bool("ready", false, "also require the dataset to be loaded and the server to accept connections")
+	fs.Parse(args)
+
+	if err := pingServer(*addr, *timeout, *ready); err != nil {
+		fmt.Fprintln(os.Stderr, "unhealthy:", err)
+		os.Exit(1)
+	}
+}
+
+// pingServer 连接 addr 发送 PING，ready 为 true 时再用 INFO 检查载入和接受连接的状态
+func pingServer(addr string, timeout time.Duration, ready bool) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+	do := func(args ...string) (interface{}, error) {
+		if _, err := conn.Write(resp.EncodeCommand(args)); err != nil {
+			return nil, err
+		}
+		return resp.ReadValue(r)
+	}
+
+	v, err := do("PING")
+	if err != nil {
+		return err
+	}
+	if v != resp.Status("PONG") {
+		return fmt.Errorf("unexpected reply to PING: %v", v)
+	}
+	if !ready {
+		return nil
+	}
+	v, err = do("INFO", "persistence", "clients")
+	if err != nil {
+		return err
+	}
+	info, _ := v.(string)
+	for _, line := range strings.Split(info, "\r\n") {
+		switch line {
+		case "loading:1":
+			return fmt.Errorf("loading the dataset")
+		case "accepting_connections:0":
+			return fmt.Errorf("not accepting connections (draining)")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// replayCommand 是抓包文件中的一条命令。at 是相对第一条命令的时间，AOF 没有时间信息，始终为 0
+type replayCommand struct {
+	at     time.Duration
+	client string
+	args   []string
+}
+
+// replayDefaultSkip 是默认不回放的命令：SELECT、MULTI、EXEC 在 redis-easy 中不存在，
+// MONITOR、QUIT、SHUTDOWN 会改变回放连接或目标实例本身的状态
+const replayDefaultSkip = "SELECT,MULTI,EXEC,MONITOR,QUIT,SHUTDOWN"
+
+// runReplay 实现 replay 模式：redis-easy replay [选项] <file>。
+// file 是 redis-cli MONITOR 的输出，或者 Redis 的 AOF 文件（以 '*' 开头时按 AOF 解析）。
+// MONITOR 格式按原始的时间间隔回放，-speed 指定加速倍数，0 表示不等待、尽快发送；
+// 同一个源客户端的命令按顺序在同一条连接上发送，不同的源客户端按地址分散到 -c 条连接上。
+// AOF 没有时间和客户端信息，在一条连接上尽快回放。结束时输出吞吐量、延迟、落后于原始时间的程度和错误回复
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	host := fs.String("h", "127.0.0.1", "target hostname")
+	port := fs.Int("p", 6379, "target port")
+	conns := fs.Int("c", 16, "number of connections, source clients are spread over them")
+	speed := fs.Float64("speed", 1, "replay speed multiplier, 0 means as fast as possible")
+	skip := fs.String("skip", replayDefaultSkip, "comma separated list of commands not to replay")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: redis-easy replay [-h host] [-p port] [-c conns] [-speed x] [-skip cmds] <file>")
+		os.Exit(2)
+	}
+	if *conns < 1 || *speed < 0 {
+		log.Fatal("replay: -c must be positive and -speed must not be negative")
+	}
+	skipped := make(map[string]bool)
+	for _, name := range strings.Split(*skip, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			skipped[strings.ToUpper(name)] = true
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal("replay: ", err)
+	}
+	defer f.Close()
+	src := &replaySource{r: bufio.NewReaderSize(f, 64*1024)}
+	if prefix, err := src.r.Peek(1); err == nil && prefix[0] == '*' {
+		src.aof = true
+	}
+
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	workers := make([]*replayWorker, *conns)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range workers {
+		w := &replayWorker{
+			client: &respClient{addr: addr},
+			queue:  make(chan replayCommand, 1024),
+			errors: make(map[string]int64),
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(start, *speed)
+		}()
+	}
+
+	var total, skippedCount, badLines int
+	for {
+		cmd, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		// MONITOR 输出中夹杂的 OK 等无法解析的行直接跳过，AOF 损坏则无法继续
+		if err == errMonitorLine {
+			badLines++
+			continue
+		}
+		if err != nil {
+			log.Fatal("replay: ", err)
+		}
+		if len(cmd.args) == 0 {
+			continue
+		}
+		if skipped[strings.ToUpper(cmd.args[0])] {
+			skippedCount++
+			continue
+		}
+		total++
+		h := fnv.New32a()
+		h.Write([]byte(cmd.client))
+		workers[h.Sum32()%uint32(len(workers))].queue <- cmd
+	}
+	for _, w := range workers {
+		close(w.queue)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	all := &latencyRecorder{}
+	errorCounts := make(map[string]int64)
+	var lag time.Duration
+	for _, w := range workers {
+		all.samples = append(all.samples, w.latency.samples...)
+		for kind, n := range w.errors {
+			errorCounts[kind] += n
+		}
+		lag = max(lag, w.maxLag)
+	}
+	done := len(all.samples)
+	fmt.Printf("Replayed %d of %d commands in %.2f seconds (%d skipped, %d unparsable lines)\n",
+		done, total, elapsed.Seconds(), skippedCount, badLines)
+	if done > 0 {
+		s := all.summary()
+		fmt.Printf("  throughput: %.2f commands per second\n", float64(done)/elapsed.Seconds())
+		fmt.Printf("  latency (msec): avg %.3f, p50 %.3f, p95 %.3f, p99 %.3f, max %.3f\n",
+			msec(s.avg), msec(s.p50), msec(s.p95), msec(s.p99), msec(s.max))
+	}
+	if *speed > 0 && !src.aof {
+		fmt.Printf("  max lag behind the original timing: %.3f ms\n", msec(lag))
+	}
+	kinds := make([]string, 0, len(errorCounts))
+	for kind := range errorCounts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("  %s: %d\n", kind, errorCounts[kind])
+	}
+}
+
+// replayWorker 在一条连接上按顺序回放分配给它的命令
+type replayWorker struct {
+	client  *respClient
+	queue   chan replayCommand
+	latency latencyRecorder
+	errors  map[string]int64 // 按类别统计：网络错误以及按前缀区分的错误回复
+	maxLag  time.Duration    // 实际发送时间落后于预定时间的最大值
+}
+
+func (w *replayWorker) run(start time.Time, speed float64) {
+	defer w.client.close()
+	for cmd := range w.queue {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(cmd.at) / speed))
+			if d := time.Until(due); d > 0 {
+				time.Sleep(d)
+			} else {
+				w.maxLag = max(w.maxLag, -d)
+			}
+		}
+		sent := time.Now()
+		_, err := w.client.do(cmd.args...)
+		if e, ok := err.(resp.Error); ok {
+			prefix, _, _ := strings.Cut(string(e), " ")
+			w.errors["reply "+prefix]++
+		} else if err != nil {
+			w.errors["network error"]++
+			continue
+		}
+		w.latency.add(time.Since(sent))
+	}
+}
+
+// errMonitorLine 表示一行不是 MONITOR 输出的命令
+var errMonitorLine = errors.New("not a MONITOR line")
+
+// replaySource 从抓包文件中逐条读取命令
+type replaySource struct {
+	r   *bufio.Reader
+	aof bool
+	// start 是第一条 MONITOR 命令的时间戳（秒），之后命令的时间都相对于它
+	start   float64
+	started bool
+}
+
+func (s *replaySource) next() (replayCommand, error) {
+	if s.aof {
+		return s.readAOFCommand()
+	}
+	return s.readMonitorCommand()
+}
+
+// readMonitorCommand 解析一行 MONITOR 输出，格式为
+//
+//	1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value"
+//
+// 参数的引号和转义与 inline 命令相同，按 resp.SplitInlineArgs 解析
+func (s *replaySource) readMonitorCommand() (replayCommand, error) {
+	line, err := s.r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return replayCommand{}, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	ts, rest, ok := bytes.Cut(line, []byte(" ["))
+	if !ok {
+		return replayCommand{}, errMonitorLine
+	}
+	source, rest, ok := bytes.Cut(rest, []byte("] "))
+	if !ok {
+		return replayCommand{}, errMonitorLine
+	}
+	sec, err := strconv.ParseFloat(string(ts), 64)
+	if err != nil {
+		return replayCommand{}, errMonitorLine
+	}
+	args, err := resp.SplitInlineArgs(rest)
+	if err != nil {
+		return replayCommand{}, errMonitorLine
+	}
+	if !s.started {
+		s.start, s.started = sec, true
+	}
+	// source 是 "<db> <客户端地址>"，按客户端地址区分源客户端
+	_, client, _ := bytes.Cut(source, []byte(" "))
+	return replayCommand{
+		at:     time.Duration((sec - s.start) * float64(time.Second)),
+		client: string(client),
+		args:   args,
+	}, nil
+}
+
+// readAOFCommand 读取 AOF 中的一条命令，AOF 与客户端发送的请求格式相同
+func (s *replaySource) readAOFCommand() (replayCommand, error) {
+	args, err := resp.ReadCommand(s.r, resp.Limits{MaxMultibulkLen: 1024 * 1024, MaxBulkLen: 512 * 1024 * 1024})
+	if err == io.ErrUnexpectedEOF {
+		// Redis 载入 AOF 时同样容忍末尾被截断的命令
+		return replayCommand{}, io.EOF
+	}
+	return replayCommand{args: args}, err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/server"
+)
+
+// systemd 的就绪通知和看门狗（sd_notify 协议），用于 Type=notify 的服务：
+//
+//   - 开始接受连接、快照载入完毕、pidfile 写好之后发送 READY=1，systemd 此时才认为服务已经启动，
+//     依赖它的服务不会在载入快照期间收到 -LOADING
+//   - 设置了 WatchdogSec= 时每隔一半的间隔检查一次实例能否执行命令（见 Server.Responsive），正常时发送 WATCHDOG=1；
+//     实例卡死时不再发送，systemd 到期后杀掉并按 Restart= 重启
+//   - 收到 SIGINT / SIGTERM 开始停止时发送 STOPPING=1
+//
+// SIGUSR2 不停机升级时新进程的 READY=1 带有 MAINPID=，systemd 据此改为跟踪新进程，这需要在 unit 中设置 NotifyAccess=all。
+// 没有设置 NOTIFY_SOCKET 时（不是由 systemd 以 Type=notify 启动）以下函数什么都不做
+
+// sdNotify 向 systemd 发送状态，多个状态用换行分隔
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// 以 @ 开头的是 Linux 的抽象 socket
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Println("Error notifying systemd:", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Println("Error notifying systemd:", err)
+	}
+}
+
+// sdReady 通知 systemd 服务已经启动
+func sdReady() {
+	sdNotify("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid()) + "\nSTATUS=Ready to accept connections")
+}
+
+// startSdWatchdog 在 systemd 开启了看门狗时启动发送 WATCHDOG=1 的 goroutine，stop 关闭时退出
+func startSdWatchdog(srv *server.Server, stop <-chan struct{}) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	// WATCHDOG_PID 是看门狗监视的进程，不是本进程时不发送。SIGUSR2 升级启动的新进程继承的是旧进程（父进程）的进程号，
+	// 新进程发送 MAINPID= 之后 systemd 改为监视新进程
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) && pid != strconv.Itoa(os.Getppid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if srv.Responsive(interval) {
+					sdNotify("WATCHDOG=1")
+				} else {
+					log.Println("Server is not responsive, skipping systemd watchdog ping")
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
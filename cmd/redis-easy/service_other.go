@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runService 在 Windows 以外的平台上不可用，请使用 systemd（见 sdnotify.go）或者 daemonize（见 daemon.go）
+func runService(args []string) {
+	fmt.Fprintln(os.Stderr, "service mode is only available on Windows, use systemd or daemonize instead")
+	os.Exit(2)
+}
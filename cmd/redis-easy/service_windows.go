@@ -0,0 +1,271 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// Windows 服务模式，由服务控制管理器（SCM）启动和停止服务端：
+//
+//	redis-easy service install [-name redis-easy] [-- [config-file] [--name value ...]]   安装为自动启动的服务
+//	redis-easy service uninstall [-name redis-easy]                                        停止并删除服务
+//	redis-easy service run [-name redis-easy] [-dir path] [-- ...]                          由 SCM 执行，不需要手动运行
+//
+// install 把当前目录和 -- 之后的参数写进服务的命令行，服务启动时先切换到该目录，dir、logfile 等相对路径与手动运行时相同。
+// 服务没有控制台，应当配置 logfile。SCM 发送停止（包括系统关机）时按 shutdown-drain-timeout 排空连接、保存快照后
+// 报告已停止。安装后用 sc start redis-easy 或服务管理器启动
+
+// SCM 接口中用到的常量，见 winsvc.h
+const (
+	scManagerAllAccess = 0xF003F
+	serviceAllAccess   = 0xF01FF
+
+	serviceWin32OwnProcess = 0x10
+	serviceAutoStart       = 0x2
+	serviceErrorNormal     = 0x1
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	errorServiceDoesNotExist = syscall.Errno(1060)
+	errorServiceNotActive    = syscall.Errno(1062)
+)
+
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procOpenSCManagerW                = advapi32.NewProc("OpenSCManagerW")
+	procCreateServiceW                = advapi32.NewProc("CreateServiceW")
+	procOpenServiceW                  = advapi32.NewProc("OpenServiceW")
+	procDeleteService                 = advapi32.NewProc("DeleteService")
+	procControlService                = advapi32.NewProc("ControlService")
+	procCloseServiceHandle            = advapi32.NewProc("CloseServiceHandle")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+)
+
+// serviceStatus 对应 SERVICE_STATUS
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// serviceTableEntry 对应 SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// runService 实现 service 模式，见文件开头的说明
+func runService(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: redis-easy service install|uninstall|run [-name name] [-- [config-file] [--name value ...]]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("service "+args[0], flag.ExitOnError)
+	name := fs.String("name", "redis-easy", "service name")
+	dir := fs.String("dir", "", "working directory of the service")
+	fs.Parse(args[1:])
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(*name, fs.Args())
+	case "uninstall":
+		err = uninstallService(*name)
+	case "run":
+		if *dir != "" {
+			if err := os.Chdir(*dir); err != nil {
+				log.Fatal("Error changing directory: ", err)
+			}
+		}
+		err = runAsService(*name, fs.Args())
+	default:
+		fmt.Fprintf(os.Stderr, "unknown service command '%s'\n", args[0])
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("service %s: %v", args[0], err)
+	}
+}
+
+// openSCManager 连接本机的 SCM
+func openSCManager() (syscall.Handle, error) {
+	h, _, err := procOpenSCManagerW.Call(0, 0, scManagerAllAccess)
+	if h == 0 {
+		return 0, err
+	}
+	return syscall.Handle(h), nil
+}
+
+// installService 把本程序安装为名为 name 的服务，服务启动时以 serverArgs 运行服务端
+func installService(name string, serverArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cmdline := []string{exe, "service", "run", "-name", name, "-dir", cwd, "--"}
+	cmdline = append(cmdline, serverArgs...)
+	for i, arg := range cmdline {
+		cmdline[i] = syscall.EscapeArg(arg)
+	}
+	m, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(uintptr(m))
+	namep, cmdlinep := syscall.StringToUTF16Ptr(name), syscall.StringToUTF16Ptr(strings.Join(cmdline, " "))
+	s, _, err := procCreateServiceW.Call(uintptr(m), uintptr(unsafe.Pointer(namep)), uintptr(unsafe.Pointer(namep)), serviceAllAccess,
+		serviceWin32OwnProcess, serviceAutoStart, serviceErrorNormal, uintptr(unsafe.Pointer(cmdlinep)), 0, 0, 0, 0, 0)
+	if s == 0 {
+		return err
+	}
+	procCloseServiceHandle.Call(s)
+	fmt.Printf("Service %s installed, working directory %s\n", name, filepath.Clean(cwd))
+	return nil
+}
+
+// uninstallService 停止并删除名为 name 的服务
+func uninstallService(name string) error {
+	m, err := openSCManager()
+	if err != nil {
+		return err
+	}
+	defer procCloseServiceHandle.Call(uintptr(m))
+	s, _, err := procOpenServiceW.Call(uintptr(m), uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(name))), serviceAllAccess)
+	if s == 0 {
+		if err == errorServiceDoesNotExist {
+			return fmt.Errorf("service %s is not installed", name)
+		}
+		return err
+	}
+	defer procCloseServiceHandle.Call(s)
+	var status serviceStatus
+	if r, _, err := procControlService.Call(s, serviceControlStop, uintptr(unsafe.Pointer(&status))); r == 0 && err != errorServiceNotActive {
+		return fmt.Errorf("stopping service: %v", err)
+	}
+	if r, _, err := procDeleteService.Call(s); r == 0 {
+		return err
+	}
+	fmt.Printf("Service %s uninstalled\n", name)
+	return nil
+}
+
+// windowsService 是 SCM 启动的服务。SCM 在自己的线程上回调 serviceMain 和 handler
+type windowsService struct {
+	name   string
+	args   []string
+	handle uintptr
+
+	mu     sync.Mutex
+	status serviceStatus
+	cancel context.CancelFunc
+}
+
+// theService 是本进程中运行的服务，供回调使用
+var theService *windowsService
+
+// runAsService 把本进程交给 SCM，直到服务停止后返回。不是由 SCM 启动时返回错误
+func runAsService(name string, serverArgs []string) error {
+	theService = &windowsService{name: name, args: serverArgs}
+	table := []serviceTableEntry{
+		{name: syscall.StringToUTF16Ptr(name), proc: syscall.NewCallback(serviceMain)},
+		{},
+	}
+	if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		return fmt.Errorf("%v (service run must be started by the service control manager)", err)
+	}
+	return nil
+}
+
+// serviceMain 是服务的入口（ServiceMain），运行服务端直到收到停止请求
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	svc := theService
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(svc.name))),
+		syscall.NewCallback(serviceHandler), 0)
+	if h == 0 {
+		log.Println("Error registering service control handler:", err)
+		return 0
+	}
+	svc.handle = h
+	ctx, cancel := context.WithCancel(context.Background())
+	svc.mu.Lock()
+	svc.cancel = cancel
+	svc.mu.Unlock()
+	svc.setStatus(serviceStartPending, 0, 30*time.Second)
+	runServer(ctx, svc.args, func() {
+		svc.setStatus(serviceRunning, serviceAcceptStop|serviceAcceptShutdown, 0)
+	})
+	svc.setStatus(serviceStopped, 0, 0)
+	return 0
+}
+
+// serviceHandler 处理 SCM 发来的控制请求（HandlerEx）
+func serviceHandler(control, eventType uint32, eventData, handlerContext uintptr) uintptr {
+	svc := theService
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		// 排空连接和保存快照可能需要一段时间，告诉 SCM 不要过早认为服务没有响应
+		wait := time.Duration(config.Get().ShutdownDrainTimeout)*time.Millisecond + 30*time.Second
+		svc.setStatus(serviceStopPending, 0, wait)
+		svc.mu.Lock()
+		svc.cancel()
+		svc.mu.Unlock()
+	case serviceControlInterrogate:
+		svc.setStatus(0, 0, 0)
+	}
+	return 0
+}
+
+// setStatus 向 SCM 报告服务状态，state 为 0 时重新报告当前状态
+func (svc *windowsService) setStatus(state, accepts uint32, waitHint time.Duration) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if state != 0 {
+		if state == svc.status.currentState {
+			svc.status.checkPoint++
+		} else {
+			svc.status.checkPoint = 0
+		}
+		svc.status = serviceStatus{
+			serviceType:      serviceWin32OwnProcess,
+			currentState:     state,
+			controlsAccepted: accepts,
+			checkPoint:       svc.status.checkPoint,
+			waitHint:         uint32(waitHint.Milliseconds()),
+		}
+	}
+	if r, _, err := procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status))); r == 0 {
+		log.Println("Error reporting service status:", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyUpgrade 在没有 SIGUSR2 的平台上返回 nil，不支持不停机升级
+func notifyUpgrade() <-chan os.Signal {
+	return nil
+}
+
+// notifyReload 在没有 SIGHUP 的平台上返回 nil，只能通过 CONFIG SET 修改配置
+func notifyReload() <-chan os.Signal {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyUpgrade 返回收到 SIGUSR2 时可读的 channel，收到后以磁盘上的可执行文件不停机升级
+func notifyUpgrade() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	return ch
+}
+
+// notifyReload 返回收到 SIGHUP 时可读的 channel，收到后重新载入配置文件
+func notifyReload() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	return ch
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand" // add this import
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// stressErrors 按类别统计压测中的错误：连接、写、读失败，以及按前缀（ERR、WRONGTYPE 等）区分的错误回复
+type stressErrors struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (e *stressErrors) add(kind string) {
+	e.mu.Lock()
+	e.counts[kind]++
+	e.mu.Unlock()
+}
+
+// stressResult 是一次压测的结果，可以追加写入 CSV 或 JSON Lines 文件，便于比较不同版本的表现
+type stressResult struct {
+	Time       string           `json:"time"`
+	Label      string           `json:"label"`
+	Workload   string           `json:"workload"`
+	Clients    int              `json:"clients"`
+	OpsPerConn int              `json:"ops_per_client"`
+	Seconds    float64          `json:"seconds"`
+	Total      int64            `json:"total"`
+	Success    int64            `json:"success"`
+	OpsPerSec  float64          `json:"ops_per_sec"`
+	P50Ms      float64          `json:"p50_ms"`
+	P95Ms      float64          `json:"p95_ms"`
+	P99Ms      float64          `json:"p99_ms"`
+	MaxMs      float64          `json:"max_ms"`
+	Errors     map[string]int64 `json:"errors"`
+}
+
+// runAdvancedStressTest 按流量模型模拟缓存服务场景下的高并发读写，默认模型中 80% 请求热点数据、20% 请求随机数据，
+// 其他模型见 stress_workload.go。
+// 记录每次操作的延迟，结束时输出分位数和错误分类；-o 指定时把结果追加到 CSV（.csv）或 JSON Lines（其他扩展名）文件
+func runAdvancedStressTest(args []string) {
+	fs := flag.NewFlagSet("stress", flag.ExitOnError)
+	output := fs.String("o", "", "append the results to this .csv or .json file")
+	label := fs.String("label", "", "label stored with the results, e.g. a git revision")
+	workload := fs.String("workload", "default", "built-in workload: "+strings.Join(stressWorkloadNames(), ", "))
+	workloadFile := fs.String("workload-file", "", "read the workload from a JSON file instead of -workload")
+	fs.Parse(args)
+	wl, err := loadStressWorkload(*workload, *workloadFile)
+	if err != nil {
+		log.Fatal("Error loading workload: ", err)
+	}
+
+	clientCount := wl.Clients
+	opsPerClient := wl.OpsPerClient
+	var wg sync.WaitGroup
+	var totalOps int64   // 总操作数计数器
+	var successOps int64 // 成功响应数计数器
+	errs := &stressErrors{counts: make(map[string]int64)}
+	recorders := make([]*latencyRecorder, clientCount)
+
+	start := time.Now()
+
+	for i := 0; i < clientCount; i++ {
+		rec := &latencyRecorder{}
+		recorders[i] = rec
+		wg.Add(1)
+		go func(clientID int) {
+			defer wg.Done()
+
+			// 初始建立连接，最多尝试 3 次
+			const maxInitialRetries = 3
+			var conn net.Conn
+			var err error
+			for r := 0; r < maxInitialRetries; r++ {
+				conn, err = net.Dial("tcp", "127.0.0.1:6379")
+				if err == nil {
+					break
+				}
+				errs.add("dial")
+				log.Printf("Client %d: initial dial attempt %d error: %v\n", clientID, r+1, err)
+				time.Sleep(50 * time.Millisecond)
+			}
+			if conn == nil {
+				log.Printf("Client %d: failed to establish initial connection after %d attempts\n", clientID, maxInitialRetries)
+				return
+			}
+			reader := bufio.NewReader(conn)
+			gen := newStressGenerator(&wl, time.Now().UnixNano()+int64(clientID))
+
+			for j := 0; j < opsPerClient; j++ {
+				cmd := gen.next()
+
+				const maxRetries = 3
+				var opErr error
+
+				// 每个操作最多尝试 maxRetries 次
+				for attempt := 0; attempt < maxRetries; attempt++ {
+					// 如果连接为 nil，则尝试重新建立连接
+					if conn == nil {
+						conn, err = net.Dial("tcp", "127.0.0.1:6379")
+						if err != nil {
+							errs.add("dial")
+							log.Printf("Client %d: re-dial error (attempt %d): %v\n", clientID, attempt+1, err)
+							time.Sleep(50 * time.Millisecond)
+							continue
+						}
+						reader = bufio.NewReader(conn)
+					}
+
+					// 发送命令
+					sent := time.Now()
+					_, err = conn.Write(cmd)
+					if err != nil {
+						errs.add("write")
+						log.Printf("Client %d: write error (attempt %d): %v\n", clientID, attempt+1, err)
+						opErr = err
+						conn.Close()
+						conn = nil
+						time.Sleep(50 * time.Millisecond)
+						continue
+					}
+
+					// 记录本次操作
+					atomic.AddInt64(&totalOps, 1)
+					// 读取完整的回复，错误回复按前缀分类
+					_, err = resp.ReadValue(reader)
+					if e, ok := err.(resp.Error); ok {
+						rec.add(time.Since(sent))
+						kind, _, _ := strings.Cut(string(e), " ")
+						errs.add("reply " + kind)
+						opErr = err
+						break
+					}
+					if err != nil {
+						errs.add("read")
+						log.Printf("Client %d: read error (attempt %d): %v\n", clientID, attempt+1, err)
+						opErr = err
+						conn.Close()
+						conn = nil
+						time.Sleep(50 * time.Millisecond)
+						continue
+					}
+					rec.add(time.Since(sent))
+					opErr = nil
+					break
+				}
+				if opErr == nil {
+					atomic.AddInt64(&successOps, 1)
+				}
+				// 中途暂停一下，模拟真实场景
+				if j == opsPerClient/2 {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+	duration := time.Since(start)
+	total := atomic.LoadInt64(&totalOps)
+	success := atomic.LoadInt64(&successOps)
+	successRatio := float64(success) / float64(total) * 100
+
+	all := &latencyRecorder{}
+	for _, rec := range recorders {
+		all.samples = append(all.samples, rec.samples...)
+	}
+	lat := all.summary()
+
+	log.Printf("Advanced stress test (workload %s) completed: %d clients * %d ops in %v\n", wl.Name, clientCount, opsPerClient, duration)
+	log.Printf("Total operations: %d, Successful responses: %d, Success ratio: %.2f%%\n", total, success, successRatio)
+	log.Printf("Latency (ms): p50 %.3f, p95 %.3f, p99 %.3f, max %.3f\n", msec(lat.p50), msec(lat.p95), msec(lat.p99), msec(lat.max))
+	kinds := make([]string, 0, len(errs.counts))
+	for kind := range errs.counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		log.Printf("Errors (%s): %d\n", kind, errs.counts[kind])
+	}
+
+	if *output != "" {
+		result := stressResult{
+			Time:       start.Format(time.RFC3339),
+			Label:      *label,
+			Workload:   wl.Name,
+			Clients:    clientCount,
+			OpsPerConn: opsPerClient,
+			Seconds:    duration.Seconds(),
+			Total:      total,
+			Success:    success,
+			OpsPerSec:  float64(total) / duration.Seconds(),
+			P50Ms:      msec(lat.p50),
+			P95Ms:      msec(lat.p95),
+			P99Ms:      msec(lat.p99),
+			MaxMs:      msec(lat.max),
+			Errors:     errs.counts,
+		}
+		if err := appendStressResult(*output, result); err != nil {
+			log.Fatal("Error writing results: ", err)
+		}
+		log.Println("Results appended to", *output)
+	}
+}
+
+// appendStressResult 把结果追加到文件：扩展名为 .csv 时追加一行（新文件先写表头），否则追加一行 JSON
+func appendStressResult(path string, r stressResult) error {
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return json.NewEncoder(f).Encode(r)
+	}
+	w := csv.NewWriter(f)
+	if os.IsNotExist(statErr) {
+		w.Write([]string{"time", "label", "workload", "clients", "ops_per_client", "seconds", "total", "success", "ops_per_sec",
+			"p50_ms", "p95_ms", "p99_ms", "max_ms", "errors"})
+	}
+	var errCount int64
+	for _, n := range r.Errors {
+		errCount += n
+	}
+	f64 := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	w.Write([]string{r.Time, r.Label, r.Workload, strconv.Itoa(r.Clients), strconv.Itoa(r.OpsPerConn), f64(r.Seconds),
+		strconv.FormatInt(r.Total, 10), strconv.FormatInt(r.Success, 10), f64(r.OpsPerSec),
+		f64(r.P50Ms), f64(r.P95Ms), f64(r.P99Ms), f64(r.MaxMs), strconv.FormatInt(errCount, 10)})
+	w.Flush()
+	return w.Error()
+}
+
+func runLeaderboardTest() {
+	const clientCount = 100
+	const opsPerClient = 10000
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	// Seed the random number generator
+	rand.Seed(time.Now().UnixNano())
+	for i := 0; i < clientCount; i++ {
+		wg.Add(1)
+		go func(clientID int) {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", "127.0.0.1:6379")
+			if err != nil {
+				log.Printf("Client %d: connection error: %v\n", clientID, err)
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for j := 0; j < opsPerClient; j++ {
+				player := fmt.Sprintf("player_%d", (clientID+j)%1000)
+				score := rand.Intn(10001)
+				cmd := fmt.Sprintf("*3\r\n$5\r\nLBADD\r\n$%d\r\n%s\r\n$%d\r\n%d\r\n",
+					len(player), player, len(strconv.Itoa(score)), score)
+				if _, err := conn.Write([]byte(cmd)); err != nil {
+					log.Printf("Client %d: write LBADD error: %v\n", clientID, err)
+					return
+				}
+				if _, err := reader.ReadString('\n'); err != nil {
+					log.Printf("Client %d: read LBADD error: %v\n", clientID, err)
+					return
+				}
+				if j%50 == 0 {
+					topN := 5
+					cmd = fmt.Sprintf("*2\r\n$5\r\nLBTOP\r\n$%d\r\n%d\r\n", len(strconv.Itoa(topN)), topN)
+					if _, err := conn.Write([]byte(cmd)); err != nil {
+						log.Printf("Client %d: write LBTOP error: %v\n", clientID, err)
+						return
+					}
+					if _, err := reader.ReadString('\n'); err != nil {
+						log.Printf("Client %d: read LBTOP error: %v\n", clientID, err)
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	duration := time.Since(start)
+	log.Printf("Leaderboard test completed: %d clients * %d ops in %v\n", clientCount, opsPerClient, duration)
+}
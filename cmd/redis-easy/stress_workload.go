@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// stressWorkload 描述压测的流量模型，可以用 -workload 选择内置模型，或者用 -workload-file 从 JSON 文件读取
+type stressWorkload struct {
+	Name         string `json:"name"`
+	Clients      int    `json:"clients"`
+	OpsPerClient int    `json:"ops_per_client"`
+	// ReadRatio 是读命令所占的比例，其余为写命令
+	ReadRatio float64 `json:"read_ratio"`
+	// HotRatio 是发往每种类型唯一热点键的请求比例，其余请求分布在 Keys 个键上
+	HotRatio float64 `json:"hot_ratio"`
+	Keys     int     `json:"keys"`
+	// Zipf 大于 1 时键按 Zipf 分布选取（越大越集中在少数键上），否则均匀选取
+	Zipf float64 `json:"zipf"`
+	// TTLRatio 是带过期时间写入的比例，TTLSeconds 是过期时间。目前只有字符串的 SET 支持过期时间
+	TTLRatio   float64 `json:"ttl_ratio"`
+	TTLSeconds int     `json:"ttl_seconds"`
+	// Types 是各数据类型的权重，类型为 string、list、set、hash
+	Types     map[string]int `json:"types"`
+	ValueSize int            `json:"value_size"`
+}
+
+// stressWorkloads 是内置的流量模型，default 接近最初固定的模式：80% 的请求访问一个热点键，其余访问随机的键
+var stressWorkloads = map[string]stressWorkload{
+	"default": {
+		Clients: 1000, OpsPerClient: 10000, ReadRatio: 0.96, HotRatio: 0.8, Keys: 10000000,
+		Types: map[string]int{"string": 1}, ValueSize: 5,
+	},
+	"read-heavy": {
+		Clients: 200, OpsPerClient: 10000, ReadRatio: 0.95, Keys: 100000, Zipf: 1.1,
+		TTLRatio: 0.1, TTLSeconds: 60, Types: map[string]int{"string": 70, "hash": 30}, ValueSize: 64,
+	},
+	"write-heavy": {
+		Clients: 200, OpsPerClient: 10000, ReadRatio: 0.3, Keys: 100000, Zipf: 1.01,
+		Types: map[string]int{"string": 40, "list": 30, "set": 15, "hash": 15}, ValueSize: 32,
+	},
+	"session": {
+		Clients: 500, OpsPerClient: 5000, ReadRatio: 0.8, Keys: 50000,
+		TTLRatio: 1, TTLSeconds: 30, Types: map[string]int{"string": 1}, ValueSize: 256,
+	},
+}
+
+// loadStressWorkload 按名称选择内置模型，file 不为空时从 JSON 文件读取，文件中没有给出的字段取 default 模型的值
+func loadStressWorkload(name, file string) (stressWorkload, error) {
+	if file == "" {
+		wl, ok := stressWorkloads[name]
+		if !ok {
+			return wl, fmt.Errorf("unknown workload '%s', available: %s", name, strings.Join(stressWorkloadNames(), ", "))
+		}
+		wl.Name = name
+		return wl, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return stressWorkload{}, err
+	}
+	wl := stressWorkloads["default"]
+	wl.Name = file
+	// Types 会被 json.Unmarshal 合并而不是替换，先清空，文件中没有给出时再取默认值
+	wl.Types = nil
+	if err := json.Unmarshal(data, &wl); err != nil {
+		return wl, fmt.Errorf("%s: %v", file, err)
+	}
+	if wl.Types == nil {
+		wl.Types = stressWorkloads["default"].Types
+	}
+	return wl, wl.validate()
+}
+
+func (wl *stressWorkload) validate() error {
+	if wl.Clients < 1 || wl.OpsPerClient < 1 || wl.Keys < 1 || wl.ValueSize < 0 {
+		return fmt.Errorf("clients, ops_per_client and keys must be positive")
+	}
+	if wl.ReadRatio < 0 || wl.ReadRatio > 1 || wl.HotRatio < 0 || wl.HotRatio > 1 || wl.TTLRatio < 0 || wl.TTLRatio > 1 {
+		return fmt.Errorf("read_ratio, hot_ratio and ttl_ratio must be between 0 and 1")
+	}
+	total := 0
+	for t, w := range wl.Types {
+		if t != "string" && t != "list" && t != "set" && t != "hash" {
+			return fmt.Errorf("unknown data type '%s', expected string, list, set or hash", t)
+		}
+		if w < 0 {
+			return fmt.Errorf("weight of data type '%s' must not be negative", t)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("types must contain at least one data type with a positive weight")
+	}
+	return nil
+}
+
+func stressWorkloadNames() []string {
+	names := make([]string, 0, len(stressWorkloads))
+	for name := range stressWorkloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stressGenerator 按流量模型为一个客户端生成命令，只被一个 goroutine 使用
+type stressGenerator struct {
+	wl    *stressWorkload
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+	types []string // 按权重展开的类型，随机取一个元素即按权重选取类型
+	value string
+}
+
+func newStressGenerator(wl *stressWorkload, seed int64) *stressGenerator {
+	g := &stressGenerator{wl: wl, rng: rand.New(rand.NewSource(seed)), value: strings.Repeat("v", wl.ValueSize)}
+	if wl.Zipf > 1 && wl.Keys > 1 {
+		g.zipf = rand.NewZipf(g.rng, wl.Zipf, 1, uint64(wl.Keys-1))
+	}
+	// 先按类型名排序，保证同样的种子生成同样的命令序列
+	names := make([]string, 0, len(wl.Types))
+	for t := range wl.Types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	for _, t := range names {
+		for i := 0; i < wl.Types[t]; i++ {
+			g.types = append(g.types, t)
+		}
+	}
+	return g
+}
+
+// next 生成下一条命令的 RESP 编码。各类型的键使用不同的前缀，避免出现 WRONGTYPE；
+// 集合成员和哈希字段取自固定的小范围，集合和哈希的大小不会无限增长
+func (g *stressGenerator) next() []byte {
+	t := g.types[g.rng.Intn(len(g.types))]
+	var key string
+	if g.rng.Float64() < g.wl.HotRatio {
+		key = "hot_data:" + t
+	} else if g.zipf != nil {
+		key = t + ":" + strconv.FormatUint(g.zipf.Uint64(), 10)
+	} else {
+		key = t + ":" + strconv.Itoa(g.rng.Intn(g.wl.Keys))
+	}
+	read := g.rng.Float64() < g.wl.ReadRatio
+	member := strconv.Itoa(g.rng.Intn(100))
+	var args []string
+	switch {
+	case t == "string" && read:
+		args = []string{"GET", key}
+	case t == "string":
+		args = []string{"SET", key, g.value}
+		if g.rng.Float64() < g.wl.TTLRatio {
+			args = append(args, "EX", strconv.Itoa(g.wl.TTLSeconds))
+		}
+	case t == "list" && read:
+		args = []string{"LRANGE", key, "0", "9"}
+	case t == "list":
+		// 写入一半是追加、一半是弹出，列表长度保持稳定
+		if g.rng.Intn(2) == 0 {
+			args = []string{"RPUSH", key, g.value}
+		} else {
+			args = []string{"LPOP", key}
+		}
+	case t == "set" && read:
+		args = []string{"SMEMBERS", key}
+	case t == "set":
+		args = []string{"SADD", key, "m" + member}
+	case t == "hash" && read:
+		args = []string{"HGET", key, "f" + member}
+	case t == "hash":
+		args = []string{"HSET", key, "f" + member, g.value}
+	}
+	return resp.EncodeCommand(args)
+}
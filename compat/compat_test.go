@@ -0,0 +1,25 @@
+package compat
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/server"
+)
+
+// startServer 在随机端口上启动一个实例，测试结束时停止，返回监听的地址
+func startServer(t *testing.T) string {
+	t.Helper()
+	if err := config.Set([][2]string{{"shutdown-drain-timeout", "0"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(server.Options{Addr: "127.0.0.1:0", Logger: log.New(io.Discard, "", 0)})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop() })
+	return srv.Addr()
+}
@@ -0,0 +1,6 @@
+// Package compat 用主流的 Go 客户端库（go-redis、redigo、rueidis）连接进程内启动的 redis-easy 实例，
+// 检查它们的握手（HELLO 失败后退回 RESP2、CLIENT SETINFO）、普通命令、管道以及回复解析。
+// 它是一个单独的模块，这些客户端库只是它的测试依赖，redis-easy 本身仍然没有第三方依赖。在本目录下运行：
+//
+//	go test ./...
+package compat
@@ -0,0 +1,17 @@
+module github.com/LikiosSedo/redis_easy/compat
+
+go 1.22
+
+require (
+	github.com/LikiosSedo/redis_easy v0.0.0
+	github.com/gomodule/redigo v1.9.2
+	github.com/redis/go-redis/v9 v9.5.1
+	github.com/redis/rueidis v1.0.19
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
+
+replace github.com/LikiosSedo/redis_easy => ../
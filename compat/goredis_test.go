@@ -0,0 +1,87 @@
+package compat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestGoRedis 使用 go-redis 的默认选项：新连接先发送 HELLO 3，失败后退回 RESP2，再以管道发送 CLIENT SETINFO
+func TestGoRedis(t *testing.T) {
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: startServer(t)})
+	t.Cleanup(func() { rdb.Close() })
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatalf("PING: %v", err)
+	}
+	if err := rdb.Set(ctx, "s", "hello", 0).Err(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if got, err := rdb.Get(ctx, "s").Result(); err != nil || got != "hello" {
+		t.Fatalf("GET = %q, %v", got, err)
+	}
+	if err := rdb.Set(ctx, "s", "v", time.Minute).Err(); err != nil {
+		t.Fatalf("SET EX: %v", err)
+	}
+	if ttl, err := rdb.TTL(ctx, "s").Result(); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL = %v, %v", ttl, err)
+	}
+	if err := rdb.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Fatalf("GET missing key: err = %v, want redis.Nil", err)
+	}
+
+	var lrange *redis.StringSliceCmd
+	var hget, wrongType *redis.StringCmd
+	_, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.RPush(ctx, "l", "a", "b", "c")
+		lrange = p.LRange(ctx, "l", 0, -1)
+		p.HSet(ctx, "h", "f", "v")
+		hget = p.HGet(ctx, "h", "f")
+		wrongType = p.Get(ctx, "l")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Fatalf("pipeline: err = %v, want the WRONGTYPE error of GET", err)
+	}
+	if got := lrange.Val(); strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("pipelined LRANGE = %q", got)
+	}
+	if got := hget.Val(); got != "v" {
+		t.Fatalf("pipelined HGET = %q", got)
+	}
+	if wrongType.Err() == nil {
+		t.Fatal("pipelined GET on a list did not fail")
+	}
+
+	// 连接池中的多条连接同时使用
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key, val := fmt.Sprintf("pool:%d", i), fmt.Sprint(i)
+			for j := 0; j < 50; j++ {
+				if err := rdb.Set(ctx, key, val, 0).Err(); err != nil {
+					errs <- err
+					return
+				}
+				if got, err := rdb.Get(ctx, key).Result(); err != nil || got != val {
+					errs <- fmt.Errorf("GET %s = %q, %v", key, got, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package compat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TestRedigo 使用 redigo 的连接池和 DialClientName，覆盖 Do 以及 Send、Flush、Receive 组成的管道
+func TestRedigo(t *testing.T) {
+	addr := startServer(t)
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, redis.DialClientName("redigo-app"))
+		},
+		TestOnBorrow: func(c redis.Conn, _ time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	t.Cleanup(func() { pool.Close() })
+	c := pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("SET", "s", "hello"); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if got, err := redis.String(c.Do("GET", "s")); err != nil || got != "hello" {
+		t.Fatalf("GET = %q, %v", got, err)
+	}
+	if _, err := redis.String(c.Do("GET", "missing")); err != redis.ErrNil {
+		t.Fatalf("GET missing key: err = %v, want redis.ErrNil", err)
+	}
+	if got, err := redis.String(c.Do("ECHO", "hello")); err != nil || got != "hello" {
+		t.Fatalf("ECHO = %q, %v", got, err)
+	}
+	if n, err := redis.Int(c.Do("SADD", "set", "a", "b")); err != nil || n != 2 {
+		t.Fatalf("SADD = %d, %v", n, err)
+	}
+	if members, err := redis.Strings(c.Do("SMEMBERS", "set")); err != nil || len(members) != 2 {
+		t.Fatalf("SMEMBERS = %q, %v", members, err)
+	}
+	if name, err := redis.String(c.Do("CLIENT", "GETNAME")); err != nil || name != "redigo-app" {
+		t.Fatalf("CLIENT GETNAME = %q, %v", name, err)
+	}
+
+	c.Send("SET", "s", "1")
+	c.Send("GET", "s")
+	c.Send("LPUSH", "s", "x")
+	c.Send("DEL", "s")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := redis.String(c.Receive()); err != nil || ok != "OK" {
+		t.Fatalf("pipelined SET = %q, %v", ok, err)
+	}
+	if got, err := redis.String(c.Receive()); err != nil || got != "1" {
+		t.Fatalf("pipelined GET = %q, %v", got, err)
+	}
+	if _, err := c.Receive(); err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Fatalf("pipelined LPUSH on a string: err = %v, want WRONGTYPE", err)
+	}
+	if n, err := redis.Int(c.Receive()); err != nil || n != 1 {
+		t.Fatalf("pipelined DEL = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,53 @@
+package compat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/rueidis"
+)
+
+// TestRueidis 使用 rueidis：NewClient 先以 CLUSTER SLOTS 探测集群，失败后作为单实例连接。
+// rueidis 只在 HELLO 返回 unknown command 时退回 RESP2，服务端对 HELLO 3 回复的 -NOPROTO 会让连接失败，
+// 因此必须设置 AlwaysRESP2；服务端没有客户端缓存，还必须设置 DisableCache
+func TestRueidis(t *testing.T) {
+	ctx := context.Background()
+	addr := startServer(t)
+	if _, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{addr}, DisableCache: true}); err == nil {
+		t.Fatal("NewClient connected without AlwaysRESP2; rueidis now falls back on -NOPROTO, update this test and hello.go")
+	}
+	client, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{addr}, DisableCache: true, AlwaysRESP2: true})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	if err := client.Do(ctx, client.B().Set().Key("s").Value("hello").Build()).Error(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if got, err := client.Do(ctx, client.B().Get().Key("s").Build()).ToString(); err != nil || got != "hello" {
+		t.Fatalf("GET = %q, %v", got, err)
+	}
+	if err := client.Do(ctx, client.B().Get().Key("missing").Build()).Error(); !rueidis.IsRedisNil(err) {
+		t.Fatalf("GET missing key: err = %v, want nil reply", err)
+	}
+
+	results := client.DoMulti(ctx,
+		client.B().Hset().Key("h").FieldValue().FieldValue("a", "1").FieldValue("b", "2").Build(),
+		client.B().Hget().Key("h").Field("a").Build(),
+		client.B().Hdel().Key("h").Field("b").Build(),
+		client.B().Get().Key("h").Build(),
+	)
+	if n, err := results[0].AsInt64(); err != nil || n != 2 {
+		t.Fatalf("HSET = %d, %v", n, err)
+	}
+	if got, err := results[1].ToString(); err != nil || got != "1" {
+		t.Fatalf("HGET = %q, %v", got, err)
+	}
+	if n, err := results[2].AsInt64(); err != nil || n != 1 {
+		t.Fatalf("HDEL = %d, %v", n, err)
+	}
+	if err := results[3].Error(); err == nil {
+		t.Fatal("GET on a hash did not fail")
+	}
+}
@@ -0,0 +1,816 @@
+// Package config 保存 redis-easy 的可调参数，参数名与 redis.conf 的写法保持一致
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// Config 保存服务端的可调参数，参数名与 redis.conf 的写法保持一致。
+// 运行时通过 Get 读取当前生效的配置；修改配置时复制一份再整体替换，
+// 因此读取方拿到的始终是一份不会被并发修改的快照
+type Config struct {
+	Port                 int
+	ProtoMaxBulkLen      int64
+	ProtoMaxMultibulkLen int64
+	Timeout              int
+	ClientReadTimeout    int
+	ClientWriteTimeout   int
+	// ClientOutputBufferLimit 按客户端类别保存输出缓冲区限制，见 OutputBufferLimit
+	ClientOutputBufferLimit [ClientClassCount]OutputBufferLimit
+	ShutdownDrainTimeout    int
+	IOBackend               string
+	IOAcceptors             int
+	WorkerThreads           int
+
+	HashMaxListpackEntries int
+	HashMaxListpackValue   int
+	SetMaxListpackEntries  int
+	SetMaxListpackValue    int
+	SetMaxIntsetEntries    int
+	ListMaxListpackSize    int
+
+	Dir            string
+	DBFilename     string
+	Save           string
+	SnapshotVerify string
+	SnapshotRepair string
+
+	LazyfreeThreshold   int
+	MemoryPurgeInterval int
+
+	LeaderboardSeason           string
+	LeaderboardMinScore         int
+	LeaderboardMaxScore         int
+	LeaderboardMaxDelta         int
+	LeaderboardMaxUpdatesPerSec int
+	LeaderboardChangesMaxLen    int
+	LeaderboardHistoryMaxLen    int
+
+	HTTPAuthToken    string
+	HTTPAuthUser     string
+	HTTPAuthPassword string
+	HTTPCORSOrigins  string
+	HTTPRateLimit    int
+	HTTPGateway      string
+	HTTPAdmin        string
+
+	SlowlogLogSlowerThan int
+	SlowlogMaxLen        int
+	SlowlogLogLevel      string
+
+	LogFile         string
+	LogFileMaxSize  int64
+	LogFileRotate   string
+	LogFileMaxFiles int
+	LogLevel        string
+	ClientLogLevel  string
+
+	Daemonize string
+	PidFile   string
+
+	SyslogEnabled   string
+	SyslogIdent     string
+	SyslogFacility  string
+	JournaldEnabled string
+
+	LoadModule string
+
+	WebhookURL        string
+	WebhookEvents     string
+	WebhookKeyPattern string
+	WebhookMaxRetries int
+
+	NATSURL        string
+	NATSSubject    string
+	NATSEvents     string
+	NATSKeyPattern string
+	NATSMaxRetries int
+
+	WriteBehindSink          string
+	WriteBehindKeyPattern    string
+	WriteBehindBatchSize     int
+	WriteBehindFlushInterval int
+	WriteBehindMaxRetries    int
+
+	ReadThroughLoader     string
+	ReadThroughKeyPattern string
+	ReadThroughTTL        int
+
+	MaxStringSize   int64
+	MaxListElements int
+	MaxSetElements  int
+	MaxHashFields   int
+
+	Namespaces string
+
+	BusyReplyThreshold int
+	OverloadQueueDepth int
+
+	AuditLogFile     string
+	AuditLogCommands string
+	AuditLogMaxLen   int
+}
+
+// Default 返回一份默认配置
+func Default() *Config {
+	return &Config{
+		Port:                 6379,
+		ProtoMaxBulkLen:      512 * 1024 * 1024,
+		ProtoMaxMultibulkLen: 1024 * 1024,
+		Timeout:              0,
+		ClientReadTimeout:    30000,
+		ClientWriteTimeout:   30000,
+		ClientOutputBufferLimit: [ClientClassCount]OutputBufferLimit{
+			ClientReplica: {Hard: 256 << 20, Soft: 64 << 20, SoftSeconds: 60},
+			ClientPubSub:  {Hard: 32 << 20, Soft: 8 << 20, SoftSeconds: 60},
+		},
+		ShutdownDrainTimeout: 5000,
+		IOBackend:            "goroutine",
+		IOAcceptors:          1,
+		WorkerThreads:        runtime.NumCPU(),
+
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue:   64,
+		SetMaxListpackEntries:  128,
+		SetMaxListpackValue:    64,
+		SetMaxIntsetEntries:    512,
+		ListMaxListpackSize:    -2,
+
+		Dir:            ".",
+		DBFilename:     "dump.reasy",
+		Save:           "3600 1 300 100 60 10000",
+		SnapshotVerify: "yes",
+		SnapshotRepair: "no",
+
+		LazyfreeThreshold:   64,
+		MemoryPurgeInterval: 0,
+
+		LeaderboardSeason:           "none",
+		LeaderboardMinScore:         0,
+		LeaderboardMaxScore:         10000,
+		LeaderboardMaxDelta:         0,
+		LeaderboardMaxUpdatesPerSec: 0,
+		LeaderboardChangesMaxLen:    10000,
+		LeaderboardHistoryMaxLen:    0,
+
+		HTTPRateLimit: 0,
+		HTTPGateway:   "no",
+		HTTPAdmin:     "no",
+
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+		SlowlogLogLevel:      "debug",
+
+		LogFileRotate:   "none",
+		LogFileMaxFiles: 7,
+		LogLevel:        "notice",
+		ClientLogLevel:  "notice",
+
+		Daemonize: "no",
+
+		SyslogEnabled:   "no",
+		SyslogIdent:     "redis-easy",
+		SyslogFacility:  "local0",
+		JournaldEnabled: "no",
+
+		WebhookEvents:     "expired,del",
+		WebhookKeyPattern: "*",
+		WebhookMaxRetries: 3,
+
+		NATSSubject:    "redis-easy.keyspace",
+		NATSEvents:     "write,del,expired",
+		NATSKeyPattern: "*",
+		NATSMaxRetries: 3,
+
+		WriteBehindKeyPattern:    "*",
+		WriteBehindBatchSize:     100,
+		WriteBehindFlushInterval: 1000,
+		WriteBehindMaxRetries:    3,
+
+		ReadThroughKeyPattern: "*",
+		ReadThroughTTL:        300,
+
+		BusyReplyThreshold: 5000,
+
+		AuditLogCommands: "config|set,config|rewrite,del,rename,save,bgsave,lbclear,lbseason|rotate,function|load,function|delete,schedule|add,schedule|remove,slowlog|reset",
+		AuditLogMaxLen:   128,
+	}
+}
+
+var currentConfig atomic.Pointer[Config]
+
+func init() {
+	currentConfig.Store(Default())
+}
+
+// Get 返回当前生效的配置快照，调用方不应修改返回值
+func Get() *Config {
+	return currentConfig.Load()
+}
+
+// Param 描述一个可配置项：如何从配置中读出它的值，以及如何把字符串值写回配置
+type Param struct {
+	Name string
+	get  func(c *Config) string
+	set  func(c *Config, value string) error
+	// Immutable 为 true 表示只在启动时生效，不能通过 CONFIG SET 修改
+	Immutable bool
+}
+
+// Value 返回配置项在 c 中的取值
+func (p *Param) Value(c *Config) string {
+	return p.get(c)
+}
+
+var params = []Param{
+	immutable(intConfig("port", func(c *Config) *int { return &c.Port }, 0, 65535)),
+	memoryConfig("proto-max-bulk-len", func(c *Config) *int64 { return &c.ProtoMaxBulkLen }, 1),
+	memoryConfig("proto-max-multibulk-len", func(c *Config) *int64 { return &c.ProtoMaxMultibulkLen }, 1),
+	// timeout 为空闲连接的超时秒数；另外两项以毫秒为单位，0 表示不限时
+	intConfig("timeout", func(c *Config) *int { return &c.Timeout }, 0, math.MaxInt32),
+	intConfig("client-read-timeout", func(c *Config) *int { return &c.ClientReadTimeout }, 0, math.MaxInt32),
+	intConfig("client-write-timeout", func(c *Config) *int { return &c.ClientWriteTimeout }, 0, math.MaxInt32),
+	// 与 redis.conf 相同：<class> <hard> <soft> <soft-seconds>，可以一次给出多个类别，没有给出的类别保持不变
+	clientOutputBufferLimitConfig(),
+	// 停止实例时排空连接的最长时间（毫秒）：不再接受新连接，等待现有连接处理完已收到的命令，0 表示直接断开
+	intConfig("shutdown-drain-timeout", func(c *Config) *int { return &c.ShutdownDrainTimeout }, 0, math.MaxInt32),
+	// goroutine：每个连接一个 goroutine；eventloop：单个 epoll 事件循环处理所有连接（仅 Linux）
+	immutable(enumConfig("io-backend", func(c *Config) *string { return &c.IOBackend }, "goroutine", "eventloop")),
+	// 监听 socket 的个数，大于 1 时各个 socket 以 SO_REUSEPORT 绑定同一端口，由内核把新连接分散到它们上面（仅 Linux）：
+	// goroutine 后端每个 socket 一个接受连接的 goroutine，eventloop 后端每个 socket 一个独立的事件循环
+	immutable(intConfig("io-acceptors", func(c *Config) *int { return &c.IOAcceptors }, 1, 1024)),
+	// 执行命令的分片 worker 数量，只在启动时生效；0 表示在连接所在的 goroutine 上直接执行
+	immutable(intConfig("worker-threads", func(c *Config) *int { return &c.WorkerThreads }, 0, 1024)),
+	// 小对象使用 listpack 紧凑编码的阈值，超过后转换为普通的切片 / map
+	intConfig("hash-max-listpack-entries", func(c *Config) *int { return &c.HashMaxListpackEntries }, 0, math.MaxInt32),
+	intConfig("hash-max-listpack-value", func(c *Config) *int { return &c.HashMaxListpackValue }, 0, math.MaxInt32),
+	intConfig("set-max-listpack-entries", func(c *Config) *int { return &c.SetMaxListpackEntries }, 0, math.MaxInt32),
+	intConfig("set-max-listpack-value", func(c *Config) *int { return &c.SetMaxListpackValue }, 0, math.MaxInt32),
+	// 只包含整数的集合在成员数不超过该值时使用 intset 编码
+	intConfig("set-max-intset-entries", func(c *Config) *int { return &c.SetMaxIntsetEntries }, 0, math.MaxInt32),
+	// 正数为最多元素个数，-1 到 -5 表示最多 4KB 到 64KB
+	intConfig("list-max-listpack-size", func(c *Config) *int { return &c.ListMaxListpackSize }, -5, math.MaxInt32),
+	// 快照文件保存在 dir 目录下的 dbfilename 中，启动时从同一位置载入
+	stringConfig("dir", func(c *Config) *string { return &c.Dir }),
+	stringConfig("dbfilename", func(c *Config) *string { return &c.DBFilename }),
+	// 自动保存快照的条件，格式见 ParseSavePoints，空字符串表示只在 SAVE、BGSAVE 和停止时保存，见 server/savepoints.go
+	optionalStringConfig("save", func(c *Config) *string { return &c.Save }),
+	// 载入快照时是否校验每条记录的 CRC32C 和文件末尾的 CRC64；snapshot-repair 为 yes 时，快照损坏不再导致启动失败，
+	// 而是载入第一条损坏的记录之前的所有数据
+	enumConfig("snapshot-verify", func(c *Config) *string { return &c.SnapshotVerify }, "yes", "no"),
+	enumConfig("snapshot-repair", func(c *Config) *string { return &c.SnapshotRepair }, "no", "yes"),
+	// 删除或覆盖元素个数超过该值的列表、集合、哈希时交给后台释放，0 表示总是直接释放
+	intConfig("lazyfree-threshold", func(c *Config) *int { return &c.LazyfreeThreshold }, 0, math.MaxInt32),
+	// 每隔多少秒检查一次并把空闲的堆内存归还给操作系统，0 表示关闭
+	intConfig("memory-purge-interval", func(c *Config) *int { return &c.MemoryPurgeInterval }, 0, math.MaxInt32),
+	// 排行榜赛季的轮换周期：每到新的一天 / ISO 周 / 月时归档当前排行榜并开始新赛季
+	enumConfig("leaderboard-season", func(c *Config) *string { return &c.LeaderboardSeason }, "none", "daily", "weekly", "monthly"),
+	// 排行榜分数的取值范围，超出范围的分数会被截断到边界
+	intConfig("leaderboard-min-score", func(c *Config) *int { return &c.LeaderboardMinScore }, math.MinInt32, math.MaxInt32),
+	intConfig("leaderboard-max-score", func(c *Config) *int { return &c.LeaderboardMaxScore }, math.MinInt32, math.MaxInt32),
+	// 反作弊：单次提交允许的最大分数变化，以及每个用户每秒最多的提交次数，0 表示不限制。
+	// 分数变化只对已经在榜上的用户检查，用户的第一次提交没有可以比较的旧分数，只按上面的范围截断
+	intConfig("leaderboard-max-delta", func(c *Config) *int { return &c.LeaderboardMaxDelta }, 0, math.MaxInt32),
+	intConfig("leaderboard-max-updates-per-second", func(c *Config) *int { return &c.LeaderboardMaxUpdatesPerSec }, 0, math.MaxInt32),
+	// LBCHANGES 变更流最多保留的记录数，0 表示不记录
+	intConfig("leaderboard-changes-max-len", func(c *Config) *int { return &c.LeaderboardChangesMaxLen }, 0, math.MaxInt32),
+	// LBHISTORY 为每个用户保留的分数历史条数，0 表示不记录
+	intConfig("leaderboard-history-max-len", func(c *Config) *int { return &c.LeaderboardHistoryMaxLen }, 0, math.MaxInt32),
+	// 排行榜 HTTP 服务的访问控制，空字符串或 0 表示关闭，见 server/http_guard.go
+	optionalStringConfig("http-auth-token", func(c *Config) *string { return &c.HTTPAuthToken }),
+	optionalStringConfig("http-auth-user", func(c *Config) *string { return &c.HTTPAuthUser }),
+	optionalStringConfig("http-auth-password", func(c *Config) *string { return &c.HTTPAuthPassword }),
+	optionalStringConfig("http-cors-origins", func(c *Config) *string { return &c.HTTPCORSOrigins }),
+	intConfig("http-rate-limit", func(c *Config) *int { return &c.HTTPRateLimit }, 0, math.MaxInt32),
+	// 是否在 :8080 上开启 HTTP/JSON 命令网关（/v1/command、/v1/keys/）以及管理后台（/admin），只在启动时生效
+	immutable(enumConfig("http-gateway", func(c *Config) *string { return &c.HTTPGateway }, "no", "yes")),
+	immutable(enumConfig("http-admin", func(c *Config) *string { return &c.HTTPAdmin }, "no", "yes")),
+	// 执行时间不少于该值（微秒）的命令记入慢查询日志，-1 表示关闭；日志最多保留 slowlog-max-len 条
+	intConfig("slowlog-log-slower-than", func(c *Config) *int { return &c.SlowlogLogSlowerThan }, -1, math.MaxInt32),
+	intConfig("slowlog-max-len", func(c *Config) *int { return &c.SlowlogMaxLen }, 0, math.MaxInt32),
+	// 以守护进程方式在后台运行，开始接受连接后把进程号写入 pidfile（为空表示不写），见 cmd/redis-easy/daemon.go
+	immutable(enumConfig("daemonize", func(c *Config) *string { return &c.Daemonize }, "no", "yes")),
+	immutable(optionalStringConfig("pidfile", func(c *Config) *string { return &c.PidFile })),
+	// 运行日志写入 logfile（为空表示写到标准错误），按 logfile-max-size 和 logfile-rotate 轮转，
+	// 最多保留 logfile-max-files 个旧文件，见 logfile 包
+	optionalStringConfig("logfile", func(c *Config) *string { return &c.LogFile }),
+	memoryConfig("logfile-max-size", func(c *Config) *int64 { return &c.LogFileMaxSize }, 0),
+	enumConfig("logfile-rotate", func(c *Config) *string { return &c.LogFileRotate }, "none", "hourly", "daily"),
+	intConfig("logfile-max-files", func(c *Config) *int { return &c.LogFileMaxFiles }, 0, math.MaxInt32),
+	// 只输出不低于 loglevel 的日志。客户端连接、断开的日志使用 client-log-level，慢查询（同时写入运行日志）使用
+	// slowlog-log-level，其他运行日志都是 notice
+	enumConfig("loglevel", func(c *Config) *string { return &c.LogLevel }, logLevels...),
+	enumConfig("client-log-level", func(c *Config) *string { return &c.ClientLogLevel }, logLevels...),
+	enumConfig("slowlog-log-level", func(c *Config) *string { return &c.SlowlogLogLevel }, logLevels...),
+	// 运行日志同时发送到本机的 syslog（以 syslog-facility、syslog-ident 标记）和 systemd journal，见 logfile/syslog.go
+	enumConfig("syslog-enabled", func(c *Config) *string { return &c.SyslogEnabled }, "no", "yes"),
+	stringConfig("syslog-ident", func(c *Config) *string { return &c.SyslogIdent }),
+	enumConfig("syslog-facility", func(c *Config) *string { return &c.SyslogFacility },
+		"user", "daemon", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"),
+	enumConfig("journald-enabled", func(c *Config) *string { return &c.JournaldEnabled }, "no", "yes"),
+	// 启动时载入的扩展模块（-buildmode=plugin 编译的 .so），多个路径用空格分隔，见 server/module.go
+	immutable(optionalStringConfig("loadmodule", func(c *Config) *string { return &c.LoadModule })),
+	// 键空间事件的 webhook：把 webhook-events 中列出的事件（write、del、expired）里键名匹配 webhook-key-pattern 的
+	// 以 JSON POST 到 webhook-url，失败时最多重试 webhook-max-retries 次；webhook-url 为空表示关闭，见 server/webhook.go
+	optionalStringConfig("webhook-url", func(c *Config) *string { return &c.WebhookURL }),
+	listConfig("webhook-events", func(c *Config) *string { return &c.WebhookEvents }, "write", "del", "expired"),
+	stringConfig("webhook-key-pattern", func(c *Config) *string { return &c.WebhookKeyPattern }),
+	intConfig("webhook-max-retries", func(c *Config) *int { return &c.WebhookMaxRetries }, 0, 100),
+	// 键空间事件发布到 NATS：nats-events 中列出的事件里键名匹配 nats-key-pattern 的以 JSON 发布到 nats-url
+	// （nats://[user:password@]host:port 或 tls://...）上的 <nats-subject>.<事件名>，失败时最多重试 nats-max-retries 次；
+	// nats-url 为空表示关闭，见 server/nats.go
+	optionalStringConfig("nats-url", func(c *Config) *string { return &c.NATSURL }),
+	stringConfig("nats-subject", func(c *Config) *string { return &c.NATSSubject }),
+	listConfig("nats-events", func(c *Config) *string { return &c.NATSEvents }, "write", "del", "expired"),
+	stringConfig("nats-key-pattern", func(c *Config) *string { return &c.NATSKeyPattern }),
+	intConfig("nats-max-retries", func(c *Config) *int { return &c.NATSMaxRetries }, 0, 100),
+	// write-behind：键名匹配 write-behind-key-pattern 的键被修改后，每隔 write-behind-flush-interval 毫秒
+	// 或者积累了 write-behind-batch-size 个键时，把这些键的最新值推送到 write-behind-sink（http(s):// 地址或者
+	// 扩展模块注册的 sink 名称），为空表示关闭，见 server/writebehind.go
+	optionalStringConfig("write-behind-sink", func(c *Config) *string { return &c.WriteBehindSink }),
+	stringConfig("write-behind-key-pattern", func(c *Config) *string { return &c.WriteBehindKeyPattern }),
+	intConfig("write-behind-batch-size", func(c *Config) *int { return &c.WriteBehindBatchSize }, 1, 100000),
+	intConfig("write-behind-flush-interval", func(c *Config) *int { return &c.WriteBehindFlushInterval }, 10, math.MaxInt32),
+	intConfig("write-behind-max-retries", func(c *Config) *int { return &c.WriteBehindMaxRetries }, 0, 100),
+	// read-through：GET 未命中键名匹配 read-through-key-pattern 的键时，从 read-through-loader（http(s):// 地址或者
+	// 扩展模块注册的 loader 名称）读取值，保存 read-through-ttl 秒（0 表示不过期）后返回；为空表示关闭。
+	// 回源会阻塞执行命令的 goroutine，不能与 io-backend eventloop 同时使用，见 server/readthrough.go
+	optionalStringConfig("read-through-loader", func(c *Config) *string { return &c.ReadThroughLoader }),
+	stringConfig("read-through-key-pattern", func(c *Config) *string { return &c.ReadThroughKeyPattern }),
+	intConfig("read-through-ttl", func(c *Config) *int { return &c.ReadThroughTTL }, 0, math.MaxInt32),
+	// 单个字符串（字符串值以及列表元素、集合成员、哈希的字段和值）的最大字节数，以及列表、集合、哈希的最大元素个数，
+	// 超过时写命令返回错误且不做任何修改；0 表示不限制
+	memoryConfig("max-string-size", func(c *Config) *int64 { return &c.MaxStringSize }, 0),
+	intConfig("max-list-elements", func(c *Config) *int { return &c.MaxListElements }, 0, math.MaxInt32),
+	intConfig("max-set-elements", func(c *Config) *int { return &c.MaxSetElements }, 0, math.MaxInt32),
+	intConfig("max-hash-fields", func(c *Config) *int { return &c.MaxHashFields }, 0, math.MaxInt32),
+	// 按键名前缀划分的命名空间及其配额，多个定义用空格分隔，格式见 ParseNamespaces，见 server/namespace.go
+	optionalStringConfig("namespaces", func(c *Config) *string { return &c.Namespaces }),
+	// 命令要访问的分片正被执行时间超过 busy-reply-threshold 毫秒的 FCALL 占用时返回 -BUSY，
+	// 命令要排入的分片 worker 队列已经积压了 overload-queue-depth 条命令时返回 -OVERLOADED；0 表示不检查，见 server/state.go
+	intConfig("busy-reply-threshold", func(c *Config) *int { return &c.BusyReplyThreshold }, 0, math.MaxInt32),
+	intConfig("overload-queue-depth", func(c *Config) *int { return &c.OverloadQueueDepth }, 0, math.MaxInt32),
+	// 审计日志：audit-log-commands 中列出的命令（逗号分隔的命令名，写父命令名表示它的所有子命令）执行时，
+	// 记录执行者、时间和参数，追加写入 audit-log-file（为空表示只保留在内存中），内存中最多保留 audit-log-max-len 条，见 server/audit.go
+	optionalStringConfig("audit-log-file", func(c *Config) *string { return &c.AuditLogFile }),
+	optionalStringConfig("audit-log-commands", func(c *Config) *string { return &c.AuditLogCommands }),
+	intConfig("audit-log-max-len", func(c *Config) *int { return &c.AuditLogMaxLen }, 0, math.MaxInt32),
+}
+
+// logLevels 是日志级别，从低到高排列
+var logLevels = []string{"debug", "verbose", "notice"}
+
+// ShouldLog 返回按当前的 loglevel 是否输出 level 级别的日志
+func ShouldLog(level string) bool {
+	return slices.Index(logLevels, level) >= slices.Index(logLevels, Get().LogLevel)
+}
+
+func immutable(p Param) Param {
+	p.Immutable = true
+	return p
+}
+
+func intConfig(name string, field func(c *Config) *int, min, max int) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < min || n > max {
+				return fmt.Errorf("argument must be an integer between %d and %d", min, max)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// stringConfig 描述取值为任意非空字符串的配置项
+func stringConfig(name string, field func(c *Config) *string) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			if value == "" {
+				return fmt.Errorf("argument must not be empty")
+			}
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// optionalStringConfig 描述可以为空字符串的配置项，空字符串通常表示关闭对应的功能
+func optionalStringConfig(name string, field func(c *Config) *string) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// enumConfig 描述只能取若干固定值之一的配置项
+func enumConfig(name string, field func(c *Config) *string, values ...string) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			for _, v := range values {
+				if strings.EqualFold(v, value) {
+					*field(c) = v
+					return nil
+				}
+			}
+			return fmt.Errorf("argument must be one of: %s", strings.Join(values, ", "))
+		},
+	}
+}
+
+// listConfig 描述取值为逗号分隔的若干固定值的配置项，可以为空
+func listConfig(name string, field func(c *Config) *string, values ...string) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				item = strings.ToLower(strings.TrimSpace(item))
+				if item == "" {
+					continue
+				}
+				found := false
+				for _, v := range values {
+					found = found || v == item
+				}
+				if !found {
+					return fmt.Errorf("argument must be a comma separated list of: %s", strings.Join(values, ", "))
+				}
+				items = append(items, item)
+			}
+			*field(c) = strings.Join(items, ",")
+			return nil
+		},
+	}
+}
+
+// HasListItem 返回 listConfig 配置项的取值 list 中是否包含 item
+func HasListItem(list, item string) bool {
+	for list != "" {
+		var v string
+		v, list, _ = strings.Cut(list, ",")
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryConfig 描述以字节为单位的配置项，取值支持 kb/mb/gb 等单位后缀
+func memoryConfig(name string, field func(c *Config) *int64, min int64) Param {
+	return Param{
+		Name: name,
+		get:  func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+		set: func(c *Config, value string) error {
+			n, err := parseMemory(value)
+			if err != nil || n < min {
+				return fmt.Errorf("argument must be a memory value of at least %d bytes", min)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// parseMemory 解析 redis.conf 风格的内存大小，例如 1024、64k、512mb、1gb
+func parseMemory(value string) (int64, error) {
+	v := strings.ToLower(value)
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSuffix(v, u.suffix)
+			mul = u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mul, nil
+}
+
+// SavePoint 是 save 配置中的一个条件：距离上次保存至少 Seconds 秒并且至少有 Changes 次修改
+type SavePoint struct {
+	Seconds int
+	Changes int
+}
+
+// ParseSavePoints 解析 save 配置：若干对以空格分隔的 "秒数 修改次数"，与 Redis 相同，
+// 例如 "3600 1 300 100 60 10000"，满足其中任意一对时保存
+func ParseSavePoints(value string) ([]SavePoint, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("save must be pairs of <seconds> <changes>")
+	}
+	var points []SavePoint
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.Atoi(fields[i])
+		changes, err2 := strconv.Atoi(fields[i+1])
+		if err1 != nil || err2 != nil || seconds < 1 || changes < 1 {
+			return nil, fmt.Errorf("invalid save point '%s %s', seconds and changes must be positive integers", fields[i], fields[i+1])
+		}
+		points = append(points, SavePoint{Seconds: seconds, Changes: changes})
+	}
+	return points, nil
+}
+
+// NamespaceDef 是 namespaces 配置中的一个命名空间定义
+type NamespaceDef struct {
+	Name      string
+	Prefix    string
+	MaxKeys   int64 // 0 表示不限制
+	MaxMemory int64 // 0 表示不限制
+}
+
+// ParseNamespaces 解析 namespaces 配置：多个定义用空格分隔，每个定义为 name,prefix[,maxkeys[,maxmemory]]，
+// 例如 "team-a,a:,100000,512mb team-b,b:"。maxmemory 支持 kb/mb/gb 等单位，省略或为 0 表示不限制
+func ParseNamespaces(value string) ([]NamespaceDef, error) {
+	var defs []NamespaceDef
+	names := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	for _, def := range strings.Fields(value) {
+		fields := strings.Split(def, ",")
+		if len(fields) < 2 || len(fields) > 4 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("invalid namespace '%s', expected name,prefix[,maxkeys[,maxmemory]]", def)
+		}
+		d := NamespaceDef{Name: fields[0], Prefix: fields[1]}
+		if names[d.Name] || prefixes[d.Prefix] {
+			return nil, fmt.Errorf("duplicate namespace name or prefix in '%s'", def)
+		}
+		names[d.Name], prefixes[d.Prefix] = true, true
+		if len(fields) > 2 {
+			n, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid maxkeys in namespace '%s'", def)
+			}
+			d.MaxKeys = n
+		}
+		if len(fields) > 3 {
+			n, err := parseMemory(fields[3])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid maxmemory in namespace '%s'", def)
+			}
+			d.MaxMemory = n
+		}
+		defs = append(defs, d)
+	}
+	return defs, nil
+}
+
+// ClientClass 是 client-output-buffer-limit 中的客户端类别
+type ClientClass int
+
+const (
+	ClientNormal ClientClass = iota
+	ClientReplica
+	ClientPubSub
+
+	ClientClassCount
+)
+
+var clientClassNames = [ClientClassCount]string{"normal", "replica", "pubsub"}
+
+func (c ClientClass) String() string {
+	return clientClassNames[c]
+}
+
+// OutputBufferLimit 是一类客户端的输出缓冲区限制：积压的回复超过 Hard 字节，
+// 或者连续 SoftSeconds 秒超过 Soft 字节时断开连接。Hard、Soft 为 0 表示不检查对应的限制
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int
+}
+
+// clientOutputBufferLimitConfig 描述 client-output-buffer-limit，取值为 "normal 0 0 0 replica 256mb 64mb 60 ..." 的形式，
+// 与 Redis 相同，类别名 slave 等同于 replica
+func clientOutputBufferLimitConfig() Param {
+	return Param{
+		Name: "client-output-buffer-limit",
+		get: func(c *Config) string {
+			parts := make([]string, 0, ClientClassCount)
+			for class, l := range c.ClientOutputBufferLimit {
+				parts = append(parts, fmt.Sprintf("%s %d %d %d", ClientClass(class), l.Hard, l.Soft, l.SoftSeconds))
+			}
+			return strings.Join(parts, " ")
+		},
+		set: func(c *Config, value string) error {
+			fields := strings.Fields(value)
+			if len(fields) == 0 || len(fields)%4 != 0 {
+				return fmt.Errorf("argument must be one or more '<class> <hard> <soft> <soft-seconds>'")
+			}
+			limits := c.ClientOutputBufferLimit
+			for i := 0; i < len(fields); i += 4 {
+				name := strings.ToLower(fields[i])
+				if name == "slave" {
+					name = "replica"
+				}
+				class := slices.Index(clientClassNames[:], name)
+				if class < 0 {
+					return fmt.Errorf("invalid client class '%s'", fields[i])
+				}
+				hard, err1 := parseMemory(fields[i+1])
+				soft, err2 := parseMemory(fields[i+2])
+				seconds, err3 := strconv.Atoi(fields[i+3])
+				if err1 != nil || err2 != nil || err3 != nil || hard < 0 || soft < 0 || seconds < 0 {
+					return fmt.Errorf("invalid limits for client class '%s'", name)
+				}
+				limits[class] = OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}
+			}
+			c.ClientOutputBufferLimit = limits
+			return nil
+		},
+	}
+}
+
+// Params 返回所有配置项，顺序与 CONFIG GET 的输出一致
+func Params() []Param {
+	return params
+}
+
+// Find 按名称（不区分大小写）查找配置项，找不到时返回 nil
+func Find(name string) *Param {
+	name = strings.ToLower(name)
+	for i := range params {
+		if params[i].Name == name {
+			return &params[i]
+		}
+	}
+	return nil
+}
+
+// applyConfigDirectives 把一组 (参数名, 参数值) 应用到配置副本上，任何一项出错都不会影响当前配置
+func applyConfigDirectives(base *Config, directives [][2]string) (*Config, error) {
+	cfg := *base
+	for _, d := range directives {
+		param := Find(d[0])
+		if param == nil {
+			return nil, fmt.Errorf("unknown config parameter '%s'", d[0])
+		}
+		if err := param.set(&cfg, d[1]); err != nil {
+			return nil, fmt.Errorf("invalid value for '%s': %v", param.Name, err)
+		}
+	}
+	if err := validateConfig(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// validateConfig 检查涉及多个配置项的约束
+func validateConfig(c *Config) error {
+	if c.LeaderboardMinScore > c.LeaderboardMaxScore {
+		return fmt.Errorf("leaderboard-min-score must not be greater than leaderboard-max-score")
+	}
+	if (c.HTTPAuthUser == "") != (c.HTTPAuthPassword == "") {
+		return fmt.Errorf("http-auth-user and http-auth-password must be set together")
+	}
+	if _, err := path.Match(c.WebhookKeyPattern, ""); err != nil {
+		return fmt.Errorf("webhook-key-pattern is not a valid pattern")
+	}
+	if _, err := path.Match(c.NATSKeyPattern, ""); err != nil {
+		return fmt.Errorf("nats-key-pattern is not a valid pattern")
+	}
+	if c.NATSURL != "" {
+		if u, err := url.Parse(c.NATSURL); err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+			return fmt.Errorf("nats-url must be nats://host:port or tls://host:port")
+		}
+	}
+	if strings.ContainsAny(c.NATSSubject, " \t\r\n*>") {
+		return fmt.Errorf("nats-subject must not contain whitespace or wildcards")
+	}
+	if _, err := path.Match(c.WriteBehindKeyPattern, ""); err != nil {
+		return fmt.Errorf("write-behind-key-pattern is not a valid pattern")
+	}
+	if _, err := path.Match(c.ReadThroughKeyPattern, ""); err != nil {
+		return fmt.Errorf("read-through-key-pattern is not a valid pattern")
+	}
+	if c.ReadThroughLoader != "" && c.IOBackend == "eventloop" {
+		return fmt.Errorf("read-through-loader can't be used with io-backend eventloop")
+	}
+	if _, err := ParseSavePoints(c.Save); err != nil {
+		return err
+	}
+	if _, err := ParseNamespaces(c.Namespaces); err != nil {
+		return err
+	}
+	if strings.ContainsAny(c.AuditLogCommands, " \t") || c.AuditLogCommands != strings.ToLower(c.AuditLogCommands) {
+		return fmt.Errorf("audit-log-commands must be a comma-separated list of lowercase command names")
+	}
+	return nil
+}
+
+// Set 在运行时修改一组配置，全部合法时才整体生效
+func Set(directives [][2]string) error {
+	for _, d := range directives {
+		if p := Find(d[0]); p != nil && p.Immutable {
+			return fmt.Errorf("can't set immutable config '%s'", p.Name)
+		}
+	}
+	for {
+		old := Get()
+		cfg, err := applyConfigDirectives(old, directives)
+		if err != nil {
+			return err
+		}
+		if currentConfig.CompareAndSwap(old, cfg) {
+			return nil
+		}
+	}
+}
+
+// readConfigFile 读取 redis.conf 格式的配置文件：每行一个 "参数名 参数值"，# 开头为注释
+func readConfigFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var directives [][2]string
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := resp.SplitInlineArgs([]byte(line))
+		if err != nil || len(args) < 2 {
+			return nil, fmt.Errorf("%s:%d: bad directive '%s'", path, lineNo, line)
+		}
+		directives = append(directives, [2]string{args[0], strings.Join(args[1:], " ")})
+	}
+	return directives, scanner.Err()
+}
+
+// Load 按 redis-server 的命令行约定加载配置：
+// 第一个参数若不以 -- 开头则视为配置文件路径，其后的 --name value 会覆盖文件中的同名配置
+// 配置文件的路径和命令行参数会被记下，供 Reload 和 Rewrite 使用
+func Load(args []string) error {
+	var directives, overrides [][2]string
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		fileDirectives, err := readConfigFile(args[0])
+		if err != nil {
+			return err
+		}
+		if file, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+		directives = append(directives, fileDirectives...)
+		args = args[1:]
+	}
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimPrefix(args[i], "--")
+		if name == args[i] || i+1 >= len(args) {
+			return fmt.Errorf("bad command line option '%s', expected --name value", args[i])
+		}
+		overrides = append(overrides, [2]string{name, args[i+1]})
+		i++
+	}
+	cfg, err := applyConfigDirectives(Get(), append(directives, overrides...))
+	if err != nil {
+		return err
+	}
+	currentConfig.Store(cfg)
+	loadedFrom.Lock()
+	loadedFrom.file, loadedFrom.overrides = file, overrides
+	loadedFrom.Unlock()
+	return nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import "testing"
+
+// TestReadThroughEventLoop 检查 read-through-loader 不能与 io-backend eventloop 同时启用，无论两者哪个先设置
+func TestReadThroughEventLoop(t *testing.T) {
+	defer currentConfig.Store(Default())
+	if err := Load([]string{"--io-backend", "eventloop", "--read-through-loader", "http://127.0.0.1:1/"}); err == nil {
+		t.Fatal("Load accepted read-through-loader with io-backend eventloop")
+	}
+	if err := Load([]string{"--io-backend", "eventloop"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set([][2]string{{"read-through-loader", "http://127.0.0.1:1/"}}); err == nil {
+		t.Fatal("Set accepted read-through-loader with io-backend eventloop")
+	}
+	if err := Load([]string{"--io-backend", "goroutine", "--read-through-loader", "http://127.0.0.1:1/"}); err != nil {
+		t.Fatal(err)
+	}
+}
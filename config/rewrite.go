@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 运行时重新载入和改写配置文件：
+//
+//	Reload   重新读取启动时的配置文件（命令行上的 --name value 仍然覆盖文件中的值），让可以在运行时修改的配置项生效；
+//	         文件中没有写的配置项恢复默认值，之前用 CONFIG SET 做的修改如果没有写回文件会被文件中的值覆盖。
+//	         只在启动时生效的配置项保持不变，返回给调用方提示需要重启
+//	Rewrite  把当前生效的配置写回配置文件（CONFIG REWRITE）：已有的行原地改写为当前值，注释和其他行保持不变，
+//	         重复出现的配置项只保留第一行，文件中没有、取值又不是默认值的配置项追加在文件末尾（第一次追加时先写一行注释）
+
+// ErrNoConfigFile 表示启动时没有指定配置文件
+var ErrNoConfigFile = errors.New("the server is running without a config file")
+
+// rewriteHeader 是 Rewrite 在追加的配置项之前写入的注释
+const rewriteHeader = "# Generated by CONFIG REWRITE"
+
+// loadedFrom 记录 Load 读取的配置文件（绝对路径）和命令行上的覆盖项
+var loadedFrom struct {
+	sync.Mutex
+	file      string
+	overrides [][2]string
+}
+
+// File 返回启动时读取的配置文件的绝对路径，没有配置文件时返回空字符串
+func File() string {
+	loadedFrom.Lock()
+	defer loadedFrom.Unlock()
+	return loadedFrom.file
+}
+
+// Reload 重新读取配置文件并让可以在运行时修改的配置项生效，返回取值发生变化的配置项，
+// 以及文件中的取值与当前不同、但只能在重启后生效的配置项。文件有错误时当前配置保持不变
+func Reload() (changed, needRestart []string, err error) {
+	loadedFrom.Lock()
+	defer loadedFrom.Unlock()
+	if loadedFrom.file == "" {
+		return nil, nil, ErrNoConfigFile
+	}
+	directives, err := readConfigFile(loadedFrom.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		changed, needRestart = nil, nil
+		old := Get()
+		cfg, err := applyConfigDirectives(Default(), append(directives, loadedFrom.overrides...))
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range params {
+			p := &params[i]
+			value := p.get(cfg)
+			if value == p.get(old) {
+				continue
+			}
+			if p.Immutable {
+				// 取值都是 get 格式化出来的，一定能够写回
+				p.set(cfg, p.get(old))
+				needRestart = append(needRestart, p.Name)
+				continue
+			}
+			changed = append(changed, p.Name)
+		}
+		if currentConfig.CompareAndSwap(old, cfg) {
+			return changed, needRestart, nil
+		}
+	}
+}
+
+// Rewrite 把当前生效的配置写回配置文件。先写入同一目录下的临时文件再改名，写入失败时原文件不受影响
+func Rewrite() error {
+	loadedFrom.Lock()
+	defer loadedFrom.Unlock()
+	if loadedFrom.file == "" {
+		return ErrNoConfigFile
+	}
+	data, err := os.ReadFile(loadedFrom.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	cfg, defaults := Get(), Default()
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	out := make([]string, 0, len(lines))
+	written := make(map[string]bool)
+	hasHeader := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		hasHeader = hasHeader || trimmed == rewriteHeader
+		var p *Param
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			if args, err := resp.SplitInlineArgs([]byte(trimmed)); err == nil && len(args) > 0 {
+				p = Find(args[0])
+			}
+		}
+		switch {
+		case p == nil:
+			out = append(out, line)
+		case !written[p.Name]:
+			out = append(out, p.Name+" "+formatConfigValue(p.get(cfg)))
+			written[p.Name] = true
+		}
+	}
+	var appended []string
+	for i := range params {
+		p := &params[i]
+		if !written[p.Name] && p.get(cfg) != p.get(defaults) {
+			appended = append(appended, p.Name+" "+formatConfigValue(p.get(cfg)))
+		}
+	}
+	if len(appended) > 0 && !hasHeader {
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, rewriteHeader)
+	}
+	out = append(out, appended...)
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(loadedFrom.file); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(loadedFrom.file), filepath.Base(loadedFrom.file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	content := strings.Join(out, "\n") + "\n"
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), loadedFrom.file)
+}
+
+// formatConfigValue 把配置项的取值写成 readConfigFile 能够原样读回的形式：空字符串以及含有引号、反斜杠、
+// 控制字符的取值加上双引号并转义。含有空格的取值不需要引号，readConfigFile 会把参数名之后的各部分以空格连接
+func formatConfigValue(v string) string {
+	needQuote := v == ""
+	for i := 0; i < len(v) && !needQuote; i++ {
+		c := v[i]
+		needQuote = c == '"' || c == '\'' || c == '\\' || c < 0x20 || c == 0x7f ||
+			(c == ' ' && (i == 0 || i == len(v)-1 || v[i-1] == ' '))
+	}
+	if !needQuote {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,3 @@
+module github.com/LikiosSedo/redis_easy
+
+go 1.22
@@ -0,0 +1,69 @@
+package leaderboard
+
+import "sync"
+
+// 排行榜变更流。当前排行榜的每次变化都按顺序分配一个递增的 ID 记录下来，
+// 下游可以先用 LBRANGE 取一份全量，再用 LBCHANGES 增量地追上后续的变化，而不必反复轮询 LBTOP。
+// 变更流只保存在内存中，最多保留 leaderboard-changes-max-len 条，ID 在重启后从 1 重新开始
+
+// ChangeRecord 是变更流中的一条记录
+type ChangeRecord struct {
+	ID     int64
+	Change Change
+}
+
+// ChangeLog 是排行榜的变更流，通过 Board.Watch 把 Record 注册为观察者即可开始记录
+type ChangeLog struct {
+	mu      sync.Mutex
+	records []ChangeRecord
+	// lastID 是最近一条变化的 ID，还没有任何变化时为 0
+	lastID int64
+}
+
+// Record 在持有排行榜写锁时被调用，把一次变化追加到变更流末尾，变更流最多保留 maxLen 条记录
+func (l *ChangeLog) Record(c Change, maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	if maxLen == 0 {
+		l.records = nil
+		return
+	}
+	records := append(l.records, ChangeRecord{l.lastID, c})
+	// 超出上限一倍时才整体搬移一次，平摊下来每条记录只复制一次
+	if len(records) >= 2*maxLen {
+		records = append([]ChangeRecord(nil), records[len(records)-maxLen:]...)
+	}
+	l.records = records
+}
+
+// LastID 返回最近一条变化的 ID，排行榜每变化一次加 1，可以用作榜单的版本号
+func (l *ChangeLog) LastID() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastID
+}
+
+// Since 返回 ID 大于 since 的最多 count 条变化（count 为 0 表示不限），maxLen 与 Record 的参数相同。
+// ok 为 false 表示 since 之后的部分变化已经被淘汰（或 since 超出了当前的最大 ID），下游需要重新全量同步
+func (l *ChangeLog) Since(since int64, count, maxLen int) (records []ChangeRecord, lastID int64, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lastID = l.lastID
+	if since > lastID {
+		return nil, lastID, false
+	}
+	all := l.records
+	if len(all) > maxLen {
+		all = all[len(all)-maxLen:]
+	}
+	first := lastID - int64(len(all)) + 1
+	if since+1 < first {
+		return nil, lastID, false
+	}
+	all = all[since+1-first:]
+	if count > 0 && len(all) > count {
+		all = all[:count]
+	}
+	return append([]ChangeRecord(nil), all...), lastID, true
+}
@@ -0,0 +1,92 @@
+package leaderboard
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// 用户分数历史。开启 leaderboard-history-max-len 后，当前排行榜上每个用户的每次分数提交（LBADD、LBINCRBY）
+// 都带上时间记录下来，每个用户最多保留最近的 leaderboard-history-max-len 条，更早的被覆盖，
+// 用 LBHISTORY 取出后可以画出用户的进度曲线，或者检查短时间内异常的分数跳变。
+// 历史只保存在内存中，用户被 LBREM 删除时一并删除，排行榜被清空（LBCLEAR、赛季轮换）时全部清空
+
+// HistoryEntry 是一次分数提交后用户的分数和名次
+type HistoryEntry struct {
+	Time  time.Time
+	Score int
+	Rank  int
+}
+
+// userHistory 是一个用户的环形缓冲区，写满之后 next 指向最早的一条
+type userHistory struct {
+	entries []HistoryEntry
+	next    int
+}
+
+// History 记录排行榜上每个用户的分数历史，通过 Board.Watch 把 Record 注册为观察者即可开始记录
+type History struct {
+	mu    sync.Mutex
+	users map[string]*userHistory
+}
+
+// Record 在持有排行榜写锁时被调用，把一次变化记入用户的历史，每个用户最多保留 maxLen 条，maxLen 为 0 时不记录
+func (h *History) Record(c Change, maxLen int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case maxLen == 0 || c.Cleared:
+		h.users = nil
+		return
+	case c.Removed:
+		delete(h.users, c.User)
+		return
+	}
+	if h.users == nil {
+		h.users = make(map[string]*userHistory)
+	}
+	u := h.users[c.User]
+	if u == nil {
+		u = &userHistory{}
+		h.users[c.User] = u
+	}
+	entry := HistoryEntry{Time: time.Now(), Score: c.Score, Rank: c.Rank}
+	if len(u.entries) > maxLen || len(u.entries) < maxLen && u.next != 0 {
+		// 运行时修改了上限，先按从旧到新重新排列，调小时只留下最近的 maxLen 条
+		entries := u.recent(min(len(u.entries), maxLen))
+		slices.Reverse(entries)
+		u.entries, u.next = entries, 0
+	}
+	if len(u.entries) < maxLen {
+		u.entries = append(u.entries, entry)
+		return
+	}
+	u.entries[u.next] = entry
+	u.next = (u.next + 1) % len(u.entries)
+}
+
+// Get 返回用户最近的最多 count 条历史（count 为 0 表示不限），从新到旧排列，maxLen 与 Record 的参数相同
+func (h *History) Get(user string, count, maxLen int) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	u := h.users[user]
+	if u == nil || maxLen == 0 {
+		return nil
+	}
+	n := min(len(u.entries), maxLen)
+	if count > 0 {
+		n = min(n, count)
+	}
+	return u.recent(n)
+}
+
+// recent 返回最近的 n 条历史，从新到旧排列
+func (u *userHistory) recent(n int) []HistoryEntry {
+	out := make([]HistoryEntry, 0, n)
+	for i := 0; i < n; i++ {
+		// 最新的一条在 next 之前
+		j := (u.next - 1 - i + 2*len(u.entries)) % len(u.entries)
+		out = append(out, u.entries[j])
+	}
+	return out
+}
@@ -0,0 +1,347 @@
+// Package leaderboard 实现排行榜：按分数排名的用户集合、赛季归档以及变更流
+package leaderboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy 是排行榜对分数更新的约束：分数被截断到 [MinScore, MaxScore]；
+// MaxDelta 大于 0 时，已在榜上的用户单次更新使分数变化超过该值的提交会被拒绝（用户的第一次提交不检查）；
+// MaxUpdatesPerSec 大于 0 时，同一用户每秒最多提交这么多次更新
+type Policy struct {
+	MinScore         int
+	MaxScore         int
+	MaxDelta         int
+	MaxUpdatesPerSec int
+}
+
+func (p Policy) clamp(score int) int {
+	return max(p.MinScore, min(p.MaxScore, score))
+}
+
+// MaxMetaLen 是单个用户元数据的最大长度
+const MaxMetaLen = 1024
+
+// ValidateMeta 检查元数据是否是不超过 MaxMetaLen 的 JSON 对象，
+// 例如 {"name":"Alice","avatar":"https://...","region":"EU"}
+func ValidateMeta(meta string) error {
+	if len(meta) > MaxMetaLen {
+		return fmt.Errorf("ERR metadata must not exceed %d bytes", MaxMetaLen)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(meta), &obj); err != nil || obj == nil {
+		return errors.New("ERR metadata must be a JSON object")
+	}
+	return nil
+}
+
+// ErrDelta 和 ErrRate 是分数提交违反 Policy 时返回的错误
+var (
+	ErrDelta = errors.New("ERR score change exceeds leaderboard-max-delta")
+	ErrRate  = errors.New("ERR too many score updates for this user, see leaderboard-max-updates-per-second")
+)
+
+// Change 描述排行榜的一次变化：用户的分数或元数据被更新（Rank 为更新后的名次），
+// 用户被移除（Removed），或者整个榜单被清空（Cleared，此时其余字段为空）
+type Change struct {
+	User    string
+	Score   int
+	Rank    int
+	Meta    string
+	Removed bool
+	Cleared bool
+}
+
+// Watch 注册一个排行榜变化的观察者，只能在处理命令之前调用。
+// 观察者在排行榜每次变化后被调用，调用时持有排行榜的写锁，因此观察者不能阻塞，也不能再访问排行榜
+func (b *Board) Watch(fn func(c Change)) {
+	b.watchers = append(b.watchers, fn)
+}
+
+// notifyLocked 把一次变化通知给所有观察者，调用方需持有写锁
+func (b *Board) notifyLocked(c Change) {
+	for _, fn := range b.watchers {
+		fn(c)
+	}
+}
+
+// notifyUpdateLocked 通知用户的分数或元数据已更新，调用方需持有写锁
+func (b *Board) notifyUpdateLocked(user string) {
+	if len(b.watchers) == 0 {
+		return
+	}
+	score := b.scores[user]
+	b.notifyLocked(Change{User: user, Score: score, Rank: b.zsl.rank(user, score), Meta: b.meta[user]})
+}
+
+// rate 记录用户在当前一秒窗口内提交的更新次数
+type rate struct {
+	window int64
+	count  int
+}
+
+// before 判断用户 a 是否排在用户 b 前面：分数高的在前，分数相同时按用户名升序，与 LBTOP 的顺序一致
+func before(userA string, scoreA int, userB string, scoreB int) bool {
+	if scoreA != scoreB {
+		return scoreA > scoreB
+	}
+	return userA < userB
+}
+
+// Entry 是排行榜中的一个用户及其分数，Meta 是用户附带的元数据（JSON 对象，没有时为空）
+type Entry struct {
+	User  string
+	Score int
+	Meta  string
+}
+
+// Board 是一个排行榜：scores 用于按用户查分数，zsl 按名次保存所有用户，
+// 因此查名次、按名次取区间和按分数计数都是 O(log n)（取区间另加返回的条数）
+type Board struct {
+	// Validator 是可选的反作弊钩子，在内置检查通过后、分数写入前调用。
+	// exists 为 false 表示用户第一次提交，此时 old 为最低分；返回错误时本次更新被拒绝，错误信息原样回复给客户端
+	Validator func(user string, old, new int, exists bool) error
+
+	mu     sync.RWMutex
+	scores map[string]int
+	zsl    *skiplist
+	rates  map[string]*rate
+	// meta 保存用户通过 LBADD ... META 附带的元数据
+	meta     map[string]string
+	watchers []func(c Change)
+}
+
+// NewBoard 创建一个空的排行榜
+func NewBoard() *Board {
+	return &Board{
+		scores: make(map[string]int),
+		zsl:    newSkiplist(),
+		rates:  make(map[string]*rate),
+		meta:   make(map[string]string),
+	}
+}
+
+// Len 返回排行榜中的用户数
+func (b *Board) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.zsl.length
+}
+
+// setLocked 设置用户的分数，调用方需持有写锁
+func (b *Board) setLocked(user string, score int) {
+	if old, ok := b.scores[user]; ok {
+		if old == score {
+			return
+		}
+		b.zsl.delete(user, old)
+	}
+	b.scores[user] = score
+	b.zsl.insert(user, score)
+}
+
+// Restore 直接写入用户的分数和元数据，不做任何检查，用于从快照载入
+func (b *Board) Restore(user string, score int, meta string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setLocked(user, score)
+	if meta != "" {
+		b.meta[user] = meta
+	}
+}
+
+// updateLocked 按 policy 检查并写入一次分数提交，调用方需持有写锁。
+// newScore 根据用户当前的分数（用户不存在时为最低分）计算提交后的分数
+func (b *Board) updateLocked(user string, p Policy, newScore func(old int) int) (int, error) {
+	old, exists := b.scores[user]
+	if !exists {
+		old = p.MinScore
+	}
+	score := p.clamp(newScore(old))
+	// 新用户没有旧分数可以比较，第一次提交不检查分数变化
+	if p.MaxDelta > 0 && exists && abs(score-old) > p.MaxDelta {
+		return 0, ErrDelta
+	}
+	if p.MaxUpdatesPerSec > 0 {
+		now := time.Now().Unix()
+		r := b.rates[user]
+		if r == nil {
+			r = &rate{}
+			b.rates[user] = r
+		}
+		if r.window != now {
+			r.window, r.count = now, 0
+		}
+		if r.count >= p.MaxUpdatesPerSec {
+			return 0, ErrRate
+		}
+		r.count++
+	}
+	if b.Validator != nil {
+		if err := b.Validator(user, old, score, exists); err != nil {
+			return 0, err
+		}
+	}
+	b.setLocked(user, score)
+	return score, nil
+}
+
+// Set 按 p 设置用户的分数，分数会被截断到合法范围内。meta 非空时同时替换用户的元数据，为空时保留原有的元数据
+func (b *Board) Set(user string, score int, meta string, p Policy) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.updateLocked(user, p, func(int) int { return score }); err != nil {
+		return err
+	}
+	if meta != "" {
+		b.meta[user] = meta
+	}
+	b.notifyUpdateLocked(user)
+	return nil
+}
+
+// Incr 把用户的分数加上 delta 并返回新分数，用户不存在时视为从最低分开始
+func (b *Board) Incr(user string, delta int, p Policy) (int, error) {
+	// 分数本身在 [min, max] 之内，把 delta 先截断到 ±(max-min) 不会改变结果，还能避免相加溢出
+	span := p.MaxScore - p.MinScore
+	delta = max(-span, min(span, delta))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	score, err := b.updateLocked(user, p, func(old int) int { return old + delta })
+	if err == nil {
+		b.notifyUpdateLocked(user)
+	}
+	return score, err
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Score 返回用户当前的分数
+func (b *Board) Score(user string) (int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	score, ok := b.scores[user]
+	return score, ok
+}
+
+// Rank 返回用户的名次（第一名为 1）以及排行榜的总人数
+func (b *Board) Rank(user string) (rank, total int, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	score, ok := b.scores[user]
+	if !ok {
+		return 0, 0, false
+	}
+	return b.zsl.rank(user, score), b.zsl.length, true
+}
+
+// Entry 返回用户的分数、元数据以及名次
+func (b *Board) Entry(user string) (Entry, int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	score, ok := b.scores[user]
+	if !ok {
+		return Entry{}, 0, false
+	}
+	return Entry{user, score, b.meta[user]}, b.zsl.rank(user, score), true
+}
+
+// Remove 移除用户，返回用户此前是否存在
+func (b *Board) Remove(user string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	score, ok := b.scores[user]
+	if ok {
+		delete(b.scores, user)
+		delete(b.rates, user)
+		delete(b.meta, user)
+		b.zsl.delete(user, score)
+		b.notifyLocked(Change{User: user, Score: score, Removed: true})
+	}
+	return ok
+}
+
+// Drain 按名次取出所有用户并清空排行榜
+func (b *Board) Drain() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := b.rangeLocked(0, b.zsl.length-1)
+	b.scores, b.zsl = make(map[string]int), newSkiplist()
+	b.rates, b.meta = make(map[string]*rate), make(map[string]string)
+	b.notifyLocked(Change{Cleared: true})
+	return entries
+}
+
+// Range 返回名次下标在 [start, stop] 之间的用户（第一名下标为 0，负数表示从末尾倒数）
+func (b *Board) Range(start, stop int) []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	start, stop, ok := NormalizeRange(start, stop, b.zsl.length)
+	if !ok {
+		return nil
+	}
+	return b.rangeLocked(start, stop)
+}
+
+// rangeLocked 返回下标在 [start, stop] 之间的用户，调用方保证下标合法并持有锁
+func (b *Board) rangeLocked(start, stop int) []Entry {
+	if start > stop {
+		return nil
+	}
+	entries := make([]Entry, 0, stop-start+1)
+	for x := b.zsl.byRank(start + 1); x != nil && len(entries) < cap(entries); x = x.level[0].forward {
+		entries = append(entries, Entry{x.user, x.score, b.meta[x.user]})
+	}
+	return entries
+}
+
+// Around 返回排在用户前后各 n 名以内的用户，以及其中第一个用户的名次（第一名为 1）
+func (b *Board) Around(user string, n int) ([]Entry, int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	score, ok := b.scores[user]
+	if !ok {
+		return nil, 0, false
+	}
+	idx := b.zsl.rank(user, score) - 1
+	// n 可以是任意大的整数，先限制在榜单长度以内，避免 idx±n 溢出
+	n = min(n, b.zsl.length)
+	start, stop := max(idx-n, 0), min(idx+n, b.zsl.length-1)
+	return b.rangeLocked(start, stop), start + 1, true
+}
+
+// Count 返回分数在 lo 与 hi 之间的用户数，loExcl / hiExcl 表示对应边界为开区间
+func (b *Board) Count(lo int, loExcl bool, hi int, hiExcl bool) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	// 跳表按分数降序排列：先数出分数高于上界的用户，再数出分数不低于下界的用户，两者之差即为区间内的用户数
+	above := b.zsl.countWhile(func(x *skiplistNode) bool {
+		return x.score > hi || (hiExcl && x.score == hi)
+	})
+	atLeastLo := b.zsl.countWhile(func(x *skiplistNode) bool {
+		return x.score > lo || (!loExcl && x.score == lo)
+	})
+	return max(atLeastLo-above, 0)
+}
+
+// NormalizeRange 把可能为负的下标换算为 [0, n) 内的闭区间，区间为空时返回 false
+func NormalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop, n-1)
+	return start, stop, start <= stop
+}
@@ -0,0 +1,52 @@
+package leaderboard
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var testPolicy = Policy{MinScore: 0, MaxScore: 1 << 30}
+
+// TestAround 检查 Around 在 n 超过榜单长度（包括最大的整数）时返回整个榜单
+func TestAround(t *testing.T) {
+	b := NewBoard()
+	for i := 1; i <= 5; i++ {
+		if err := b.Set("u"+strconv.Itoa(i), i*10, "", testPolicy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		n, want, first int
+	}{
+		{0, 1, 3},
+		{1, 3, 2},
+		{5, 5, 1},
+		{math.MaxInt, 5, 1},
+	}
+	for _, tt := range tests {
+		entries, first, ok := b.Around("u3", tt.n)
+		if !ok || len(entries) != tt.want || first != tt.first {
+			t.Errorf("Around(u3, %d) = %d entries from rank %d, want %d from rank %d", tt.n, len(entries), first, tt.want, tt.first)
+		}
+	}
+}
+
+// TestMaxDelta 检查 MaxDelta 只限制已在榜上的用户的分数变化，新用户的第一次提交不受限制
+func TestMaxDelta(t *testing.T) {
+	b := NewBoard()
+	p := testPolicy
+	p.MaxDelta = 100
+	if err := b.Set("new", 5000, "", p); err != nil {
+		t.Fatalf("first submission of 5000: %v", err)
+	}
+	if err := b.Set("new", 5100, "", p); err != nil {
+		t.Fatalf("change of 100: %v", err)
+	}
+	if err := b.Set("new", 5201, "", p); err != ErrDelta {
+		t.Fatalf("change of 101: err = %v, want ErrDelta", err)
+	}
+	if score, _ := b.Score("new"); score != 5100 {
+		t.Fatalf("score after a rejected change = %d, want 5100", score)
+	}
+}
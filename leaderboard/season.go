@@ -0,0 +1,129 @@
+package leaderboard
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 排行榜赛季。配置 leaderboard-season 后，每到一个新的周期（天 / ISO 周 / 月），
+// 当前排行榜会被归档为一个以赛季命名的只读榜单（如 lb:2024w07），随后从空榜开始新赛季。
+// 归档榜单保存在内存中，并随快照一起持久化
+
+// Archive 是一个已经结束的赛季的最终排名
+type Archive struct {
+	Name      string
+	CreatedAt time.Time
+	Entries   []Entry // 按名次排序，归档后不再修改
+}
+
+// Seasons 管理一个排行榜的赛季：当前赛季名以及按归档时间排列的归档榜单
+type Seasons struct {
+	board *Board
+
+	mu sync.Mutex
+	// current 是当前赛季的名称，未开启赛季时为空
+	current  string
+	archives []*Archive
+}
+
+// NewSeasons 创建排行榜 b 的赛季管理，初始时未开启赛季
+func NewSeasons(b *Board) *Seasons {
+	return &Seasons{board: b}
+}
+
+// SeasonName 返回时间 t 所在赛季的名称，schedule 为 none 时返回空字符串
+func SeasonName(schedule string, t time.Time) string {
+	switch schedule {
+	case "daily":
+		return "lb:" + t.Format("2006-01-02")
+	case "weekly":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("lb:%04dw%02d", year, week)
+	case "monthly":
+		return "lb:" + t.Format("2006-01")
+	}
+	return ""
+}
+
+// Current 返回当前赛季的名称，未开启赛季时为空
+func (s *Seasons) Current() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Restore 写入从快照载入的当前赛季名
+func (s *Seasons) Restore(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = name
+}
+
+// AddArchive 追加一个从快照载入的归档榜单
+func (s *Seasons) AddArchive(a *Archive) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archives = append(s.archives, a)
+}
+
+// Archives 按归档时间返回所有归档榜单，归档榜单本身是只读的
+func (s *Seasons) Archives() []*Archive {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Archive(nil), s.archives...)
+}
+
+// Find 按名称查找归档榜单，找不到时返回 nil
+func (s *Seasons) Find(name string) *Archive {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findLocked(name)
+}
+
+// Advance 把当前赛季切换为 name（时间所在赛季的名称，见 SeasonName）。
+// 已经处在某个赛季且 name 与之不同时（包括停机期间跨过了赛季边界），先归档当前排行榜并返回归档
+func (s *Seasons) Advance(name string, now time.Time) *Archive {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var archive *Archive
+	if s.current != "" && name != s.current {
+		archive = s.archiveLocked(s.current, now)
+	}
+	s.current = name
+	return archive
+}
+
+// Rotate 立即结束当前赛季并归档，未开启赛季时以当前时间命名归档
+func (s *Seasons) Rotate(now time.Time) *Archive {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := s.current
+	if name == "" {
+		name = "lb:" + now.Format("2006-01-02T15:04:05")
+	}
+	return s.archiveLocked(name, now)
+}
+
+// archiveLocked 把当前排行榜移入名为 name 的归档榜单并清空排行榜，调用方需持有 s.mu
+func (s *Seasons) archiveLocked(name string, now time.Time) *Archive {
+	entries := s.board.Drain()
+	// 同一个赛季被手动轮换过时，后续归档加上序号以免重名
+	unique := name
+	for i := 2; s.findLocked(unique) != nil; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	archive := &Archive{Name: unique, CreatedAt: now, Entries: entries}
+	s.archives = append(s.archives, archive)
+	return archive
+}
+
+func (s *Seasons) findLocked(name string) *Archive {
+	for _, a := range s.archives {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
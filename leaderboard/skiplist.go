@@ -0,0 +1,168 @@
+package leaderboard
+
+import "math/rand"
+
+// 跳表参数与 Redis zskiplist 相同：每个节点以 1/4 的概率多一层，最多 32 层
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+// skiplistNode 是跳表中的一个用户。level[i].span 记录第 i 层指针跨过的节点数，用于 O(log n) 计算名次
+type skiplistNode struct {
+	user     string
+	score    int
+	backward *skiplistNode
+	level    []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+// skiplist 按排行榜的名次顺序（分数降序，分数相同按用户名升序，见 before）保存用户，
+// 插入、删除、按名次定位以及计算名次都是 O(log n)
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{level: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// nodeBefore 判断节点 x 是否排在 (user, score) 之前
+func nodeBefore(x *skiplistNode, user string, score int) bool {
+	return before(x.user, x.score, user, score)
+}
+
+// insert 插入一个用户，调用方保证该用户当前不在跳表中
+func (sl *skiplist) insert(user string, score int) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, user, score) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	level := randomSkiplistLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+	x = &skiplistNode{user: user, score: score, level: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+}
+
+// delete 删除 (user, score) 对应的节点，返回节点是否存在
+func (sl *skiplist) delete(user string, score int) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && nodeBefore(x.level[i].forward, user, score) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x == nil || x.user != user || x.score != score {
+		return false
+	}
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// countWhile 返回从头开始连续满足 pred 的节点个数。pred 必须对名次单调：
+// 对某个节点成立时对排在它之前的所有节点也成立
+func (sl *skiplist) countWhile(pred func(x *skiplistNode) bool) int {
+	n := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && pred(x.level[i].forward) {
+			n += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	return n
+}
+
+// rank 返回 (user, score) 的名次，第一名为 1。调用方保证该用户在跳表中
+func (sl *skiplist) rank(user string, score int) int {
+	return sl.countWhile(func(x *skiplistNode) bool { return nodeBefore(x, user, score) }) + 1
+}
+
+// byRank 返回名次为 rank（从 1 开始）的节点，超出范围时返回 nil
+func (sl *skiplist) byRank(rank int) *skiplistNode {
+	if rank < 1 || rank > sl.length {
+		return nil
+	}
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package logfile 把运行日志写入 logfile 配置的文件并按大小、时间轮转，没有配置时写到标准错误；
+// 还可以同时发送到 syslog 和 systemd journal，见 syslog.go
+package logfile
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 轮转规则：
+//
+//	logfile-max-size         文件写满该大小后轮转，0 表示不按大小轮转
+//	logfile-rotate           hourly / daily：每到新的一小时 / 一天轮转，none 表示不按时间轮转
+//	logfile-max-files        最多保留的旧文件个数，更早的文件被删除，0 表示全部保留
+//
+// 轮转时把当前文件改名为 <logfile>.<YYYYMMDD-HHMMSS>（文件开始写入的时间，同名时再加 -1、-2 ...）并重新打开 logfile。
+// 每次写入时读取当前配置，运行时修改 logfile 后下一条日志写入新文件。
+// 使用 logrotate 等外部工具轮转时，改名后调用 Reopen（cmd/redis-easy 在收到 SIGHUP 时调用）
+
+// rotatedTimeFormat 是轮转后文件名中的时间格式
+const rotatedTimeFormat = "20060102-150405"
+
+// Writer 是写入日志文件的 io.Writer，可以并发使用，零值即可使用
+type Writer struct {
+	mu     sync.Mutex
+	path   string // 当前打开的文件，为空表示写到标准错误
+	file   *os.File
+	size   int64
+	opened time.Time // 当前文件开始写入的时间
+	reopen bool
+
+	syslog  socketTarget
+	journal socketTarget
+}
+
+// Write 写入一条日志，写入文件之前按需打开或轮转文件。文件打不开时写到标准错误，不返回错误，
+// 避免 log 包的调用方因为日志写不进去而失败
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cfg := config.Get()
+	if w.reopen {
+		w.syslog.reset()
+		w.journal.reset()
+	}
+	if cfg.LogFile != w.path || w.reopen {
+		w.open(cfg.LogFile)
+	}
+	msg := stripLogPrefix(p)
+	if cfg.SyslogEnabled == "yes" {
+		w.syslog.send("syslog", dialSyslog, formatSyslog(cfg, severityOf(msg), msg))
+	} else {
+		w.syslog.reset()
+	}
+	if cfg.JournaldEnabled == "yes" {
+		w.journal.send("systemd journal", dialJournal, formatJournal(cfg, severityOf(msg), msg))
+	} else {
+		w.journal.reset()
+	}
+	if w.file == nil {
+		if w.path == "" && (cfg.SyslogEnabled == "yes" || cfg.JournaldEnabled == "yes") {
+			return len(p), nil
+		}
+		return os.Stderr.Write(p)
+	}
+	now := time.Now()
+	if w.size > 0 && (cfg.LogFileMaxSize > 0 && w.size+int64(len(p)) > cfg.LogFileMaxSize ||
+		rotatePeriod(cfg.LogFileRotate, w.opened) != rotatePeriod(cfg.LogFileRotate, now)) {
+		w.rotate(cfg.LogFileMaxFiles)
+		if w.file == nil {
+			return os.Stderr.Write(p)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing log file %s: %v\n", w.path, err)
+		os.Stderr.Write(p[n:])
+	}
+	return len(p), nil
+}
+
+// Reopen 在下一次写入时重新打开日志文件，并重新连接 syslog 和 journal
+func (w *Writer) Reopen() {
+	w.mu.Lock()
+	w.reopen = true
+	w.mu.Unlock()
+}
+
+// Close 关闭打开的日志文件以及到 syslog、journal 的连接，之后的写入重新打开它们
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syslog.reset()
+	w.journal.reset()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file, w.path = nil, ""
+	return err
+}
+
+// open 关闭当前文件，以追加方式打开 path，path 为空时之后写到标准错误。调用方需持有 w.mu
+func (w *Writer) open(path string) {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	w.path, w.reopen, w.size = path, false, 0
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log file %s: %v\n", path, err)
+		return
+	}
+	w.file, w.opened = f, time.Now()
+	// 接着写入已有的文件时，按文件原来的大小和最后修改时间判断是否需要轮转
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		w.size, w.opened = info.Size(), info.ModTime()
+	}
+}
+
+// rotate 把当前文件改名后重新打开 logfile，并删除超出 maxFiles 的旧文件。调用方需持有 w.mu
+func (w *Writer) rotate(maxFiles int) {
+	path := w.path
+	w.file.Close()
+	w.file = nil
+	rotated := path + "." + w.opened.Format(rotatedTimeFormat)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%s.%s-%d", path, w.opened.Format(rotatedTimeFormat), i)
+	}
+	if err := os.Rename(path, rotated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rotating log file %s: %v\n", path, err)
+	}
+	w.open(path)
+	if maxFiles > 0 {
+		removeOldFiles(path, maxFiles)
+	}
+}
+
+// rotatePeriod 返回 t 所在的轮转周期，周期不同时需要轮转
+func rotatePeriod(rotate string, t time.Time) string {
+	switch rotate {
+	case "hourly":
+		return t.Format("2006010215")
+	case "daily":
+		return t.Format("20060102")
+	}
+	return ""
+}
+
+// removeOldFiles 只保留 path 最新的 maxFiles 个旧文件
+func removeOldFiles(path string, maxFiles int) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return
+	}
+	type rotatedFile struct {
+		name string
+		time string // 文件名中的时间，按字典序排列就是时间顺序
+		seq  int
+	}
+	var rotated []rotatedFile
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || len(suffix) < len(rotatedTimeFormat) {
+			continue
+		}
+		f := rotatedFile{name: e.Name(), time: suffix[:len(rotatedTimeFormat)]}
+		if _, err := time.Parse(rotatedTimeFormat, f.time); err != nil {
+			continue
+		}
+		if rest := suffix[len(rotatedTimeFormat):]; rest != "" {
+			seq, err := strconv.Atoi(strings.TrimPrefix(rest, "-"))
+			if err != nil || !strings.HasPrefix(rest, "-") {
+				continue
+			}
+			f.seq = seq
+		}
+		rotated = append(rotated, f)
+	}
+	if len(rotated) <= maxFiles {
+		return
+	}
+	slices.SortFunc(rotated, func(a, b rotatedFile) int {
+		return cmp.Or(strings.Compare(a.time, b.time), a.seq-b.seq)
+	})
+	for _, f := range rotated[:len(rotated)-maxFiles] {
+		if err := os.Remove(filepath.Join(dir, f.name)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing old log file %s: %v\n", f.name, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package logfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 集中收集日志的环境中，运行日志可以同时发送到本机的 syslog 和 systemd journal：
+//
+//	syslog-enabled yes     以 syslog-facility、syslog-ident 发送到本机的 syslog（/dev/log 等 unix socket）
+//	journald-enabled yes   以 syslog-ident 为 SYSLOG_IDENTIFIER 发送到 systemd journal
+//
+// 两者都是在 logfile 之外额外输出；开启其中之一并且 logfile 为空时不再写到标准错误，
+// 避免在 systemd 下运行时标准错误也被 journal 收集而重复。
+// 日志行开头 log 包写入的时间戳由 syslog / journal 自己记录，发送前去掉。
+// 以 WARNING 或 Error 开头的日志以 warning 级别发送，其他日志以 notice 级别发送。
+// socket 连不上时在标准错误上提示一次，之后不再尝试，直到 Reopen 或者关闭后重新开启
+
+// syslogSockets 是本机 syslog 可能监听的 unix socket，与 log/syslog 相同
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// journalSocket 是 systemd journal 接收日志的 socket
+const journalSocket = "/run/systemd/journal/socket"
+
+// syslogFacilities 是 syslog-facility 的取值对应的 facility 编号
+var syslogFacilities = map[string]int{
+	"user": 1, "daemon": 3,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslog 的日志级别
+const (
+	severityWarning = 4
+	severityNotice  = 5
+)
+
+// socketTarget 是到 syslog 或 journal 的连接
+type socketTarget struct {
+	conn net.Conn
+	// failed 为 true 表示上次没有连上，不再尝试，reset 时清除
+	failed bool
+}
+
+// send 发送一条日志，连接断开时（例如 syslog 重启）重新连接一次再发送
+func (t *socketTarget) send(name string, dial func() (net.Conn, error), msg []byte) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if t.conn == nil {
+			if t.failed {
+				return
+			}
+			conn, err := dial()
+			if err != nil {
+				t.failed = true
+				fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", name, err)
+				return
+			}
+			t.conn = conn
+		}
+		if _, err := t.conn.Write(msg); err == nil {
+			return
+		}
+		t.close()
+	}
+}
+
+func (t *socketTarget) close() {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// reset 关闭连接并清除 failed，下次发送时重新连接
+func (t *socketTarget) reset() {
+	t.close()
+	t.failed = false
+}
+
+// dialSyslog 连接本机的 syslog
+func dialSyslog() (net.Conn, error) {
+	var err error
+	for _, path := range syslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			if conn, err = net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// dialJournal 连接 systemd journal
+func dialJournal() (net.Conn, error) {
+	return net.Dial("unixgram", journalSocket)
+}
+
+// formatSyslog 按 RFC 3164 的格式生成发送给本机 syslog 的一条日志
+func formatSyslog(cfg *config.Config, severity int, msg []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>%s %s[%d]: ", syslogFacilities[cfg.SyslogFacility]*8+severity,
+		time.Now().Format(time.Stamp), cfg.SyslogIdent, os.Getpid())
+	b.Write(msg)
+	return b.Bytes()
+}
+
+// formatJournal 按 journal 的原生协议生成一条日志：每个字段一行 KEY=value，
+// 值中含有换行时写成 KEY、换行、8 字节小端长度、值
+func formatJournal(cfg *config.Config, severity int, msg []byte) []byte {
+	var b bytes.Buffer
+	field := func(key string, value []byte) {
+		b.WriteString(key)
+		if bytes.IndexByte(value, '\n') < 0 {
+			b.WriteByte('=')
+		} else {
+			b.WriteByte('\n')
+			binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		}
+		b.Write(value)
+		b.WriteByte('\n')
+	}
+	field("MESSAGE", msg)
+	field("PRIORITY", []byte(strconv.Itoa(severity)))
+	field("SYSLOG_IDENTIFIER", []byte(cfg.SyslogIdent))
+	field("SYSLOG_FACILITY", []byte(strconv.Itoa(syslogFacilities[cfg.SyslogFacility])))
+	field("SYSLOG_PID", []byte(strconv.Itoa(os.Getpid())))
+	return b.Bytes()
+}
+
+// stripLogPrefix 去掉 log 包在日志行开头写入的 "2006/01/02 15:04:05 " 时间戳和末尾的换行
+func stripLogPrefix(p []byte) []byte {
+	const layout = "2006/01/02 15:04:05"
+	if len(p) > len(layout) && p[len(layout)] == ' ' {
+		if _, err := time.Parse(layout, string(p[:len(layout)])); err == nil {
+			p = p[len(layout)+1:]
+		}
+	}
+	return bytes.TrimSuffix(p, []byte("\n"))
+}
+
+// severityOf 按日志内容估计 syslog 的日志级别
+func severityOf(msg []byte) int {
+	if bytes.HasPrefix(msg, []byte("WARNING")) || bytes.HasPrefix(msg, []byte("Error")) {
+		return severityWarning
+	}
+	return severityNotice
+}
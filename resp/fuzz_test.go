@@ -0,0 +1,135 @@
+package resp
+
+// 原生的模糊测试，go test 时用种子语料运行一遍，需要持续变异时单独运行其中一个，例如：
+//
+//	go test ./resp -run '^$' -fuzz FuzzReadCommand
+//
+// testdata/fuzz/corpus 是初始语料，收集了各种格式错误的请求和回复，每个文件是一个原样的输入，
+// 所有模糊测试都以它们为种子；太大不适合放进仓库的种子在 addSeeds 中生成。
+// 发现的崩溃由 go test 写入 testdata/fuzz/<测试名>，之后的 go test 会一直回放它
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fuzzLimits 使用 proto-max-bulk-len 的默认值，同时保证语料中超过限制的长度依然会被拒绝
+var fuzzLimits = Limits{MaxMultibulkLen: 1024 * 1024, MaxBulkLen: 512 * 1024 * 1024}
+
+// addSeeds 把 testdata/fuzz/corpus 中的每个文件加入种子语料
+func addSeeds(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "fuzz", "corpus", "*"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	// 嵌套过深的数组回复
+	f.Add(bytes.Repeat([]byte("*1\r\n"), 50000))
+}
+
+// FuzzReadCommand 把输入当作客户端发送的请求流解析。解析出的每条命令重新编码为 RESP 数组后
+// 必须能解析回完全相同的参数
+func FuzzReadCommand(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		for {
+			args, err := ReadCommand(r, fuzzLimits)
+			if err != nil {
+				return
+			}
+			if args == nil {
+				continue
+			}
+			again, err := ReadCommand(bufio.NewReader(bytes.NewReader(EncodeCommand(args))), fuzzLimits)
+			if err != nil {
+				t.Fatalf("re-encoded command %q does not parse: %v", args, err)
+			}
+			if !slices.Equal(args, again) {
+				t.Fatalf("re-encoded command %q parses to %q", args, again)
+			}
+		}
+	})
+}
+
+// FuzzReadValue 把输入当作服务端的回复流解析，只检查不会崩溃或无限制地分配内存
+func FuzzReadValue(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		for {
+			if _, err := ReadValue(r); err != nil {
+				if _, ok := err.(Error); !ok {
+					return
+				}
+			}
+		}
+	})
+}
+
+// FuzzWriter 检查回复编码：把输入按 0 字节切分为若干字符串，分别以批量字符串和错误回复输出，
+// 读回的批量字符串必须与原值相同，错误回复必须仍是单独的一行，不会破坏后续回复的格式。
+// 单行回复与请求头一样受 MaxInlineSize 限制，超长的字符串只作为批量字符串输出
+func FuzzWriter(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		items := strings.Split(string(data), "\x00")
+		var lines []string
+		for _, item := range items {
+			if len(item) < MaxInlineSize-8 {
+				lines = append(lines, item)
+			}
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteArrayHeader(len(items))
+		for _, item := range items {
+			w.WriteBulk(item)
+		}
+		for _, item := range lines {
+			w.WriteError("ERR " + item)
+			w.WriteInteger(len(item))
+		}
+		w.Flush()
+		w.Release()
+
+		r := bufio.NewReader(&buf)
+		v, err := ReadValue(r)
+		if err != nil {
+			t.Fatalf("bulk array does not parse: %v", err)
+		}
+		arr, ok := v.([]interface{})
+		if !ok || len(arr) != len(items) {
+			t.Fatalf("bulk array of %d items parses to %v", len(items), v)
+		}
+		for i, item := range items {
+			if s, _ := arr[i].(string); s != item {
+				t.Fatalf("bulk string %q parses to %q", item, s)
+			}
+		}
+		for _, item := range lines {
+			if _, err := ReadValue(r); err == nil {
+				t.Fatalf("error reply for %q parses as a value", item)
+			} else if e, ok := err.(Error); !ok || strings.ContainsAny(string(e), "\r\n") {
+				t.Fatalf("error reply for %q is not a single line: %v", item, err)
+			}
+			if n, err := ReadValue(r); err != nil || n != int64(len(item)) {
+				t.Fatalf("reply stream out of sync after the error reply for %q", item)
+			}
+		}
+		if r.Buffered() != 0 {
+			t.Fatal("trailing data after replies")
+		}
+	})
+}
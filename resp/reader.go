@@ -0,0 +1,259 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ProtocolError 表示客户端发送的请求无法解析，服务端回复错误后关闭连接
+type ProtocolError string
+
+func (e ProtocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// Limits 是解析请求时的长度限制，对应 proto-max-multibulk-len 和 proto-max-bulk-len
+type Limits struct {
+	MaxMultibulkLen int64
+	MaxBulkLen      int64
+}
+
+// ReadCommand 解析客户端发送的命令，支持 RESP 和 inline 格式
+func ReadCommand(reader *bufio.Reader, limits Limits) ([]string, error) {
+	prefix, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix[0] == '*' {
+		// RESP 数组格式
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		count, convErr := strconv.ParseInt(string(line[1:]), 10, 64)
+		if convErr != nil || count > limits.MaxMultibulkLen {
+			return nil, ProtocolError("invalid multibulk length")
+		}
+		if count <= 0 {
+			// *0 与 *-1 都表示空命令，直接忽略
+			return nil, nil
+		}
+		// 元素个数由客户端声明，不能据此一次性预分配
+		args := make([]string, 0, min(count, 1024))
+		for i := int64(0); i < count; i++ {
+			lengthLine, err := readLine(reader)
+			if err != nil {
+				return nil, err
+			}
+			if len(lengthLine) == 0 || lengthLine[0] != '$' {
+				return nil, ProtocolError(fmt.Sprintf("expected '$', got '%s'", truncateForError(lengthLine)))
+			}
+			bulkLen, err := strconv.ParseInt(string(lengthLine[1:]), 10, 64)
+			if err != nil || bulkLen < 0 || bulkLen > limits.MaxBulkLen {
+				return nil, ProtocolError("invalid bulk length")
+			}
+			data, err := readBulkData(reader, bulkLen)
+			if err != nil {
+				return nil, err
+			}
+			if err := readCRLF(reader); err != nil {
+				return nil, err
+			}
+			args = append(args, string(data))
+		}
+		return args, nil
+	} else {
+		// inline 格式
+		line, err := readLine(reader)
+		if err != nil {
+			if err == errLineTooLong {
+				return nil, ProtocolError("too big inline request")
+			}
+			return nil, err
+		}
+		return SplitInlineArgs(line)
+	}
+}
+
+// MaxInlineSize 是 inline 命令以及 RESP 头部行允许的最大长度，与 Redis 的 PROTO_INLINE_MAX_SIZE 一致
+const MaxInlineSize = 64 * 1024
+
+var errLineTooLong = ProtocolError("too big count string")
+
+// readLine 读取一行并去掉行尾的 \r\n（或 \n），行长度超过 MaxInlineSize 时返回协议错误，
+// 防止客户端发送不带换行的超长数据耗尽内存
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MaxInlineSize {
+			return nil, errLineTooLong
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line, nil
+}
+
+// bulkPreallocLimit 以内的批量数据按声明长度一次性分配，更大的数据随读取进度逐步扩容，
+// 这样声明了超大长度却迟迟不发送数据的客户端无法让服务端提前分配大块内存
+const bulkPreallocLimit = 64 * 1024
+
+func readBulkData(reader *bufio.Reader, n int64) ([]byte, error) {
+	if n <= bulkPreallocLimit {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(bulkPreallocLimit)
+	if _, err := io.CopyN(&buf, reader, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readCRLF 读取批量数据后面必须紧跟的 CRLF
+func readCRLF(reader *bufio.Reader) error {
+	var crlf [2]byte
+	if _, err := io.ReadFull(reader, crlf[:]); err != nil {
+		return err
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return ProtocolError("expected CRLF after bulk data")
+	}
+	return nil
+}
+
+// truncateForError 截断写入错误信息中的客户端数据，避免错误回复过长
+func truncateForError(b []byte) string {
+	if len(b) > 32 {
+		return string(b[:32]) + "..."
+	}
+	return string(b)
+}
+
+// SplitInlineArgs 按 Redis inline 命令的规则切分参数：
+// 参数之间以空白分隔；双引号内支持 \n \r \t \b \a \\ \" 以及 \xHH 十六进制转义；
+// 单引号内只支持 \' 转义；闭合引号后必须紧跟空白或行尾，否则视为引号不匹配。
+// 整个过程按字节处理，因此参数可以包含任意二进制数据
+func SplitInlineArgs(line []byte) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDouble, inSingle, done := false, false, false
+		for !done {
+			if inDouble {
+				if i >= len(line) {
+					return nil, ProtocolError("unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					current = append(current, hexDigitValue(line[i+2])<<4|hexDigitValue(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if c == '"' {
+					// 闭合引号后必须是空白或行尾
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ProtocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else if inSingle {
+				if i >= len(line) {
+					return nil, ProtocolError("unbalanced quotes in request")
+				}
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					current = append(current, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, ProtocolError("unbalanced quotes in request")
+					}
+					done = true
+				} else {
+					current = append(current, c)
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch c := line[i]; {
+				case isInlineSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current = append(current, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, string(current))
+	}
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexDigitValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
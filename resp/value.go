@@ -0,0 +1,99 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+)
+
+// Error 是命令返回的错误回复，内容包括 ERR / WRONGTYPE 等前缀
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Status 是简单字符串回复，例如 OK，用于与内容相同的批量字符串区分
+type Status string
+
+// EncodeCommand 把一条命令编码为 RESP 数组，用于向服务端发送请求
+func EncodeCommand(args []string) []byte {
+	buf := make([]byte, 0, 16*len(args)+16)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// maxValueDepth 是 ReadValue 允许的数组嵌套层数，防止恶意或损坏的数据造成过深的递归
+const maxValueDepth = 128
+
+// ReadValue 读取一个完整的 RESP 回复：简单字符串为 Status，批量字符串为 string，整数为 int64，
+// nil 为 nil，数组为 []interface{}。顶层的错误回复作为 Error 返回，数组中的错误回复以 Error 值出现在数组里
+func ReadValue(r *bufio.Reader) (interface{}, error) {
+	return readValue(r, 0)
+}
+
+func readValue(r *bufio.Reader, depth int) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return Status(line[1:]), nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || n < -1 {
+			return nil, ProtocolError("invalid bulk length")
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		// 长度由对端声明，与解析请求时一样不据此一次性分配
+		data, err := readBulkData(r, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := readCRLF(r); err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case '*':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || n < -1 {
+			return nil, ProtocolError("invalid multibulk length")
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		if depth >= maxValueDepth {
+			return nil, ProtocolError("too deeply nested reply")
+		}
+		items := make([]interface{}, 0, min(n, 1024))
+		for i := int64(0); i < n; i++ {
+			v, err := readValue(r, depth+1)
+			if e, ok := err.(Error); ok {
+				v, err = e, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	return nil, ProtocolError("unexpected reply type '" + truncateForError(line[:1]) + "'")
+}
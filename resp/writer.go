@@ -0,0 +1,105 @@
+// Package resp 实现 RESP 协议的请求解析与回复编码
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bufferSize 是每个连接回复缓冲区的大小，缓冲区写满后即下发到连接
+const bufferSize = 16 * 1024
+
+// Writer 是每个连接独占的回复缓冲区。回复先写入带缓冲的 writer，由连接在处理完
+// 一批管道命令后统一 Flush；大集合以流式方式逐个输出元素，缓冲区写满即下发到连接，
+// 因此内存占用不随集合大小增长。
+// 所有输出都直接追加字节，不经过 fmt，整数通过 strconv.AppendInt 写入 scratch，不产生堆分配
+type Writer struct {
+	*bufio.Writer
+	scratch [24]byte
+}
+
+// writerPool 复用各连接的回复缓冲区，连接频繁建立与断开时不必每次重新分配 16KB 的缓冲区
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return &Writer{Writer: bufio.NewWriterSize(nil, bufferSize)}
+	},
+}
+
+// NewWriter 从池中取出一个回复缓冲区，回复写入 w
+func NewWriter(w io.Writer) *Writer {
+	rw := writerPool.Get().(*Writer)
+	rw.Reset(w)
+	return rw
+}
+
+// Release 在连接关闭后把回复缓冲区归还到池中，之后不能再使用 rw
+func (rw *Writer) Release() {
+	rw.Reset(nil)
+	writerPool.Put(rw)
+}
+
+// sharedHeaderCount 以内的数组头与批量字符串头预先生成，与 Redis 的 shared.mbulkhdr / shared.bulkhdr 相同
+const sharedHeaderCount = 64
+
+var (
+	sharedArrayHeaders [sharedHeaderCount]string
+	sharedBulkHeaders  [sharedHeaderCount]string
+)
+
+func init() {
+	for i := 0; i < sharedHeaderCount; i++ {
+		sharedArrayHeaders[i] = "*" + strconv.Itoa(i) + "\r\n"
+		sharedBulkHeaders[i] = "$" + strconv.Itoa(i) + "\r\n"
+	}
+}
+
+// writePrefixedInt 输出 <prefix><n>\r\n
+func (rw *Writer) writePrefixedInt(prefix byte, n int64) {
+	b := append(rw.scratch[:0], prefix)
+	b = strconv.AppendInt(b, n, 10)
+	b = append(b, '\r', '\n')
+	rw.Write(b)
+}
+
+// WriteArrayHeader 输出数组头 *<n>\r\n
+func (rw *Writer) WriteArrayHeader(n int) {
+	if n >= 0 && n < sharedHeaderCount {
+		rw.WriteString(sharedArrayHeaders[n])
+		return
+	}
+	rw.writePrefixedInt('*', int64(n))
+}
+
+// WriteBulk 输出一个批量字符串 $<len>\r\n<data>\r\n
+func (rw *Writer) WriteBulk(s string) {
+	if len(s) < sharedHeaderCount {
+		rw.WriteString(sharedBulkHeaders[len(s)])
+	} else {
+		rw.writePrefixedInt('$', int64(len(s)))
+	}
+	rw.WriteString(s)
+	rw.WriteString("\r\n")
+}
+
+// WriteInteger 输出整数回复 :<n>\r\n
+func (rw *Writer) WriteInteger(n int) {
+	rw.writePrefixedInt(':', int64(n))
+}
+
+// errorLineReplacer 把错误信息中的换行替换为空格
+var errorLineReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// WriteError 输出错误回复 -<msg>\r\n，msg 需自带 ERR / WRONGTYPE 等前缀。
+// 错误信息中经常带有客户端发送的命令名或参数，其中的 \r \n 会被替换为空格（与 Redis 的 addReplyError 相同），
+// 否则客户端可以借此在回复中插入任意内容，使之后的回复全部错位
+func (rw *Writer) WriteError(msg string) {
+	if strings.ContainsAny(msg, "\r\n") {
+		msg = errorLineReplacer.Replace(msg)
+	}
+	rw.WriteByte('-')
+	rw.WriteString(msg)
+	rw.WriteString("\r\n")
+}
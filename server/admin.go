@@ -0,0 +1,484 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 管理后台，配置 http-admin yes 后挂在 :8080 的 /admin 下，与其他 HTTP 接口一样受 http-auth-* 保护。
+// 页面本身只是静态的 HTML + JS，数据全部来自以下 JSON 接口：
+//
+//	GET    /admin/api/keys?cursor=C&match=P&count=N  按分片增量遍历键空间，返回下一个 cursor（0 表示遍历结束）
+//	GET    /admin/api/keys/{key}                     返回键的类型、剩余生存时间和值，格式与 /v1/keys/{key} 相同
+//	DELETE /admin/api/keys/{key}                     删除键
+//	GET    /admin/api/info                           以 小节 -> 字段 -> 值 的形式返回 INFO
+//	GET    /admin/api/clients                        返回当前连接的客户端
+//	GET    /admin/api/slowlog                        返回慢查询日志；DELETE 清空
+//	GET    /admin/api/config                         返回所有配置项；POST {"name": "value", ...} 相当于 CONFIG SET
+//	GET    /admin/api/audit                          返回内存中的审计日志
+//	GET    /admin/api/drain                          返回连接排空的状态；POST ?timeout=N 开始排空，DELETE 恢复接受新连接，见 drain.go
+//
+// 数据集的导出和导入见 admin_transfer.go
+
+// adminScanDefaultCount 是每次遍历默认返回的键数
+const adminScanDefaultCount = 100
+
+func (srv *Server) registerAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("/admin", srv.adminPageHandler)
+	mux.HandleFunc("/admin/api/keys", srv.adminKeysHandler)
+	mux.HandleFunc("/admin/api/keys/", srv.adminKeyHandler)
+	mux.HandleFunc("/admin/api/info", adminGetOnly(func() interface{} { return srv.infoFields() }))
+	mux.HandleFunc("/admin/api/clients", adminGetOnly(func() interface{} { return srv.listClients() }))
+	mux.HandleFunc("/admin/api/slowlog", srv.adminSlowlogHandler)
+	mux.HandleFunc("/admin/api/config", srv.adminConfigHandler)
+	mux.HandleFunc("/admin/api/audit", adminGetOnly(func() interface{} { return srv.auditGet(-1) }))
+	mux.HandleFunc("/admin/api/drain", srv.adminDrainHandler)
+}
+
+// adminGetOnly 返回一个只接受 GET 请求、以 JSON 返回 fn() 结果的处理函数
+func adminGetOnly(fn func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, fn())
+	}
+}
+
+// adminKey 是键空间遍历结果中的一个键
+type adminKey struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	TTL  int    `json:"ttl"`
+}
+
+// adminKeysHandler 以分片编号作为 cursor 遍历键空间：每次从 cursor 指向的分片开始，
+// 逐个分片取出匹配的键，直到凑够 count 个。与 SCAN 一样，一次返回的键数可能略多于 count
+func (srv *Server) adminKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cursor, ok1 := queryInt(r, "cursor", 0)
+	count, ok2 := queryInt(r, "count", adminScanDefaultCount)
+	match := r.URL.Query().Get("match")
+	if _, err := path.Match(match, ""); !ok1 || !ok2 || cursor >= store.ShardCount || count == 0 || err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid cursor, count or match pattern")
+		return
+	}
+	now := time.Now()
+	keys := []adminKey{}
+	for ; cursor < store.ShardCount && len(keys) < count; cursor++ {
+		srv.store.ScanShard(cursor, func(key string, entry *store.Entry) {
+			if match != "" {
+				if ok, _ := path.Match(match, key); !ok {
+					return
+				}
+			}
+			k := adminKey{Key: key, Type: entry.Type.String(), TTL: -1}
+			if !entry.ExpireAt.IsZero() {
+				k.TTL = max(0, int(entry.ExpireAt.Sub(now).Seconds()))
+			}
+			keys = append(keys, k)
+		})
+	}
+	if cursor == store.ShardCount {
+		cursor = 0
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"cursor": cursor, "keys": keys})
+}
+
+func (srv *Server) adminKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/admin/api/keys/")
+	if key == "" {
+		writeJSONError(w, http.StatusNotFound, "no such key")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		k, ok := srv.lookupKeyJSON(key)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "no such key")
+			return
+		}
+		writeJSON(w, http.StatusOK, k)
+	case http.MethodDelete:
+		result, err := srv.runGatewayCommand(r, []string{"DEL", key})
+		if err != nil {
+			writeGatewayResult(w, nil, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": result})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (srv *Server) adminSlowlogHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, srv.slowlogGet(-1))
+	case http.MethodDelete:
+		srv.slowlogReset()
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// adminConfigParam 是配置编辑器中的一项
+type adminConfigParam struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Immutable bool   `json:"immutable"`
+}
+
+func (srv *Server) adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		var values map[string]interface{}
+		if !decodeJSONBody(w, r, &values) {
+			return
+		}
+		var directives [][2]string
+		for name, v := range values {
+			switch v := v.(type) {
+			case string:
+				directives = append(directives, [2]string{name, v})
+			case json.Number:
+				directives = append(directives, [2]string{name, v.String()})
+			default:
+				writeJSONError(w, http.StatusBadRequest, "config values must be strings or numbers")
+				return
+			}
+		}
+		sort.Slice(directives, func(i, j int) bool { return directives[i][0] < directives[j][0] })
+		start := time.Now()
+		err := config.Set(directives)
+		args := []string{"CONFIG", "SET"}
+		for _, d := range directives {
+			args = append(args, d[0], d[1])
+		}
+		if shouldAudit(config.Get().AuditLogCommands, args) {
+			srv.audit(httpCaller(r), args, start)
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		srv.configChanged(directives)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	cfg := config.Get()
+	params := make([]adminConfigParam, len(config.Params()))
+	for i, p := range config.Params() {
+		params[i] = adminConfigParam{p.Name, p.Value(cfg), p.Immutable}
+	}
+	writeJSON(w, http.StatusOK, params)
+}
+
+func (srv *Server) adminDrainHandler(w http.ResponseWriter, r *http.Request) {
+	var args []string
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		timeout, ok := queryInt(r, "timeout", 0)
+		if !ok || timeout <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "timeout must be a positive number of milliseconds")
+			return
+		}
+		args = []string{"DRAIN", "START", strconv.Itoa(timeout)}
+		srv.startDrain(time.Duration(timeout) * time.Millisecond)
+	case http.MethodDelete:
+		args = []string{"DRAIN", "CANCEL"}
+		srv.cancelDrain()
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if args != nil && shouldAudit(config.Get().AuditLogCommands, args) {
+		srv.audit(httpCaller(r), args, time.Now())
+	}
+	accepting, draining, connections, remaining := srv.drainStatus()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"accepting":    accepting,
+		"draining":     draining,
+		"connections":  connections,
+		"remaining_ms": remaining.Milliseconds(),
+	})
+}
+
+func (srv *Server) adminPageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(adminPage))
+}
+
+// adminPage 是管理后台的单页应用，所有元素都用 DOM API 构造，键名和值不会被当作 HTML 解析
+const adminPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>redis_easy admin</title>
+<style>
+body { font-family: sans-serif; margin: 0; }
+nav { background: #333; padding: 8px; }
+nav button { background: none; border: none; color: #ccc; font-size: 15px; margin-right: 12px; cursor: pointer; }
+nav button.active { color: #fff; font-weight: bold; }
+section { display: none; padding: 16px; }
+section.active { display: block; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-size: 13px; }
+tr.clickable { cursor: pointer; }
+tr.clickable:hover { background: #eef; }
+pre { background: #f6f6f6; padding: 8px; white-space: pre-wrap; word-break: break-all; }
+.charts { display: flex; flex-wrap: wrap; gap: 16px; }
+.chart h4 { margin: 4px 0; }
+.error { color: #c00; }
+#keys-layout { display: flex; gap: 24px; align-items: flex-start; }
+</style>
+</head>
+<body>
+<nav>
+<button data-tab="keys" class="active">Keys</button>
+<button data-tab="metrics">Metrics</button>
+<button data-tab="clients">Clients</button>
+<button data-tab="slowlog">Slowlog</button>
+<button data-tab="config">Config</button>
+</nav>
+
+<section id="keys" class="active">
+<form id="scan-form">
+<input id="match" placeholder="match pattern, e.g. user:*" size="30">
+<button type="submit">Scan</button>
+<button type="button" id="scan-more" disabled>More</button>
+</form>
+<div id="keys-layout">
+<table><thead><tr><th>Key</th><th>Type</th><th>TTL</th></tr></thead><tbody id="key-rows"></tbody></table>
+<div id="key-view"></div>
+</div>
+</section>
+
+<section id="metrics">
+<div class="charts" id="charts"></div>
+<pre id="info"></pre>
+</section>
+
+<section id="clients">
+<table><thead><tr><th>ID</th><th>Address</th><th>Age (s)</th><th>Idle (s)</th><th>Last command</th></tr></thead><tbody id="client-rows"></tbody></table>
+</section>
+
+<section id="slowlog">
+<p><button id="slowlog-refresh">Refresh</button> <button id="slowlog-reset">Reset</button></p>
+<table><thead><tr><th>ID</th><th>Time</th><th>Duration (µs)</th><th>Command</th></tr></thead><tbody id="slowlog-rows"></tbody></table>
+</section>
+
+<section id="config">
+<p class="error" id="config-error"></p>
+<table><thead><tr><th>Name</th><th>Value</th><th></th></tr></thead><tbody id="config-rows"></tbody></table>
+</section>
+
+<script>
+// 使用 http-auth-token 时，页面通过 ?access_token= 打开，后续请求沿用同一个令牌
+const token = new URLSearchParams(location.search).get("access_token");
+
+function api(path, opts) {
+  if (token) path += (path.includes("?") ? "&" : "?") + "access_token=" + encodeURIComponent(token);
+  return fetch(path, opts).then(r => r.json().then(body => {
+    if (!r.ok) throw new Error(body.error || r.statusText);
+    return body;
+  }));
+}
+
+function el(tag, text, attrs) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  Object.assign(e, attrs || {});
+  return e;
+}
+
+function row(tbody, cells) {
+  const tr = tbody.insertRow();
+  for (const c of cells) {
+    const td = tr.insertCell();
+    if (c instanceof Node) td.append(c); else td.textContent = c;
+  }
+  return tr;
+}
+
+// 标签页
+let current = "keys";
+for (const b of document.querySelectorAll("nav button")) {
+  b.onclick = () => {
+    document.querySelectorAll("nav button, section").forEach(e => e.classList.remove("active"));
+    b.classList.add("active");
+    document.getElementById(b.dataset.tab).classList.add("active");
+    current = b.dataset.tab;
+    refreshTab();
+  };
+}
+
+// 键空间浏览
+let cursor = 0;
+function scan(reset) {
+  const rows = document.getElementById("key-rows");
+  if (reset) { rows.replaceChildren(); cursor = 0; }
+  const match = document.getElementById("match").value;
+  api("/admin/api/keys?count=100&cursor=" + cursor + "&match=" + encodeURIComponent(match)).then(page => {
+    for (const k of page.keys) {
+      const tr = row(rows, [k.key, k.type, k.ttl]);
+      tr.className = "clickable";
+      tr.onclick = () => showKey(k.key);
+    }
+    cursor = page.cursor;
+    document.getElementById("scan-more").disabled = cursor === 0;
+  }).catch(e => alert(e.message));
+}
+document.getElementById("scan-form").onsubmit = ev => { ev.preventDefault(); scan(true); };
+document.getElementById("scan-more").onclick = () => scan(false);
+
+function showKey(key) {
+  const view = document.getElementById("key-view");
+  api("/admin/api/keys/" + encodeURIComponent(key)).then(k => {
+    view.replaceChildren(el("h3", k.key), el("p", k.type + ", ttl " + k.ttl));
+    if (k.type === "string") {
+      view.append(el("pre", k.value));
+    } else if (k.type === "hash") {
+      const t = el("table"), body = t.createTBody();
+      for (const f of Object.keys(k.value).sort()) row(body, [f, k.value[f]]);
+      view.append(t);
+    } else {
+      const list = el(k.type === "list" ? "ol" : "ul");
+      list.start = 0;
+      for (const v of k.value) list.append(el("li", v));
+      view.append(list);
+    }
+    const del = el("button", "Delete key");
+    del.onclick = () => {
+      if (!confirm("Delete " + key + "?")) return;
+      api("/admin/api/keys/" + encodeURIComponent(key), {method: "DELETE"}).then(() => { view.replaceChildren(); scan(true); });
+    };
+    view.append(del);
+  }).catch(e => view.replaceChildren(el("p", e.message, {className: "error"})));
+}
+
+// 指标：每秒拉取一次 INFO，保留最近 120 个点
+const history = 120;
+const charts = [
+  {title: "Ops/sec", value: (info, prev) => prev ? info.stats.total_commands_processed - prev.stats.total_commands_processed : 0},
+  {title: "Used memory (bytes)", value: info => +info.memory.used_memory},
+  {title: "Dataset memory (bytes)", value: info => +info.memory.used_memory_dataset},
+  {title: "Connected clients", value: info => +info.clients.connected_clients},
+];
+for (const c of charts) {
+  c.points = [];
+  c.canvas = el("canvas", undefined, {width: 360, height: 120});
+  c.label = el("h4", c.title);
+  const box = el("div", undefined, {className: "chart"});
+  box.append(c.label, c.canvas);
+  document.getElementById("charts").append(box);
+}
+
+function draw(c) {
+  const ctx = c.canvas.getContext("2d"), w = c.canvas.width, h = c.canvas.height;
+  ctx.clearRect(0, 0, w, h);
+  ctx.strokeStyle = "#ccc";
+  ctx.strokeRect(0, 0, w, h);
+  const max = Math.max(1, ...c.points);
+  ctx.strokeStyle = "#36c";
+  ctx.beginPath();
+  c.points.forEach((v, i) => {
+    const x = w - (c.points.length - 1 - i) * w / (history - 1), y = h - 4 - v / max * (h - 8);
+    if (i === 0) ctx.moveTo(x, y); else ctx.lineTo(x, y);
+  });
+  ctx.stroke();
+  c.label.textContent = c.title + ": " + (c.points.length ? c.points[c.points.length - 1] : "-") + " (max " + max + ")";
+}
+
+let prevInfo = null;
+function pollInfo() {
+  api("/admin/api/info").then(info => {
+    for (const c of charts) {
+      c.points.push(c.value(info, prevInfo));
+      if (c.points.length > history) c.points.shift();
+      if (current === "metrics") draw(c);
+    }
+    prevInfo = info;
+    if (current === "metrics") {
+      const lines = [];
+      for (const [section, fields] of Object.entries(info)) {
+        lines.push("# " + section);
+        for (const [k, v] of Object.entries(fields)) lines.push(k + ":" + v);
+        lines.push("");
+      }
+      document.getElementById("info").textContent = lines.join("\n");
+    }
+  }).catch(() => {});
+}
+setInterval(pollInfo, 1000);
+pollInfo();
+
+// 客户端、慢查询、配置
+function loadClients() {
+  api("/admin/api/clients").then(list => {
+    const rows = document.getElementById("client-rows");
+    rows.replaceChildren();
+    for (const c of list) row(rows, [c.id, c.addr, c.age, c.idle, c.cmd]);
+  });
+}
+
+function loadSlowlog() {
+  api("/admin/api/slowlog").then(list => {
+    const rows = document.getElementById("slowlog-rows");
+    rows.replaceChildren();
+    for (const e of list) row(rows, [e.id, new Date(e.time * 1000).toLocaleString(), e.duration, e.args.join(" ")]);
+  });
+}
+document.getElementById("slowlog-refresh").onclick = loadSlowlog;
+document.getElementById("slowlog-reset").onclick = () => api("/admin/api/slowlog", {method: "DELETE"}).then(loadSlowlog);
+
+function renderConfig(params) {
+  const rows = document.getElementById("config-rows");
+  rows.replaceChildren();
+  for (const p of params) {
+    const input = el("input", undefined, {value: p.value, disabled: p.immutable, size: 40});
+    const save = el("button", "Save", {disabled: p.immutable});
+    save.onclick = () => {
+      document.getElementById("config-error").textContent = "";
+      api("/admin/api/config", {method: "POST", body: JSON.stringify({[p.name]: input.value})})
+        .then(renderConfig)
+        .catch(e => { document.getElementById("config-error").textContent = e.message; });
+    };
+    row(rows, [p.name, input, p.immutable ? "restart required" : save]);
+  }
+}
+
+function refreshTab() {
+  if (current === "metrics") charts.forEach(draw);
+  if (current === "clients") loadClients();
+  if (current === "slowlog") loadSlowlog();
+  if (current === "config") api("/admin/api/config").then(renderConfig);
+}
+setInterval(() => { if (current === "clients") loadClients(); }, 2000);
+scan(true);
+</script>
+</body>
+</html>
+`
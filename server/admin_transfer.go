@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 通过 HTTP 以 JSON Lines 格式导出和导入数据集，随管理后台一起在 http-admin yes 时开启。每行一个键：
+//
+//	{"key":"user:1","type":"hash","ttl":-1,"value":{"name":"alice"}}
+//
+// type 为 string / list / set / hash / cuckoo / timeseries / queue，value 分别为字符串、数组、数组、对象，
+// 后三者为 base64 编码的值；ttl 为剩余秒数，-1 表示不过期。
+//
+//	GET  /admin/export  以流的方式导出所有未过期的键
+//	POST /admin/import  导入请求体中的键，同名的键会被覆盖；返回 {"imported": n}
+
+func (srv *Server) registerAdminTransfer(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/export", srv.adminExportHandler)
+	mux.HandleFunc("/admin/import", srv.adminImportHandler)
+}
+
+func (srv *Server) adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="redis_easy-export.jsonl"`)
+	bw := bufio.NewWriterSize(w, 64*1024)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for i := 0; i < store.ShardCount; i++ {
+		// 持锁期间只把分片编码到内存中，写出到连接时不持锁，慢客户端不会阻塞分片上的命令
+		buf.Reset()
+		now := time.Now()
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			k := gatewayKey{Key: key, Type: entry.Type.String(), TTL: -1, Value: entryValueJSON(entry)}
+			if !entry.ExpireAt.IsZero() {
+				k.TTL = max(0, int(entry.ExpireAt.Sub(now).Seconds()))
+			}
+			enc.Encode(k)
+		})
+		if _, err := bw.Write(buf.Bytes()); err != nil {
+			return
+		}
+	}
+	bw.Flush()
+}
+
+// importRecord 是导入文件中的一行
+type importRecord struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	TTL   *int            `json:"ttl"`
+	Value json.RawMessage `json:"value"`
+}
+
+// entry 把一行记录转换为条目。ok 为 false 表示这一行应被跳过（已过期或值为空）
+func (rec *importRecord) entry(now time.Time) (e *store.Entry, ok bool, err error) {
+	if rec.Key == "" {
+		return nil, false, fmt.Errorf("missing key")
+	}
+	e = &store.Entry{}
+	if rec.TTL != nil && *rec.TTL >= 0 {
+		if *rec.TTL == 0 {
+			return nil, false, nil
+		}
+		e.ExpireAt = now.Add(time.Duration(*rec.TTL) * time.Second)
+	}
+	switch rec.Type {
+	case "string":
+		var s string
+		if err := json.Unmarshal(rec.Value, &s); err != nil {
+			return nil, false, fmt.Errorf("value of a string must be a JSON string")
+		}
+		e.Type, e.Value = store.StringType, s
+	case "list", "set":
+		var elems []string
+		if err := json.Unmarshal(rec.Value, &elems); err != nil {
+			return nil, false, fmt.Errorf("value of a %s must be an array of strings", rec.Type)
+		}
+		if len(elems) == 0 {
+			return nil, false, nil
+		}
+		if rec.Type == "list" {
+			list := store.NewListObject()
+			list.PushBack(elems)
+			e.Type, e.Value = store.ListType, list
+		} else {
+			set := store.NewSetObject()
+			for _, m := range elems {
+				set.Add(m)
+			}
+			e.Type, e.Value = store.SetType, set
+		}
+	case "hash":
+		var fields map[string]string
+		if err := json.Unmarshal(rec.Value, &fields); err != nil {
+			return nil, false, fmt.Errorf("value of a hash must be an object of strings")
+		}
+		if len(fields) == 0 {
+			return nil, false, nil
+		}
+		hash := store.NewHashObject()
+		for f, v := range fields {
+			hash.Set(f, v)
+		}
+		e.Type, e.Value = store.HashType, hash
+	case "cuckoo":
+		var data []byte
+		if err := json.Unmarshal(rec.Value, &data); err != nil {
+			return nil, false, fmt.Errorf("value of a cuckoo filter must be a base64 string")
+		}
+		cf, err := store.UnmarshalCuckoo(data)
+		if err != nil {
+			return nil, false, err
+		}
+		e.Type, e.Value = store.CuckooType, cf
+	case "timeseries":
+		var data []byte
+		if err := json.Unmarshal(rec.Value, &data); err != nil {
+			return nil, false, fmt.Errorf("value of a time series must be a base64 string")
+		}
+		ts, err := store.UnmarshalTimeSeries(data)
+		if err != nil {
+			return nil, false, err
+		}
+		e.Type, e.Value = store.TimeSeriesType, ts
+	case "queue":
+		var data []byte
+		if err := json.Unmarshal(rec.Value, &data); err != nil {
+			return nil, false, fmt.Errorf("value of a queue must be a base64 string")
+		}
+		q, err := store.UnmarshalQueue(data)
+		if err != nil {
+			return nil, false, err
+		}
+		e.Type, e.Value = store.QueueType, q
+	default:
+		return nil, false, fmt.Errorf("unknown type '%s'", rec.Type)
+	}
+	return e, true, nil
+}
+
+func (srv *Server) adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	maxLine := int(min(config.Get().ProtoMaxBulkLen, 1<<30))
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	imported, skipped, lineNo := 0, 0, 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec importRecord
+		err := json.Unmarshal(line, &rec)
+		var e *store.Entry
+		ok := false
+		if err == nil {
+			e, ok, err = rec.entry(time.Now())
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":    fmt.Sprintf("line %d: %v", lineNo, err),
+				"imported": imported,
+			})
+			return
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		srv.store.Run(store.ShardsOf([]string{rec.Key}), func() { srv.store.Put(rec.Key, e) })
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":    fmt.Sprintf("line %d: %v", lineNo+1, err),
+			"imported": imported,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"imported": imported, "skipped": skipped})
+}
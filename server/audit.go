@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 审计日志：audit-log-commands 中列出的管理命令和写命令每执行一次，记录一条 谁（执行者）、何时、执行了什么（参数），
+// 以 JSON 行追加写入 audit-log-file，同时在内存中保留最近的 audit-log-max-len 条，供 AUDITLOG GET 和管理后台查询。
+//
+// 执行者是 TCP 客户端的 id=N addr=ip:port、HTTP 网关和管理后台的 http addr=ip:port [user=name]，
+// 或者定时任务的 schedule=id。无论命令执行成功与否都会记录；CONFIG SET 中密码、令牌类配置项的值不会写入日志。
+// 内存中的记录不提供清空的命令，日志文件只追加，由运维方自行轮转（轮转后修改 audit-log-file 即可写入新文件）
+
+type auditEntry struct {
+	ID     int64    `json:"id"`
+	Time   int64    `json:"time"`
+	Caller string   `json:"caller"`
+	Args   []string `json:"args"`
+}
+
+// auditLog 是内存中的审计记录以及打开的审计日志文件
+type auditLog struct {
+	mu      sync.Mutex
+	entries []auditEntry // 最新的记录在最前面
+	nextID  int64
+	path    string
+	file    *os.File
+}
+
+// auditRedacted 替换 CONFIG SET 中敏感配置项的值
+const auditRedacted = "(redacted)"
+
+// httpCaller 返回 HTTP 请求在审计日志中的执行者
+func httpCaller(r *http.Request) string {
+	caller := "http addr=" + r.RemoteAddr
+	if user, _, ok := r.BasicAuth(); ok {
+		caller += " user=" + user
+	}
+	return caller
+}
+
+// shouldAudit 返回 request 对应的命令是否在 audit-log-commands 中
+func shouldAudit(list string, request []string) bool {
+	if list == "" {
+		return false
+	}
+	spec, _ := lookupCommand(request)
+	if spec == nil {
+		return false
+	}
+	if config.HasListItem(list, spec.name) {
+		return true
+	}
+	parent, _, isSub := strings.Cut(spec.name, "|")
+	return isSub && config.HasListItem(list, parent)
+}
+
+// auditCommand 在每条命令执行完后调用，命令需要审计时写入审计日志
+func (srv *Server) auditCommand(caller string, request []string, start time.Time) {
+	if !shouldAudit(config.Get().AuditLogCommands, request) {
+		return
+	}
+	srv.audit(caller, request, start)
+}
+
+// audit 记录一条审计日志，args 是执行的命令。不经过 executeCommand 的管理操作（例如管理后台修改配置）直接调用它
+func (srv *Server) audit(caller string, args []string, start time.Time) {
+	args = truncateArgs(args)
+	if len(args) >= 2 && strings.EqualFold(args[0], "config") && strings.EqualFold(args[1], "set") {
+		for i := 2; i+1 < len(args); i += 2 {
+			if sensitiveConfig(args[i]) {
+				args[i+1] = auditRedacted
+			}
+		}
+	}
+
+	cfg := config.Get()
+	srv.auditLog.mu.Lock()
+	defer srv.auditLog.mu.Unlock()
+	e := auditEntry{ID: srv.auditLog.nextID, Time: start.Unix(), Caller: caller, Args: args}
+	srv.auditLog.nextID++
+	if cfg.AuditLogMaxLen > 0 {
+		srv.auditLog.entries = append([]auditEntry{e}, srv.auditLog.entries...)
+		if len(srv.auditLog.entries) > cfg.AuditLogMaxLen {
+			srv.auditLog.entries = srv.auditLog.entries[:cfg.AuditLogMaxLen]
+		}
+	}
+	srv.writeAuditFile(cfg.AuditLogFile, e)
+}
+
+// sensitiveConfig 返回配置项的值是否不应出现在审计日志中
+func sensitiveConfig(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "password") || strings.Contains(name, "token")
+}
+
+// writeAuditFile 把一条记录追加到审计日志文件，audit-log-file 改变时关闭原来的文件并打开新文件。调用方需持有 srv.auditLog.mu
+func (srv *Server) writeAuditFile(path string, e auditEntry) {
+	if path != srv.auditLog.path {
+		srv.closeAuditFile()
+		srv.auditLog.path = path
+		if path != "" {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+			if err != nil {
+				srv.logger.Println("Error opening audit log:", err)
+			}
+			srv.auditLog.file = f
+		}
+	}
+	if srv.auditLog.file == nil {
+		return
+	}
+	line, _ := json.Marshal(e)
+	if _, err := srv.auditLog.file.Write(append(line, '\n')); err != nil {
+		srv.logger.Println("Error writing audit log:", err)
+	}
+}
+
+// closeAuditFile 关闭打开的审计日志文件，调用方需持有 srv.auditLog.mu
+func (srv *Server) closeAuditFile() {
+	if srv.auditLog.file != nil {
+		srv.auditLog.file.Close()
+		srv.auditLog.file = nil
+	}
+	srv.auditLog.path = ""
+}
+
+// auditGet 返回最新的 n 条审计记录，n 为负数时返回全部
+func (srv *Server) auditGet(n int) []auditEntry {
+	srv.auditLog.mu.Lock()
+	defer srv.auditLog.mu.Unlock()
+	if n < 0 || n > len(srv.auditLog.entries) {
+		n = len(srv.auditLog.entries)
+	}
+	return append([]auditEntry(nil), srv.auditLog.entries[:n]...)
+}
+
+// AUDITLOG GET 命令：AUDITLOG GET [count]，返回最新的 count 条（默认 10 条，-1 表示全部）审计记录，
+// 每条为 [id, 时间戳, 执行者, [参数...]]
+func (srv *Server) handleAuditlogGet(w *resp.Writer, args []string) {
+	count := 10
+	if len(args) == 3 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < -1 {
+			w.WriteString("-ERR count should be greater than or equal to -1\r\n")
+			return
+		}
+		count = n
+	}
+	entries := srv.auditGet(count)
+	w.WriteArrayHeader(len(entries))
+	for _, e := range entries {
+		w.WriteArrayHeader(4)
+		w.WriteInteger(int(e.ID))
+		w.WriteInteger(int(e.Time))
+		w.WriteBulk(e.Caller)
+		w.WriteArrayHeader(len(e.Args))
+		for _, arg := range e.Args {
+			w.WriteBulk(arg)
+		}
+	}
+}
+
+// AUDITLOG LEN 命令：返回内存中审计记录的条数
+func (srv *Server) handleAuditlogLen(w *resp.Writer, args []string) {
+	srv.auditLog.mu.Lock()
+	n := len(srv.auditLog.entries)
+	srv.auditLog.mu.Unlock()
+	w.WriteInteger(n)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// MEMORY BIGKEYS [COUNT n] [BY BYTES|ELEMENTS]：在线遍历整个键空间，找出每种类型中最大的 n 个键（默认 1 个），
+// 对应 redis-cli --bigkeys / --memkeys。大小按估算字节数（默认）或元素个数（字符串为字节数）比较。
+// 逐个分片加锁遍历，每个分片之后让出 CPU，同一时间只锁住一个分片，其他分片上的命令不受影响；
+// 遍历不是原子的，期间写入或删除的键可能被统计也可能不被统计。回复中每种出现过的类型一项：
+//
+//	[类型, 键数, 总字节数, [[key, 元素个数, 字节数], ...]]
+
+// bigKeysDefaultCount 是 MEMORY BIGKEYS 默认为每种类型返回的键数
+const bigKeysDefaultCount = 1
+
+// bigKey 是 MEMORY BIGKEYS 找到的一个键
+type bigKey struct {
+	key      string
+	elements int64
+	bytes    int64
+}
+
+// bigKeysByType 是一种类型的统计，biggest 按大小从大到小排列
+type bigKeysByType struct {
+	keys    int64
+	bytes   int64
+	biggest []bigKey
+}
+
+// MEMORY BIGKEYS 命令，见文件开头的说明
+func (srv *Server) handleMemoryBigKeys(w *resp.Writer, args []string) {
+	count := bigKeysDefaultCount
+	byElements := false
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			n, _ := strconv.Atoi(args[i+1])
+			if n <= 0 {
+				w.WriteString("-ERR COUNT must be a positive integer\r\n")
+				return
+			}
+			count = n
+		case "BY":
+			switch strings.ToUpper(args[i+1]) {
+			case "BYTES":
+				byElements = false
+			case "ELEMENTS":
+				byElements = true
+			default:
+				w.WriteError(errSyntax)
+				return
+			}
+		}
+	}
+	size := func(k bigKey) int64 {
+		if byElements {
+			return k.elements
+		}
+		return k.bytes
+	}
+
+	var stats [store.TypeCount]bigKeysByType
+	for i := 0; i < store.ShardCount; i++ {
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			t := &stats[entry.Type]
+			k := bigKey{key: key, elements: entry.Len(), bytes: entry.Size()}
+			t.keys++
+			t.bytes += k.bytes
+			// biggest 很短，直接插入排序
+			pos := len(t.biggest)
+			for pos > 0 && size(t.biggest[pos-1]) < size(k) {
+				pos--
+			}
+			if pos >= count {
+				return
+			}
+			if len(t.biggest) < count {
+				t.biggest = append(t.biggest, bigKey{})
+			}
+			copy(t.biggest[pos+1:], t.biggest[pos:])
+			t.biggest[pos] = k
+		})
+		runtime.Gosched()
+	}
+
+	n := 0
+	for _, t := range stats {
+		if t.keys > 0 {
+			n++
+		}
+	}
+	w.WriteArrayHeader(n)
+	for typ, t := range stats {
+		if t.keys == 0 {
+			continue
+		}
+		w.WriteArrayHeader(4)
+		w.WriteBulk(store.DataType(typ).String())
+		w.WriteInteger(int(t.keys))
+		w.WriteInteger(int(t.bytes))
+		w.WriteArrayHeader(len(t.biggest))
+		for _, k := range t.biggest {
+			w.WriteArrayHeader(3)
+			w.WriteBulk(k.key)
+			w.WriteInteger(int(k.elements))
+			w.WriteInteger(int(k.bytes))
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// client 记录一个 TCP 客户端连接的基本信息，供 CLIENT LIST 和管理后台查看。
+// 两种网络后端在连接建立时 registerClient，断开时 unregisterClient，每执行一条命令后调用 touch
+type client struct {
+	id        int64
+	addr      string
+	createdAt time.Time
+	// conn 是 goroutine 后端的连接，Stop 时用于关闭连接；事件循环后端由事件循环自己关闭连接，conn 为 nil
+	conn net.Conn
+	// caller 是审计日志中记录的执行者
+	caller string
+	// class 是 client-output-buffer-limit 中的类别。目前只有 normal 类的连接，replica、pubsub 的限制留给将来的复制和发布订阅连接
+	class config.ClientClass
+
+	// omem 是连接积压的回复字节数，由连接所在的 goroutine（或事件循环）更新，CLIENT LIST 读取；
+	// softLimitSince 是积压开始超过软限制的时间，只由连接所在的 goroutine 访问
+	omem           atomic.Int64
+	softLimitSince time.Time
+	// idle 在 goroutine 后端的连接等待下一条命令时为 true，排空时只唤醒这样的连接
+	idle atomic.Bool
+
+	mu         sync.Mutex
+	lastCmd    string
+	lastActive time.Time
+	// name 由 CLIENT SETNAME 或 HELLO SETNAME 设置，libName、libVer 由 CLIENT SETINFO 设置
+	name    string
+	libName string
+	libVer  string
+}
+
+// internalClient 返回一个不在客户端列表中的临时客户端，用于 HTTP 网关、定时任务等不经过 TCP 连接执行的命令，
+// caller 是审计日志中记录的执行者
+func internalClient(caller string) *client {
+	now := time.Now()
+	return &client{caller: caller, createdAt: now, lastActive: now}
+}
+
+func (srv *Server) registerClient(addr string, conn net.Conn) *client {
+	now := time.Now()
+	c := &client{id: srv.nextClientID.Add(1), addr: addr, conn: conn, createdAt: now, lastActive: now}
+	c.caller = "id=" + strconv.FormatInt(c.id, 10) + " addr=" + addr
+	srv.clients.mu.Lock()
+	srv.clients.byID[c.id] = c
+	srv.clients.mu.Unlock()
+	srv.totalConnections.Add(1)
+	return c
+}
+
+func (srv *Server) unregisterClient(c *client) {
+	srv.clients.mu.Lock()
+	delete(srv.clients.byID, c.id)
+	srv.clients.mu.Unlock()
+}
+
+// tooManyClients 判断连接数是否已经达到 Options.MaxClients
+func (srv *Server) tooManyClients() bool {
+	if srv.opts.MaxClients <= 0 {
+		return false
+	}
+	srv.clients.mu.Lock()
+	defer srv.clients.mu.Unlock()
+	return len(srv.clients.byID) >= srv.opts.MaxClients
+}
+
+// closeClients 关闭 goroutine 后端的所有客户端连接，连接的处理 goroutine 随后退出
+func (srv *Server) closeClients() {
+	srv.clients.mu.Lock()
+	defer srv.clients.mu.Unlock()
+	for _, c := range srv.clients.byID {
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+// wakeIdleClients 唤醒 goroutine 后端正在等待下一条命令的连接，连接发现在排空后自行关闭。
+// 连接可能在唤醒之后又设置了新的读超时，因此排空期间会反复调用
+func (srv *Server) wakeIdleClients() {
+	srv.clients.mu.Lock()
+	defer srv.clients.mu.Unlock()
+	for _, c := range srv.clients.byID {
+		if c.conn != nil && c.idle.Load() {
+			c.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// outputLimitExceeded 记录连接当前积压的回复字节数 pending，按连接类别的 client-output-buffer-limit 判断是否应断开连接。
+// 只由连接所在的 goroutine 调用
+func (srv *Server) outputLimitExceeded(c *client, pending int64, now time.Time) bool {
+	c.omem.Store(pending)
+	limit := config.Get().ClientOutputBufferLimit[c.class]
+	exceeded := limit.Hard > 0 && pending > limit.Hard
+	if limit.Soft > 0 && pending > limit.Soft {
+		if c.softLimitSince.IsZero() {
+			c.softLimitSince = now
+		}
+		exceeded = exceeded || now.Sub(c.softLimitSince) >= time.Duration(limit.SoftSeconds)*time.Second
+	} else {
+		c.softLimitSince = time.Time{}
+	}
+	if exceeded {
+		srv.outputLimitDisconnections.Add(1)
+		srv.logger.Printf("Client %s scheduled to be closed for overcoming of output buffer limits (%d bytes pending, class %s)\n", c.addr, pending, c.class)
+	}
+	return exceeded
+}
+
+// touch 记录客户端刚执行完的命令
+func (c *client) touch(cmd string) {
+	c.mu.Lock()
+	c.lastCmd = cmd
+	c.lastActive = time.Now()
+	c.mu.Unlock()
+}
+
+// clientInfo 是某一时刻客户端状态的副本
+type clientInfo struct {
+	ID      int64  `json:"id"`
+	Addr    string `json:"addr"`
+	Name    string `json:"name"`
+	Age     int    `json:"age"`
+	Idle    int    `json:"idle"`
+	OMem    int64  `json:"omem"`
+	LastCmd string `json:"cmd"`
+	LibName string `json:"lib_name"`
+	LibVer  string `json:"lib_ver"`
+}
+
+// info 返回客户端状态的副本
+func (c *client) info(now time.Time) clientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return clientInfo{
+		ID:      c.id,
+		Addr:    c.addr,
+		Name:    c.name,
+		Age:     int(now.Sub(c.createdAt).Seconds()),
+		Idle:    int(now.Sub(c.lastActive).Seconds()),
+		OMem:    c.omem.Load(),
+		LastCmd: strings.ToLower(c.lastCmd),
+		LibName: c.libName,
+		LibVer:  c.libVer,
+	}
+}
+
+// listClients 按 ID 顺序返回当前所有客户端
+func (srv *Server) listClients() []clientInfo {
+	srv.clients.mu.Lock()
+	list := make([]*client, 0, len(srv.clients.byID))
+	for _, c := range srv.clients.byID {
+		list = append(list, c)
+	}
+	srv.clients.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+
+	now := time.Now()
+	infos := make([]clientInfo, len(list))
+	for i, c := range list {
+		infos[i] = c.info(now)
+	}
+	return infos
+}
+
+func (srv *Server) connectedClients() int {
+	srv.clients.mu.Lock()
+	defer srv.clients.mu.Unlock()
+	return len(srv.clients.byID)
+}
+
+// logClient 按 client-log-level 输出客户端连接、断开的日志
+func (srv *Server) logClient(v ...any) {
+	if config.ShouldLog(config.Get().ClientLogLevel) {
+		srv.logger.Println(v...)
+	}
+}
+
+// writeClientLine 按 CLIENT LIST 的格式写出一个客户端
+func writeClientLine(b *strings.Builder, c clientInfo) {
+	b.WriteString("id=" + strconv.FormatInt(c.ID, 10))
+	b.WriteString(" addr=" + c.Addr)
+	b.WriteString(" name=" + c.Name)
+	b.WriteString(" age=" + strconv.Itoa(c.Age))
+	b.WriteString(" idle=" + strconv.Itoa(c.Idle))
+	b.WriteString(" omem=" + strconv.FormatInt(c.OMem, 10))
+	b.WriteString(" cmd=" + c.LastCmd)
+	b.WriteString(" resp=2")
+	b.WriteString(" lib-name=" + c.LibName)
+	b.WriteString(" lib-ver=" + c.LibVer + "\n")
+}
+
+// CLIENT LIST 命令：每行返回一个客户端的 id、地址、名称、连接时长、空闲时长、积压的回复字节数、最近执行的命令、协议版本以及客户端库的名称和版本，
+// 格式与 Redis 相同
+func (srv *Server) handleClientList(w *resp.Writer, args []string) {
+	var b strings.Builder
+	for _, c := range srv.listClients() {
+		writeClientLine(&b, c)
+	}
+	w.WriteBulk(b.String())
+}
+
+// CLIENT INFO 命令：按 CLIENT LIST 的格式返回当前连接
+func (srv *Server) handleClientInfo(c *client, w *resp.Writer, args []string) {
+	var b strings.Builder
+	writeClientLine(&b, c.info(time.Now()))
+	w.WriteBulk(b.String())
+}
+
+// CLIENT ID 命令：返回当前连接的 ID
+func (srv *Server) handleClientID(c *client, w *resp.Writer, args []string) {
+	w.WriteInteger(int(c.id))
+}
+
+// validClientAttr 检查客户端名称或库名称、版本中是否只有可见字符且没有空格，这些值会原样出现在 CLIENT LIST 中
+func validClientAttr(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] <= ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// CLIENT SETNAME 命令：CLIENT SETNAME name，设置当前连接的名称，空字符串表示清除
+func (srv *Server) handleClientSetName(c *client, w *resp.Writer, args []string) {
+	if !validClientAttr(args[2]) {
+		w.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+		return
+	}
+	c.mu.Lock()
+	c.name = args[2]
+	c.mu.Unlock()
+	w.WriteString("+OK\r\n")
+}
+
+// CLIENT GETNAME 命令：返回当前连接的名称，没有设置时返回 nil
+func (srv *Server) handleClientGetName(c *client, w *resp.Writer, args []string) {
+	c.mu.Lock()
+	name := c.name
+	c.mu.Unlock()
+	if name == "" {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteBulk(name)
+}
+
+// CLIENT SETINFO 命令：CLIENT SETINFO LIB-NAME|LIB-VER value，记录客户端库的名称和版本，显示在 CLIENT LIST 中
+func (srv *Server) handleClientSetInfo(c *client, w *resp.Writer, args []string) {
+	attr, value := strings.ToLower(args[2]), args[3]
+	if attr != "lib-name" && attr != "lib-ver" {
+		w.WriteError("ERR Unrecognized option '" + args[2] + "'")
+		return
+	}
+	if !validClientAttr(value) {
+		w.WriteError("ERR " + attr + " cannot contain spaces, newlines or special characters.")
+		return
+	}
+	c.mu.Lock()
+	if attr == "lib-name" {
+		c.libName = value
+	} else {
+		c.libVer = value
+	}
+	c.mu.Unlock()
+	w.WriteString("+OK\r\n")
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// commandSpec 描述一条命令（或子命令）的参数格式、涉及的键和处理函数。
+// dispatchCommand 在调用处理函数之前按描述统一检查参数，处理函数可以假定参数个数、整数参数和可选项的语法都是正确的，
+// 只需检查取值范围等与命令语义相关的条件
+type commandSpec struct {
+	name string // 小写的完整名称，子命令为 "config|get"，用于错误信息
+	// arity 与 Redis 相同：正数表示参数个数（包括命令名）必须等于它，负数表示至少为 -arity；maxArgs 大于 0 时参数个数不能超过它
+	arity   int
+	maxArgs int
+	flags   CommandFlags
+	keys    keySpec
+	// getKeys 不为空时代替 keys 从参数中取出键，用于键的位置由参数决定的命令（例如 FCALL 的 numkeys）
+	getKeys func(request []string) []string
+	// extraKeys 不为空时返回命令执行时还要访问的其他键，这些键由键空间中的数据决定（例如 TS.ADD 写入降采样规则的目标键），
+	// 调用时已经持有 extractKeys 返回的键所在分片的锁，见 runCommandKeys
+	extraKeys func(srv *Server, request []string) []string
+	// intArgs 是必须为整数的参数位置，参数个数可变时只检查存在的位置
+	intArgs []int
+	// optionsFrom 大于 0 时，从这个位置开始的参数都是 options 中的可选项
+	optionsFrom int
+	options     []commandOption
+	handler     CommandHandler
+	// clientHandler 不为空时代替 handler，用于需要读写当前连接状态的命令（例如 HELLO、CLIENT SETNAME）
+	clientHandler func(srv *Server, c *client, w *resp.Writer, args []string)
+	// subcommands 不为空时 handler 不使用，按第二个参数选择子命令，子命令各自描述参数格式
+	subcommands []*commandSpec
+	custom      bool // 通过 RegisterCommand 注册的自定义命令
+}
+
+// keySpec 是键参数的位置，与 Redis 命令表中的 firstkey、lastkey、step 相同：last 为 -1 表示直到最后一个参数，
+// first 为 0 表示命令不访问键空间
+type keySpec struct {
+	first, last, step int
+}
+
+var (
+	firstKey = keySpec{1, 1, 1}
+	allKeys  = keySpec{1, -1, 1}
+)
+
+// extract 返回 request 中的键
+func (k keySpec) extract(request []string) []string {
+	if k.first == 0 || k.first >= len(request) {
+		return nil
+	}
+	last := k.last
+	if last < 0 {
+		last += len(request)
+	}
+	last = min(last, len(request)-1)
+	if k.step == 1 {
+		return request[k.first : last+1]
+	}
+	var keys []string
+	for i := k.first; i <= last; i += k.step {
+		keys = append(keys, request[i])
+	}
+	return keys
+}
+
+// commandOption 是一个可选项，例如 SET 的 EX seconds
+type commandOption struct {
+	name string // 大写
+	arg  optionArg
+	// group 不为空时，同一组的选项最多出现一个，例如 SET 的 EX 与 PX
+	group string
+}
+
+type optionArg int
+
+const (
+	optNoArg  optionArg = iota
+	optArg              // 后面跟一个参数
+	optIntArg           // 后面跟一个整数参数
+)
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+)
+
+// commandTable 按大写的命令名保存所有命令，包括 RegisterCommand 注册的自定义命令，只在开始处理命令之前修改
+var commandTable = make(map[string]*commandSpec)
+
+func init() {
+	for _, spec := range []*commandSpec{
+		{name: "get", arity: -2, keys: firstKey, optionsFrom: 2, options: []commandOption{
+			{name: "WITHLOCK", arg: optIntArg},
+		}, handler: (*Server).handleGet},
+		{name: "set", arity: -3, flags: CmdDenyOOM, keys: firstKey, optionsFrom: 3, options: []commandOption{
+			{name: "EX", arg: optIntArg, group: "expire"},
+			{name: "PX", arg: optIntArg, group: "expire"},
+		}, handler: (*Server).handleSet},
+		{name: "cas", arity: -4, flags: CmdDenyOOM, keys: firstKey, optionsFrom: 4, options: []commandOption{
+			{name: "EX", arg: optIntArg, group: "expire"},
+			{name: "PX", arg: optIntArg, group: "expire"},
+		}, handler: (*Server).handleCAS},
+		{name: "cad", arity: 3, keys: firstKey, handler: (*Server).handleCAD},
+		{name: "throttle", arity: -5, maxArgs: 6, flags: CmdDenyOOM, keys: firstKey, intArgs: []int{2, 3, 4, 5}, handler: (*Server).handleThrottle},
+		{name: "lock", arity: 4, flags: CmdDenyOOM, keys: firstKey, intArgs: []int{3}, handler: (*Server).handleLock},
+		{name: "unlock", arity: 3, keys: firstKey, handler: (*Server).handleUnlock},
+		{name: "extend", arity: 4, keys: firstKey, intArgs: []int{3}, handler: (*Server).handleExtend},
+		{name: "del", arity: -2, keys: allKeys, handler: (*Server).handleDel},
+		{name: "ttl", arity: 2, keys: firstKey, handler: (*Server).handleTTL},
+		{name: "expirematch", arity: -3, maxArgs: 4, intArgs: []int{2}, optionsFrom: 3, options: []commandOption{
+			{name: "NX", group: "condition"},
+			{name: "XX", group: "condition"},
+		}, handler: (*Server).handleExpireMatch},
+		{name: "ttlscan", arity: -2, intArgs: []int{1}, optionsFrom: 2, options: []commandOption{
+			{name: "MATCH", arg: optArg},
+			{name: "COUNT", arg: optIntArg},
+		}, handler: (*Server).handleTTLScan},
+		{name: "rename", arity: 3, flags: CmdDenyOOM, keys: keySpec{1, 2, 1}, handler: (*Server).handleRename},
+		{name: "msetnx", arity: -3, flags: CmdDenyOOM, keys: keySpec{1, -1, 2}, handler: (*Server).handleMSetNX},
+		{name: "lpush", arity: -3, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleLPush},
+		{name: "rpush", arity: -3, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleRPush},
+		{name: "lpop", arity: 2, keys: firstKey, handler: (*Server).handleLPop},
+		{name: "rpop", arity: 2, keys: firstKey, handler: (*Server).handleRPop},
+		{name: "lmove", arity: 5, flags: CmdDenyOOM, keys: keySpec{1, 2, 1}, handler: (*Server).handleLMove},
+		{name: "lrange", arity: 4, keys: firstKey, intArgs: []int{2, 3}, handler: (*Server).handleLRange},
+		{name: "sadd", arity: -3, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleSAdd},
+		{name: "smembers", arity: 2, keys: firstKey, handler: (*Server).handleSMembers},
+		{name: "srem", arity: -3, keys: firstKey, handler: (*Server).handleSRem},
+		{name: "sinterstore", arity: -3, flags: CmdDenyOOM, keys: allKeys, handler: (*Server).handleSInterStore},
+		{name: "hset", arity: -4, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleHSet},
+		{name: "hget", arity: 3, keys: firstKey, handler: (*Server).handleHGet},
+		{name: "hdel", arity: -3, keys: firstKey, handler: (*Server).handleHDel},
+		{name: "cf.reserve", arity: -3, flags: CmdDenyOOM, keys: firstKey, intArgs: []int{2}, optionsFrom: 3, options: []commandOption{
+			{name: "BUCKETSIZE", arg: optIntArg},
+			{name: "MAXITERATIONS", arg: optIntArg},
+			{name: "EXPANSION", arg: optIntArg},
+		}, handler: (*Server).handleCFReserve},
+		{name: "cf.add", arity: 3, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleCFAdd},
+		{name: "cf.addnx", arity: 3, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleCFAddNX},
+		{name: "cf.exists", arity: 3, keys: firstKey, handler: (*Server).handleCFExists},
+		{name: "cf.del", arity: 3, keys: firstKey, handler: (*Server).handleCFDel},
+		{name: "cf.count", arity: 3, keys: firstKey, handler: (*Server).handleCFCount},
+		{name: "cf.info", arity: 2, keys: firstKey, handler: (*Server).handleCFInfo},
+		{name: "ts.create", arity: -2, flags: CmdDenyOOM, keys: firstKey, handler: (*Server).handleTSCreate},
+		{name: "ts.add", arity: -4, flags: CmdDenyOOM, keys: firstKey, extraKeys: tsAddExtraKeys, handler: (*Server).handleTSAdd},
+		{name: "ts.get", arity: 2, keys: firstKey, handler: (*Server).handleTSGet},
+		{name: "ts.info", arity: 2, keys: firstKey, handler: (*Server).handleTSInfo},
+		{name: "ts.range", arity: -4, keys: firstKey, handler: (*Server).handleTSRange},
+		{name: "ts.mrange", arity: -5, handler: (*Server).handleTSMRange},
+		{name: "ts.createrule", arity: 6, keys: keySpec{1, 2, 1}, intArgs: []int{5}, handler: (*Server).handleTSCreateRule},
+		{name: "ts.deleterule", arity: 3, keys: keySpec{1, 2, 1}, handler: (*Server).handleTSDeleteRule},
+		{name: "qpush", arity: 4, flags: CmdDenyOOM, keys: firstKey, intArgs: []int{3}, handler: (*Server).handleQPush},
+		{name: "qpop", arity: 2, keys: firstKey, handler: (*Server).handleQPop},
+		{name: "qlen", arity: 2, keys: firstKey, handler: (*Server).handleQLen},
+		{name: "qclaim", arity: -3, getKeys: qclaimKeys, intArgs: []int{2}, optionsFrom: 3, options: []commandOption{
+			{name: "COUNT", arg: optIntArg},
+			{name: "MAXDELIVERIES", arg: optIntArg},
+			{name: "DEADLETTER", arg: optArg},
+		}, handler: (*Server).handleQClaim},
+		{name: "qack", arity: -3, keys: firstKey, handler: (*Server).handleQAck},
+		{name: "ft.create", arity: -5, handler: (*Server).handleFTCreate},
+		{name: "ft.search", arity: -3, handler: (*Server).handleFTSearch},
+		{name: "ft.dropindex", arity: 2, handler: (*Server).handleFTDropIndex},
+		{name: "ft.info", arity: 2, handler: (*Server).handleFTInfo},
+		{name: "ft._list", arity: 1, handler: (*Server).handleFTList},
+
+		{name: "lbadd", arity: -3, intArgs: []int{2}, optionsFrom: 3, options: []commandOption{
+			{name: "META", arg: optArg},
+		}, handler: (*Server).handleLBAdd},
+		{name: "lbincrby", arity: 3, intArgs: []int{2}, handler: (*Server).handleLBIncrBy},
+		{name: "lbtop", arity: -2, maxArgs: 3, intArgs: []int{1}, optionsFrom: 2, options: leaderboardReplyOptionSpecs,
+			handler: (*Server).handleLBTop},
+		{name: "lbrem", arity: 2, handler: (*Server).handleLBRem},
+		{name: "lbclear", arity: 1, handler: (*Server).handleLBClear},
+		{name: "lbaround", arity: 3, intArgs: []int{2}, handler: (*Server).handleLBAround},
+		{name: "lbpercentile", arity: 2, handler: (*Server).handleLBPercentile},
+		{name: "lbcount", arity: 3, handler: (*Server).handleLBCount},
+		{name: "lbchanges", arity: -3, optionsFrom: 3, options: []commandOption{
+			{name: "COUNT", arg: optIntArg},
+		}, handler: (*Server).handleLBChanges},
+		{name: "lbseason", arity: -2, subcommands: []*commandSpec{
+			{name: "lbseason|current", arity: 2, handler: (*Server).handleLBSeasonCurrent},
+			{name: "lbseason|list", arity: 2, handler: (*Server).handleLBSeasonList},
+			{name: "lbseason|top", arity: -4, maxArgs: 5, intArgs: []int{3}, optionsFrom: 4, options: leaderboardReplyOptionSpecs,
+				handler: (*Server).handleLBSeasonTop},
+			{name: "lbseason|range", arity: -5, intArgs: []int{3, 4}, optionsFrom: 5, options: leaderboardReplyOptionSpecs,
+				handler: (*Server).handleLBSeasonRange},
+			{name: "lbseason|rotate", arity: 2, handler: (*Server).handleLBSeasonRotate},
+		}},
+		{name: "lbrange", arity: -3, intArgs: []int{1, 2}, optionsFrom: 3, options: leaderboardReplyOptionSpecs,
+			handler: (*Server).handleLBRange},
+		{name: "lbrank", arity: 2, handler: (*Server).handleLBRank},
+		{name: "lbscore", arity: 2, handler: (*Server).handleLBScore},
+		{name: "lbhistory", arity: -2, maxArgs: 3, intArgs: []int{2}, handler: (*Server).handleLBHistory},
+
+		{name: "object", arity: -2, subcommands: []*commandSpec{
+			{name: "object|encoding", arity: 3, keys: keySpec{2, 2, 1}, handler: (*Server).handleObjectEncoding},
+		}},
+		{name: "memory", arity: -2, subcommands: []*commandSpec{
+			{name: "memory|usage", arity: -3, keys: keySpec{2, 2, 1}, optionsFrom: 3, options: []commandOption{
+				{name: "SAMPLES", arg: optIntArg},
+			}, handler: (*Server).handleMemoryUsage},
+			{name: "memory|bigkeys", arity: -2, optionsFrom: 2, options: []commandOption{
+				{name: "COUNT", arg: optIntArg},
+				{name: "BY", arg: optArg},
+			}, handler: (*Server).handleMemoryBigKeys},
+			{name: "memory|doctor", arity: 2, handler: (*Server).handleMemoryDoctor},
+			{name: "memory|purge", arity: 2, handler: (*Server).handleMemoryPurge},
+			{name: "memory|help", arity: 2, handler: (*Server).handleMemoryHelp},
+		}},
+		{name: "latency", arity: -2, subcommands: []*commandSpec{
+			{name: "latency|doctor", arity: 2, handler: (*Server).handleLatencyDoctor},
+			{name: "latency|help", arity: 2, handler: (*Server).handleLatencyHelp},
+		}},
+		{name: "function", arity: -2, flags: CmdNoGateway, subcommands: []*commandSpec{
+			{name: "function|load", arity: -3, maxArgs: 4, handler: (*Server).handleFunctionLoad},
+			{name: "function|delete", arity: 3, handler: (*Server).handleFunctionDelete},
+			{name: "function|list", arity: 2, handler: (*Server).handleFunctionList},
+		}},
+		{name: "fcall", arity: -3, flags: CmdDenyOOM, intArgs: []int{2}, getKeys: fcallKeys, handler: (*Server).handleFCall},
+		{name: "schedule", arity: -2, flags: CmdNoGateway, subcommands: []*commandSpec{
+			{name: "schedule|add", arity: -5, handler: (*Server).handleScheduleAdd},
+			{name: "schedule|remove", arity: 3, handler: (*Server).handleScheduleRemove},
+			{name: "schedule|list", arity: 2, handler: (*Server).handleScheduleList},
+		}},
+		{name: "info", arity: -1, flags: CmdLoading, handler: (*Server).handleInfo},
+		{name: "save", arity: 1, flags: CmdNoGateway, handler: (*Server).handleSave},
+		{name: "bgsave", arity: 1, flags: CmdNoGateway, handler: (*Server).handleBgSave},
+		{name: "lastsave", arity: 1, flags: CmdLoading, handler: (*Server).handleLastSave},
+		{name: "config", arity: -2, flags: CmdLoading | CmdNoGateway, subcommands: []*commandSpec{
+			{name: "config|get", arity: -3, handler: (*Server).handleConfigGet},
+			{name: "config|set", arity: -4, handler: (*Server).handleConfigSet},
+			{name: "config|rewrite", arity: 2, handler: (*Server).handleConfigRewrite},
+		}},
+		{name: "hello", arity: -1, flags: CmdLoading | CmdNoGateway, clientHandler: (*Server).handleHello},
+		{name: "ping", arity: -1, flags: CmdLoading, maxArgs: 2, handler: (*Server).handlePing},
+		{name: "echo", arity: 2, flags: CmdLoading, handler: (*Server).handleEcho},
+		{name: "client", arity: -2, flags: CmdLoading | CmdNoGateway, subcommands: []*commandSpec{
+			{name: "client|list", arity: 2, handler: (*Server).handleClientList},
+			{name: "client|info", arity: 2, clientHandler: (*Server).handleClientInfo},
+			{name: "client|id", arity: 2, clientHandler: (*Server).handleClientID},
+			{name: "client|setname", arity: 3, clientHandler: (*Server).handleClientSetName},
+			{name: "client|getname", arity: 2, clientHandler: (*Server).handleClientGetName},
+			{name: "client|setinfo", arity: 4, clientHandler: (*Server).handleClientSetInfo},
+		}},
+		{name: "slowlog", arity: -2, flags: CmdLoading | CmdNoGateway, subcommands: []*commandSpec{
+			{name: "slowlog|get", arity: -2, maxArgs: 3, handler: (*Server).handleSlowlogGet},
+			{name: "slowlog|len", arity: 2, handler: (*Server).handleSlowlogLen},
+			{name: "slowlog|reset", arity: 2, handler: (*Server).handleSlowlogReset},
+		}},
+		{name: "auditlog", arity: -2, flags: CmdLoading, subcommands: []*commandSpec{
+			{name: "auditlog|get", arity: -2, maxArgs: 3, handler: (*Server).handleAuditlogGet},
+			{name: "auditlog|len", arity: 2, handler: (*Server).handleAuditlogLen},
+		}},
+		{name: "drain", arity: -2, flags: CmdLoading | CmdNoGateway, subcommands: []*commandSpec{
+			{name: "drain|start", arity: 3, intArgs: []int{2}, handler: (*Server).handleDrainStart},
+			{name: "drain|cancel", arity: 2, handler: (*Server).handleDrainCancel},
+			{name: "drain|status", arity: 2, handler: (*Server).handleDrainStatus},
+		}},
+		{name: "quit", arity: -1, flags: CmdLoading | CmdNoGateway, handler: func(srv *Server, w *resp.Writer, args []string) {
+			w.WriteString("+OK\r\n")
+		}},
+	} {
+		commandTable[strings.ToUpper(spec.name)] = spec
+	}
+}
+
+// lookupCommand 按命令名（以及子命令名）查找命令，找不到时返回要回复给客户端的错误
+func lookupCommand(request []string) (*commandSpec, string) {
+	spec, ok := commandTable[strings.ToUpper(request[0])]
+	if !ok {
+		return nil, unknownCommandError(request)
+	}
+	if len(spec.subcommands) == 0 {
+		return spec, ""
+	}
+	if len(request) < 2 {
+		return nil, "ERR wrong number of arguments for '" + spec.name + "' command"
+	}
+	for _, sub := range spec.subcommands {
+		if _, subName, _ := strings.Cut(sub.name, "|"); strings.EqualFold(subName, request[1]) {
+			return sub, ""
+		}
+	}
+	return nil, "ERR unknown subcommand '" + request[1] + "'. Try " + spec.subcommandHint()
+}
+
+// unknownCommandError 返回未知命令的错误，格式与 Redis 相同：命令名以及最多约 128 字节的参数
+func unknownCommandError(request []string) string {
+	var args strings.Builder
+	for _, arg := range request[1:] {
+		if args.Len() >= 128 {
+			break
+		}
+		args.WriteString("'" + truncate(arg, 128-args.Len()) + "' ")
+	}
+	return "ERR unknown command '" + truncate(request[0], 128) + "', with args beginning with: " + args.String()
+}
+
+// truncate 返回 s 的前 n 个字节
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// subcommandHint 是未知子命令的错误中提示的用法：有 HELP 子命令时提示 HELP，否则列出所有子命令
+func (spec *commandSpec) subcommandHint() string {
+	upper := strings.ToUpper(spec.name)
+	names := make([]string, 0, len(spec.subcommands))
+	for _, sub := range spec.subcommands {
+		_, subName, _ := strings.Cut(strings.ToUpper(sub.name), "|")
+		if subName == "HELP" {
+			return upper + " HELP."
+		}
+		names = append(names, subName)
+	}
+	return upper + " " + strings.Join(names, "|")
+}
+
+// check 按描述检查参数，不合法时返回要回复给客户端的错误
+func (spec *commandSpec) check(request []string) string {
+	n := len(request)
+	if (spec.arity > 0 && n != spec.arity) || (spec.arity < 0 && n < -spec.arity) || (spec.maxArgs > 0 && n > spec.maxArgs) {
+		return "ERR wrong number of arguments for '" + spec.name + "' command"
+	}
+	for _, i := range spec.intArgs {
+		if i < n && !isInteger(request[i]) {
+			return errNotInteger
+		}
+	}
+	if spec.optionsFrom == 0 {
+		return ""
+	}
+	seen := make(map[string]bool)
+	for i := spec.optionsFrom; i < n; i++ {
+		opt := spec.findOption(request[i])
+		if opt == nil || seen[opt.name] || (opt.group != "" && seen[opt.group]) {
+			return errSyntax
+		}
+		seen[opt.name] = true
+		if opt.group != "" {
+			seen[opt.group] = true
+		}
+		if opt.arg == optNoArg {
+			continue
+		}
+		if i++; i >= n {
+			return errSyntax
+		}
+		if opt.arg == optIntArg && !isInteger(request[i]) {
+			return errNotInteger
+		}
+	}
+	return ""
+}
+
+func (spec *commandSpec) findOption(arg string) *commandOption {
+	for i := range spec.options {
+		if strings.EqualFold(spec.options[i].name, arg) {
+			return &spec.options[i]
+		}
+	}
+	return nil
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+// commandKeys 返回命令涉及的键，用于确定命令在哪些分片上执行。排行榜等不访问键空间的命令以及未知的命令返回 nil
+func commandKeys(request []string) []string {
+	spec, _ := lookupCommand(request)
+	if spec == nil {
+		return nil
+	}
+	return spec.extractKeys(request)
+}
+
+// extractKeys 返回 request 中属于这条命令的键
+func (spec *commandSpec) extractKeys(request []string) []string {
+	if spec.getKeys != nil {
+		return spec.getKeys(request)
+	}
+	return spec.keys.extract(request)
+}
@@ -0,0 +1,548 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// GET 命令：GET key [WITHLOCK milliseconds]，返回指定键对应的字符串值。
+// WITHLOCK 用于防止缓存击穿：键不存在时只有取得重建锁的客户端得到 nil，其他客户端得到 LOCKED 错误，见 readthrough.go
+func (srv *Server) handleGet(w *resp.Writer, args []string) {
+	key := args[1]
+	var lockTTL time.Duration
+	if len(args) == 4 {
+		ms, _ := strconv.Atoi(args[3])
+		if ms <= 0 {
+			w.WriteString("-ERR invalid lock time in 'get' command\r\n")
+			return
+		}
+		lockTTL = time.Duration(ms) * time.Millisecond
+	}
+	entry, ok := srv.store.Load(key)
+	if ok && entry.IsExpired() {
+		srv.store.Delete(key)
+		ok = false
+	}
+	if !ok {
+		if lockTTL > 0 {
+			if !srv.acquireRegenLock(key, lockTTL) {
+				w.WriteString("-LOCKED key is being regenerated by another client, retry later\r\n")
+				return
+			}
+		}
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if entry.Type != store.StringType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	w.WriteBulk(entry.Value.(string))
+}
+
+// SET 命令：设置字符串键值，并支持 EX/PX 选项设置过期时间
+func (srv *Server) handleSet(w *resp.Writer, args []string) {
+	key := args[1]
+	value := args[2]
+	if errMsg := checkStringSizes(value); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	var expireAt time.Time
+	if len(args) == 5 {
+		// 选项的语法已由命令表检查，EX 与 PX 最多出现一个
+		var ok bool
+		if expireAt, ok = expireTime(args[3], args[4]); !ok {
+			w.WriteString("-ERR invalid expire time in 'set' command\r\n")
+			return
+		}
+	}
+	entry := &store.Entry{
+		Type:     store.StringType,
+		Value:    value,
+		ExpireAt: expireAt,
+	}
+	srv.store.Put(key, entry)
+	w.WriteString("+OK\r\n")
+}
+
+// expireTime 返回 EX seconds 或 PX milliseconds（option 为 EX 或 PX，arg 是已经检查过的整数）对应的过期时间。
+// arg 不是正数、换算为 time.Duration 后溢出或者加上当前时间后超出 unix 纳秒的范围（约 2262 年）时返回 false，
+// 命令与 Redis 一样回复 invalid expire time
+func expireTime(option, arg string) (time.Time, bool) {
+	n, _ := strconv.ParseInt(arg, 10, 64)
+	unit := time.Millisecond
+	if strings.EqualFold(option, "EX") {
+		unit = time.Second
+	}
+	now := time.Now()
+	if n <= 0 || n > (math.MaxInt64-now.UnixNano())/int64(unit) {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(n) * unit), true
+}
+
+// CAS 命令：CAS key expected value [EX seconds|PX milliseconds]，键的值等于 expected 时改为 value 并返回 1，
+// 不相等时返回 0，键不存在时返回 -1。不指定 EX/PX 时保留原来的过期时间。用于不需要 MULTI/WATCH 的乐观并发控制
+func (srv *Server) handleCAS(w *resp.Writer, args []string) {
+	key := args[1]
+	if errMsg := checkStringSizes(args[3]); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	var expireAt time.Time
+	if len(args) == 6 {
+		// 选项的语法已由命令表检查，EX 与 PX 最多出现一个
+		var ok bool
+		if expireAt, ok = expireTime(args[4], args[5]); !ok {
+			w.WriteString("-ERR invalid expire time in 'cas' command\r\n")
+			return
+		}
+	}
+	entry, wrongType := srv.lookupTyped(key, store.StringType, false)
+	switch {
+	case wrongType:
+		w.WriteError(errWrongType)
+	case entry == nil:
+		w.WriteInteger(-1)
+	case entry.Value.(string) != args[2]:
+		w.WriteInteger(0)
+	default:
+		if expireAt.IsZero() {
+			expireAt = entry.ExpireAt
+		}
+		srv.store.Put(key, &store.Entry{Type: store.StringType, Value: args[3], ExpireAt: expireAt})
+		w.WriteInteger(1)
+	}
+}
+
+// CAD 命令：CAD key expected，键的值等于 expected 时删除键并返回 1，不相等时返回 0，键不存在时返回 -1。
+// 用于只删除自己写入的值，例如用 SET key token PX ms 保存的租约：只有持有者（值为自己的令牌）才能删除。
+// 本服务的 SET 不支持 NX，需要互斥的锁应当使用 LOCK / UNLOCK（见 lock.go）
+func (srv *Server) handleCAD(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.StringType, false)
+	switch {
+	case wrongType:
+		w.WriteError(errWrongType)
+	case entry == nil:
+		w.WriteInteger(-1)
+	case entry.Value.(string) != args[2]:
+		w.WriteInteger(0)
+	default:
+		srv.store.Delete(args[1])
+		w.WriteInteger(1)
+	}
+}
+
+// DEL 命令：删除一个或多个键
+func (srv *Server) handleDel(w *resp.Writer, args []string) {
+	count := 0
+	for _, key := range args[1:] {
+		if entry, ok := srv.store.Load(key); ok {
+			if entry.IsExpired() {
+				srv.store.Delete(key)
+			} else {
+				srv.store.Delete(key)
+				count++
+			}
+		}
+	}
+	w.WriteInteger(count)
+}
+
+// TTL 命令：返回指定键剩余的生存时间（单位秒）
+func (srv *Server) handleTTL(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, ok := srv.store.Load(key)
+	if !ok {
+		w.WriteString(":-2\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString(":-2\r\n")
+		return
+	}
+	if entry.ExpireAt.IsZero() {
+		w.WriteString(":-1\r\n")
+		return
+	}
+	// 与 Redis 相同，剩余时间按四舍五入换算为秒
+	ttl := (time.Until(entry.ExpireAt).Milliseconds() + 500) / 1000
+	w.WriteInteger(int(max(ttl, 0)))
+}
+
+// LPUSH 命令：向列表左侧插入一个或多个元素，并返回列表的新长度
+func (srv *Server) handleLPush(w *resp.Writer, args []string) {
+	srv.pushGeneric(w, args, true)
+}
+
+// RPUSH 命令：向列表右侧追加一个或多个元素，并返回列表的新长度
+func (srv *Server) handleRPush(w *resp.Writer, args []string) {
+	srv.pushGeneric(w, args, false)
+}
+
+// pushGeneric 实现 LPUSH / RPUSH，left 表示插入到列表头部
+func (srv *Server) pushGeneric(w *resp.Writer, args []string, left bool) {
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if ok && entry.IsExpired() {
+		srv.store.Delete(key)
+		ok = false
+	}
+	if ok && entry.Type != store.ListType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	if errMsg := checkStringSizes(args[2:]...); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if !ok {
+		entry = &store.Entry{Type: store.ListType, Value: store.NewListObject()}
+	}
+	list := entry.Value.(*store.ListObject)
+	if errMsg := checkElements(store.ListType, list.Len()+len(args)-2); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if left {
+		list.PushFront(args[2:])
+	} else {
+		list.PushBack(args[2:])
+	}
+	// 已有的列表原地修改，保留原来的过期时间
+	srv.store.PutOrUpdate(key, entry, ok)
+	w.WriteInteger(list.Len())
+}
+
+// LPOP 命令：弹出列表左侧的一个元素
+func (srv *Server) handleLPop(w *resp.Writer, args []string) {
+	srv.popGeneric(w, args, true)
+}
+
+// RPOP 命令：弹出列表右侧的一个元素
+func (srv *Server) handleRPop(w *resp.Writer, args []string) {
+	srv.popGeneric(w, args, false)
+}
+
+// popGeneric 实现 LPOP / RPOP，left 表示从列表头部弹出
+func (srv *Server) popGeneric(w *resp.Writer, args []string, left bool) {
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if entry.Type != store.ListType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	list := entry.Value.(*store.ListObject)
+	var popped string
+	if left {
+		popped, ok = list.PopFront()
+	} else {
+		popped, ok = list.PopBack()
+	}
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if list.Len() == 0 {
+		srv.store.Delete(key)
+	} else {
+		srv.store.Updated(key)
+	}
+	w.WriteBulk(popped)
+}
+
+// SADD 命令：向集合中添加一个或多个成员，返回新增的成员数
+func (srv *Server) handleSAdd(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if ok && entry.IsExpired() {
+		srv.store.Delete(key)
+		ok = false
+	}
+	if ok && entry.Type != store.SetType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	if errMsg := checkStringSizes(args[2:]...); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if !ok {
+		entry = &store.Entry{Type: store.SetType, Value: store.NewSetObject()}
+	}
+	set := entry.Value.(*store.SetObject)
+	if elementLimitEnabled(store.SetType) {
+		if errMsg := checkElements(store.SetType, set.Len()+countNewMembers(set, args[2:])); errMsg != "" {
+			w.WriteError(errMsg)
+			return
+		}
+	}
+	added := 0
+	for _, member := range args[2:] {
+		if set.Add(member) {
+			added++
+		}
+	}
+	// 已有的集合原地修改，保留原来的过期时间
+	srv.store.PutOrUpdate(key, entry, ok)
+	w.WriteInteger(added)
+}
+
+// SMEMBERS 命令：返回集合中的所有成员
+func (srv *Server) handleSMembers(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, ok := srv.store.Load(key)
+	if !ok {
+		w.WriteString("*0\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString("*0\r\n")
+		return
+	}
+	if entry.Type != store.SetType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	set := entry.Value.(*store.SetObject)
+	w.WriteArrayHeader(set.Len())
+	set.ForEach(func(member string) {
+		w.WriteBulk(member)
+	})
+}
+
+// SREM 命令：从集合中删除一个或多个成员，返回删除的成员数量
+func (srv *Server) handleSRem(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if !ok {
+		// 键不存在，直接返回 0
+		w.WriteString(":0\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString(":0\r\n")
+		return
+	}
+	if entry.Type != store.SetType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	set := entry.Value.(*store.SetObject)
+	removed := 0
+	// 遍历待删除的每个成员
+	for _, member := range args[2:] {
+		if set.Remove(member) {
+			removed++
+		}
+	}
+	// 如果删除后集合为空，删除整个键
+	if set.Len() == 0 {
+		srv.store.Delete(key)
+	} else {
+		srv.store.Updated(key)
+	}
+	// 返回删除的成员数量
+	w.WriteInteger(removed)
+}
+
+// HSET 命令：HSET key field value [field value ...]，设置哈希中一个或多个字段的值，返回新增的字段数（更新已有字段不计入）
+func (srv *Server) handleHSet(w *resp.Writer, args []string) {
+	if len(args)%2 != 0 {
+		w.WriteString("-ERR wrong number of arguments for 'hset' command\r\n")
+		return
+	}
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if ok && entry.IsExpired() {
+		srv.store.Delete(key)
+		ok = false
+	}
+	if ok && entry.Type != store.HashType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	if errMsg := checkStringSizes(args[2:]...); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if !ok {
+		entry = &store.Entry{Type: store.HashType, Value: store.NewHashObject()}
+	}
+	hash := entry.Value.(*store.HashObject)
+	if elementLimitEnabled(store.HashType) {
+		if errMsg := checkElements(store.HashType, hash.Len()+countNewFields(hash, args[2:])); errMsg != "" {
+			w.WriteError(errMsg)
+			return
+		}
+	}
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+	// 已有的哈希原地修改，保留原来的过期时间
+	srv.store.PutOrUpdate(key, entry, ok)
+	w.WriteInteger(added)
+}
+
+// HGET 命令：获取哈希中指定字段的值
+func (srv *Server) handleHGet(w *resp.Writer, args []string) {
+	key := args[1]
+	field := args[2]
+	entry, ok := srv.store.Load(key)
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if entry.Type != store.HashType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	value, exists := entry.Value.(*store.HashObject).Get(field)
+	if !exists {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteBulk(value)
+}
+
+// HDEL 命令：删除哈希中一个或多个字段，返回成功删除的字段数
+func (srv *Server) handleHDel(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, ok := srv.store.LoadForWrite(key)
+	if !ok {
+		// 如果 key 不存在，则删除字段数为 0
+		w.WriteString(":0\r\n")
+		return
+	}
+	// 如果 key 已过期，则删除条目并返回 0
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString(":0\r\n")
+		return
+	}
+	// 如果类型不是 HashType，则返回错误
+	if entry.Type != store.HashType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	hash := entry.Value.(*store.HashObject)
+
+	// 统计成功删除的字段数
+	deletedCount := 0
+	for _, field := range args[2:] {
+		if hash.Del(field) {
+			deletedCount++
+		}
+	}
+
+	// 如果删完后 hash 为空，删除整个 key
+	if hash.Len() == 0 {
+		srv.store.Delete(key)
+	} else {
+		srv.store.Updated(key)
+	}
+	w.WriteInteger(deletedCount)
+}
+
+// LRANGE 命令：返回列表中从 start 到 stop 范围内的元素（stop 为闭区间）
+func (srv *Server) handleLRange(w *resp.Writer, args []string) {
+	key := args[1]
+	startIdx, _ := strconv.Atoi(args[2])
+	stopIdx, _ := strconv.Atoi(args[3])
+	// 获取列表数据
+	entry, ok := srv.store.Load(key)
+	if !ok {
+		w.WriteString("*0\r\n")
+		return
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		w.WriteString("*0\r\n")
+		return
+	}
+	if entry.Type != store.ListType {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return
+	}
+	list := entry.Value.(*store.ListObject)
+	n := list.Len()
+
+	// 处理负索引：如果 start 或 stop 为负值，则从列表尾部计算偏移
+	if startIdx < 0 {
+		startIdx = n + startIdx
+	}
+	if stopIdx < 0 {
+		stopIdx = n + stopIdx
+	}
+	// 修正起始和结束索引的边界
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	if stopIdx < 0 {
+		stopIdx = 0
+	}
+	if startIdx > n-1 {
+		w.WriteString("*0\r\n")
+		return
+	}
+	if stopIdx > n-1 {
+		stopIdx = n - 1
+	}
+	if startIdx > stopIdx {
+		w.WriteString("*0\r\n")
+		return
+	}
+	// 按 RESP 协议格式逐个输出元素
+	w.WriteArrayHeader(stopIdx - startIdx + 1)
+	list.Range(startIdx, stopIdx, func(item string) {
+		w.WriteBulk(item)
+	})
+}
+
+// OBJECT ENCODING 命令：OBJECT ENCODING key，返回键的值当前使用的内部编码
+func (srv *Server) handleObjectEncoding(w *resp.Writer, args []string) {
+	key := args[2]
+	entry, ok := srv.store.Load(key)
+	if !ok || entry.IsExpired() {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	var encoding string
+	switch v := entry.Value.(type) {
+	case *store.ListObject:
+		encoding = v.Encoding()
+	case *store.SetObject:
+		encoding = v.Encoding()
+	case *store.HashObject:
+		encoding = v.Encoding()
+	default:
+		encoding = "raw"
+	}
+	w.WriteBulk(encoding)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"path"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// CONFIG GET 命令：CONFIG GET pattern [pattern ...]，返回名称匹配任一 glob 模式的配置项，回复为 名称、值 交替排列的数组
+func (srv *Server) handleConfigGet(w *resp.Writer, args []string) {
+	cfg := config.Get()
+	var reply []string
+	for _, p := range config.Params() {
+		for _, pattern := range args[2:] {
+			if ok, _ := path.Match(strings.ToLower(pattern), p.Name); ok {
+				reply = append(reply, p.Name, p.Value(cfg))
+				break
+			}
+		}
+	}
+	w.WriteArrayHeader(len(reply))
+	for _, s := range reply {
+		w.WriteBulk(s)
+	}
+}
+
+// CONFIG SET 命令：CONFIG SET name value [name value ...]，修改配置，任何一项不合法时所有修改都不生效
+func (srv *Server) handleConfigSet(w *resp.Writer, args []string) {
+	if len(args)%2 != 0 {
+		w.WriteString("-ERR wrong number of arguments for 'config|set' command\r\n")
+		return
+	}
+	var directives [][2]string
+	for i := 2; i < len(args); i += 2 {
+		directives = append(directives, [2]string{args[i], args[i+1]})
+	}
+	if err := config.Set(directives); err != nil {
+		w.WriteError("ERR CONFIG SET failed - " + err.Error())
+		return
+	}
+	srv.configChanged(directives)
+	w.WriteString("+OK\r\n")
+}
+
+// CONFIG REWRITE 命令：把当前生效的配置写回启动时读取的配置文件，见 config.Rewrite
+func (srv *Server) handleConfigRewrite(w *resp.Writer, args []string) {
+	if err := config.Rewrite(); err != nil {
+		w.WriteError("ERR Rewriting config file: " + err.Error())
+		return
+	}
+	srv.logger.Println("CONFIG REWRITE executed with success")
+	w.WriteString("+OK\r\n")
+}
+
+// ReloadConfig 重新读取启动时的配置文件，让可以在运行时修改的配置项生效，cmd/redis-easy 收到 SIGHUP 时调用。
+// 只在启动时生效的配置项即使在文件中改了也保持不变，记录一条日志提示需要重启
+func (srv *Server) ReloadConfig() error {
+	changed, needRestart, err := config.Reload()
+	if err != nil {
+		srv.logger.Println("Error reloading config:", err)
+		return err
+	}
+	if len(needRestart) > 0 {
+		srv.logger.Printf("Config reloaded, restart required for: %s\n", strings.Join(needRestart, ", "))
+	}
+	srv.logger.Printf("Config reloaded, %d parameters changed: %s\n", len(changed), strings.Join(changed, ", "))
+	cfg := config.Get()
+	directives := make([][2]string, len(changed))
+	for i, name := range changed {
+		directives[i] = [2]string{name, config.Find(name).Value(cfg)}
+	}
+	srv.configChanged(directives)
+	return nil
+}
+
+// configChanged 在 CONFIG SET、管理后台或重新载入配置文件修改配置成功后调用，让需要重建状态的配置项生效
+func (srv *Server) configChanged(directives [][2]string) {
+	for _, d := range directives {
+		if strings.EqualFold(d[0], "namespaces") {
+			srv.applyNamespaces()
+			break
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule 计算定时任务的下一次执行时间
+type cronSchedule interface {
+	// next 返回晚于 t 的下一次执行时间，永远不会再执行时返回零值
+	next(t time.Time) time.Time
+}
+
+// everySchedule 是 @every <duration> 形式的固定间隔
+type everySchedule time.Duration
+
+func (d everySchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+// cronExpr 是 5 个字段的标准 cron 表达式：分 时 日 月 星期，每个字段用位图表示允许的取值。
+// 与 cron 相同，日和星期都不是 * 时满足其中之一即可；时间按服务端的本地时区计算
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// cronField 是一个字段的取值范围
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7},
+}
+
+// cronMacros 是常用表达式的简写
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// parseCronSchedule 解析定时任务的执行时间：5 个字段的 cron 表达式、@daily 等简写，或者 @every 10m 形式的固定间隔（至少 1 秒）
+func parseCronSchedule(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid interval '%s', expected a duration of at least 1s", rest)
+		}
+		return everySchedule(d), nil
+	}
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule '%s', expected 5 fields, a macro such as @daily or @every <duration>", spec)
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	e := &cronExpr{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}
+	// 星期日既可以写作 0 也可以写作 7
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	return e, nil
+}
+
+// parseCronField 解析一个字段，支持 *、数字、a-b 范围、/step 步长以及逗号分隔的列表
+func parseCronField(s string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s' in %s field", stepPart, f.name)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		if rangePart != "*" {
+			a, b, isRange := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(a)
+			hi = lo
+			if isRange {
+				hi, err2 = strconv.Atoi(b)
+			} else if hasStep {
+				hi = f.max
+			}
+			if err1 != nil || err2 != nil || lo < f.min || hi > f.max || lo > hi {
+				return 0, fmt.Errorf("invalid value '%s' in %s field, expected %d-%d", part, f.name, f.min, f.max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// cronSearchYears 是查找下一次执行时间的范围，2 月 30 日这种永远不会出现的日期在这个范围内找不到时放弃
+const cronSearchYears = 5
+
+func (e *cronExpr) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case e.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !e.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case e.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case e.minute&(1<<t.Minute()) == 0:
+			// 直接跳到本小时内下一个允许的分钟，没有则进入下一个小时
+			rest := e.minute >> (t.Minute() + 1)
+			if rest == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)+1) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (e *cronExpr) dayMatches(t time.Time) bool {
+	dom := e.dom&(1<<t.Day()) != 0
+	dow := e.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case e.domStar && e.dowStar:
+		return true
+	case e.domStar:
+		return dow
+	case e.dowStar:
+		return dom
+	}
+	return dom || dow
+}
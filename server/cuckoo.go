@@ -0,0 +1,188 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 布谷鸟过滤器命令，命令名和回复与 RedisBloom 的 CF.* 相同。过滤器只保存元素的指纹，
+// 回答“可能存在”或者“一定不存在”，与布隆过滤器不同的是可以删除元素。
+// CF.ADD 等写命令在键不存在时按默认参数自动创建过滤器，需要指定容量时先执行 CF.RESERVE
+
+// cuckooMaxCapacity 是 CF.RESERVE 的容量上限
+const cuckooMaxCapacity = 1 << 30
+
+// cuckooForAdd 取出 key 上的过滤器用于写入，键不存在时按默认参数创建一个；类型不对时回复错误并返回 nil。
+// created 为 true 时调用方需在修改后 Put，否则调用 Updated
+func (srv *Server) cuckooForAdd(w *resp.Writer, key string) (cf *store.CuckooObject, created bool) {
+	entry, wrongType := srv.lookupTyped(key, store.CuckooType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return nil, false
+	}
+	if entry == nil {
+		return store.NewCuckooObject(store.CuckooDefaultCapacity, store.CuckooDefaultBucketSize,
+			store.CuckooDefaultMaxIterations, store.CuckooDefaultExpansion), true
+	}
+	return entry.Value.(*store.CuckooObject), false
+}
+
+// cuckooAdd 把 item 加入 key 上的过滤器，nx 为 true 时元素可能已存在就不再加入，返回 0
+func (srv *Server) cuckooAdd(w *resp.Writer, key, item string, nx bool) {
+	cf, created := srv.cuckooForAdd(w, key)
+	if cf == nil {
+		return
+	}
+	if nx && cf.Exists(item) {
+		w.WriteInteger(0)
+		return
+	}
+	if err := cf.Add(item); err != nil {
+		// 加入失败时过滤器保持原样，新建的过滤器也不必保存
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if created {
+		srv.store.Put(key, &store.Entry{Type: store.CuckooType, Value: cf})
+	} else {
+		srv.store.Updated(key)
+	}
+	w.WriteInteger(1)
+}
+
+// CF.RESERVE 命令：CF.RESERVE key capacity [BUCKETSIZE n] [MAXITERATIONS n] [EXPANSION n]，
+// 创建一个至少能容纳 capacity 个元素的过滤器，键已存在时返回错误
+func (srv *Server) handleCFReserve(w *resp.Writer, args []string) {
+	capacity, _ := strconv.Atoi(args[2])
+	if capacity <= 0 || capacity > cuckooMaxCapacity {
+		w.WriteString("-ERR Bad capacity\r\n")
+		return
+	}
+	bucketSize, maxIterations, expansion := store.CuckooDefaultBucketSize, store.CuckooDefaultMaxIterations, store.CuckooDefaultExpansion
+	for i := 3; i+1 < len(args); i += 2 {
+		// 选项的语法和整数参数已由命令表检查
+		n, _ := strconv.Atoi(args[i+1])
+		switch strings.ToUpper(args[i]) {
+		case "BUCKETSIZE":
+			if n < 1 || n > 255 {
+				w.WriteString("-ERR Bad bucket size\r\n")
+				return
+			}
+			bucketSize = n
+		case "MAXITERATIONS":
+			if n < 1 || n > 65535 {
+				w.WriteString("-ERR Bad max iterations\r\n")
+				return
+			}
+			maxIterations = n
+		case "EXPANSION":
+			if n < 0 || n > 32768 {
+				w.WriteString("-ERR Bad expansion\r\n")
+				return
+			}
+			expansion = n
+		}
+	}
+	if entry, ok := srv.store.Load(args[1]); ok {
+		if !entry.IsExpired() {
+			w.WriteString("-ERR item exists\r\n")
+			return
+		}
+		srv.store.Delete(args[1])
+	}
+	cf := store.NewCuckooObject(capacity, bucketSize, maxIterations, expansion)
+	srv.store.Put(args[1], &store.Entry{Type: store.CuckooType, Value: cf})
+	w.WriteString("+OK\r\n")
+}
+
+// CF.ADD 命令：CF.ADD key item，把 item 加入过滤器（同一元素可以加入多次），成功时返回 1
+func (srv *Server) handleCFAdd(w *resp.Writer, args []string) {
+	srv.cuckooAdd(w, args[1], args[2], false)
+}
+
+// CF.ADDNX 命令：CF.ADDNX key item，item 可能已存在时返回 0，否则加入并返回 1
+func (srv *Server) handleCFAddNX(w *resp.Writer, args []string) {
+	srv.cuckooAdd(w, args[1], args[2], true)
+}
+
+// CF.EXISTS 命令：CF.EXISTS key item，item 可能存在时返回 1，一定不存在（包括键不存在）时返回 0
+func (srv *Server) handleCFExists(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.CuckooType, false)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil || !entry.Value.(*store.CuckooObject).Exists(args[2]) {
+		w.WriteInteger(0)
+		return
+	}
+	w.WriteInteger(1)
+}
+
+// CF.DEL 命令：CF.DEL key item，删除 item 的一次加入，找到时返回 1，否则返回 0。
+// 只应删除确实加入过的元素，否则可能误删指纹相同的其他元素
+func (srv *Server) handleCFDel(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.CuckooType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteString("-ERR Not found\r\n")
+		return
+	}
+	if !entry.Value.(*store.CuckooObject).Delete(args[2]) {
+		w.WriteInteger(0)
+		return
+	}
+	srv.store.Updated(args[1])
+	w.WriteInteger(1)
+}
+
+// CF.COUNT 命令：CF.COUNT key item，返回 item 可能被加入的次数，结果可能偏大
+func (srv *Server) handleCFCount(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.CuckooType, false)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteInteger(0)
+		return
+	}
+	w.WriteInteger(entry.Value.(*store.CuckooObject).Count(args[2]))
+}
+
+// CF.INFO 命令：CF.INFO key，返回过滤器的大小、桶数、子过滤器个数、元素个数等，名称和值交替排列
+func (srv *Server) handleCFInfo(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.CuckooType, false)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteString("-ERR not found\r\n")
+		return
+	}
+	cf := entry.Value.(*store.CuckooObject)
+	w.WriteArrayHeader(16)
+	w.WriteString("+Size\r\n")
+	w.WriteInteger(cf.Bytes())
+	w.WriteString("+Number of buckets\r\n")
+	w.WriteInteger(int(cf.Buckets()))
+	w.WriteString("+Number of filters\r\n")
+	w.WriteInteger(cf.Filters())
+	w.WriteString("+Number of items inserted\r\n")
+	w.WriteInteger(int(cf.Items))
+	w.WriteString("+Number of items deleted\r\n")
+	w.WriteInteger(int(cf.Deletes))
+	w.WriteString("+Bucket size\r\n")
+	w.WriteInteger(cf.BucketSize)
+	w.WriteString("+Expansion rate\r\n")
+	w.WriteInteger(cf.Expansion)
+	w.WriteString("+Max iterations\r\n")
+	w.WriteInteger(cf.MaxIterations)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// MEMORY DOCTOR 和 LATENCY DOCTOR：根据内部统计给出可读的诊断结论，作为排查内存和延迟问题的第一步。
+// 只读取已有的计数器和少量采样，不改变任何状态，结论是启发式的，具体数值仍以 INFO、SLOWLOG、MEMORY BIGKEYS 为准。
+// 回复是一段多行文本，每条发现以 "* " 开头，没有发现问题时说明检查了哪些方面
+
+// MEMORY DOCTOR 使用的阈值
+const (
+	// doctorMinMemory 以下认为实例几乎是空的，不做诊断
+	doctorMinMemory = 1 << 20
+	// 堆中已分配但没有被对象使用的内存同时超过这两个值时认为碎片过多
+	doctorFragmentationRatio = 1.4
+	doctorFragmentationBytes = 16 << 20
+	// 空闲且尚未归还操作系统的堆内存超过该值时提示归还
+	doctorIdleHeapBytes = 64 << 20
+	// 等待后台释放的值超过该个数时认为惰性释放积压
+	doctorLazyfreeBacklog = 1000
+	// 采样分片中的键大小或元素个数超过这两个值之一时认为是大键
+	doctorHugeValueBytes    = 1 << 20
+	doctorHugeValueElements = 100000
+	// doctorSampleStride 是采样分片的间隔，只检查编号为它的倍数的分片
+	doctorSampleStride = 16
+	// 命名空间的用量达到配额的该比例时提示
+	doctorQuotaRatio = 0.9
+)
+
+// LATENCY DOCTOR 使用的阈值
+const (
+	// 最近的 GC 停顿超过该值时提示
+	doctorGCPause = 10 * time.Millisecond
+	// 分片 worker 队列积压超过该长度时提示
+	doctorQueueDepth = 1000
+	// doctorProbeTimeout 是检查分片 worker 能否及时执行命令的超时
+	doctorProbeTimeout = 100 * time.Millisecond
+	// doctorTopCommands 是列出的慢查询中出现最多的命令个数
+	doctorTopCommands = 3
+)
+
+// writeDoctorReport 把诊断结论写成一段多行文本回复
+func writeDoctorReport(w *resp.Writer, intro string, findings []string, healthy string) {
+	var b strings.Builder
+	b.WriteString(intro)
+	b.WriteString("\n\n")
+	if len(findings) == 0 {
+		b.WriteString(healthy)
+		b.WriteString("\n")
+	}
+	for _, f := range findings {
+		b.WriteString("* ")
+		b.WriteString(f)
+		b.WriteString("\n")
+	}
+	w.WriteBulk(b.String())
+}
+
+// MEMORY DOCTOR 命令：检查堆内存碎片、未归还的空闲内存、惰性释放积压、大键和命名空间配额
+func (srv *Server) handleMemoryDoctor(w *resp.Writer, args []string) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc < doctorMinMemory {
+		w.WriteBulk("The instance is using very little memory (" + bytesToHuman(int64(ms.HeapAlloc)) +
+			"), there is nothing for the memory doctor to diagnose.\n")
+		return
+	}
+
+	var findings []string
+	if waste := int64(ms.HeapInuse) - int64(ms.HeapAlloc); float64(ms.HeapInuse) > doctorFragmentationRatio*float64(ms.HeapAlloc) &&
+		waste > doctorFragmentationBytes {
+		findings = append(findings, fmt.Sprintf("High heap fragmentation: the heap holds %s in spans for %s of live objects (ratio %.2f). "+
+			"This usually follows deleting or overwriting many keys; the space is reused by new writes over time.",
+			bytesToHuman(int64(ms.HeapInuse)), bytesToHuman(int64(ms.HeapAlloc)), float64(ms.HeapInuse)/float64(ms.HeapAlloc)))
+	}
+	if idle := int64(ms.HeapIdle - ms.HeapReleased); idle > doctorIdleHeapBytes {
+		advice := "run MEMORY PURGE to return it now"
+		if config.Get().MemoryPurgeInterval <= 0 {
+			advice += ", or set memory-purge-interval to return it periodically"
+		}
+		findings = append(findings, fmt.Sprintf("%s of idle heap memory has not been returned to the operating system yet, "+
+			"so the process looks bigger than its data: %s.", bytesToHuman(idle), advice))
+	}
+	if pending, _ := store.LazyfreeStats(); pending > doctorLazyfreeBacklog {
+		findings = append(findings, fmt.Sprintf("%d deleted values are still waiting to be freed in the background. "+
+			"Memory goes down once they are freed; if this keeps growing, big values are deleted faster than they can be dismantled.", pending))
+	}
+
+	var huge int
+	var biggest bigKey
+	var biggestDesc string
+	for i := 0; i < store.ShardCount; i += doctorSampleStride {
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			size, elements := entry.Size(), entry.Len()
+			if size < doctorHugeValueBytes && (entry.Type == store.StringType || elements < doctorHugeValueElements) {
+				return
+			}
+			huge++
+			if size > biggest.bytes {
+				biggest = bigKey{key: key, elements: elements, bytes: size}
+				biggestDesc = entry.Type.String() + ", " + bytesToHuman(size)
+				if entry.Type != store.StringType {
+					biggestDesc += ", " + strconv.FormatInt(elements, 10) + " elements"
+				}
+			}
+		})
+	}
+	if huge > 0 {
+		findings = append(findings, fmt.Sprintf("Found %d keys over %s or %d elements in 1/%d of the keyspace, the biggest is %q (%s). "+
+			"Commands that read or delete such keys as a whole are slow and their replies use a lot of memory; "+
+			"run MEMORY BIGKEYS to list the biggest keys of each type.",
+			huge, bytesToHuman(doctorHugeValueBytes), doctorHugeValueElements, store.ShardCount/doctorSampleStride,
+			biggest.key, biggestDesc))
+	}
+	for _, ns := range srv.store.Namespaces() {
+		if ns.MaxMemory > 0 && float64(ns.Memory()) >= doctorQuotaRatio*float64(ns.MaxMemory) {
+			findings = append(findings, fmt.Sprintf("Namespace '%s' uses %s of its %s memory quota, writes to it will be rejected with -OOM once it is full.",
+				ns.Name, bytesToHuman(ns.Memory()), bytesToHuman(ns.MaxMemory)))
+		}
+		if ns.MaxKeys > 0 && float64(ns.Keys()) >= doctorQuotaRatio*float64(ns.MaxKeys) {
+			findings = append(findings, fmt.Sprintf("Namespace '%s' has %d keys out of its quota of %d, new keys will be rejected with -OOM once it is full.",
+				ns.Name, ns.Keys(), ns.MaxKeys))
+		}
+	}
+	writeDoctorReport(w, "Memory doctor report (used_memory "+bytesToHuman(int64(ms.HeapAlloc))+"):", findings,
+		"No memory issues detected: heap fragmentation, idle heap memory, background freeing, big keys and namespace quotas look fine.")
+}
+
+// LATENCY DOCTOR 命令：检查慢查询日志、GC 停顿、被占用或积压的分片、输出缓冲区超限断开的客户端以及是否暂停接受连接
+func (srv *Server) handleLatencyDoctor(w *resp.Writer, args []string) {
+	cfg := config.Get()
+	var findings []string
+
+	if cfg.SlowlogLogSlowerThan < 0 || cfg.SlowlogMaxLen == 0 {
+		findings = append(findings, "The slow log is disabled (slowlog-log-slower-than < 0 or slowlog-max-len 0), "+
+			"so slow commands cannot be diagnosed. Enable it to let the latency doctor see them.")
+	} else {
+		srv.slowlog.mu.Lock()
+		entries := slices.Clone(srv.slowlog.entries)
+		srv.slowlog.mu.Unlock()
+		if len(entries) > 0 {
+			slowest := entries[0]
+			counts := make(map[string]int)
+			for _, e := range entries {
+				if e.Duration > slowest.Duration {
+					slowest = e
+				}
+				if len(e.Args) > 0 {
+					counts[strings.ToUpper(e.Args[0])]++
+				}
+			}
+			names := make([]string, 0, len(counts))
+			for name := range counts {
+				names = append(names, name)
+			}
+			slices.SortFunc(names, func(a, b string) int {
+				return cmp.Or(counts[b]-counts[a], strings.Compare(a, b))
+			})
+			var top []string
+			for _, name := range names[:min(len(names), doctorTopCommands)] {
+				top = append(top, name+" ("+strconv.Itoa(counts[name])+")")
+			}
+			findings = append(findings, fmt.Sprintf("The slow log holds %d commands slower than %d microseconds, most often %s. "+
+				"The slowest took %d microseconds: %s. Avoid commands that scan big keys or the whole keyspace on the hot path.",
+				len(entries), cfg.SlowlogLogSlowerThan, strings.Join(top, ", "), slowest.Duration, strings.Join(slowest.Args, " ")))
+		}
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	var maxPause time.Duration
+	for i := 0; i < min(int(ms.NumGC), len(ms.PauseNs)); i++ {
+		maxPause = max(maxPause, time.Duration(ms.PauseNs[i]))
+	}
+	if maxPause > doctorGCPause {
+		findings = append(findings, fmt.Sprintf("Go GC pauses reached %v among the last %d collections. "+
+			"Long pauses usually mean a very large heap or many pointers; check MEMORY DOCTOR and consider a smaller dataset per instance.",
+			maxPause, min(int(ms.NumGC), len(ms.PauseNs))))
+	}
+
+	if n := srv.rejectedBusy.Load(); n > 0 {
+		findings = append(findings, fmt.Sprintf("%d commands were rejected with -BUSY because a function ran longer than busy-reply-threshold (%d ms) on their shard. "+
+			"Keep functions short or split their work.", n, cfg.BusyReplyThreshold))
+	}
+	if n := srv.rejectedOverloaded.Load(); n > 0 {
+		findings = append(findings, fmt.Sprintf("%d commands were rejected with -OVERLOADED because a shard queue reached overload-queue-depth (%d). "+
+			"Clients are sending more than the shard workers can execute.", n, cfg.OverloadQueueDepth))
+	}
+	deepest, depth := 0, 0
+	for i := 0; i < store.ShardCount; i++ {
+		if n := srv.store.QueueLen(i); n > depth {
+			deepest, depth = i, n
+		}
+	}
+	if depth > doctorQueueDepth {
+		findings = append(findings, fmt.Sprintf("%d commands are queued on the worker of shard %d right now; commands on that shard wait behind them.",
+			depth, deepest))
+	}
+	if !srv.Responsive(doctorProbeTimeout) {
+		findings = append(findings, fmt.Sprintf("Some shard workers did not run a no-op within %v, "+
+			"a long running command or function is blocking them.", doctorProbeTimeout))
+	}
+	if n := srv.outputLimitDisconnections.Load(); n > 0 {
+		findings = append(findings, fmt.Sprintf("%d clients were disconnected for exceeding client-output-buffer-limit. "+
+			"They read replies slower than they are produced, usually because of big replies or slow consumers.", n))
+	}
+	if accepting, draining, _, _ := srv.drainStatus(); !accepting || draining {
+		findings = append(findings, "The server is not accepting new connections (paused or draining), new clients wait in the listen backlog.")
+	}
+	if srv.snapshotInProgress.Load() {
+		findings = append(findings, "A snapshot is being saved. Writes to keys that the snapshot has not written yet copy the value first, "+
+			"which makes writes to big keys slower until it finishes.")
+	}
+	writeDoctorReport(w, "Latency doctor report:", findings,
+		"No latency issues detected: the slow log, GC pauses, shard workers, client output buffers and connection acceptance look fine.")
+}
+
+// latencyHelp 是 LATENCY HELP 的输出
+var latencyHelp = []string{
+	"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"DOCTOR",
+	"    Return a human readable latency analysis report.",
+	"HELP",
+	"    Print this help.",
+}
+
+// LATENCY HELP 命令
+func (srv *Server) handleLatencyHelp(w *resp.Writer, args []string) {
+	w.WriteArrayHeader(len(latencyHelp))
+	for _, line := range latencyHelp {
+		w.WriteString("+" + line + "\r\n")
+	}
+}
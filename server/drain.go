@@ -0,0 +1,194 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 连接排空，用于在负载均衡器后面滚动重启：
+//
+//	DRAIN START milliseconds   暂停接受新连接并开始排空现有连接，最多等待 milliseconds 毫秒
+//	DRAIN CANCEL               结束排空（如果还在进行），重新接受新连接；排空完成后监听 socket 保持暂停，同样用它恢复
+//	DRAIN STATUS               返回 [accepting, 0|1, draining, 0|1, connections, n, remaining_ms, n]
+//
+// 管理后台的 POST /admin/api/drain?timeout=N、DELETE /admin/api/drain、GET /admin/api/drain 与之对应。
+//
+// 暂停接受时监听 socket 保持打开，新连接留在内核的 backlog 中，负载均衡器的健康检查因此超时并把实例摘除。
+// 排空期间每条连接处理完已经收到的命令、回复写完之后关闭（包括发送 DRAIN 的连接），空闲的连接立即关闭；
+// 排行榜的 SSE 订阅者收到一个 shutdown 事件后断开，重连到其他实例。到期仍未关闭的连接被直接断开。
+//
+// 收到 SIGINT / SIGTERM 停止实例时，先按 shutdown-drain-timeout 排空连接再保存快照
+
+// drainPollInterval 是排空期间检查剩余连接、唤醒空闲连接的周期
+const drainPollInterval = 100 * time.Millisecond
+
+// drainState 是进行中的排空
+type drainState struct {
+	mu       sync.Mutex
+	deadline time.Time     // 零值表示没有进行中的排空
+	done     chan struct{} // 排空结束（连接全部关闭或者被 DRAIN CANCEL 取消）时关闭
+}
+
+// listenerDeadliner 是可以设置 Accept 超时的监听 socket，用于唤醒阻塞在 Accept 中的 acceptLoop
+type listenerDeadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// pauseAccepting 暂停接受新连接。goroutine 后端通过设置已经过去的超时唤醒 Accept，
+// 事件循环后端在下一轮循环中把监听 socket 移出 epoll
+func (srv *Server) pauseAccepting() {
+	srv.acceptPaused.Store(true)
+	for _, l := range srv.listeners {
+		if d, ok := l.(listenerDeadliner); ok {
+			d.SetDeadline(time.Now())
+		}
+	}
+}
+
+// waitAcceptResumed 在暂停接受期间阻塞，恢复接受时返回 true，实例 Stop 时返回 false
+func (srv *Server) waitAcceptResumed(listener net.Listener) bool {
+	for srv.acceptPaused.Load() {
+		select {
+		case <-srv.stopping:
+			return false
+		case <-time.After(drainPollInterval):
+		}
+	}
+	if d, ok := listener.(listenerDeadliner); ok {
+		d.SetDeadline(time.Time{})
+	}
+	return true
+}
+
+// startDrain 暂停接受新连接并开始排空现有连接，timeout 后断开剩余的连接。
+// 已经在排空时不改变原来的期限。返回的 channel 在排空结束时关闭
+func (srv *Server) startDrain(timeout time.Duration) <-chan struct{} {
+	srv.drain.mu.Lock()
+	defer srv.drain.mu.Unlock()
+	if !srv.drain.deadline.IsZero() {
+		return srv.drain.done
+	}
+	srv.drain.deadline = time.Now().Add(timeout)
+	srv.drain.done = make(chan struct{})
+	srv.pauseAccepting()
+	srv.draining.Store(true)
+	srv.closeLeaderboardFeed()
+	srv.logger.Printf("Draining connections (timeout %v)\n", timeout)
+	go srv.drainLoop(srv.drain.deadline, srv.drain.done)
+	return srv.drain.done
+}
+
+// cancelDrain 结束进行中的排空并重新接受新连接，没有暂停接受新连接时返回 false
+func (srv *Server) cancelDrain() bool {
+	srv.drain.mu.Lock()
+	defer srv.drain.mu.Unlock()
+	if !srv.acceptPaused.Load() {
+		return false
+	}
+	if !srv.drain.deadline.IsZero() {
+		srv.finishDrain()
+	}
+	srv.acceptPaused.Store(false)
+	srv.logger.Println("Drain cancelled, accepting new connections")
+	return true
+}
+
+// finishDrain 结束进行中的排空，调用时持有 srv.drain.mu。监听 socket 保持暂停
+func (srv *Server) finishDrain() {
+	srv.draining.Store(false)
+	srv.drainForce.Store(false)
+	srv.drain.deadline = time.Time{}
+	close(srv.drain.done)
+}
+
+// drainLoop 等待连接全部关闭：期间反复唤醒空闲的连接，到期后断开剩余的连接
+func (srv *Server) drainLoop(deadline time.Time, done chan struct{}) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		srv.drain.mu.Lock()
+		if srv.drain.done != done || srv.drain.deadline.IsZero() {
+			// 已被 DRAIN CANCEL 取消
+			srv.drain.mu.Unlock()
+			return
+		}
+		remaining := srv.connectedClients()
+		if remaining == 0 {
+			srv.finishDrain()
+			srv.drain.mu.Unlock()
+			srv.logger.Println("All connections drained")
+			return
+		}
+		srv.drain.mu.Unlock()
+
+		if time.Now().After(deadline) {
+			if !srv.drainForce.Swap(true) {
+				srv.logger.Printf("Drain timeout reached, closing %d remaining connections\n", remaining)
+			}
+			srv.closeClients()
+		} else {
+			srv.wakeIdleClients()
+		}
+		select {
+		case <-ticker.C:
+		case <-srv.stopping:
+			return
+		}
+	}
+}
+
+// drainStatus 返回是否在接受新连接、是否在排空、当前连接数以及距离排空期限的毫秒数
+func (srv *Server) drainStatus() (accepting, draining bool, connections int, remaining time.Duration) {
+	srv.drain.mu.Lock()
+	deadline := srv.drain.deadline
+	srv.drain.mu.Unlock()
+	if !deadline.IsZero() {
+		remaining = max(time.Until(deadline), 0)
+	}
+	return !srv.acceptPaused.Load(), !deadline.IsZero(), srv.connectedClients(), remaining
+}
+
+// DRAIN START 命令：DRAIN START milliseconds
+func (srv *Server) handleDrainStart(w *resp.Writer, args []string) {
+	// 整数参数已由命令表检查
+	ms, _ := strconv.ParseInt(args[2], 10, 64)
+	if ms <= 0 || ms > int64(24*time.Hour/time.Millisecond) {
+		w.WriteString("-ERR invalid drain timeout\r\n")
+		return
+	}
+	srv.startDrain(time.Duration(ms) * time.Millisecond)
+	w.WriteString("+OK\r\n")
+}
+
+// DRAIN CANCEL 命令
+func (srv *Server) handleDrainCancel(w *resp.Writer, args []string) {
+	if !srv.cancelDrain() {
+		w.WriteString("-ERR not draining\r\n")
+		return
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// DRAIN STATUS 命令
+func (srv *Server) handleDrainStatus(w *resp.Writer, args []string) {
+	accepting, draining, connections, remaining := srv.drainStatus()
+	flag := func(v bool) int {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	w.WriteArrayHeader(8)
+	w.WriteBulk("accepting")
+	w.WriteInteger(flag(accepting))
+	w.WriteBulk("draining")
+	w.WriteInteger(flag(draining))
+	w.WriteBulk("connections")
+	w.WriteInteger(connections)
+	w.WriteBulk("remaining_ms")
+	w.WriteInteger(int(remaining.Milliseconds()))
+}
@@ -0,0 +1,528 @@
+//go:build linux
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// eventLoopMaxPendingOutput 是单个连接允许积压的回复字节数，超过后暂停读取该连接的新命令，
+// 直到客户端把回复读走。这样一个疯狂发送管道命令却不读回复的客户端无法让回复无限堆积
+const eventLoopMaxPendingOutput = 1024 * 1024
+
+// eventLoopTick 是 epoll_wait 的最长等待时间，也是检查各连接超时的周期
+const eventLoopTick = 100 * time.Millisecond
+
+// eventLoopConn 是事件循环中一个客户端连接的状态。所有字段只由事件循环所在的 goroutine 访问，无需加锁
+type eventLoopConn struct {
+	fd   int
+	addr string
+
+	in      []byte         // 已收到但尚未解析完的请求数据
+	start   int            // in 中已经解析执行过的前缀长度，process 结束时才从 in 中移走
+	pending pendingCommand // in[start:] 中下一条命令已经确认收到的部分
+	out     bytes.Buffer   // 尚未写入 socket 的回复
+	w       *resp.Writer   // 命令的回复先写入 w，再由 w 刷到 out
+	cl      *client
+
+	closing      bool      // 回复发送完毕后关闭连接（QUIT 或协议错误）
+	lastRead     time.Time // 最近一次收到数据的时间，用于空闲超时
+	pendingSince time.Time // in 中开始出现半条命令的时间，用于读超时
+	stalledSince time.Time // out 中的回复开始没有写出进展的时间，用于写超时
+	events       uint32    // 当前在 epoll 中注册的事件
+}
+
+// eventLoop 用一个 goroutine 通过 epoll 管理它接受的所有客户端连接：没有每连接一个 goroutine 的栈开销，
+// 也不需要调度器在数万个 goroutine 之间切换。命令的解析与执行与 goroutine 后端共用同一套代码
+type eventLoop struct {
+	srv   *Server
+	epfd  int
+	lfd   int
+	conns map[int]*eventLoopConn
+	buf   []byte // 所有连接共用的读缓冲区
+	// br 和 reader 用于解析命令，所有连接共用
+	br     bytes.Reader
+	reader *bufio.Reader
+	// paused 为 true 时监听 socket 已移出 epoll，不再接受新连接
+	paused bool
+}
+
+// startEventLoop 在 addr 的端口上启动事件循环后端，事件循环在后台 goroutine 中运行，实例 Stop 时退出。
+// io-acceptors 大于 1 时启动多个事件循环，各自以 SO_REUSEPORT 监听同一端口并管理自己接受的连接。
+// inherited 不为空时不新建监听 socket，每个从上一个进程继承的监听 socket 启动一个事件循环（见 upgrade.go）
+func (srv *Server) startEventLoop(addr string, inherited []*os.File) error {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port in address %s", addr)
+	}
+	n := max(config.Get().IOAcceptors, 1)
+	if len(inherited) > 0 {
+		n = len(inherited)
+	}
+	loops := make([]*eventLoop, 0, n)
+	for i := 0; i < n; i++ {
+		var lfd int
+		if len(inherited) > 0 {
+			lfd, err = inheritedListenFD(inherited[i])
+		} else {
+			lfd, err = listenNonBlocking(port, n > 1)
+		}
+		var el *eventLoop
+		if err == nil {
+			el, err = newEventLoop(srv, lfd)
+		}
+		if err != nil {
+			for _, el := range loops {
+				syscall.Close(el.lfd)
+				syscall.Close(el.epfd)
+			}
+			for _, f := range inherited[min(i+1, len(inherited)):] {
+				f.Close()
+			}
+			return err
+		}
+		// 端口为 0 时之后的事件循环绑定第一个事件循环实际分配到的端口
+		if sa, err := syscall.Getsockname(el.lfd); err == nil {
+			if sa4, ok := sa.(*syscall.SockaddrInet4); ok {
+				port = sa4.Port
+			}
+			if i == 0 {
+				srv.addr = sockaddrString(sa)
+			}
+		}
+		loops = append(loops, el)
+		srv.listenFDs = append(srv.listenFDs, lfd)
+	}
+	if n > 1 {
+		srv.logger.Printf("Server is listening on %s (eventloop backend, %d event loops)\n", srv.addr, n)
+	} else {
+		srv.logger.Printf("Server is listening on %s (eventloop backend)\n", srv.addr)
+	}
+
+	for _, el := range loops {
+		srv.serving.Add(1)
+		go func(el *eventLoop) {
+			defer srv.serving.Done()
+			if err := el.run(); err != nil {
+				srv.logger.Println("Event loop stopped:", err)
+			}
+		}(el)
+	}
+	return nil
+}
+
+// newEventLoop 创建一个在监听 socket lfd 上接受连接的事件循环，出错时关闭 lfd
+func newEventLoop(srv *Server, lfd int) (*eventLoop, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		syscall.Close(lfd)
+		return nil, err
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, lfd, &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(lfd)}); err != nil {
+		syscall.Close(epfd)
+		syscall.Close(lfd)
+		return nil, err
+	}
+	return &eventLoop{
+		srv:    srv,
+		epfd:   epfd,
+		lfd:    lfd,
+		conns:  make(map[int]*eventLoopConn),
+		buf:    make([]byte, 64*1024),
+		reader: bufio.NewReader(nil),
+	}, nil
+}
+
+// run 循环等待并处理 socket 事件，直到实例 Stop；退出前关闭所有连接和监听 socket
+func (el *eventLoop) run() error {
+	defer func() {
+		for _, c := range el.conns {
+			el.close(c)
+		}
+		syscall.Close(el.lfd)
+		syscall.Close(el.epfd)
+	}()
+	events := make([]syscall.EpollEvent, 256)
+	for {
+		select {
+		case <-el.srv.stopping:
+			return nil
+		default:
+		}
+		n, err := syscall.EpollWait(el.epfd, events, int(eventLoopTick/time.Millisecond))
+		if err != nil && err != syscall.EINTR {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == el.lfd {
+				el.accept()
+				continue
+			}
+			c, ok := el.conns[fd]
+			if !ok {
+				continue
+			}
+			ev := events[i].Events
+			if ev&(syscall.EPOLLIN|syscall.EPOLLRDHUP|syscall.EPOLLHUP|syscall.EPOLLERR) != 0 {
+				el.read(c)
+			}
+			if ev&syscall.EPOLLOUT != 0 && el.conns[fd] == c {
+				el.flush(c)
+			}
+		}
+		el.checkTimeouts()
+		el.checkDrain()
+	}
+}
+
+// checkDrain 跟随实例暂停或恢复接受新连接，排空时关闭已经没有待处理命令和待发送回复的连接，到期后关闭所有连接
+func (el *eventLoop) checkDrain() {
+	if paused := el.srv.acceptPaused.Load(); paused != el.paused {
+		if paused {
+			syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_DEL, el.lfd, nil)
+		} else {
+			syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_ADD, el.lfd, &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(el.lfd)})
+		}
+		el.paused = paused
+	}
+	if !el.srv.draining.Load() {
+		return
+	}
+	force := el.srv.drainForce.Load()
+	for _, c := range el.conns {
+		if force || (len(c.in) == 0 && c.out.Len() == 0) {
+			el.srv.logClient("Closing connection for draining:", c.addr)
+			el.close(c)
+		}
+	}
+}
+
+// listenNonBlocking 创建非阻塞的监听 socket，reusePort 为 true 时设置 SO_REUSEPORT
+func listenNonBlocking(port int, reusePort bool) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	if reusePort {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Port: port}); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("bind port %d: %v", port, err)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// inheritedListenFD 把继承的监听 socket 转换为事件循环使用的非阻塞 fd，之后关闭 f
+func inheritedListenFD(f *os.File) (int, error) {
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		return -1, err
+	}
+	syscall.CloseOnExec(fd)
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// dupListenFD 复制事件循环的监听 socket，交给升级后的新进程
+func dupListenFD(fd int) (*os.File, error) {
+	nfd, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(nfd), "listener"), nil
+}
+
+func (el *eventLoop) accept() {
+	for {
+		fd, sa, err := syscall.Accept4(el.lfd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		if err != nil {
+			if err != syscall.EAGAIN && err != syscall.EINTR {
+				el.srv.logger.Println("Failed to accept connection:", err)
+			}
+			return
+		}
+		if el.srv.tooManyClients() {
+			syscall.Write(fd, []byte("-ERR max number of clients reached\r\n"))
+			syscall.Close(fd)
+			continue
+		}
+		syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1)
+		c := &eventLoopConn{fd: fd, addr: sockaddrString(sa), lastRead: time.Now()}
+		c.w = resp.NewWriter(&c.out)
+		c.events = syscall.EPOLLIN | syscall.EPOLLRDHUP
+		if err := syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: c.events, Fd: int32(fd)}); err != nil {
+			el.srv.logger.Println("Failed to register connection:", err)
+			syscall.Close(fd)
+			continue
+		}
+		el.conns[fd] = c
+		c.cl = el.srv.registerClient(c.addr, nil)
+		el.srv.logClient("New client connected:", c.addr)
+	}
+}
+
+// eventLoopReadsPerEvent 限制每次可读事件中读取 socket 的次数，避免持续发送数据的客户端独占事件循环；
+// 未读完的数据会在下一轮 epoll_wait 中继续触发可读事件
+const eventLoopReadsPerEvent = 16
+
+// read 读取 socket 中的可读数据并执行其中完整的命令
+func (el *eventLoop) read(c *eventLoopConn) {
+	for i := 0; i < eventLoopReadsPerEvent; i++ {
+		n, err := syscall.Read(c.fd, el.buf)
+		if n > 0 {
+			if len(c.in) == 0 {
+				c.pendingSince = time.Now()
+			}
+			c.in = append(c.in, el.buf[:n]...)
+			c.lastRead = time.Now()
+			continue
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			break
+		}
+		// n == 0 表示对端关闭；其它错误同样关闭连接，但先把已收到的命令处理完
+		el.process(c)
+		if err == nil {
+			el.srv.logClient("Client disconnected:", c.addr)
+		} else {
+			el.srv.logger.Println("Error reading command:", err)
+		}
+		el.close(c)
+		return
+	}
+	el.process(c)
+	el.flush(c)
+}
+
+// process 依次解析并执行 in 中完整的命令，半条命令留到下次数据到达后再解析。
+// 已执行的命令在最后一次性从 in 中移走；半条命令由 pending 记住已经确认收到的部分，
+// 数据没有到齐之前不重新解析，一条很大的批量数据分成许多个包到达时总的解析和复制开销仍然与它的长度成正比
+func (el *eventLoop) process(c *eventLoopConn) {
+	if c.out.Len() == 0 {
+		c.stalledSince = time.Now()
+	}
+	limits := protoLimits(config.Get())
+	for c.start < len(c.in) && !c.closing && c.out.Len() < eventLoopMaxPendingOutput {
+		in := c.in[c.start:]
+		if !c.pending.complete(in, limits) {
+			break
+		}
+		el.br.Reset(in)
+		el.reader.Reset(&el.br)
+		request, err := resp.ReadCommand(el.reader, limits)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if perr, ok := err.(resp.ProtocolError); ok {
+				c.w.WriteError("ERR " + perr.Error())
+				el.srv.logger.Println("Protocol error from client:", c.addr, perr)
+			}
+			c.closing = true
+			break
+		}
+		c.start += len(in) - el.br.Len() - el.reader.Buffered()
+		c.pending = pendingCommand{}
+		if c.start < len(c.in) {
+			c.pendingSince = time.Now()
+		}
+		if len(request) == 0 {
+			continue
+		}
+		if !el.srv.executeCommand(c.w, request, c.cl) {
+			c.closing = true
+		}
+		c.cl.touch(request[0])
+	}
+	if c.start > 0 {
+		c.in = append(c.in[:0], c.in[c.start:]...)
+		c.start = 0
+	}
+	c.w.Flush()
+}
+
+// pendingCommand 记录一条 RESP 数组格式的命令已经确认收到的部分：pos 之前的头部行和参数都已完整，
+// 还有 args 个参数没有检查；need 是下一个参数完整时 in 至少需要的长度
+type pendingCommand struct {
+	started bool
+	pos     int
+	args    int64
+	need    int
+}
+
+// complete 在 in 的开头可能已经是一条完整的命令时返回 true，只检查上次之后新到的数据。
+// inline 命令以及格式错误、超出限制的头部直接交给 resp.ReadCommand 处理
+func (p *pendingCommand) complete(in []byte, limits resp.Limits) bool {
+	if len(in) < p.need {
+		return false
+	}
+	if in[0] != '*' {
+		return true
+	}
+	for !p.started || p.args > 0 {
+		end := bytes.IndexByte(in[p.pos:], '\n')
+		if end < 0 {
+			return len(in)-p.pos > resp.MaxInlineSize
+		}
+		line := bytes.TrimSuffix(in[p.pos:p.pos+end], []byte("\r"))
+		n, err := strconv.ParseInt(string(line[min(len(line), 1):]), 10, 64)
+		if !p.started {
+			if err != nil || n > limits.MaxMultibulkLen {
+				return true
+			}
+			p.started, p.pos, p.args = true, p.pos+end+1, n
+			continue
+		}
+		if len(line) == 0 || line[0] != '$' || err != nil || n < 0 || n > limits.MaxBulkLen {
+			return true
+		}
+		next := p.pos + end + 1 + int(n) + 2
+		if next > len(in) {
+			p.need = next
+			return false
+		}
+		p.pos, p.args = next, p.args-1
+	}
+	return true
+}
+
+// flush 尽可能多地把回复写入 socket，写不完的部分等待 EPOLLOUT 后继续
+func (el *eventLoop) flush(c *eventLoopConn) {
+	for c.out.Len() > 0 {
+		n, err := syscall.Write(c.fd, c.out.Bytes())
+		if n > 0 {
+			c.out.Next(n)
+			c.stalledSince = time.Now()
+			continue
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			break
+		}
+		el.srv.logger.Println("Error writing reply:", err)
+		el.close(c)
+		return
+	}
+	if el.srv.outputLimitExceeded(c.cl, int64(c.out.Len()), time.Now()) {
+		el.close(c)
+		return
+	}
+	if c.out.Len() == 0 {
+		if c.closing {
+			el.close(c)
+			return
+		}
+		// 积压的回复已写完，继续处理之前因背压而暂缓的命令
+		if len(c.in) > 0 {
+			el.process(c)
+			if c.out.Len() > 0 {
+				el.flush(c)
+				return
+			}
+		}
+	}
+	el.updateEvents(c)
+}
+
+// updateEvents 根据连接当前状态调整 epoll 关注的事件：有待发送回复时关注可写，
+// 回复积压过多或即将关闭时不再读取新命令
+func (el *eventLoop) updateEvents(c *eventLoopConn) {
+	var events uint32
+	if !c.closing && c.out.Len() < eventLoopMaxPendingOutput {
+		events |= syscall.EPOLLIN | syscall.EPOLLRDHUP
+	}
+	if c.out.Len() > 0 {
+		events |= syscall.EPOLLOUT
+	}
+	if events == c.events {
+		return
+	}
+	c.events = events
+	syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_MOD, c.fd, &syscall.EpollEvent{Events: events, Fd: int32(c.fd)})
+}
+
+// checkTimeouts 按 timeout / client-read-timeout / client-write-timeout 断开超时的连接，
+// 并断开积压的回复超过 client-output-buffer-limit 软限制的时间已经到期的连接
+func (el *eventLoop) checkTimeouts() {
+	cfg := config.Get()
+	now := time.Now()
+	idle := time.Duration(cfg.Timeout) * time.Second
+	readTimeout := time.Duration(cfg.ClientReadTimeout) * time.Millisecond
+	writeTimeout := time.Duration(cfg.ClientWriteTimeout) * time.Millisecond
+	for _, c := range el.conns {
+		timedOut := false
+		switch {
+		case c.out.Len() > 0:
+			timedOut = writeTimeout > 0 && now.Sub(c.stalledSince) > writeTimeout
+		case len(c.in) > 0:
+			timedOut = readTimeout > 0 && now.Sub(c.pendingSince) > readTimeout
+		default:
+			timedOut = idle > 0 && now.Sub(c.lastRead) > idle
+		}
+		if timedOut {
+			el.srv.logClient("Client timed out:", c.addr)
+			el.close(c)
+			continue
+		}
+		// 软限制按时间判断，回复一直写不出去时也要在这里检查
+		if c.out.Len() > 0 && el.srv.outputLimitExceeded(c.cl, int64(c.out.Len()), now) {
+			el.close(c)
+		}
+	}
+}
+
+func (el *eventLoop) close(c *eventLoopConn) {
+	el.srv.logClient("Closing connection:", c.addr)
+	syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_DEL, c.fd, nil)
+	syscall.Close(c.fd)
+	delete(el.conns, c.fd)
+	el.srv.unregisterClient(c.cl)
+	c.w.Release()
+}
+
+func sockaddrString(sa syscall.Sockaddr) string {
+	switch a := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), fmt.Sprint(a.Port))
+	case *syscall.SockaddrInet6:
+		return net.JoinHostPort(net.IP(a.Addr[:]).String(), fmt.Sprint(a.Port))
+	}
+	return "unknown"
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// startEventLoop 目前只有基于 epoll 的 Linux 实现
+func (srv *Server) startEventLoop(addr string, inherited []*os.File) error {
+	for _, f := range inherited {
+		f.Close()
+	}
+	return errors.New("io-backend eventloop is only supported on Linux")
+}
+
+// dupListenFD 只用于事件循环后端
+func dupListenFD(fd int) (*os.File, error) {
+	return nil, errors.New("io-backend eventloop is only supported on Linux")
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 批量维护过期时间的命令，用于按前缀管理缓存命名空间：
+//
+//	EXPIREMATCH pattern seconds [NX|XX]        把名称匹配 pattern 的键的过期时间设为 seconds 秒后，返回设置的键数；
+//	                                           NX 只设置没有过期时间的键，XX 只设置已有过期时间的键
+//	TTLSCAN cursor [MATCH pattern] [COUNT n]   与 SCAN 相同的方式遍历键，返回 [下一个 cursor, [key, ttl, ...]]，ttl 的含义与 TTL 相同
+//
+// pattern 的语法与 path.Match 相同。这两个命令逐个分片加锁遍历整个键空间，
+// 不是原子的：执行期间其他客户端新写入的键可能被处理也可能不被处理
+
+// ttlScanDefaultCount 是 TTLSCAN 默认每次返回的键数
+const ttlScanDefaultCount = 10
+
+// EXPIREMATCH 命令：EXPIREMATCH pattern seconds [NX|XX]
+func (srv *Server) handleExpireMatch(w *resp.Writer, args []string) {
+	pattern := args[1]
+	if _, err := path.Match(pattern, ""); err != nil {
+		w.WriteString("-ERR invalid pattern\r\n")
+		return
+	}
+	// 整数参数已由命令表检查
+	seconds, _ := strconv.ParseInt(args[2], 10, 64)
+	if seconds <= 0 || seconds > int64(10*365*24*time.Hour/time.Second) {
+		w.WriteString("-ERR invalid expire time in 'expirematch' command\r\n")
+		return
+	}
+	var nx, xx bool
+	if len(args) == 4 {
+		nx = strings.EqualFold(args[3], "NX")
+		xx = !nx
+	}
+
+	expireAt := time.Now().Add(time.Duration(seconds) * time.Second)
+	updated := 0
+	for i := 0; i < store.ShardCount; i++ {
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			if ok, _ := path.Match(pattern, key); !ok {
+				return
+			}
+			if (nx && !entry.ExpireAt.IsZero()) || (xx && entry.ExpireAt.IsZero()) {
+				return
+			}
+			// 回调时持有分片锁，可以原地修改；经 LoadForWrite 取出，避免修改进行中的快照引用的条目
+			entry, _ = srv.store.LoadForWrite(key)
+			srv.store.SetExpireAt(key, entry, expireAt)
+			updated++
+		})
+	}
+	w.WriteInteger(updated)
+}
+
+// TTLSCAN 命令：TTLSCAN cursor [MATCH pattern] [COUNT n]，cursor 是分片编号，
+// 与 HTTP 管理接口的键遍历相同，一次返回的键数可能略多于 COUNT
+func (srv *Server) handleTTLScan(w *resp.Writer, args []string) {
+	// 整数参数和选项的语法已由命令表检查
+	cursor, _ := strconv.ParseInt(args[1], 10, 64)
+	if cursor < 0 || cursor >= store.ShardCount {
+		w.WriteString("-ERR invalid cursor\r\n")
+		return
+	}
+	count := int64(ttlScanDefaultCount)
+	var pattern string
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			count, _ = strconv.ParseInt(args[i+1], 10, 64)
+		}
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		w.WriteString("-ERR invalid pattern\r\n")
+		return
+	}
+	if count <= 0 {
+		w.WriteError(errSyntax)
+		return
+	}
+
+	type keyTTL struct {
+		key string
+		ttl int64
+	}
+	now := time.Now()
+	var keys []keyTTL
+	shard := int(cursor)
+	for ; shard < store.ShardCount && int64(len(keys)) < count; shard++ {
+		srv.store.ScanShard(shard, func(key string, entry *store.Entry) {
+			if pattern != "" {
+				if ok, _ := path.Match(pattern, key); !ok {
+					return
+				}
+			}
+			k := keyTTL{key: key, ttl: -1}
+			if !entry.ExpireAt.IsZero() {
+				// 与 TTL 相同，剩余时间按四舍五入换算为秒
+				k.ttl = max((entry.ExpireAt.Sub(now).Milliseconds()+500)/1000, 0)
+			}
+			keys = append(keys, k)
+		})
+	}
+	if shard == store.ShardCount {
+		shard = 0
+	}
+
+	w.WriteArrayHeader(2)
+	w.WriteBulk(strconv.Itoa(shard))
+	w.WriteArrayHeader(2 * len(keys))
+	for _, k := range keys {
+		w.WriteBulk(k.key)
+		w.WriteInteger(int(k.ttl))
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 服务端函数。与 Redis 7 的 FUNCTION 类似，但函数库是用 go build -buildmode=plugin 编译的 Go 插件而不是 Lua 代码：
+//
+//	FUNCTION LOAD [REPLACE] path   载入插件中的函数库，返回库名
+//	FUNCTION DELETE library        删除函数库中的所有函数
+//	FUNCTION LIST                  列出已载入的函数库和函数
+//	FCALL function numkeys key [key ...] arg [arg ...]
+//
+// 插件需要导出 Functions 变量（map[string]server.Function），可以再导出 Library 变量（string）作为库名，
+// 没有导出时使用文件名（去掉扩展名）。FCALL 与其他命令一样在所有键所在的分片上执行，
+// 函数执行期间这些键不会被其他命令修改，因此函数对它们的多次读写是原子的。
+//
+// Go 插件载入后无法卸载，FUNCTION DELETE 只是让函数不能再被调用；同一个路径的插件也只会被载入一次，
+// 更新函数库时需要把新版本编译到新的路径再用 FUNCTION LOAD REPLACE 载入
+
+// Function 是函数库中的一个函数。keys 是 FCALL 中 numkeys 指定的键，args 是其余参数。
+// 函数执行时已经持有 keys 所在分片的锁，只能访问 keys 中的键，限制与 CommandHandler 相同
+type Function func(srv *Server, w *resp.Writer, keys, args []string)
+
+// functionLibrary 是 FUNCTION LOAD 载入的一个函数库
+type functionLibrary struct {
+	name      string
+	path      string
+	functions map[string]Function
+}
+
+// functionRegistry 保存已载入的函数库。FUNCTION LOAD 可以在处理命令的过程中随时执行，因此需要加锁
+type functionRegistry struct {
+	mu        sync.RWMutex
+	libraries map[string]*functionLibrary
+	functions map[string]Function // 所有库中的函数，函数名在所有库中唯一
+}
+
+var functions = &functionRegistry{
+	libraries: make(map[string]*functionLibrary),
+	functions: make(map[string]Function),
+}
+
+// openFunctionLibrary 打开插件并读取其中导出的函数
+func openFunctionLibrary(path string) (*functionLibrary, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Functions")
+	if err != nil {
+		return nil, fmt.Errorf("plugin does not export Functions")
+	}
+	fns, ok := sym.(*map[string]Function)
+	if !ok {
+		return nil, fmt.Errorf("Functions must be a map[string]server.Function, got %T", sym)
+	}
+	lib := &functionLibrary{path: path, functions: *fns}
+	if sym, err := p.Lookup("Library"); err == nil {
+		name, ok := sym.(*string)
+		if !ok {
+			return nil, fmt.Errorf("Library must be a string, got %T", sym)
+		}
+		lib.name = *name
+	} else {
+		lib.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(lib.functions) == 0 {
+		return nil, fmt.Errorf("library '%s' has no functions", lib.name)
+	}
+	return lib, nil
+}
+
+// add 注册函数库，replace 为 true 时替换同名的函数库
+func (r *functionRegistry) add(lib *functionLibrary, replace bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, exists := r.libraries[lib.name]
+	if exists && !replace {
+		return fmt.Errorf("Library '%s' already exists", lib.name)
+	}
+	for name := range lib.functions {
+		if _, ok := r.functions[name]; ok && (old == nil || old.functions[name] == nil) {
+			return fmt.Errorf("Function %s already exists", name)
+		}
+	}
+	if exists {
+		for name := range old.functions {
+			delete(r.functions, name)
+		}
+	}
+	for name, fn := range lib.functions {
+		r.functions[name] = fn
+	}
+	r.libraries[lib.name] = lib
+	return nil
+}
+
+// FUNCTION LOAD 命令：FUNCTION LOAD [REPLACE] path，载入 Go 插件中的函数库并返回库名
+func (srv *Server) handleFunctionLoad(w *resp.Writer, args []string) {
+	replace := false
+	path := args[2]
+	if len(args) == 4 {
+		if !strings.EqualFold(args[2], "REPLACE") {
+			w.WriteError(errSyntax)
+			return
+		}
+		replace, path = true, args[3]
+	}
+	lib, err := openFunctionLibrary(path)
+	if err != nil {
+		w.WriteError("ERR Error loading library: " + err.Error())
+		return
+	}
+	if err := functions.add(lib, replace); err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	srv.logger.Printf("Function library %s loaded from %s", lib.name, path)
+	w.WriteBulk(lib.name)
+}
+
+// FUNCTION DELETE 命令：FUNCTION DELETE library，删除函数库中的所有函数
+func (srv *Server) handleFunctionDelete(w *resp.Writer, args []string) {
+	functions.mu.Lock()
+	defer functions.mu.Unlock()
+	lib, ok := functions.libraries[args[2]]
+	if !ok {
+		w.WriteError("ERR Library not found")
+		return
+	}
+	for name := range lib.functions {
+		delete(functions.functions, name)
+	}
+	delete(functions.libraries, lib.name)
+	w.WriteString("+OK\r\n")
+}
+
+// FUNCTION LIST 命令：按库名顺序返回每个函数库的名称、插件路径和函数名
+func (srv *Server) handleFunctionList(w *resp.Writer, args []string) {
+	functions.mu.RLock()
+	defer functions.mu.RUnlock()
+	names := make([]string, 0, len(functions.libraries))
+	for name := range functions.libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.WriteArrayHeader(len(names))
+	for _, name := range names {
+		lib := functions.libraries[name]
+		fnames := make([]string, 0, len(lib.functions))
+		for fname := range lib.functions {
+			fnames = append(fnames, fname)
+		}
+		sort.Strings(fnames)
+		w.WriteArrayHeader(8)
+		w.WriteBulk("library_name")
+		w.WriteBulk(lib.name)
+		w.WriteBulk("engine")
+		w.WriteBulk("GO")
+		w.WriteBulk("path")
+		w.WriteBulk(lib.path)
+		w.WriteBulk("functions")
+		w.WriteArrayHeader(len(fnames))
+		for _, fname := range fnames {
+			w.WriteBulk(fname)
+		}
+	}
+}
+
+// fcallKeys 返回 FCALL 的键：numkeys 之后的 numkeys 个参数。numkeys 不合法时返回 nil，由 handleFCall 报错
+func fcallKeys(request []string) []string {
+	if len(request) < 3 {
+		return nil
+	}
+	n, err := strconv.Atoi(request[2])
+	if err != nil || n < 0 || n > len(request)-3 {
+		return nil
+	}
+	return request[3 : 3+n]
+}
+
+// FCALL 命令：FCALL function numkeys key [key ...] arg [arg ...]，调用 FUNCTION LOAD 载入的函数
+func (srv *Server) handleFCall(w *resp.Writer, args []string) {
+	n, _ := strconv.Atoi(args[2])
+	switch {
+	case n < 0:
+		w.WriteError("ERR Number of keys can't be negative")
+		return
+	case n > len(args)-3:
+		w.WriteError("ERR Number of keys can't be greater than number of args")
+		return
+	}
+	functions.mu.RLock()
+	fn, ok := functions.functions[args[1]]
+	functions.mu.RUnlock()
+	if !ok {
+		w.WriteError("ERR Function not found")
+		return
+	}
+	defer srv.markBusy(args[3 : 3+n])()
+	fn(srv, w, args[3:3+n], args[3+n:])
+}
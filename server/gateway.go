@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// HTTP/JSON 网关，配置 http-gateway yes 后挂在 :8080 上，供不方便使用 RESP 的客户端（浏览器、Serverless 函数）访问：
+//
+//	POST   /v1/command     请求体为命令及参数组成的 JSON 数组，如 ["SET","k","v"]，返回 {"result": ...}
+//	GET    /v1/keys/{key}  返回键的类型、剩余生存时间和值
+//	PUT    /v1/keys/{key}  请求体为 {"value": "...", "ttl": 秒数}，相当于 SET key value [EX ttl]
+//	DELETE /v1/keys/{key}  相当于 DEL key，返回 {"deleted": n}
+//
+// 所有请求都经过与 TCP 连接相同的 executeCommand 分发，命令出错时返回 400 和 {"error": "ERR ..."}。
+// 只对 RESP 连接有意义的命令（HELLO、CLIENT、QUIT）和影响整个实例的管理命令（CONFIG、DRAIN、SAVE、FUNCTION、SCHEDULE 等）
+// 在命令表中带有 CmdNoGateway 标志，网关拒绝执行。GET /v1/keys/{key} 与 GET 命令一样先检查实例状态（-LOADING 等，见 state.go）
+
+func (srv *Server) registerGateway(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/command", srv.gatewayCommandHandler)
+	mux.HandleFunc("/v1/keys/", srv.gatewayKeyHandler)
+}
+
+// runGatewayCommand 执行一条命令并把 RESP 回复转换为 JSON 值：简单字符串和批量字符串为字符串，
+// 整数为数字，nil 为 null，数组为数组；命令返回错误回复时返回 respError。r 是发起命令的 HTTP 请求
+func (srv *Server) runGatewayCommand(r *http.Request, args []string) (interface{}, error) {
+	if spec, ok := commandTable[strings.ToUpper(args[0])]; ok && spec.flags&CmdNoGateway != 0 {
+		return nil, resp.Error("ERR command '" + spec.name + "' is not available over the HTTP gateway")
+	}
+	var buf bytes.Buffer
+	w := resp.NewWriter(&buf)
+	srv.executeCommand(w, args, internalClient(httpCaller(r)))
+	w.Flush()
+	w.Release()
+	return resp.ReadValue(bufio.NewReader(&buf))
+}
+
+// writeGatewayResult 把命令的执行结果写成 JSON 响应
+func writeGatewayResult(w http.ResponseWriter, result interface{}, err error) {
+	if e, ok := err.(resp.Error); ok {
+		writeJSONError(w, http.StatusBadRequest, string(e))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": result})
+}
+
+// decodeJSONBody 解析请求体，请求体大小受 proto-max-bulk-len 限制
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, config.Get().ProtoMaxBulkLen))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (srv *Server) gatewayCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var raw []interface{}
+	if !decodeJSONBody(w, r, &raw) {
+		return
+	}
+	if len(raw) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "command must be a non-empty array")
+		return
+	}
+	args := make([]string, len(raw))
+	for i, v := range raw {
+		switch v := v.(type) {
+		case string:
+			args[i] = v
+		case json.Number:
+			args[i] = v.String()
+		default:
+			writeJSONError(w, http.StatusBadRequest, "command arguments must be strings or numbers")
+			return
+		}
+	}
+	result, err := srv.runGatewayCommand(r, args)
+	writeGatewayResult(w, result, err)
+}
+
+// gatewayKey 是 GET /v1/keys/{key} 的响应，TTL 为剩余秒数，不过期时为 -1
+type gatewayKey struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	TTL   int         `json:"ttl"`
+	Value interface{} `json:"value"`
+}
+
+// lookupKeyJSON 在键所在的分片上读取键的完整内容，键不存在或已过期时返回 false
+func (srv *Server) lookupKeyJSON(key string) (gatewayKey, bool) {
+	var result gatewayKey
+	found := false
+	srv.store.Run(store.ShardsOf([]string{key}), func() {
+		entry, ok := srv.store.Load(key)
+		if !ok {
+			return
+		}
+		if entry.IsExpired() {
+			srv.store.Delete(key)
+			return
+		}
+		found = true
+		result = gatewayKey{Key: key, Type: entry.Type.String(), TTL: -1, Value: entryValueJSON(entry)}
+		if !entry.ExpireAt.IsZero() {
+			result.TTL = max(0, int(time.Until(entry.ExpireAt).Seconds()))
+		}
+	})
+	return result, found
+}
+
+// entryValueJSON 把条目的值转换为 JSON 值：字符串为字符串，列表和集合为数组，哈希为对象，
+// 布谷鸟过滤器、时间序列和延迟队列为编码后的值（base64 字符串，可以原样导入）。调用方需持有分片锁
+func entryValueJSON(entry *store.Entry) interface{} {
+	switch v := entry.Value.(type) {
+	case string:
+		return v
+	case *store.ListObject:
+		items := make([]string, 0, v.Len())
+		if v.Len() > 0 {
+			v.Range(0, v.Len()-1, func(s string) { items = append(items, s) })
+		}
+		return items
+	case *store.SetObject:
+		members := make([]string, 0, v.Len())
+		v.ForEach(func(m string) { members = append(members, m) })
+		return members
+	case *store.HashObject:
+		fields := make(map[string]string, v.Len())
+		v.ForEach(func(f, val string) { fields[f] = val })
+		return fields
+	case *store.CuckooObject:
+		data, _ := v.MarshalBinary()
+		return data
+	case *store.TimeSeriesObject:
+		data, _ := v.MarshalBinary()
+		return data
+	case *store.QueueObject:
+		data, _ := v.MarshalBinary()
+		return data
+	}
+	return nil
+}
+
+func (srv *Server) gatewayKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/keys/")
+	if key == "" {
+		writeJSONError(w, http.StatusNotFound, "no such key")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if errMsg := srv.checkServerState([]string{"GET", key}); errMsg != "" {
+			writeGatewayResult(w, nil, resp.Error(errMsg))
+			return
+		}
+		k, ok := srv.lookupKeyJSON(key)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "no such key")
+			return
+		}
+		writeJSON(w, http.StatusOK, k)
+	case http.MethodPut:
+		var body struct {
+			Value *string `json:"value"`
+			TTL   int     `json:"ttl"`
+		}
+		if !decodeJSONBody(w, r, &body) {
+			return
+		}
+		if body.Value == nil {
+			writeJSONError(w, http.StatusBadRequest, "missing 'value'")
+			return
+		}
+		args := []string{"SET", key, *body.Value}
+		if body.TTL > 0 {
+			args = append(args, "EX", strconv.Itoa(body.TTL))
+		}
+		result, err := srv.runGatewayCommand(r, args)
+		writeGatewayResult(w, result, err)
+	case http.MethodDelete:
+		result, err := srv.runGatewayCommand(r, []string{"DEL", key})
+		if err != nil {
+			writeGatewayResult(w, nil, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": result})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
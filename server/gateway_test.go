@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// TestGatewayRejects 检查网关拒绝带 CmdNoGateway 标志的命令，并且载入快照期间 GET /v1/keys/{key} 返回 -LOADING
+func TestGatewayRejects(t *testing.T) {
+	if err := config.Load([]string{"--io-backend", "goroutine", "--http-gateway", "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.Load([]string{"--http-gateway", "no"}) })
+	srv := New(Options{Logger: log.New(io.Discard, "", 0)})
+	handler := srv.HTTPHandler()
+	request := func(method, path, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec.Code, rec.Body.String()
+	}
+
+	for _, cmd := range []string{`["QUIT"]`, `["HELLO","3"]`, `["CLIENT","SETNAME","x"]`, `["DRAIN","START","1000"]`,
+		`["CONFIG","SET","maxclients","1"]`, `["SAVE"]`, `["SCHEDULE","LIST"]`} {
+		if code, body := request(http.MethodPost, "/v1/command", cmd); code != http.StatusBadRequest || !strings.Contains(body, "not available over the HTTP gateway") {
+			t.Fatalf("POST %s = %d %s", cmd, code, body)
+		}
+	}
+	if code, body := request(http.MethodPost, "/v1/command", `["SET","k","v"]`); code != http.StatusOK {
+		t.Fatalf("POST SET = %d %s", code, body)
+	}
+
+	srv.loadingSnapshot.Store(true)
+	if code, body := request(http.MethodGet, "/v1/keys/k", ""); code != http.StatusBadRequest || !strings.Contains(body, "LOADING") {
+		t.Fatalf("GET /v1/keys/k while loading = %d %s", code, body)
+	}
+	srv.loadingSnapshot.Store(false)
+	if code, body := request(http.MethodGet, "/v1/keys/k", ""); code != http.StatusOK || !strings.Contains(body, `"value":"v"`) {
+		t.Fatalf("GET /v1/keys/k = %d %s", code, body)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 连接相关的命令以及客户端库的握手命令。go-redis、Lettuce 等客户端在连接建立后发送 HELLO 和 CLIENT SETINFO，
+// 只支持 RESP2，HELLO 3 返回 -NOPROTO，go-redis 等客户端会退回到 RESP2 继续使用这个连接；
+// rueidis 只在 HELLO 是未知命令时才退回，需要设置 AlwaysRESP2（见 compat 模块的测试）。
+// 服务端没有用户和密码，HELLO 的 AUTH 只接受 default 用户（与没有设置 requirepass 的 Redis 相同，密码任意）
+
+// compatRedisVersion 是 HELLO 回复的版本号，客户端库按它判断可以使用的握手命令（CLIENT SETINFO 从 7.2 开始支持）
+const compatRedisVersion = "7.2.0"
+
+// HELLO 命令：HELLO [protover [AUTH username password] [SETNAME clientname]]，
+// 回复 server、version、proto、id、mode、role、modules 交替排列的数组，之后附带 redis-easy 自己的版本、提交号和构建时间，
+// version 是兼容的 Redis 版本号
+func (srv *Server) handleHello(c *client, w *resp.Writer, args []string) {
+	if len(args) >= 2 {
+		ver, err := strconv.Atoi(args[1])
+		if err != nil {
+			w.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if ver != 2 {
+			w.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+	}
+	var name string
+	setName := false
+	for i := 2; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "AUTH") && i+2 < len(args):
+			if args[i+1] != "default" {
+				w.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+				return
+			}
+			i += 2
+		case strings.EqualFold(args[i], "SETNAME") && i+1 < len(args):
+			name, setName = args[i+1], true
+			if !validClientAttr(name) {
+				w.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+				return
+			}
+			i++
+		default:
+			w.WriteError("ERR Syntax error in HELLO option '" + args[i] + "'")
+			return
+		}
+	}
+	if setName {
+		c.mu.Lock()
+		c.name = name
+		c.mu.Unlock()
+	}
+
+	w.WriteArrayHeader(20)
+	w.WriteBulk("server")
+	w.WriteBulk("redis-easy")
+	w.WriteBulk("version")
+	w.WriteBulk(compatRedisVersion)
+	w.WriteBulk("proto")
+	w.WriteInteger(2)
+	w.WriteBulk("id")
+	w.WriteInteger(int(c.id))
+	w.WriteBulk("mode")
+	w.WriteBulk("standalone")
+	w.WriteBulk("role")
+	w.WriteBulk("master")
+	w.WriteBulk("modules")
+	w.WriteArrayHeader(0)
+	w.WriteBulk("redis_easy_version")
+	w.WriteBulk(Version)
+	w.WriteBulk("redis_easy_git_sha1")
+	w.WriteBulk(GitCommit)
+	w.WriteBulk("redis_easy_build_date")
+	w.WriteBulk(BuildDate)
+}
+
+// PING 命令：PING [message]，没有参数时返回 PONG，否则原样返回 message。客户端库用它检查连接池中的连接是否可用
+func (srv *Server) handlePing(w *resp.Writer, args []string) {
+	if len(args) == 2 {
+		w.WriteBulk(args[1])
+		return
+	}
+	w.WriteString("+PONG\r\n")
+}
+
+// ECHO 命令：ECHO message，原样返回 message
+func (srv *Server) handleEcho(w *resp.Writer, args []string) {
+	w.WriteBulk(args[1])
+}
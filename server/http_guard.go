@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 排行榜 HTTP 服务（:8080）的访问控制，默认全部关闭：
+//   - http-auth-token 设置后要求 Authorization: Bearer <token>；浏览器的 EventSource 无法设置请求头，
+//     因此也接受查询参数 ?access_token=<token>
+//   - http-auth-user / http-auth-password 设置后接受 HTTP Basic 认证；两种认证都配置时满足任意一种即可
+//   - http-cors-origins 为允许跨域访问的来源列表（空格分隔），* 表示允许任意来源
+//   - http-rate-limit 为每个客户端 IP 每秒允许的请求数，超出时返回 429
+//
+// GET、HEAD、OPTIONS 以外的请求可能修改数据集，Upgrade 交接数据集期间返回 503（见 upgrade.go）
+
+// protectHTTP 在 next 外面依次加上限流、CORS 和认证，以及交接数据集期间对写请求的拒绝
+func (srv *Server) protectHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get()
+		if cfg.HTTPRateLimit > 0 && !srv.httpLimiter.allow(clientIP(r), cfg.HTTPRateLimit, time.Now()) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		if setCORSHeaders(w, r, cfg.HTTPCORSOrigins) && r.Method == http.MethodOptions {
+			// 预检请求不携带认证信息，直接放行
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !httpAuthorized(r, cfg) {
+			if cfg.HTTPAuthUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="leaderboard"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="leaderboard"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if !srv.beginBackgroundWrite() {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "dataset is being handed off to a new process", http.StatusServiceUnavailable)
+				return
+			}
+			defer srv.endBackgroundWrite()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpAuthorized 判断请求是否通过认证，没有配置任何认证方式时总是通过
+func httpAuthorized(r *http.Request, cfg *config.Config) bool {
+	if cfg.HTTPAuthToken == "" && cfg.HTTPAuthUser == "" {
+		return true
+	}
+	if cfg.HTTPAuthToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token != "" && secureEqual(token, cfg.HTTPAuthToken) {
+			return true
+		}
+	}
+	if cfg.HTTPAuthUser != "" {
+		user, password, ok := r.BasicAuth()
+		if ok && secureEqual(user, cfg.HTTPAuthUser) && secureEqual(password, cfg.HTTPAuthPassword) {
+			return true
+		}
+	}
+	return false
+}
+
+// secureEqual 以与内容无关的时间比较两个字符串，避免通过响应时间猜测凭据
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// setCORSHeaders 在请求来源被允许时写入 CORS 响应头，返回来源是否被允许
+func setCORSHeaders(w http.ResponseWriter, r *http.Request, origins string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origins == "" {
+		return false
+	}
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	allowed := false
+	for _, o := range strings.Fields(origins) {
+		if o == "*" {
+			h.Set("Access-Control-Allow-Origin", "*")
+			allowed = true
+			break
+		}
+		if strings.EqualFold(o, origin) {
+			// 只有明确列出的来源才允许携带 Cookie 和 Basic 认证等凭据
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	if r.Method == http.MethodOptions {
+		h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		h.Set("Access-Control-Max-Age", "600")
+	}
+	return true
+}
+
+// clientIP 返回请求的来源 IP。不信任 X-Forwarded-For，避免客户端伪造来源绕过限流
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tokenBucket 是一个客户端的令牌桶，容量等于每秒允许的请求数
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 按客户端 IP 限流，长时间没有请求的客户端会被定期清理
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// rateLimiterIdle 是客户端的令牌桶在没有请求多久之后被清理
+const rateLimiterIdle = time.Minute
+
+// allow 判断来自 ip 的请求是否在每秒 rate 次的限制之内，是则消耗一个令牌
+func (l *rateLimiter) allow(ip string, rate int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimiterIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > rateLimiterIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b := l.buckets[ip]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(rate), last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = min(float64(rate), b.tokens+now.Sub(b.last).Seconds()*float64(rate))
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
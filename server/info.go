@@ -0,0 +1,189 @@
+package server
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// infoSection 是 INFO 命令输出中的一个小节，write 以 "name:value" 的形式逐行追加字段
+type infoSection struct {
+	name  string
+	title string
+	write func(srv *Server, b *strings.Builder)
+}
+
+var infoSections = []infoSection{
+	{"server", "Server", (*Server).writeInfoServer},
+	{"clients", "Clients", (*Server).writeInfoClients},
+	{"memory", "Memory", (*Server).writeInfoMemory},
+	{"persistence", "Persistence", (*Server).writeInfoPersistence},
+	{"stats", "Stats", (*Server).writeInfoStats},
+	{"keyspace", "Keyspace", (*Server).writeInfoKeyspace},
+	{"namespaces", "Namespaces", (*Server).writeInfoNamespaces},
+}
+
+func writeInfoField(b *strings.Builder, name string, value string) {
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteString("\r\n")
+}
+
+func (srv *Server) writeInfoServer(b *strings.Builder) {
+	writeInfoField(b, "redis_version", compatRedisVersion)
+	writeInfoField(b, "redis_easy_version", Version)
+	writeInfoField(b, "redis_easy_git_sha1", GitCommit)
+	writeInfoField(b, "redis_easy_build_date", BuildDate)
+	writeInfoField(b, "go_version", runtime.Version())
+	writeInfoField(b, "os", runtime.GOOS+" "+runtime.GOARCH)
+	writeInfoField(b, "process_id", strconv.Itoa(os.Getpid()))
+	writeInfoField(b, "io_backend", config.Get().IOBackend)
+	writeInfoField(b, "uptime_in_seconds", strconv.FormatInt(int64(time.Since(srv.started).Seconds()), 10))
+}
+
+func (srv *Server) writeInfoClients(b *strings.Builder) {
+	writeInfoField(b, "connected_clients", strconv.Itoa(srv.connectedClients()))
+	accepting, draining, _, _ := srv.drainStatus()
+	writeInfoField(b, "accepting_connections", boolToInfo(accepting))
+	writeInfoField(b, "draining", boolToInfo(draining))
+}
+
+func (srv *Server) writeInfoPersistence(b *strings.Builder) {
+	writeInfoField(b, "loading", boolToInfo(srv.loadingSnapshot.Load()))
+	writeInfoField(b, "rdb_bgsave_in_progress", boolToInfo(srv.snapshotInProgress.Load()))
+	writeInfoField(b, "rdb_changes_since_last_save", strconv.FormatInt(srv.changesSinceSave.Load(), 10))
+	writeInfoField(b, "rdb_last_save_time", strconv.FormatInt(srv.lastSaveUnix.Load(), 10))
+	status := "ok"
+	if srv.lastSaveFailed.Load() {
+		status = "err"
+	}
+	writeInfoField(b, "rdb_last_bgsave_status", status)
+}
+
+// boolToInfo 把布尔值格式化为 INFO 中的 0 / 1
+func boolToInfo(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func (srv *Server) writeInfoStats(b *strings.Builder) {
+	writeInfoField(b, "total_connections_received", strconv.FormatInt(srv.totalConnections.Load(), 10))
+	writeInfoField(b, "total_commands_processed", strconv.FormatInt(srv.totalCommands.Load(), 10))
+	writeInfoField(b, "client_output_buffer_limit_disconnections", strconv.FormatInt(srv.outputLimitDisconnections.Load(), 10))
+	writeInfoField(b, "rejected_busy_commands", strconv.FormatInt(srv.rejectedBusy.Load(), 10))
+	writeInfoField(b, "rejected_overloaded_commands", strconv.FormatInt(srv.rejectedOverloaded.Load(), 10))
+	_, _, expired := srv.store.ExpireStats()
+	writeInfoField(b, "expired_keys", strconv.FormatInt(expired, 10))
+	// 没有按内存淘汰键的策略，始终为 0，保留这一项是为了可以直接使用 Redis 的监控面板
+	writeInfoField(b, "evicted_keys", "0")
+	writeInfoField(b, "webhook_sent_events", strconv.FormatInt(srv.webhook.sent.Load(), 10))
+	writeInfoField(b, "webhook_failed_events", strconv.FormatInt(srv.webhook.failed.Load(), 10))
+	writeInfoField(b, "webhook_dropped_events", strconv.FormatInt(srv.webhook.dropped.Load(), 10))
+	writeInfoField(b, "nats_published_events", strconv.FormatInt(srv.nats.sent.Load(), 10))
+	writeInfoField(b, "nats_failed_events", strconv.FormatInt(srv.nats.failed.Load(), 10))
+	writeInfoField(b, "nats_dropped_events", strconv.FormatInt(srv.nats.dropped.Load(), 10))
+	srv.writeBehind.mu.Lock()
+	pending := len(srv.writeBehind.pending)
+	srv.writeBehind.mu.Unlock()
+	writeInfoField(b, "write_behind_pending_keys", strconv.Itoa(pending))
+	writeInfoField(b, "write_behind_synced_keys", strconv.FormatInt(srv.writeBehind.flushed.Load(), 10))
+	writeInfoField(b, "write_behind_failed_batches", strconv.FormatInt(srv.writeBehind.failed.Load(), 10))
+}
+
+func (srv *Server) writeInfoKeyspace(b *strings.Builder) {
+	expires, avgTTL, _ := srv.store.ExpireStats()
+	writeInfoField(b, "db0", "keys="+strconv.Itoa(srv.store.KeyCount())+",expires="+strconv.FormatInt(expires, 10)+
+		",avg_ttl="+strconv.FormatInt(avgTTL.Milliseconds(), 10))
+}
+
+func (srv *Server) writeInfoMemory(b *strings.Builder) {
+	byType := srv.store.UsedMemory()
+	var dataset int64
+	for _, n := range byType {
+		dataset += n
+	}
+	lazyfreePending, lazyfreed := store.LazyfreeStats()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	writeInfoField(b, "used_memory", strconv.FormatUint(ms.HeapAlloc, 10))
+	writeInfoField(b, "used_memory_human", bytesToHuman(int64(ms.HeapAlloc)))
+	writeInfoField(b, "used_memory_dataset", strconv.FormatInt(dataset, 10))
+	writeInfoField(b, "used_memory_dataset_human", bytesToHuman(dataset))
+	for t, n := range byType {
+		writeInfoField(b, "used_memory_"+store.DataType(t).String(), strconv.FormatInt(n, 10))
+	}
+	writeInfoField(b, "used_memory_heap_inuse", strconv.FormatUint(ms.HeapInuse, 10))
+	writeInfoField(b, "used_memory_heap_released", strconv.FormatUint(ms.HeapReleased, 10))
+	writeInfoField(b, "used_memory_sys", strconv.FormatUint(ms.Sys, 10))
+	writeInfoField(b, "used_memory_sys_human", bytesToHuman(int64(ms.Sys)))
+	writeInfoField(b, "lazyfree_pending_objects", strconv.FormatInt(lazyfreePending, 10))
+	writeInfoField(b, "lazyfreed_objects", strconv.FormatInt(lazyfreed, 10))
+}
+
+// bytesToHuman 把字节数格式化为 1.50M 这样的可读形式，与 Redis 的 used_memory_human 一致
+func bytesToHuman(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64) + units[i]
+}
+
+// infoFields 以 小节名 -> 字段名 -> 值 的形式返回 INFO 的全部内容，供管理后台使用
+func (srv *Server) infoFields() map[string]map[string]string {
+	fields := make(map[string]map[string]string, len(infoSections))
+	for _, section := range infoSections {
+		var b strings.Builder
+		section.write(srv, &b)
+		m := make(map[string]string)
+		for _, line := range strings.Split(b.String(), "\r\n") {
+			if name, value, ok := strings.Cut(line, ":"); ok {
+				m[name] = value
+			}
+		}
+		fields[section.name] = m
+	}
+	return fields
+}
+
+// INFO 命令：INFO [section ...]，不带参数或参数为 all / everything / default 时输出所有小节
+func (srv *Server) handleInfo(w *resp.Writer, args []string) {
+	want := make(map[string]bool)
+	all := len(args) == 1
+	for _, arg := range args[1:] {
+		switch name := strings.ToLower(arg); name {
+		case "all", "everything", "default":
+			all = true
+		default:
+			want[name] = true
+		}
+	}
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !want[section.name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + section.title + "\r\n")
+		section.write(srv, &b)
+	}
+	w.WriteBulk(b.String())
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// leaderboardPolicy 从当前配置读取排行榜对分数更新的约束
+func leaderboardPolicy() leaderboard.Policy {
+	cfg := config.Get()
+	return leaderboard.Policy{
+		MinScore:         cfg.LeaderboardMinScore,
+		MaxScore:         cfg.LeaderboardMaxScore,
+		MaxDelta:         cfg.LeaderboardMaxDelta,
+		MaxUpdatesPerSec: cfg.LeaderboardMaxUpdatesPerSec,
+	}
+}
+
+// startLeaderboardSeasons 启动赛季轮换 goroutine，每秒检查一次是否进入了新的赛季，实例 Stop 时退出；数据集冻结期间不轮换。
+// 从快照载入的赛季名与当前时间对应的赛季不同（停机期间跨过了赛季边界）时，启动后会立即轮换
+func (srv *Server) startLeaderboardSeasons() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if !srv.beginBackgroundWrite() {
+					continue
+				}
+				name := leaderboard.SeasonName(config.Get().LeaderboardSeason, now)
+				if archive := srv.seasons.Advance(name, now); archive != nil {
+					srv.logger.Printf("Leaderboard season %s archived, starting %s\n", archive.Name, name)
+				}
+				srv.endBackgroundWrite()
+			case <-srv.stopping:
+				return
+			}
+		}
+	}()
+}
+
+// LBADD 命令：LBADD user score [META json]，更新或插入用户分数到排行榜。
+// META 为用户附带一段 JSON 元数据（显示名、头像、地区等），省略时保留用户原有的元数据
+func (srv *Server) handleLBAdd(w *resp.Writer, args []string) {
+	user := args[1]
+	score, _ := strconv.Atoi(args[2])
+	var meta string
+	if len(args) == 5 {
+		meta = args[4]
+		if err := leaderboard.ValidateMeta(meta); err != nil {
+			w.WriteError(err.Error())
+			return
+		}
+	}
+	if err := srv.board.Set(user, score, meta, leaderboardPolicy()); err != nil {
+		w.WriteError(err.Error())
+		return
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// LBTOP 命令：LBTOP N [WITHMETA]，返回排行榜前 N 名及其分数（返回 RESP 格式）
+func (srv *Server) handleLBTop(w *resp.Writer, args []string) {
+	topN, _ := strconv.Atoi(args[1])
+	if topN <= 0 {
+		w.WriteString("-ERR N must be a positive integer\r\n")
+		return
+	}
+	opts := parseLeaderboardReplyOptions(args[2:], true)
+	writeLeaderboardEntries(w, srv.board.Range(0, topN-1), opts)
+}
+
+// LBINCRBY 命令：LBINCRBY user delta，把用户的分数原子地加上 delta（可以为负数）并返回新分数。
+// 用户不存在时视为从最低分开始，结果同样截断到 leaderboard-min-score 与 leaderboard-max-score 之间
+func (srv *Server) handleLBIncrBy(w *resp.Writer, args []string) {
+	user := args[1]
+	delta, _ := strconv.Atoi(args[2])
+	score, err := srv.board.Incr(user, delta, leaderboardPolicy())
+	if err != nil {
+		w.WriteError(err.Error())
+		return
+	}
+	w.WriteInteger(score)
+}
+
+// LBRANK 命令：LBRANK user，返回用户的名次（第一名为 1），用户不存在时返回 nil
+func (srv *Server) handleLBRank(w *resp.Writer, args []string) {
+	rank, _, ok := srv.board.Rank(args[1])
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteInteger(rank)
+}
+
+// LBSCORE 命令：LBSCORE user，返回用户当前的分数，用户不存在时返回 nil
+func (srv *Server) handleLBScore(w *resp.Writer, args []string) {
+	score, ok := srv.board.Score(args[1])
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteInteger(score)
+}
+
+// LBHISTORY 命令：LBHISTORY user [count]，返回用户最近的最多 count 条分数历史（不带 count 时返回全部），从新到旧排列，
+// 每条是 [提交时间的 unix 毫秒数, 提交后的分数, 提交后的名次]。没有开启 leaderboard-history-max-len 或者用户没有历史时返回空数组
+func (srv *Server) handleLBHistory(w *resp.Writer, args []string) {
+	count := 0
+	if len(args) == 3 {
+		n, _ := strconv.Atoi(args[2])
+		if n <= 0 {
+			w.WriteString("-ERR count must be a positive integer\r\n")
+			return
+		}
+		count = n
+	}
+	entries := srv.history.Get(args[1], count, config.Get().LeaderboardHistoryMaxLen)
+	w.WriteArrayHeader(len(entries))
+	for _, e := range entries {
+		w.WriteArrayHeader(3)
+		w.WriteInteger(int(e.Time.UnixMilli()))
+		w.WriteInteger(e.Score)
+		w.WriteInteger(e.Rank)
+	}
+}
+
+// LBRANGE 命令：LBRANGE start stop [WITHSCORES] [WITHMETA]，按名次返回下标 [start, stop] 之间的用户
+// （第一名下标为 0，负数表示从末尾倒数），用于分页浏览排行榜。带 WITHSCORES 时每个用户后紧跟其分数，
+// 与 LBTOP 的回复格式相同；带 WITHMETA 时再跟上用户的元数据（没有时为 nil）
+func (srv *Server) handleLBRange(w *resp.Writer, args []string) {
+	start, _ := strconv.Atoi(args[1])
+	stop, _ := strconv.Atoi(args[2])
+	opts := parseLeaderboardReplyOptions(args[3:], false)
+	writeLeaderboardEntries(w, srv.board.Range(start, stop), opts)
+}
+
+// leaderboardReplyOptions 决定回复用户列表时每个用户后面附带哪些字段
+type leaderboardReplyOptions struct {
+	withScores bool
+	withMeta   bool
+}
+
+// leaderboardReplyOptionSpecs 是命令表中 LBTOP、LBRANGE 等命令的可选项
+var leaderboardReplyOptionSpecs = []commandOption{{name: "WITHSCORES"}, {name: "WITHMETA"}}
+
+// parseLeaderboardReplyOptions 解析 WITHSCORES / WITHMETA 选项，withScores 为默认是否附带分数。
+// 选项的语法已由命令表检查
+func parseLeaderboardReplyOptions(args []string, withScores bool) leaderboardReplyOptions {
+	opts := leaderboardReplyOptions{withScores: withScores}
+	for _, arg := range args {
+		if strings.EqualFold(arg, "WITHSCORES") {
+			opts.withScores = true
+		} else {
+			opts.withMeta = true
+		}
+	}
+	return opts
+}
+
+// writeLeaderboardEntries 按 LBRANGE 的约定回复一组用户
+func writeLeaderboardEntries(w *resp.Writer, entries []leaderboard.Entry, opts leaderboardReplyOptions) {
+	fields := 1
+	if opts.withScores {
+		fields++
+	}
+	if opts.withMeta {
+		fields++
+	}
+	w.WriteArrayHeader(len(entries) * fields)
+	for _, e := range entries {
+		w.WriteBulk(e.User)
+		if opts.withScores {
+			w.WriteBulk(strconv.Itoa(e.Score))
+		}
+		if opts.withMeta {
+			if e.Meta == "" {
+				w.WriteString("$-1\r\n")
+			} else {
+				w.WriteBulk(e.Meta)
+			}
+		}
+	}
+}
+
+// LBREM 命令：LBREM user，把用户从排行榜中移除，返回移除的用户数（0 或 1）
+func (srv *Server) handleLBRem(w *resp.Writer, args []string) {
+	if srv.board.Remove(args[1]) {
+		w.WriteString(":1\r\n")
+	} else {
+		w.WriteString(":0\r\n")
+	}
+}
+
+// LBCLEAR 命令：清空整个排行榜
+func (srv *Server) handleLBClear(w *resp.Writer, args []string) {
+	srv.board.Drain()
+	w.WriteString("+OK\r\n")
+}
+
+// LBAROUND 命令：LBAROUND user N，返回排在用户前后各 N 名以内的用户（包括用户本人），
+// 每个用户依次回复用户名、分数和名次（第一名为 1）。用户不存在时返回 nil
+func (srv *Server) handleLBAround(w *resp.Writer, args []string) {
+	n, _ := strconv.Atoi(args[2])
+	if n < 0 {
+		w.WriteString("-ERR N must be a non-negative integer\r\n")
+		return
+	}
+	entries, first, ok := srv.board.Around(args[1], n)
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteArrayHeader(len(entries) * 3)
+	for i, e := range entries {
+		w.WriteBulk(e.User)
+		w.WriteBulk(strconv.Itoa(e.Score))
+		w.WriteInteger(first + i)
+	}
+}
+
+// LBPERCENTILE 命令：LBPERCENTILE user，返回用户位于排行榜前百分之多少（保留两位小数，第一名为 100/总人数），
+// 用户不存在时返回 nil
+func (srv *Server) handleLBPercentile(w *resp.Writer, args []string) {
+	rank, total, ok := srv.board.Rank(args[1])
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteBulk(strconv.FormatFloat(float64(rank)*100/float64(total), 'f', 2, 64))
+}
+
+// parseScoreBound 解析 LBCOUNT 的分数边界，与 ZCOUNT 相同支持 -inf、+inf 以及表示开区间的 ( 前缀
+func parseScoreBound(s string) (bound int, exclusive bool, err error) {
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.MinInt, false, nil
+	case "+inf", "inf":
+		return math.MaxInt, false, nil
+	}
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	bound, err = strconv.Atoi(s)
+	return bound, exclusive, err
+}
+
+// LBCOUNT 命令：LBCOUNT min max，返回分数在 [min, max] 之间的用户数
+func (srv *Server) handleLBCount(w *resp.Writer, args []string) {
+	lo, loExcl, err1 := parseScoreBound(args[1])
+	hi, hiExcl, err2 := parseScoreBound(args[2])
+	if err1 != nil || err2 != nil {
+		w.WriteString("-ERR min or max is not an integer\r\n")
+		return
+	}
+	w.WriteInteger(srv.board.Count(lo, loExcl, hi, hiExcl))
+}
+
+func writeArchiveRange(w *resp.Writer, a *leaderboard.Archive, start, stop int, opts leaderboardReplyOptions) {
+	start, stop, ok := leaderboard.NormalizeRange(start, stop, len(a.Entries))
+	if !ok {
+		w.WriteString("*0\r\n")
+		return
+	}
+	writeLeaderboardEntries(w, a.Entries[start:stop+1], opts)
+}
+
+// LBSEASON CURRENT 命令：返回当前赛季名，未开启赛季时返回 nil
+func (srv *Server) handleLBSeasonCurrent(w *resp.Writer, args []string) {
+	current := srv.seasons.Current()
+	if current == "" {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteBulk(current)
+}
+
+// LBSEASON LIST 命令：按归档时间返回所有已归档的赛季名
+func (srv *Server) handleLBSeasonList(w *resp.Writer, args []string) {
+	archives := srv.seasons.Archives()
+	w.WriteArrayHeader(len(archives))
+	for _, a := range archives {
+		w.WriteBulk(a.Name)
+	}
+}
+
+// LBSEASON TOP 命令：LBSEASON TOP season N [WITHMETA]，返回归档赛季的前 N 名，格式与 LBTOP 相同
+func (srv *Server) handleLBSeasonTop(w *resp.Writer, args []string) {
+	topN, _ := strconv.Atoi(args[3])
+	if topN <= 0 {
+		w.WriteString("-ERR N must be a positive integer\r\n")
+		return
+	}
+	archive := srv.seasons.Find(args[2])
+	if archive == nil {
+		w.WriteError("ERR no such season '" + args[2] + "'")
+		return
+	}
+	writeArchiveRange(w, archive, 0, topN-1, parseLeaderboardReplyOptions(args[4:], true))
+}
+
+// LBSEASON RANGE 命令：LBSEASON RANGE season start stop [WITHSCORES] [WITHMETA]，分页查询归档赛季，格式与 LBRANGE 相同
+func (srv *Server) handleLBSeasonRange(w *resp.Writer, args []string) {
+	start, _ := strconv.Atoi(args[3])
+	stop, _ := strconv.Atoi(args[4])
+	archive := srv.seasons.Find(args[2])
+	if archive == nil {
+		w.WriteError("ERR no such season '" + args[2] + "'")
+		return
+	}
+	writeArchiveRange(w, archive, start, stop, parseLeaderboardReplyOptions(args[5:], false))
+}
+
+// LBSEASON ROTATE 命令：立即结束当前赛季并归档，返回归档的名称
+func (srv *Server) handleLBSeasonRotate(w *resp.Writer, args []string) {
+	w.WriteBulk(srv.seasons.Rotate(time.Now()).Name)
+}
+
+// LBCHANGES 命令：LBCHANGES board since-id [COUNT n]，返回排行榜在 since-id 之后的变化。
+// board 为 current 或当前赛季名；since-id 为 $ 时表示从当前最新的位置开始。
+// 回复为两个元素的数组：下一次调用应使用的 since-id，以及按顺序排列的变化，每个变化是以下之一：
+//   - [id, "set", user, score]  用户的分数或元数据被更新
+//   - [id, "rem", user]         用户被移除
+//   - [id, "clear"]             排行榜被清空（LBCLEAR 或赛季轮换）
+func (srv *Server) handleLBChanges(w *resp.Writer, args []string) {
+	count := 0
+	if len(args) == 5 {
+		n, _ := strconv.Atoi(args[4])
+		if n <= 0 {
+			w.WriteString("-ERR COUNT must be a positive integer\r\n")
+			return
+		}
+		count = n
+	}
+
+	season := srv.seasons.Current()
+	current := args[1] == "current" || (season != "" && args[1] == season)
+	archived := srv.seasons.Find(args[1]) != nil
+	if !current && !archived {
+		w.WriteError("ERR no such board '" + args[1] + "'")
+		return
+	}
+
+	maxLen := config.Get().LeaderboardChangesMaxLen
+	var since int64
+	if args[2] == "$" {
+		_, since, _ = srv.changes.Since(0, 0, maxLen)
+	} else {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n < 0 {
+			w.WriteString("-ERR since-id must be a non-negative integer or $\r\n")
+			return
+		}
+		since = n
+	}
+	if archived && !current {
+		// 归档榜单不再变化
+		w.WriteArrayHeader(2)
+		w.WriteInteger(int(since))
+		w.WriteArrayHeader(0)
+		return
+	}
+
+	records, _, ok := srv.changes.Since(since, count, maxLen)
+	if !ok {
+		w.WriteError("ERR changes after id " + strconv.FormatInt(since, 10) + " are no longer available, resync with LBRANGE")
+		return
+	}
+	next := since
+	if len(records) > 0 {
+		next = records[len(records)-1].ID
+	}
+	w.WriteArrayHeader(2)
+	w.WriteInteger(int(next))
+	w.WriteArrayHeader(len(records))
+	for _, r := range records {
+		switch c := r.Change; {
+		case c.Cleared:
+			w.WriteArrayHeader(2)
+			w.WriteInteger(int(r.ID))
+			w.WriteBulk("clear")
+		case c.Removed:
+			w.WriteArrayHeader(3)
+			w.WriteInteger(int(r.ID))
+			w.WriteBulk("rem")
+			w.WriteBulk(c.User)
+		default:
+			w.WriteArrayHeader(4)
+			w.WriteInteger(int(r.ID))
+			w.WriteBulk("set")
+			w.WriteBulk(c.User)
+			w.WriteInteger(c.Score)
+		}
+	}
+}
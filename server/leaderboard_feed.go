@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+)
+
+// 排行榜实时推送。/leaderboard/events 是一个 Server-Sent Events 端点，排行榜每次变化
+// （LBADD、LBINCRBY、LBREM、LBCLEAR、赛季轮换）都会立即推送给所有订阅者：
+//
+//	event: change
+//	data: {"user":"alice","score":90,"rank":3,"meta":{...}}
+//
+//	event: remove
+//	data: {"user":"alice"}
+//
+//	event: clear
+//	data: {}
+//
+// 实例排空连接时（见 drain.go）订阅者收到 event: shutdown 后被断开，应重连（到其他实例）。
+//
+// 推送只描述发生变化的用户，其他用户的名次随之移动，需要完整榜单的客户端应在连接后
+// 以及收到事件后通过 /api/leaderboard 重新拉取
+
+const (
+	// feedBufferSize 是每个订阅者的待发送事件队列长度。订阅者跟不上时会被断开，
+	// 浏览器的 EventSource 会自动重连并重新拉取榜单
+	feedBufferSize = 256
+	// feedHeartbeat 是空闲时发送心跳注释的间隔，避免代理关闭长时间没有数据的连接
+	feedHeartbeat = 15 * time.Second
+)
+
+// publishLeaderboardChange 把排行榜的变化分发给所有 SSE 订阅者（srv.feed）。
+// 它在持有排行榜写锁时被调用，因此只做非阻塞发送
+func (srv *Server) publishLeaderboardChange(c leaderboard.Change) {
+	srv.feed.mu.Lock()
+	defer srv.feed.mu.Unlock()
+	for ch := range srv.feed.subs {
+		select {
+		case ch <- c:
+		default:
+			// 订阅者的队列已满，断开它而不是丢掉中间的事件
+			delete(srv.feed.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (srv *Server) subscribeLeaderboard() chan leaderboard.Change {
+	ch := make(chan leaderboard.Change, feedBufferSize)
+	srv.feed.mu.Lock()
+	srv.feed.subs[ch] = struct{}{}
+	srv.feed.mu.Unlock()
+	return ch
+}
+
+func (srv *Server) unsubscribeLeaderboard(ch chan leaderboard.Change) {
+	srv.feed.mu.Lock()
+	defer srv.feed.mu.Unlock()
+	if _, ok := srv.feed.subs[ch]; ok {
+		delete(srv.feed.subs, ch)
+		close(ch)
+	}
+}
+
+// closeLeaderboardFeed 在排空连接时断开所有 SSE 订阅者，订阅者收到 shutdown 事件后重连到其他实例
+func (srv *Server) closeLeaderboardFeed() {
+	srv.feed.mu.Lock()
+	defer srv.feed.mu.Unlock()
+	for ch := range srv.feed.subs {
+		delete(srv.feed.subs, ch)
+		close(ch)
+	}
+}
+
+// writeFeedEvent 把一次变化写成一个 SSE 事件
+func writeFeedEvent(w http.ResponseWriter, c leaderboard.Change) {
+	switch {
+	case c.Cleared:
+		fmt.Fprint(w, "event: clear\ndata: {}\n\n")
+	case c.Removed:
+		data, _ := json.Marshal(map[string]string{"user": c.User})
+		fmt.Fprintf(w, "event: remove\ndata: %s\n\n", data)
+	default:
+		data, _ := json.Marshal(toAPIEntry(c.Rank, leaderboard.Entry{User: c.User, Score: c.Score, Meta: c.Meta}))
+		fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+	}
+}
+
+func (srv *Server) leaderboardEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	if srv.draining.Load() {
+		http.Error(w, "server is draining", http.StatusServiceUnavailable)
+		return
+	}
+	ch := srv.subscribeLeaderboard()
+	defer srv.unsubscribeLeaderboard(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// 断线后浏览器在 1 秒后重连
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(feedHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				if srv.draining.Load() {
+					fmt.Fprint(w, "event: shutdown\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			writeFeedEvent(w, c)
+			// 把已经排队的事件一起写出，只刷新一次
+			for n := len(ch); n > 0; n-- {
+				if c, ok = <-ch; !ok {
+					break
+				}
+				writeFeedEvent(w, c)
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+)
+
+// 排行榜的 JSON API，与 HTML 快照页面一起挂在 :8080 上：
+//
+//	GET /api/leaderboard?board=X&limit=N&offset=M  按名次分页返回榜单
+//	GET /api/leaderboard/{user}?board=X            返回单个用户的名次和分数
+//
+// board 省略或为 current 时查询当前榜单，否则为归档赛季名（见 LBSEASON LIST）。
+// 当前榜单的分页带有按榜单版本生成的 ETag，榜单没有变化时对 If-None-Match 回复 304，不重新计算这一页
+
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 1000
+)
+
+type apiLeaderboardEntry struct {
+	Rank  int             `json:"rank"`
+	User  string          `json:"user"`
+	Score int             `json:"score"`
+	Meta  json.RawMessage `json:"meta,omitempty"`
+}
+
+type apiLeaderboardPage struct {
+	Board   string                `json:"board"`
+	Total   int                   `json:"total"`
+	Offset  int                   `json:"offset"`
+	Limit   int                   `json:"limit"`
+	Entries []apiLeaderboardEntry `json:"entries"`
+}
+
+func (srv *Server) registerLeaderboardAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/leaderboard", srv.leaderboardAPIHandler)
+	mux.HandleFunc("/api/leaderboard/", srv.leaderboardUserAPIHandler)
+}
+
+// checkAPIRequest 检查请求方法和 Accept 头，不满足时写入错误响应并返回 false
+func checkAPIRequest(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if negotiate(r, "application/json") == "" {
+		writeJSONError(w, http.StatusNotAcceptable, "only application/json is available")
+		return false
+	}
+	return true
+}
+
+// negotiate 按请求的 Accept 头从 offers 中选出客户端最偏好的媒体类型，q 值相同时取 offers 中靠前的一个。
+// 没有 Accept 头时返回第一个 offer，没有可接受的类型时返回空字符串
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := 0.0
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+			prefix, _, _ := strings.Cut(offer, "/")
+			if mediaType != offer && mediaType != prefix+"/*" && mediaType != "*/*" {
+				continue
+			}
+			partQ := 1.0
+			for _, p := range strings.Split(params, ";") {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						partQ = f
+					}
+				}
+			}
+			q = max(q, partQ)
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// etagMatch 返回 If-None-Match 头中是否包含 etag
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// queryInt 读取非负整数查询参数，参数不存在时返回 def
+func queryInt(r *http.Request, name string, def int) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n >= 0
+}
+
+// boardEntries 返回榜单中名次下标在 [offset, offset+limit) 之间的用户以及榜单总人数
+func (srv *Server) boardEntries(board string, offset, limit int) ([]leaderboard.Entry, int, bool) {
+	// offset 和 limit 可以是任意大的非负整数，先与榜单人数比较，避免 offset+limit 溢出
+	if board == "" || board == "current" {
+		total := srv.board.Len()
+		if limit == 0 || offset >= total {
+			return nil, total, true
+		}
+		return srv.board.Range(offset, offset+min(limit, total-offset)-1), total, true
+	}
+	archive := srv.seasons.Find(board)
+	if archive == nil {
+		return nil, 0, false
+	}
+	total := len(archive.Entries)
+	start := min(offset, total)
+	return archive.Entries[start : start+min(limit, total-start)], total, true
+}
+
+func toAPIEntry(rank int, e leaderboard.Entry) apiLeaderboardEntry {
+	entry := apiLeaderboardEntry{Rank: rank, User: e.User, Score: e.Score}
+	if e.Meta != "" {
+		entry.Meta = json.RawMessage(e.Meta)
+	}
+	return entry
+}
+
+func (srv *Server) leaderboardAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkAPIRequest(w, r) {
+		return
+	}
+	limit, ok1 := queryInt(r, "limit", apiDefaultLimit)
+	offset, ok2 := queryInt(r, "offset", 0)
+	if !ok1 || !ok2 {
+		writeJSONError(w, http.StatusBadRequest, "limit and offset must be non-negative integers")
+		return
+	}
+	limit = min(limit, apiMaxLimit)
+	board := r.URL.Query().Get("board")
+	if board == "" || board == "current" {
+		// 先取版本号再取数据，期间榜单发生变化时 ETag 偏旧，客户端下次只会多拉取一次
+		etag := fmt.Sprintf(`"%d-%d-%d-%d"`, srv.started.UnixNano(), srv.changes.LastID(), offset, limit)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	entries, total, ok := srv.boardEntries(board, offset, limit)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "no such board")
+		return
+	}
+	if board == "" {
+		board = "current"
+	}
+	page := apiLeaderboardPage{Board: board, Total: total, Offset: offset, Limit: limit, Entries: []apiLeaderboardEntry{}}
+	for i, e := range entries {
+		page.Entries = append(page.Entries, toAPIEntry(offset+i+1, e))
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (srv *Server) leaderboardUserAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkAPIRequest(w, r) {
+		return
+	}
+	user := strings.TrimPrefix(r.URL.Path, "/api/leaderboard/")
+	if user == "" || strings.Contains(user, "/") {
+		writeJSONError(w, http.StatusNotFound, "no such user")
+		return
+	}
+	board := r.URL.Query().Get("board")
+	if board == "" || board == "current" {
+		e, rank, ok := srv.board.Entry(user)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIEntry(rank, e))
+		return
+	}
+	archive := srv.seasons.Find(board)
+	if archive == nil {
+		writeJSONError(w, http.StatusNotFound, "no such board")
+		return
+	}
+	for i, e := range archive.Entries {
+		if e.User == user {
+			writeJSON(w, http.StatusOK, toAPIEntry(i+1, e))
+			return
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, "no such user")
+}
+
+// HTTP handler: 实时生成排行榜快照页面，显示 Top20。页面订阅 /leaderboard/events，
+// 前 20 名发生变化时通过 /api/leaderboard 重新拉取并就地更新表格；重新连接事件流时的拉取由 ETag 确认，
+// 期间榜单没有变化时服务端回复 304，不重新计算榜单
+func (srv *Server) leaderboardSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	// 请求 JSON 的客户端得到与 /api/leaderboard 相同的数据
+	switch negotiate(r, "text/html", "application/json") {
+	case "application/json":
+		srv.leaderboardAPIHandler(w, r)
+		return
+	case "":
+		http.Error(w, "not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	data := srv.board.Range(0, 19)
+	topN := len(data)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<html>
+<head>
+<title>Leaderboard Snapshot</title>
+<style>
+table { border-collapse: collapse; width: 50%%; }
+th, td { border: 1px solid #ccc; padding: 8px; text-align: center; }
+</style>
+</head>
+<body>
+<h2>Leaderboard Snapshot (Top <span id="top">%d</span>)</h2>
+<table>
+<thead><tr><th>Rank</th><th>User</th><th>Region</th><th>Score</th></tr></thead>
+<tbody id="rows">`, topN)
+	for i := 0; i < topN; i++ {
+		// 用户带有元数据时显示其中的显示名、头像和地区
+		var meta struct {
+			Name   string `json:"name"`
+			Avatar string `json:"avatar"`
+			Region string `json:"region"`
+		}
+		if data[i].Meta != "" {
+			json.Unmarshal([]byte(data[i].Meta), &meta)
+		}
+		name := data[i].User
+		if meta.Name != "" {
+			name = meta.Name
+		}
+		user := html.EscapeString(name)
+		if meta.Avatar != "" {
+			user = fmt.Sprintf(`<img src="%s" width="24" height="24"> %s`, html.EscapeString(meta.Avatar), user)
+		}
+		fmt.Fprintf(w, "<tr data-user=\"%s\"><td>%d</td><td>%s</td><td>%s</td><td>%d</td></tr>", html.EscapeString(data[i].User), i+1, user, html.EscapeString(meta.Region), data[i].Score)
+	}
+	fmt.Fprint(w, `</tbody>
+</table>
+<script>
+const limit = 20;
+// 使用 http-auth-token 时，页面通过 ?access_token= 打开，后续请求沿用同一个令牌
+const token = new URLSearchParams(location.search).get("access_token");
+const auth = token ? "&access_token=" + encodeURIComponent(token) : "";
+let shown = new Set([...document.querySelectorAll("#rows tr")].map(tr => tr.dataset.user));
+let pending = null;
+
+function cell(tr, text) {
+  const td = tr.insertCell();
+  td.textContent = text;
+  return td;
+}
+
+function render(page) {
+  const rows = document.getElementById("rows");
+  rows.replaceChildren();
+  shown = new Set();
+  for (const e of page.entries) {
+    const meta = e.meta || {};
+    const tr = rows.insertRow();
+    tr.dataset.user = e.user;
+    shown.add(e.user);
+    cell(tr, e.rank);
+    const td = cell(tr, " " + (meta.name || e.user));
+    if (meta.avatar) {
+      const img = document.createElement("img");
+      img.src = meta.avatar;
+      img.width = img.height = 24;
+      td.prepend(img);
+    }
+    cell(tr, meta.region || "");
+    cell(tr, e.score);
+  }
+  document.getElementById("top").textContent = page.entries.length;
+}
+
+// 一批事件只触发一次拉取
+function refresh() {
+  if (pending) return;
+  pending = setTimeout(() => {
+    fetch("/api/leaderboard?limit=" + limit + auth)
+      .then(r => r.json())
+      .then(render)
+      .finally(() => { pending = null; });
+  }, 100);
+}
+
+const events = new EventSource("/leaderboard/events?" + auth.slice(1));
+events.onopen = refresh;
+events.addEventListener("change", ev => {
+  const c = JSON.parse(ev.data);
+  if (c.rank <= limit || shown.has(c.user)) refresh();
+});
+events.addEventListener("remove", ev => {
+  if (shown.has(JSON.parse(ev.data).user)) refresh();
+});
+events.addEventListener("clear", refresh);
+</script>
+</body>
+</html>`)
+}
@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// TestLeaderboardAPIPaging 检查榜单 API 对当前榜单和已归档的赛季都能处理任意大的 offset 和 limit
+func TestLeaderboardAPIPaging(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	for i := 1; i <= 3; i++ {
+		c.do("LBADD", "u"+strconv.Itoa(i), strconv.Itoa(i*10))
+	}
+	season, ok := c.do("LBSEASON", "ROTATE").(string)
+	if !ok {
+		t.Fatal("LBSEASON ROTATE did not return the archived season")
+	}
+	c.do("LBADD", "u1", "10")
+	c.do("LBADD", "u2", "20")
+
+	maxInt := strconv.Itoa(math.MaxInt)
+	tests := []struct {
+		board, offset, limit string
+		want, total          int
+	}{
+		{"current", "0", "10", 2, 2},
+		{"current", "1", maxInt, 1, 2},
+		{"current", maxInt, "10", 0, 2},
+		{season, "0", "10", 3, 3},
+		{season, "2", maxInt, 1, 3},
+		{season, maxInt, "10", 0, 3},
+		{season, maxInt, maxInt, 0, 3},
+	}
+	for _, tt := range tests {
+		url := "/api/leaderboard?board=" + tt.board + "&offset=" + tt.offset + "&limit=" + tt.limit
+		rec := httptest.NewRecorder()
+		srv.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d: %s", url, rec.Code, rec.Body)
+			continue
+		}
+		var page struct {
+			Total   int               `json:"total"`
+			Entries []json.RawMessage `json:"entries"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		if len(page.Entries) != tt.want || page.Total != tt.total {
+			t.Errorf("GET %s: %d entries of %d, want %d of %d", url, len(page.Entries), page.Total, tt.want, tt.total)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 值和集合类型大小的上限（max-string-size、max-list-elements、max-set-elements、max-hash-fields），
+// 防止单个客户端写入一个巨大的值或者无限增长的集合占满整个进程的堆。
+// 写命令在修改之前检查，超过上限时返回错误且不做任何修改，已经超过上限的值（例如调小配置之前写入的）仍然可以读取和缩小
+
+// checkStringSizes 检查 args 中每个字符串是否超过 max-string-size，超过时返回错误信息，否则返回空字符串
+func checkStringSizes(args ...string) string {
+	limit := config.Get().MaxStringSize
+	if limit <= 0 {
+		return ""
+	}
+	for _, arg := range args {
+		if int64(len(arg)) > limit {
+			return fmt.Sprintf("ERR string of %d bytes exceeds max-string-size (%d bytes)", len(arg), limit)
+		}
+	}
+	return ""
+}
+
+// checkElements 检查类型为 t 的集合类型写入后的元素个数 n 是否超过对应的上限，超过时返回错误信息，否则返回空字符串
+func checkElements(t store.DataType, n int) string {
+	cfg := config.Get()
+	var limit int
+	var param string
+	switch t {
+	case store.ListType:
+		limit, param = cfg.MaxListElements, "max-list-elements"
+	case store.SetType:
+		limit, param = cfg.MaxSetElements, "max-set-elements"
+	case store.HashType:
+		limit, param = cfg.MaxHashFields, "max-hash-fields"
+	}
+	if limit > 0 && n > limit {
+		return fmt.Sprintf("ERR %s would grow to %d elements, exceeding %s (%d)", t, n, param, limit)
+	}
+	return ""
+}
+
+// elementLimitEnabled 返回类型 t 是否设置了元素个数上限，没有设置时不必统计新增的元素个数
+func elementLimitEnabled(t store.DataType) bool {
+	cfg := config.Get()
+	switch t {
+	case store.ListType:
+		return cfg.MaxListElements > 0
+	case store.SetType:
+		return cfg.MaxSetElements > 0
+	case store.HashType:
+		return cfg.MaxHashFields > 0
+	}
+	return false
+}
+
+// countNewMembers 返回 members 中不在 set 里的不同成员个数
+func countNewMembers(set *store.SetObject, members []string) int {
+	seen := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		if !set.Contains(m) {
+			seen[m] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// countNewFields 返回 field value 交替排列的 pairs 中不在 hash 里的不同字段个数
+func countNewFields(hash *store.HashObject, pairs []string) int {
+	seen := make(map[string]struct{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := hash.Get(pairs[i]); !ok {
+			seen[pairs[i]] = struct{}{}
+		}
+	}
+	return len(seen)
+}
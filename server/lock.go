@@ -0,0 +1,132 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 分布式锁命令，代替手写的 SET NX PX + 比较后删除脚本：
+//
+//	LOCK key owner milliseconds     获得锁时返回栅栏令牌，锁被其他持有者持有时返回 nil；持有者重复加锁时延长 TTL 并返回原来的令牌
+//	UNLOCK key owner                持有者释放锁返回 1，否则返回 0
+//	EXTEND key owner milliseconds   持有者把锁的 TTL 重新设为 milliseconds 返回 1，否则返回 0
+//
+// 锁以哈希保存在 key 中：owner 是持有者，expires 是到期时间（unix 毫秒），token 是栅栏令牌。
+// 到期后锁自动视为释放，但键本身不过期：token 在每次获得锁时加一并一直保留，
+// 被判定为失去锁的旧持有者带着较小的令牌写入下游时可以被拒绝
+
+const (
+	lockFieldOwner   = "owner"
+	lockFieldExpires = "expires"
+	lockFieldToken   = "token"
+)
+
+// lockState 返回 key 上的锁：当前持有者（没有持有者或者已经到期时为空）、令牌。
+// 键不是哈希时 wrongType 为 true，返回的哈希可以原地修改
+func (srv *Server) lockState(key string, now time.Time) (hash *store.HashObject, owner string, token int64, wrongType bool) {
+	entry, wrongType := srv.lookupTyped(key, store.HashType, true)
+	if entry == nil {
+		return nil, "", 0, wrongType
+	}
+	hash = entry.Value.(*store.HashObject)
+	if v, ok := hash.Get(lockFieldToken); ok {
+		token, _ = strconv.ParseInt(v, 10, 64)
+	}
+	owner, _ = hash.Get(lockFieldOwner)
+	if v, _ := hash.Get(lockFieldExpires); owner != "" {
+		if expires, err := strconv.ParseInt(v, 10, 64); err != nil || expires <= now.UnixMilli() {
+			owner = ""
+		}
+	}
+	return hash, owner, token, false
+}
+
+// parseLockTTL 解析锁的 TTL（毫秒），不是正数时回复错误并返回 0
+func parseLockTTL(w *resp.Writer, s string) int64 {
+	// 整数参数已由命令表检查
+	ttl, _ := strconv.ParseInt(s, 10, 64)
+	if ttl <= 0 || ttl > int64(24*365*time.Hour/time.Millisecond) {
+		w.WriteString("-ERR invalid lock TTL\r\n")
+		return 0
+	}
+	return ttl
+}
+
+// LOCK 命令：LOCK key owner milliseconds
+func (srv *Server) handleLock(w *resp.Writer, args []string) {
+	key, owner := args[1], args[2]
+	ttl := parseLockTTL(w, args[3])
+	if ttl == 0 {
+		return
+	}
+	if owner == "" {
+		w.WriteString("-ERR lock owner must not be empty\r\n")
+		return
+	}
+	now := time.Now()
+	hash, holder, token, wrongType := srv.lockState(key, now)
+	switch {
+	case wrongType:
+		w.WriteError(errWrongType)
+		return
+	case holder != "" && holder != owner:
+		w.WriteString("$-1\r\n")
+		return
+	case holder == "":
+		token++
+	}
+	created := hash == nil
+	if created {
+		hash = store.NewHashObject()
+	}
+	hash.Set(lockFieldOwner, owner)
+	hash.Set(lockFieldExpires, strconv.FormatInt(now.UnixMilli()+ttl, 10))
+	hash.Set(lockFieldToken, strconv.FormatInt(token, 10))
+	if created {
+		srv.store.Put(key, &store.Entry{Type: store.HashType, Value: hash})
+	} else {
+		srv.store.Updated(key)
+	}
+	w.WriteInteger(int(token))
+}
+
+// UNLOCK 命令：UNLOCK key owner
+func (srv *Server) handleUnlock(w *resp.Writer, args []string) {
+	key, owner := args[1], args[2]
+	hash, holder, _, wrongType := srv.lockState(key, time.Now())
+	switch {
+	case wrongType:
+		w.WriteError(errWrongType)
+	case holder == "" || holder != owner:
+		w.WriteInteger(0)
+	default:
+		hash.Del(lockFieldOwner)
+		hash.Del(lockFieldExpires)
+		srv.store.Updated(key)
+		w.WriteInteger(1)
+	}
+}
+
+// EXTEND 命令：EXTEND key owner milliseconds
+func (srv *Server) handleExtend(w *resp.Writer, args []string) {
+	key, owner := args[1], args[2]
+	ttl := parseLockTTL(w, args[3])
+	if ttl == 0 {
+		return
+	}
+	now := time.Now()
+	hash, holder, _, wrongType := srv.lockState(key, now)
+	switch {
+	case wrongType:
+		w.WriteError(errWrongType)
+	case holder == "" || holder != owner:
+		w.WriteInteger(0)
+	default:
+		hash.Set(lockFieldExpires, strconv.FormatInt(now.UnixMilli()+ttl, 10))
+		srv.store.Updated(key)
+		w.WriteInteger(1)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// memoryHelp 是 MEMORY HELP 的输出
+var memoryHelp = []string{
+	"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"USAGE <key> [SAMPLES <count>]",
+	"    Return memory in bytes used by <key> and its value.",
+	"BIGKEYS [COUNT <count>] [BY BYTES|ELEMENTS]",
+	"    Scan the keyspace and return the biggest keys of each type.",
+	"DOCTOR",
+	"    Return a human readable memory problems report.",
+	"PURGE",
+	"    Return unused heap memory to the operating system.",
+	"HELP",
+	"    Print this help.",
+}
+
+// MEMORY USAGE 命令：MEMORY USAGE key [SAMPLES count]，返回键估算占用的字节数。估算值是随写入增量维护的，
+// 不需要采样，SAMPLES 参数只做语法检查
+func (srv *Server) handleMemoryUsage(w *resp.Writer, args []string) {
+	entry, ok := srv.store.Load(args[2])
+	if !ok || entry.IsExpired() {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	w.WriteInteger(int(entry.Size()))
+}
+
+// MEMORY PURGE 命令：立即执行一次 GC 并把空闲的堆内存归还给操作系统
+func (srv *Server) handleMemoryPurge(w *resp.Writer, args []string) {
+	debug.FreeOSMemory()
+	w.WriteString("+OK\r\n")
+}
+
+// MEMORY HELP 命令
+func (srv *Server) handleMemoryHelp(w *resp.Writer, args []string) {
+	w.WriteArrayHeader(len(memoryHelp))
+	for _, line := range memoryHelp {
+		w.WriteString("+" + line + "\r\n")
+	}
+}
+
+// purgeMinIdle 是触发定期归还内存的最小空闲堆大小，空闲内存不多时没有必要强制 GC
+const purgeMinIdle = 16 * 1024 * 1024
+
+// startMemoryPurger 启动定期归还内存的 goroutine。Go 运行时本身会逐步把空闲内存还给操作系统，
+// 但在删除大量数据之后这个过程可能持续几分钟；设置 memory-purge-interval 后每隔该秒数检查一次，
+// 空闲且尚未归还的堆内存超过 purgeMinIdle 时调用 debug.FreeOSMemory 立即归还
+func startMemoryPurger() {
+	go func() {
+		var last time.Time
+		for range time.Tick(time.Second) {
+			interval := config.Get().MemoryPurgeInterval
+			if interval <= 0 || time.Since(last) < time.Duration(interval)*time.Second {
+				continue
+			}
+			last = time.Now()
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			if idle := ms.HeapIdle - ms.HeapReleased; idle >= purgeMinIdle {
+				debug.FreeOSMemory()
+				log.Printf("Returned %s of idle heap memory to the OS\n", bytesToHuman(int64(idle)))
+			}
+		}
+	}()
+}
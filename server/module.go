@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"plugin"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 自定义命令。嵌入 redis-easy 的程序或者扩展模块可以通过 RegisterCommand 增加新命令，而不必修改 command_table.go 中的内置命令表。
+// 扩展模块有两种加载方式：
+//   - 编译进二进制：在 cmd/redis-easy 下增加一个带构建标签的文件，匿名导入在 init 中调用 RegisterCommand 的包，
+//     例如 //go:build mymodule 加上 import _ "example.com/mymodule"，用 go build -tags mymodule 构建
+//   - 运行时加载：把同样的包用 go build -buildmode=plugin 编译为 .so，通过 loadmodule 配置项在启动时载入（仅 Linux / macOS）
+
+// CommandFlags 描述自定义命令的属性，决定命令在哪些分片上执行
+type CommandFlags int
+
+const (
+	// CmdWrite 表示命令会修改键空间，CmdReadOnly 表示命令只读取键空间，目前只用于说明
+	CmdWrite CommandFlags = 1 << iota
+	CmdReadOnly
+	// CmdFirstKey 表示命令的第一个参数是键，CmdAllKeys 表示所有参数都是键。
+	// 两者都没有设置的命令不访问键空间，直接在连接所在的 goroutine 上执行
+	CmdFirstKey
+	CmdAllKeys
+	// CmdDenyOOM 表示命令可能增加内存占用，键所在的命名空间超过配额时拒绝执行，见 namespace.go
+	CmdDenyOOM
+	// CmdLoading 表示命令不访问数据集，启动时载入快照期间也可以执行，见 state.go
+	CmdLoading
+	// CmdNoGateway 表示命令只对 RESP 连接有意义或者影响整个实例，HTTP 网关拒绝执行，见 gateway.go
+	CmdNoGateway
+)
+
+// CommandHandler 处理一条自定义命令，args[0] 为命令名。处理函数执行时已经持有命令涉及的键所在分片的锁，
+// 可以直接使用 srv.Store() 的 Load/Put/Delete，但不能调用 Get/Set 等自己加锁的方法
+type CommandHandler func(srv *Server, w *resp.Writer, args []string)
+
+// RegisterCommand 注册一条自定义命令，只能在开始处理命令之前调用（通常在 init 中）。
+// arity 的含义与 Redis 相同：正数表示参数个数（包括命令名）必须等于它，负数表示至少为 -arity
+func RegisterCommand(name string, arity int, flags CommandFlags, handler CommandHandler) error {
+	upper := strings.ToUpper(name)
+	if upper == "" || strings.ContainsAny(upper, " |\r\n") {
+		return fmt.Errorf("invalid command name '%s'", name)
+	}
+	if arity == 0 {
+		return fmt.Errorf("invalid arity 0 for command '%s'", name)
+	}
+	if existing, ok := commandTable[upper]; ok {
+		if !existing.custom {
+			return fmt.Errorf("command '%s' is a built-in command", name)
+		}
+		return fmt.Errorf("command '%s' is already registered", name)
+	}
+	spec := &commandSpec{name: strings.ToLower(name), arity: arity, flags: flags, handler: handler, custom: true}
+	switch {
+	case flags&CmdAllKeys != 0:
+		spec.keys = allKeys
+	case flags&CmdFirstKey != 0:
+		spec.keys = firstKey
+	}
+	commandTable[upper] = spec
+	return nil
+}
+
+// LoadModules 依次载入 paths 中用 -buildmode=plugin 编译的扩展模块，模块在自己的 init 中调用 RegisterCommand
+func LoadModules(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading module %s: %v", path, err)
+		}
+		log.Println("Module loaded:", path)
+	}
+	return nil
+}
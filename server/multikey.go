@@ -0,0 +1,193 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 本文件是同时读写多个键的命令。executeCommand 通过 store.RunKeys 按分片号顺序锁住命令表中声明的所有键所在的分片，
+// 处理函数执行期间其他命令看不到中间状态，多个多键命令之间也不会死锁
+
+const errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// lookupTyped 返回键对应的未过期条目，已过期的条目会被顺便删除，键不存在时返回 nil；
+// 键存在但类型不是 t 时 wrongType 为 true。forWrite 为 true 时按 LoadForWrite 取出，随后可以原地修改
+func (srv *Server) lookupTyped(key string, t store.DataType, forWrite bool) (entry *store.Entry, wrongType bool) {
+	var ok bool
+	if forWrite {
+		entry, ok = srv.store.LoadForWrite(key)
+	} else {
+		entry, ok = srv.store.Load(key)
+	}
+	if !ok {
+		return nil, false
+	}
+	if entry.IsExpired() {
+		srv.store.Delete(key)
+		return nil, false
+	}
+	if entry.Type != t {
+		return nil, true
+	}
+	return entry, false
+}
+
+// RENAME 命令：RENAME key newkey，把 key 改名为 newkey，覆盖 newkey 原有的值，过期时间随值一起转移
+func (srv *Server) handleRename(w *resp.Writer, args []string) {
+	src, dst := args[1], args[2]
+	entry, ok := srv.store.Load(src)
+	if ok && entry.IsExpired() {
+		srv.store.Delete(src)
+		ok = false
+	}
+	if !ok {
+		w.WriteError("ERR no such key")
+		return
+	}
+	if src != dst {
+		entry, _ = srv.store.Take(src)
+		srv.store.Put(dst, entry)
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// MSETNX 命令：MSETNX key value [key value ...]，所有键都不存在时才设置全部键值并返回 1，否则不做任何修改并返回 0
+func (srv *Server) handleMSetNX(w *resp.Writer, args []string) {
+	if len(args)%2 != 1 {
+		w.WriteString("-ERR wrong number of arguments for 'msetnx' command\r\n")
+		return
+	}
+	for i := 2; i < len(args); i += 2 {
+		if errMsg := checkStringSizes(args[i]); errMsg != "" {
+			w.WriteError(errMsg)
+			return
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		if entry, ok := srv.store.Load(args[i]); ok {
+			if !entry.IsExpired() {
+				w.WriteInteger(0)
+				return
+			}
+			srv.store.Delete(args[i])
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		srv.store.Put(args[i], &store.Entry{Type: store.StringType, Value: args[i+1]})
+	}
+	w.WriteInteger(1)
+}
+
+// parseListSide 解析 LMOVE 的 LEFT / RIGHT 参数，返回是否为 LEFT
+func parseListSide(arg string) (left bool, ok bool) {
+	switch {
+	case strings.EqualFold(arg, "LEFT"):
+		return true, true
+	case strings.EqualFold(arg, "RIGHT"):
+		return false, true
+	}
+	return false, false
+}
+
+// LMOVE 命令：LMOVE source destination LEFT|RIGHT LEFT|RIGHT，从 source 的一端弹出元素并插入到 destination 的一端，
+// 返回移动的元素；source 不存在时返回 nil。source 与 destination 可以是同一个列表（用于轮转）
+func (srv *Server) handleLMove(w *resp.Writer, args []string) {
+	src, dst := args[1], args[2]
+	fromLeft, ok1 := parseListSide(args[3])
+	toLeft, ok2 := parseListSide(args[4])
+	if !ok1 || !ok2 {
+		w.WriteError(errSyntax)
+		return
+	}
+	srcEntry, wrongType := srv.lookupTyped(src, store.ListType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if srcEntry == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	// 先取出目标列表再弹出元素：source 与 destination 相同且只有一个元素时，弹出后列表为空但不能被删除
+	dstEntry, wrongType := srv.lookupTyped(dst, store.ListType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if dstEntry != nil && src != dst {
+		if errMsg := checkElements(store.ListType, dstEntry.Value.(*store.ListObject).Len()+1); errMsg != "" {
+			w.WriteError(errMsg)
+			return
+		}
+	}
+	srcList := srcEntry.Value.(*store.ListObject)
+	var elem string
+	if fromLeft {
+		elem, _ = srcList.PopFront()
+	} else {
+		elem, _ = srcList.PopBack()
+	}
+	exists := dstEntry != nil
+	if !exists {
+		dstEntry = &store.Entry{Type: store.ListType, Value: store.NewListObject()}
+	}
+	dstList := dstEntry.Value.(*store.ListObject)
+	if toLeft {
+		dstList.PushFront([]string{elem})
+	} else {
+		dstList.PushBack([]string{elem})
+	}
+	if src != dst {
+		if srcList.Len() == 0 {
+			srv.store.Delete(src)
+		} else {
+			srv.store.Updated(src)
+		}
+	}
+	srv.store.PutOrUpdate(dst, dstEntry, exists)
+	w.WriteBulk(elem)
+}
+
+// SINTERSTORE 命令：SINTERSTORE destination key [key ...]，把所有集合的交集保存到 destination 并返回交集的成员数。
+// 与 Redis 相同，不存在的键按空集合处理，交集为空时删除 destination
+func (srv *Server) handleSInterStore(w *resp.Writer, args []string) {
+	dst := args[1]
+	sets := make([]*store.SetObject, 0, len(args)-2)
+	empty := false
+	for _, key := range args[2:] {
+		entry, wrongType := srv.lookupTyped(key, store.SetType, false)
+		if wrongType {
+			w.WriteError(errWrongType)
+			return
+		}
+		// 结果已经确定为空时也要继续检查后面的键的类型，与 Redis 相同返回 WRONGTYPE
+		if entry == nil {
+			empty = true
+		} else if !empty {
+			sets = append(sets, entry.Value.(*store.SetObject))
+		}
+	}
+
+	result := store.NewSetObject()
+	if !empty {
+		// 遍历最小的集合，逐个检查成员是否在其余集合中
+		sort.Slice(sets, func(i, j int) bool { return sets[i].Len() < sets[j].Len() })
+		sets[0].ForEach(func(member string) {
+			for _, set := range sets[1:] {
+				if !set.Contains(member) {
+					return
+				}
+			}
+			result.Add(member)
+		})
+	}
+	if result.Len() == 0 {
+		srv.store.Delete(dst)
+	} else {
+		srv.store.Put(dst, &store.Entry{Type: store.SetType, Value: result})
+	}
+	w.WriteInteger(result.Len())
+}
@@ -0,0 +1,33 @@
+package server_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// TestSInterStoreWrongType 检查 SINTERSTORE 在前面的键不存在、交集已经确定为空时，仍然对后面的键检查类型，
+// 返回 WRONGTYPE 并且不修改 destination
+func TestSInterStoreWrongType(t *testing.T) {
+	c := dial(t, startServer(t, "goroutine").Addr())
+	c.do("SADD", "s1", "a", "b")
+	c.do("SADD", "dst", "x")
+	c.do("SET", "str", "v")
+	tests := [][]string{
+		{"SINTERSTORE", "dst", "missing", "str"},
+		{"SINTERSTORE", "dst", "s1", "missing", "str"},
+		{"SINTERSTORE", "dst", "str", "missing"},
+	}
+	for _, args := range tests {
+		if err, ok := c.do(args...).(resp.Error); !ok || !strings.Contains(string(err), "WRONGTYPE") {
+			t.Errorf("%q = %v, want WRONGTYPE", args, err)
+		}
+	}
+	if got, ok := c.do("SMEMBERS", "dst").([]interface{}); !ok || len(got) != 1 || got[0] != "x" {
+		t.Fatalf("SMEMBERS dst = %v after failed SINTERSTOREs, want [x]", got)
+	}
+	if got := c.do("SINTERSTORE", "dst", "s1", "missing"); got != int64(0) {
+		t.Fatalf("SINTERSTORE with a missing key = %v, want 0", got)
+	}
+}
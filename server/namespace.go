@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 命名空间：多个团队共用一个实例时，按键名前缀划分命名空间（namespaces 配置，格式见 config.ParseNamespaces），
+// 每个命名空间可以有键数和内存配额，INFO namespaces 输出各命名空间的用量。
+//
+// 配额在执行带 CmdDenyOOM 标志的命令（可能增加内存占用的写命令）之前检查：命名空间的内存已经达到配额时拒绝执行，
+// 命令会新建的键使命名空间的键数超过配额时也拒绝执行，与 Redis 超过 maxmemory 时相同，返回 -OOM 错误。
+// 删除键、读取键以及不会新建键的修改不受影响，因此超过配额的命名空间总是可以通过删除数据恢复
+
+// applyNamespaces 按当前的 namespaces 配置重建命名空间并重新统计用量
+func (srv *Server) applyNamespaces() {
+	defs, _ := config.ParseNamespaces(config.Get().Namespaces)
+	list := make([]*store.Namespace, len(defs))
+	for i, d := range defs {
+		list[i] = &store.Namespace{Name: d.Name, Prefix: d.Prefix, MaxKeys: d.MaxKeys, MaxMemory: d.MaxMemory}
+	}
+	srv.store.SetNamespaces(list)
+}
+
+// checkNamespaceQuota 检查命令涉及的键所在的命名空间是否超过配额，超过时返回错误信息，否则返回空字符串。
+// 调用方需持有这些键所在分片的锁
+func (srv *Server) checkNamespaceQuota(keys []string) string {
+	var newKeys map[*store.Namespace]int64
+	for _, key := range keys {
+		ns := srv.store.NamespaceOf(key)
+		if ns == nil {
+			continue
+		}
+		if ns.MaxMemory > 0 && ns.Memory() >= ns.MaxMemory {
+			return fmt.Sprintf("OOM command not allowed when namespace '%s' used memory >= its quota (%d bytes)", ns.Name, ns.MaxMemory)
+		}
+		if ns.MaxKeys <= 0 {
+			continue
+		}
+		if entry, ok := srv.store.Load(key); ok && !entry.IsExpired() {
+			continue
+		}
+		if newKeys == nil {
+			newKeys = make(map[*store.Namespace]int64)
+		}
+		newKeys[ns]++
+		if ns.Keys()+newKeys[ns] > ns.MaxKeys {
+			return fmt.Sprintf("OOM command not allowed when namespace '%s' has reached its key quota (%d keys)", ns.Name, ns.MaxKeys)
+		}
+	}
+	return ""
+}
+
+func (srv *Server) writeInfoNamespaces(b *strings.Builder) {
+	for _, ns := range srv.store.Namespaces() {
+		writeInfoField(b, "ns_"+ns.Name, "prefix="+ns.Prefix+
+			",keys="+strconv.FormatInt(ns.Keys(), 10)+
+			",memory="+strconv.FormatInt(ns.Memory(), 10)+
+			",maxkeys="+strconv.FormatInt(ns.MaxKeys, 10)+
+			",maxmemory="+strconv.FormatInt(ns.MaxMemory, 10))
+	}
+}
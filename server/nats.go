@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 键空间事件发布到 NATS，供消息系统上的消费者订阅缓存的变化。配置 nats-url 后，nats-events 中列出的事件里
+// 键名匹配 nats-key-pattern 的被发布到 <nats-subject>.<事件名>（例如 redis-easy.keyspace.expired），
+// 每条消息的内容与 webhook 中的一个事件相同：
+//
+//	{"event": "expired", "key": "session:42", "time": 1700000000123}
+//
+// 事件与 webhook 一样在内存队列中排队并成批发送，一批消息发送之后用 PING 等待服务器的 PONG 确认已经收到；
+// 连接断开或者服务器返回错误时重新连接，按指数退避重试 nats-max-retries 次，仍然失败的一批事件被丢弃。
+// nats-url 中的用户名、密码用于认证，只有用户名时作为 token；服务器要求 TLS 或者使用 tls:// 时以 TLS 连接。
+// 发布、失败、丢弃的事件数见 INFO stats
+
+// natsDefaultPort 是 nats-url 中没有端口时使用的端口
+const natsDefaultPort = "4222"
+
+func (srv *Server) natsKeyEvent(cfg *config.Config, event store.KeyEvent, key string) {
+	if cfg.NATSURL == "" || !config.HasListItem(cfg.NATSEvents, event.String()) {
+		return
+	}
+	if ok, _ := path.Match(cfg.NATSKeyPattern, key); !ok {
+		return
+	}
+	select {
+	case srv.nats.queue <- webhookEvent{Event: event.String(), Key: key, Time: time.Now().UnixMilli()}:
+	default:
+		srv.nats.dropped.Add(1)
+	}
+}
+
+// startNATS 启动发布 goroutine，与 webhook 相同，每次取出队列中已有的事件（最多 webhookBatchSize 个）作为一批发布，实例 Stop 时退出
+func (srv *Server) startNATS() {
+	go func() {
+		var conn *natsConn
+		defer func() {
+			if conn != nil {
+				conn.close()
+			}
+		}()
+		batch := make([]webhookEvent, 0, webhookBatchSize)
+		for {
+			select {
+			case ev := <-srv.nats.queue:
+				batch = append(batch[:0], ev)
+			case <-srv.stopping:
+				return
+			}
+		drain:
+			for len(batch) < webhookBatchSize {
+				select {
+				case ev := <-srv.nats.queue:
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			var err error
+			if conn, err = srv.publishNATS(conn, batch); err != nil {
+				srv.nats.failed.Add(int64(len(batch)))
+				srv.logger.Printf("NATS: dropping %d events: %v\n", len(batch), err)
+			} else {
+				srv.nats.sent.Add(int64(len(batch)))
+			}
+		}
+	}()
+}
+
+// publishNATS 通过 conn 发布一批事件，conn 为 nil、出错或者 nats-url 已经修改时重新连接，
+// 可以重试的错误按指数退避重试。返回之后继续使用的连接
+func (srv *Server) publishNATS(conn *natsConn, batch []webhookEvent) (*natsConn, error) {
+	backoff := webhookMinBackoff
+	for attempt := 0; ; attempt++ {
+		cfg := config.Get()
+		if cfg.NATSURL == "" {
+			return conn, fmt.Errorf("nats-url was cleared")
+		}
+		if conn != nil && conn.url != cfg.NATSURL {
+			conn.close()
+			conn = nil
+		}
+		var err error
+		if conn == nil {
+			conn, err = dialNATS(cfg.NATSURL)
+		}
+		if err == nil {
+			if err = conn.publish(cfg.NATSSubject, batch); err == nil {
+				return conn, nil
+			}
+			conn.close()
+			conn = nil
+		}
+		if attempt >= cfg.NATSMaxRetries {
+			return nil, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-srv.stopping:
+			return nil, err
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
+
+// natsConn 是到 NATS 服务器的一个连接，只使用协议中发布消息的部分
+type natsConn struct {
+	url  string
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// natsServerInfo 是服务器连接后首先发送的 INFO 中用到的字段
+type natsServerInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// dialNATS 连接 rawURL 指定的 NATS 服务器，完成 CONNECT 并等到服务器确认
+func dialNATS(rawURL string) (*natsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), natsDefaultPort)
+	}
+	raw, err := net.DialTimeout("tcp", addr, webhookTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &natsConn{url: rawURL, conn: raw, r: bufio.NewReader(raw)}
+	c.conn.SetDeadline(time.Now().Add(webhookTimeout))
+	line, err := c.readLine()
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	var info natsServerInfo
+	infoJSON, ok := strings.CutPrefix(line, "INFO ")
+	if !ok || json.Unmarshal([]byte(infoJSON), &info) != nil {
+		c.close()
+		return nil, fmt.Errorf("unexpected greeting from %s: %.64q", addr, line)
+	}
+	useTLS := u.Scheme == "tls" || info.TLSRequired
+	if useTLS {
+		tlsConn := tls.Client(raw, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			c.close()
+			return nil, err
+		}
+		c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	opts := map[string]interface{}{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": useTLS,
+		"name":         "redis-easy",
+		"lang":         "go",
+		"version":      Version,
+		"protocol":     0,
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), password
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(c.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		c.close()
+		return nil, err
+	}
+	// 认证失败时服务器回复 -ERR 并关闭连接
+	if err := c.waitPong(); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// publish 把每个事件作为一条消息发布到 subject.<事件名>，然后等待服务器确认
+func (c *natsConn) publish(subject string, batch []webhookEvent) error {
+	var b bytes.Buffer
+	for _, ev := range batch {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "PUB %s.%s %d\r\n", subject, ev.Event, len(payload))
+		b.Write(payload)
+		b.WriteString("\r\n")
+	}
+	b.WriteString("PING\r\n")
+	c.conn.SetDeadline(time.Now().Add(webhookTimeout))
+	if _, err := c.conn.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return c.waitPong()
+}
+
+// waitPong 读取服务器的回复直到 PONG，途中回应服务器的 PING，遇到 -ERR 时返回错误
+func (c *natsConn) waitPong() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server replied %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK 和服务器推送的 INFO 不需要处理
+	}
+}
+
+// readLine 读取一行协议，去掉末尾的 \r\n
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *natsConn) close() {
+	c.conn.Close()
+}
@@ -0,0 +1,56 @@
+package server_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// TestPipelineReplyOrder 在一条连接上流水线发送耗时的命令（读取整个大列表）和快速的命令（PING、SET、GET、RPUSH），
+// 键分布在不同的分片上，检查回复按命令的发送顺序返回
+func TestPipelineReplyOrder(t *testing.T) {
+	const listLen, rounds = 50000, 50
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c := dial(t, startServer(t, backend).Addr())
+			push := []string{"RPUSH", "big"}
+			for i := 0; i < listLen; i++ {
+				push = append(push, strconv.Itoa(i))
+			}
+			if got := c.do(push...); got != int64(listLen) {
+				t.Fatalf("RPUSH = %v, want %d", got, listLen)
+			}
+
+			var cmds [][]string
+			for i := 0; i < rounds; i++ {
+				key, val := "k:"+strconv.Itoa(i), strconv.Itoa(i)
+				cmds = append(cmds,
+					[]string{"LRANGE", "big", "0", "-1"},
+					[]string{"PING"},
+					[]string{"SET", key, val},
+					[]string{"GET", key},
+					[]string{"RPUSH", "counter", val},
+				)
+			}
+			c.send(cmds...)
+			for i := 0; i < rounds; i++ {
+				if items, ok := c.read().([]interface{}); !ok || len(items) != listLen || items[listLen-1] != strconv.Itoa(listLen-1) {
+					t.Fatalf("round %d: LRANGE reply is not the whole list", i)
+				}
+				if got := c.read(); got != resp.Status("PONG") {
+					t.Fatalf("round %d: PING = %v", i, got)
+				}
+				if got := c.read(); got != resp.Status("OK") {
+					t.Fatalf("round %d: SET = %v", i, got)
+				}
+				if got := c.read(); got != strconv.Itoa(i) {
+					t.Fatalf("round %d: GET = %v, want %d", i, got, i)
+				}
+				if got := c.read(); got != int64(i+1) {
+					t.Fatalf("round %d: RPUSH = %v, want %d", i, got, i+1)
+				}
+			}
+		})
+	}
+}
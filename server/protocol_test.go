@@ -0,0 +1,38 @@
+package server_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// TestLargeBulkInChunks 把一条带有大批量数据的命令拆成许多小块发送，后面紧跟一条短命令，
+// 检查两种后端都在数据到齐后才执行它，并且不丢失、不重复执行后面的命令
+func TestLargeBulkInChunks(t *testing.T) {
+	const size, chunk = 8 << 20, 16 << 10
+	value := strings.Repeat("v", size)
+	request := append(resp.EncodeCommand([]string{"SET", "big", value}), resp.EncodeCommand([]string{"PING"})...)
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c := dial(t, startServer(t, backend).Addr())
+			start := time.Now()
+			for i := 0; i < len(request); i += chunk {
+				if _, err := c.conn.Write(request[i:min(i+chunk, len(request))]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := c.read(); got != resp.Status("OK") {
+				t.Fatalf("SET = %v", got)
+			}
+			if got := c.read(); got != resp.Status("PONG") {
+				t.Fatalf("PING = %v", got)
+			}
+			t.Logf("%d bytes in %d byte chunks took %v", size, chunk, time.Since(start))
+			if got := c.do("GET", "big"); got != value {
+				t.Fatalf("GET returned %d bytes, want %d", len(got.(string)), size)
+			}
+		})
+	}
+}
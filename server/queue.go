@@ -0,0 +1,252 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 延迟队列命令，元素在加入时指定的延迟之后才能被弹出，不需要客户端自己轮询有序集合：
+//
+//	QPUSH key payload delay   加入一个 delay 毫秒后可见的元素（0 表示立即可见），返回队列长度
+//	QPOP key                  弹出最早可见的元素，没有可见的元素时返回 nil
+//	QLEN key                  返回队列长度，包括还不可见的元素
+//
+// 需要至少一次处理时用认领代替 QPOP：
+//
+//	QCLAIM key timeout [COUNT n] [MAXDELIVERIES n] [DEADLETTER dlkey]
+//	QACK key id [id ...]
+//
+// QCLAIM 认领最多 n 个（默认 1 个）已经可见的元素，返回 [编号, 内容, 投递次数] 的数组。被认领的元素在 timeout 毫秒内不可见，
+// 处理完成后用 QACK 确认删除；消费者超时未确认时元素重新可见，被下一次 QCLAIM 认领。
+// 给出 MAXDELIVERIES 时，已经投递了 n 次仍未确认的元素不再投递，内容追加到 DEADLETTER 指定的列表末尾，
+// 没有指定 DEADLETTER 时直接丢弃
+
+// queueMaxDelay 是 QPUSH 的延迟上限（毫秒）
+const queueMaxDelay = int64(10 * 365 * 24 * time.Hour / time.Millisecond)
+
+// QPUSH 命令：QPUSH key payload delay
+func (srv *Server) handleQPush(w *resp.Writer, args []string) {
+	key, payload := args[1], args[2]
+	// 整数参数已由命令表检查
+	delay, _ := strconv.ParseInt(args[3], 10, 64)
+	if delay < 0 || delay > queueMaxDelay {
+		w.WriteString("-ERR invalid delay\r\n")
+		return
+	}
+	if errMsg := checkStringSizes(payload); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	entry, wrongType := srv.lookupTyped(key, store.QueueType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	visibleAt := time.Now().UnixMilli() + delay
+	if entry == nil {
+		q := store.NewQueueObject()
+		q.Push(payload, visibleAt)
+		srv.store.Put(key, &store.Entry{Type: store.QueueType, Value: q})
+		w.WriteInteger(1)
+		return
+	}
+	q := entry.Value.(*store.QueueObject)
+	q.Push(payload, visibleAt)
+	srv.store.Updated(key)
+	w.WriteInteger(q.Len())
+}
+
+// QPOP 命令：QPOP key
+func (srv *Server) handleQPop(w *resp.Writer, args []string) {
+	key := args[1]
+	entry, wrongType := srv.lookupTyped(key, store.QueueType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	q := entry.Value.(*store.QueueObject)
+	item := q.Pop(time.Now().UnixMilli())
+	if item == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	if q.Len() == 0 {
+		srv.store.Delete(key)
+	} else {
+		srv.store.Updated(key)
+	}
+	w.WriteBulk(item.Payload)
+}
+
+// QLEN 命令：QLEN key
+func (srv *Server) handleQLen(w *resp.Writer, args []string) {
+	entry, wrongType := srv.lookupTyped(args[1], store.QueueType, false)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteInteger(0)
+		return
+	}
+	w.WriteInteger(entry.Value.(*store.QueueObject).Len())
+}
+
+// qclaimKeys 返回 QCLAIM 的键：队列以及 DEADLETTER 指定的死信列表
+func qclaimKeys(request []string) []string {
+	if len(request) < 2 {
+		return nil
+	}
+	keys := []string{request[1]}
+	for i := 3; i+1 < len(request); i += 2 {
+		if strings.EqualFold(request[i], "DEADLETTER") {
+			keys = append(keys, request[i+1])
+		}
+	}
+	return keys
+}
+
+// QCLAIM 命令：QCLAIM key timeout [COUNT n] [MAXDELIVERIES n] [DEADLETTER dlkey]
+func (srv *Server) handleQClaim(w *resp.Writer, args []string) {
+	key := args[1]
+	// 选项的语法和整数参数已由命令表检查
+	timeout, _ := strconv.ParseInt(args[2], 10, 64)
+	count, maxDeliveries := int64(1), int64(0)
+	var deadLetter string
+	for i := 3; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			count, _ = strconv.ParseInt(args[i+1], 10, 64)
+		case "MAXDELIVERIES":
+			maxDeliveries, _ = strconv.ParseInt(args[i+1], 10, 64)
+		case "DEADLETTER":
+			deadLetter = args[i+1]
+		}
+	}
+	switch {
+	case timeout <= 0 || timeout > queueMaxDelay:
+		w.WriteString("-ERR invalid timeout\r\n")
+		return
+	case count <= 0:
+		w.WriteString("-ERR COUNT must be positive\r\n")
+		return
+	case maxDeliveries < 0:
+		w.WriteString("-ERR MAXDELIVERIES must be non-negative\r\n")
+		return
+	case deadLetter != "" && maxDeliveries == 0:
+		w.WriteString("-ERR DEADLETTER requires MAXDELIVERIES\r\n")
+		return
+	case deadLetter == key:
+		w.WriteString("-ERR DEADLETTER must be a different key\r\n")
+		return
+	}
+
+	entry, wrongType := srv.lookupTyped(key, store.QueueType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	// 先检查死信列表的类型，出错时队列保持原样
+	var dlEntry *store.Entry
+	if deadLetter != "" {
+		if dlEntry, wrongType = srv.lookupTyped(deadLetter, store.ListType, true); wrongType {
+			w.WriteError(errWrongType)
+			return
+		}
+	}
+	if entry == nil {
+		w.WriteArrayHeader(0)
+		return
+	}
+
+	q := entry.Value.(*store.QueueObject)
+	now := time.Now().UnixMilli()
+	var claimed, dead []*store.QueueItem
+	for int64(len(claimed)) < count {
+		item := q.Peek()
+		if item == nil || item.VisibleAt > now {
+			break
+		}
+		if maxDeliveries > 0 && item.Deliveries >= maxDeliveries {
+			dead = append(dead, q.Remove(item.ID))
+			continue
+		}
+		claimed = append(claimed, q.Claim(now, timeout))
+	}
+
+	if len(dead) > 0 && deadLetter != "" {
+		payloads := make([]string, len(dead))
+		for i, item := range dead {
+			payloads[i] = item.Payload
+		}
+		// 死信不受 max-list-elements 限制，避免丢失处理失败的元素
+		if dlEntry == nil {
+			list := store.NewListObject()
+			list.PushBack(payloads)
+			srv.store.Put(deadLetter, &store.Entry{Type: store.ListType, Value: list})
+		} else {
+			dlEntry.Value.(*store.ListObject).PushBack(payloads)
+			srv.store.Updated(deadLetter)
+		}
+	}
+	switch {
+	case q.Len() == 0:
+		srv.store.Delete(key)
+	case len(claimed) > 0 || len(dead) > 0:
+		srv.store.Updated(key)
+	}
+
+	w.WriteArrayHeader(len(claimed))
+	for _, item := range claimed {
+		w.WriteArrayHeader(3)
+		w.WriteInteger(int(item.ID))
+		w.WriteBulk(item.Payload)
+		w.WriteInteger(int(item.Deliveries))
+	}
+}
+
+// QACK 命令：QACK key id [id ...]，删除认领的元素，返回删除的个数。
+// 元素已经超时重新可见（甚至已被再次认领）时也会删除，晚到的确认说明元素已经处理完成
+func (srv *Server) handleQAck(w *resp.Writer, args []string) {
+	key := args[1]
+	ids := make([]int64, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			w.WriteError(errNotInteger)
+			return
+		}
+		ids[i] = id
+	}
+	entry, wrongType := srv.lookupTyped(key, store.QueueType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	if entry == nil {
+		w.WriteInteger(0)
+		return
+	}
+	q := entry.Value.(*store.QueueObject)
+	acked := 0
+	for _, id := range ids {
+		if q.Remove(id) != nil {
+			acked++
+		}
+	}
+	switch {
+	case q.Len() == 0:
+		srv.store.Delete(key)
+	case acked > 0:
+		srv.store.Updated(key)
+	}
+	w.WriteInteger(acked)
+}
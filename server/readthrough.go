@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// read-through 缓存：GET 未命中键名匹配 read-through-key-pattern 的键时，由服务端调用 read-through-loader
+// 从外部数据源读取值，保存为字符串键（过期时间为 read-through-ttl 秒）后作为 GET 的结果返回，客户端不必自己回源。
+//
+// read-through-loader 为 http:// 或 https:// 地址时，以 GET <地址>?key=<键名> 读取：200 响应的响应体是值，
+// 404 表示数据源中也没有这个键（GET 返回 nil），其他响应作为错误返回给客户端；
+// 其他取值是扩展模块通过 RegisterLoader 注册的 loader 名称。
+//
+// loader 在执行命令的 goroutine 上同步调用，最长阻塞 read-through 超时时间，因此不能与 io-backend eventloop 同时使用
+// （事件循环阻塞期间它上面的所有连接都会停顿），配置校验会拒绝这种组合。
+// loader 在不持有分片锁的情况下调用，回源期间同一分片上的其他命令照常执行；
+// 回源结束后如果键已经被其他客户端写入，以已有的值为准。多个客户端同时 GET 同一个未命中的键时只回源一次，
+// 其余客户端等待这一次的结果（singleflight），避免热点键过期瞬间大量请求同时打到数据源。
+//
+// 没有配置 loader、由客户端自己回源时，可以用 GET key WITHLOCK milliseconds 防止缓存击穿：
+// 键存在时与 GET 相同；键不存在时第一个客户端得到 nil 并取得该键 milliseconds 毫秒的重建锁，
+// 应当回源后 SET 这个键，锁到期前其他客户端得到 -LOCKED 错误，稍后重试即可
+
+// Loader 从外部数据源读取键的值，数据源中没有这个键时 found 为 false
+type Loader interface {
+	Load(key string) (value string, found bool, err error)
+}
+
+// loaders 保存扩展模块注册的 loader，只在开始处理命令之前修改
+var loaders = make(map[string]Loader)
+
+// RegisterLoader 注册一个 read-through loader，配置 read-through-loader 为 name 时使用。
+// 与 RegisterCommand 相同，只能在开始处理命令之前调用（通常在扩展模块的 init 中）
+func RegisterLoader(name string, loader Loader) error {
+	if name == "" || isHTTPURL(name) {
+		return fmt.Errorf("invalid loader name '%s'", name)
+	}
+	if _, ok := loaders[name]; ok {
+		return fmt.Errorf("loader '%s' is already registered", name)
+	}
+	loaders[name] = loader
+	return nil
+}
+
+// httpLoader 通过 HTTP GET 读取值
+type httpLoader struct {
+	url    string
+	client *http.Client
+}
+
+// readThroughTimeout 是 HTTP loader 一次请求的超时时间
+const readThroughTimeout = 5 * time.Second
+
+// Load 读取的值不能超过 proto-max-bulk-len，超过的值本来也无法通过 SET 写入
+func (l *httpLoader) Load(key string) (string, bool, error) {
+	u := l.url
+	if strings.Contains(u, "?") {
+		u += "&key=" + url.QueryEscape(key)
+	} else {
+		u += "?key=" + url.QueryEscape(key)
+	}
+	res, err := l.client.Get(u)
+	if err != nil {
+		return "", false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", false, nil
+	default:
+		return "", false, fmt.Errorf("server replied %s", res.Status)
+	}
+	limit := config.Get().ProtoMaxBulkLen
+	body, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return "", false, err
+	}
+	if int64(len(body)) > limit {
+		return "", false, fmt.Errorf("value is larger than proto-max-bulk-len")
+	}
+	return string(body), true, nil
+}
+
+// readThroughLoader 返回 GET request 应该使用的 loader：不是参数正确的 GET 命令、没有配置 loader
+// 或者键名不匹配时返回 nil。HTTP loader 在地址变化时才重新建立，回源之间复用同一个 http.Client 的连接
+func (srv *Server) readThroughLoader(request []string) (Loader, error) {
+	cfg := config.Get()
+	if cfg.ReadThroughLoader == "" || len(request) != 2 || !strings.EqualFold(request[0], "GET") {
+		return nil, nil
+	}
+	if ok, _ := path.Match(cfg.ReadThroughKeyPattern, request[1]); !ok {
+		return nil, nil
+	}
+	if isHTTPURL(cfg.ReadThroughLoader) {
+		l := srv.httpLoader.Load()
+		if l == nil || l.url != cfg.ReadThroughLoader {
+			l = &httpLoader{url: cfg.ReadThroughLoader, client: &http.Client{Timeout: readThroughTimeout}}
+			srv.httpLoader.Store(l)
+		}
+		return l, nil
+	}
+	loader, ok := loaders[cfg.ReadThroughLoader]
+	if !ok {
+		return nil, fmt.Errorf("unknown read-through loader '%s'", cfg.ReadThroughLoader)
+	}
+	return loader, nil
+}
+
+// executeReadThrough 执行 GET key：键存在时与普通的 GET 相同；不存在时在分片锁之外调用 loader，
+// 再回到分片上保存读到的值并执行 GET
+func (srv *Server) executeReadThrough(w *resp.Writer, request []string, loader Loader, c *client) {
+	key := request[1]
+	keys := request[1:]
+	hit := false
+	srv.store.RunKeys(keys, func() {
+		if entry, ok := srv.store.Load(key); ok && !entry.IsExpired() {
+			hit = true
+			srv.dispatchCommand(w, request, c)
+		}
+	})
+	if hit {
+		return
+	}
+
+	value, found, err := srv.loadOnce(key, loader)
+	if err != nil {
+		w.WriteError("ERR read-through loader failed: " + err.Error())
+		return
+	}
+	if errMsg := checkStringSizes(value); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	srv.store.RunKeys(keys, func() {
+		if found {
+			entry, ok := srv.store.Load(key)
+			if !ok || entry.IsExpired() {
+				e := &store.Entry{Type: store.StringType, Value: value}
+				if ttl := config.Get().ReadThroughTTL; ttl > 0 {
+					e.ExpireAt = time.Now().Add(time.Duration(ttl) * time.Second)
+				}
+				srv.store.Put(key, e)
+			}
+		}
+		srv.dispatchCommand(w, request, c)
+	})
+}
+
+// loadCall 是一次进行中的回源，done 关闭后结果可用
+type loadCall struct {
+	done  chan struct{}
+	value string
+	found bool
+	err   error
+}
+
+// loadOnce 调用 loader 读取 key，同一个键同时只有一次回源，并发的调用者共享它的结果
+func (srv *Server) loadOnce(key string, loader Loader) (string, bool, error) {
+	srv.loading.mu.Lock()
+	if c, ok := srv.loading.calls[key]; ok {
+		srv.loading.mu.Unlock()
+		<-c.done
+		return c.value, c.found, c.err
+	}
+	c := &loadCall{done: make(chan struct{})}
+	srv.loading.calls[key] = c
+	srv.loading.mu.Unlock()
+
+	c.value, c.found, c.err = loader.Load(key)
+	srv.loading.mu.Lock()
+	delete(srv.loading.calls, key)
+	srv.loading.mu.Unlock()
+	close(c.done)
+	return c.value, c.found, c.err
+}
+
+// regenLockSweepSize 是重建锁表的大小超过后在加锁时顺便清理到期的锁的阈值，锁住后从未被 SET 的键不会一直占用内存
+const regenLockSweepSize = 1024
+
+// acquireRegenLock 尝试取得 key 的重建锁，锁在 ttl 之后自动释放，返回是否取得。
+// 锁只在键不存在时有意义，因此 SET 之后无需显式释放
+func (srv *Server) acquireRegenLock(key string, ttl time.Duration) bool {
+	now := time.Now()
+	srv.regenLocks.mu.Lock()
+	defer srv.regenLocks.mu.Unlock()
+	if until, ok := srv.regenLocks.until[key]; ok && now.Before(until) {
+		return false
+	}
+	if len(srv.regenLocks.until) >= regenLockSweepSize {
+		for k, until := range srv.regenLocks.until {
+			if !now.Before(until) {
+				delete(srv.regenLocks.until, k)
+			}
+		}
+	}
+	srv.regenLocks.until[key] = now.Add(ttl)
+	return true
+}
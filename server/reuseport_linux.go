@@ -0,0 +1,33 @@
+//go:build linux
+
+package server
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// soReusePort 是 SO_REUSEPORT 选项的值，syscall 包在 Linux 上没有定义它；MIPS 上的取值与其他架构不同
+var soReusePort = func() int {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 0x200
+	}
+	return 0xf
+}()
+
+// listenReusePort 以 SO_REUSEPORT 监听 addr，多个这样的 socket 可以绑定同一个端口，内核按连接的四元组把新连接分散到它们上面
+func listenReusePort(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+		}); err != nil {
+			return err
+		}
+		return serr
+	}}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+// listenReusePort 目前只有 Linux 实现
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errors.New("io-acceptors greater than 1 is only supported on Linux")
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 按修改次数自动保存快照（与 Redis 的 save 相同）。键的写入、删除、过期以及排行榜的每次变化都计为一次修改，
+// 设置了 Options.Persistence 时每秒检查一次 save 中的各个条件，距离上次成功保存（还没有保存过时从启动算起）
+// 已经过了 Seconds 秒并且至少有 Changes 次修改时在后台保存快照。保存失败后至少等待 saveRetryDelay 再重试。
+// 上次保存以来的修改次数和上次保存的结果见 INFO persistence。Upgrade 冻结数据集之后不再自动保存，
+// 此后由新进程负责持久化，旧进程的保存会覆盖新进程写出的快照
+
+// saveRetryDelay 是自动保存失败之后再次尝试之前至少等待的时间
+const saveRetryDelay = 5 * time.Second
+
+// startSavePoints 启动检查 save 条件的 goroutine，实例 Stop 时退出
+func (srv *Server) startSavePoints() {
+	if !srv.opts.Persistence {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if !srv.beginBackgroundWrite() {
+					continue
+				}
+				if point, ok := srv.dueSavePoint(now); ok {
+					srv.logger.Printf("%d changes in %d seconds. Saving...\n", point.Changes, point.Seconds)
+					if err := srv.saveSnapshot(snapshotPath()); err != nil {
+						srv.logger.Println("Background saving error:", err)
+					}
+				}
+				srv.endBackgroundWrite()
+			case <-srv.stopping:
+				return
+			}
+		}
+	}()
+}
+
+// dueSavePoint 返回 now 时满足的第一个 save 条件
+func (srv *Server) dueSavePoint(now time.Time) (config.SavePoint, bool) {
+	changes := srv.changesSinceSave.Load()
+	if changes == 0 || srv.snapshotInProgress.Load() {
+		return config.SavePoint{}, false
+	}
+	if srv.lastSaveFailed.Load() && now.Sub(time.Unix(srv.lastSaveAttemptUnix.Load(), 0)) < saveRetryDelay {
+		return config.SavePoint{}, false
+	}
+	points, _ := config.ParseSavePoints(config.Get().Save)
+	elapsed := now.Sub(srv.started)
+	if last := srv.lastSaveUnix.Load(); last > 0 {
+		elapsed = now.Sub(time.Unix(last, 0))
+	}
+	for _, p := range points {
+		if changes >= int64(p.Changes) && elapsed >= time.Duration(p.Seconds)*time.Second {
+			return p, true
+		}
+	}
+	return config.SavePoint{}, false
+}
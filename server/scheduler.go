@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 服务端定时任务：按 cron 表达式定期执行保存的命令，例如每晚清空排行榜：
+//
+//	SCHEDULE ADD nightly-reset "0 0 * * *" LBCLEAR
+//	SCHEDULE ADD purge "@every 10m" MEMORY PURGE
+//	SCHEDULE REMOVE id
+//	SCHEDULE LIST
+//
+// 命令与客户端发送的命令一样经过 executeCommand 执行，会记入慢查询日志。
+// 定时任务只保存在内存中，不写入快照，重启后需要重新添加
+
+// scheduledJob 是一个定时任务
+type scheduledJob struct {
+	id       string
+	spec     string
+	schedule cronSchedule
+	args     []string
+
+	next       time.Time // 零值表示不会再执行
+	lastRun    time.Time
+	lastResult string // 上一次执行的结果：OK 或者错误回复
+	runs       int64
+	running    bool // 正在执行时不会再次触发，执行时间比间隔长的任务会跳过中间的触发
+}
+
+// schedulerState 是实例的定时任务表，嵌入在 Server 中
+type schedulerState struct {
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
+}
+
+// startScheduler 启动定时任务 goroutine，每秒检查一次到期的任务，实例 Stop 时退出
+func (srv *Server) startScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, job := range srv.dueJobs(now) {
+					go srv.runScheduledJob(job)
+				}
+			case <-srv.stopping:
+				return
+			}
+		}
+	}()
+}
+
+// dueJobs 返回到期的任务并计算它们的下一次执行时间
+func (srv *Server) dueJobs(now time.Time) []*scheduledJob {
+	srv.scheduler.mu.Lock()
+	defer srv.scheduler.mu.Unlock()
+	var due []*scheduledJob
+	for _, job := range srv.scheduler.jobs {
+		if job.next.IsZero() || job.next.After(now) {
+			continue
+		}
+		job.next = job.schedule.next(now)
+		if !job.running {
+			job.running = true
+			due = append(due, job)
+		}
+	}
+	return due
+}
+
+// runScheduledJob 执行一次任务并记录结果，数据集已经冻结时不执行
+func (srv *Server) runScheduledJob(job *scheduledJob) {
+	start := time.Now()
+	result := "OK"
+	if srv.beginBackgroundWrite() {
+		var buf bytes.Buffer
+		w := resp.NewWriter(&buf)
+		srv.executeCommand(w, job.args, internalClient("schedule="+job.id))
+		srv.endBackgroundWrite()
+		w.Flush()
+		w.Release()
+		if _, err := resp.ReadValue(bufio.NewReader(&buf)); err != nil {
+			result = err.Error()
+			srv.logger.Printf("Scheduled job %s failed: %s\n", job.id, result)
+		}
+	} else {
+		result = errHandoff
+	}
+
+	srv.scheduler.mu.Lock()
+	job.lastRun, job.lastResult, job.running = start, result, false
+	job.runs++
+	srv.scheduler.mu.Unlock()
+}
+
+// SCHEDULE ADD 命令：SCHEDULE ADD id schedule command [arg ...]，添加或替换一个定时任务。
+// schedule 是 5 个字段的 cron 表达式（需要加引号）、@daily 等简写或者 @every <duration>
+func (srv *Server) handleScheduleAdd(w *resp.Writer, args []string) {
+	id, spec, request := args[2], args[3], args[4:]
+	schedule, err := parseCronSchedule(spec)
+	if err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	// 添加时就检查命令和参数，避免到了执行时间才发现命令写错
+	cmd, errMsg := lookupCommand(request)
+	if cmd == nil {
+		w.WriteError(errMsg)
+		return
+	}
+	if errMsg := cmd.check(request); errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if strings.HasPrefix(cmd.name, "schedule") || cmd.name == "quit" {
+		w.WriteError("ERR command '" + cmd.name + "' can't be scheduled")
+		return
+	}
+
+	job := &scheduledJob{
+		id:       id,
+		spec:     spec,
+		schedule: schedule,
+		args:     append([]string(nil), request...),
+		next:     schedule.next(time.Now()),
+	}
+	srv.scheduler.mu.Lock()
+	srv.scheduler.jobs[id] = job
+	srv.scheduler.mu.Unlock()
+	w.WriteString("+OK\r\n")
+}
+
+// SCHEDULE REMOVE 命令：SCHEDULE REMOVE id，删除定时任务，返回删除的任务数。正在执行的任务会执行完
+func (srv *Server) handleScheduleRemove(w *resp.Writer, args []string) {
+	srv.scheduler.mu.Lock()
+	_, ok := srv.scheduler.jobs[args[2]]
+	delete(srv.scheduler.jobs, args[2])
+	srv.scheduler.mu.Unlock()
+	if ok {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+// SCHEDULE LIST 命令：按 id 顺序返回所有定时任务，时间为 Unix 时间戳（秒），没有时为 0
+func (srv *Server) handleScheduleList(w *resp.Writer, args []string) {
+	srv.scheduler.mu.Lock()
+	defer srv.scheduler.mu.Unlock()
+	ids := make([]string, 0, len(srv.scheduler.jobs))
+	for id := range srv.scheduler.jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	w.WriteArrayHeader(len(ids))
+	for _, id := range ids {
+		job := srv.scheduler.jobs[id]
+		w.WriteArrayHeader(14)
+		w.WriteBulk("id")
+		w.WriteBulk(job.id)
+		w.WriteBulk("schedule")
+		w.WriteBulk(job.spec)
+		w.WriteBulk("command")
+		w.WriteArrayHeader(len(job.args))
+		for _, arg := range job.args {
+			w.WriteBulk(arg)
+		}
+		w.WriteBulk("next-run")
+		w.WriteInteger(unixOrZero(job.next))
+		w.WriteBulk("last-run")
+		w.WriteInteger(unixOrZero(job.lastRun))
+		w.WriteBulk("last-result")
+		w.WriteBulk(job.lastResult)
+		w.WriteBulk("runs")
+		w.WriteInteger(int(job.runs))
+	}
+}
+
+func unixOrZero(t time.Time) int {
+	if t.IsZero() {
+		return 0
+	}
+	return int(t.Unix())
+}
@@ -0,0 +1,639 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 二级索引：按 FT.CREATE 声明的字段为哈希建立索引，FT.SEARCH 按字段值查询键，命令名和查询语法是 RediSearch 的一个子集：
+//
+//	FT.CREATE index [ON HASH] [PREFIX count prefix ...] SCHEMA field TAG|NUMERIC|VECTOR ... [field ...]
+//	FT.SEARCH index query [NOCONTENT] [LIMIT offset num] [PARAMS nargs name value ...] [DIALECT n]
+//	                                                       返回 [匹配的键数, 键...]，键按名称排序
+//	FT.DROPINDEX index / FT.INFO index / FT._LIST
+//
+// 查询由空格分隔的条件组成，所有条件同时满足的键匹配，* 匹配索引中的所有键：
+//
+//	@field:{a|b}       TAG 字段的值等于 a 或 b（忽略大小写，字段值按逗号分隔为多个标签）
+//	@field:[min max]   NUMERIC 字段的值在范围内，( 开头表示不包括端点，-inf 和 +inf 表示不限
+//
+// 索引在键空间事件中同步更新：键被写入时重新读取声明的字段，被删除、过期或者不再是哈希时移出索引，
+// 因此 FT.SEARCH 总能看到已经完成的写命令的结果。FT.CREATE 在返回之前为已有的键建立索引。
+// 索引定义保存在快照中，载入时重新建立索引。不带 TAG 条件的查询需要检查索引中的每个键。
+// VECTOR 字段和 KNN 查询见 vector.go
+
+// indexFieldType 是索引字段的类型
+type indexFieldType int
+
+const (
+	indexTag indexFieldType = iota
+	indexNumeric
+	indexVector
+)
+
+var indexFieldTypeNames = []string{"TAG", "NUMERIC", "VECTOR"}
+
+type indexField struct {
+	name string
+	typ  indexFieldType
+	vec  *vectorParams // VECTOR 字段的参数
+}
+
+// indexValue 是一个键在某个字段上的索引值，ok 为 false 表示没有这个字段（或者 NUMERIC 字段的值不是数字）
+type indexValue struct {
+	ok   bool
+	tags []string
+	num  float64
+	vec  []float32
+}
+
+// indexDoc 是索引中的一个键，values 与索引的 fields 一一对应
+type indexDoc struct {
+	expireAt time.Time
+	values   []indexValue
+}
+
+func (doc *indexDoc) expired() bool {
+	return !doc.expireAt.IsZero() && time.Now().After(doc.expireAt)
+}
+
+// searchIndex 是 FT.CREATE 创建的一个索引
+type searchIndex struct {
+	name string
+	// args 是 FT.CREATE 中索引名之后的参数，写入快照，载入时重新解析
+	args     []string
+	prefixes []string
+	fields   []indexField
+
+	mu   sync.RWMutex
+	docs map[string]*indexDoc
+	// tags 是 TAG 字段的倒排表：字段序号 -> 标签 -> 键
+	tags map[int]map[string]map[string]struct{}
+	// graphs 是 HNSW 向量字段的近邻图：字段序号 -> 图
+	graphs map[int]*hnswGraph
+}
+
+// searchIndexes 是实例上的所有索引。键空间事件在分片锁内读取 indexes，不加锁；
+// FT.CREATE、FT.DROPINDEX 在 mu 的保护下复制并替换整个列表
+type searchIndexes struct {
+	mu      sync.Mutex
+	indexes atomic.Pointer[[]*searchIndex]
+}
+
+var (
+	errUnknownIndex = errors.New("Unknown index name")
+	errIndexExists  = errors.New("Index already exists")
+)
+
+// parseIndexDefinition 解析 FT.CREATE 中索引名之后的参数
+func parseIndexDefinition(name string, args []string) (*searchIndex, error) {
+	idx := &searchIndex{name: name, args: args}
+	i := 0
+	if i+1 < len(args) && strings.EqualFold(args[i], "ON") {
+		if !strings.EqualFold(args[i+1], "HASH") {
+			return nil, errors.New("Only HASH indexes are supported")
+		}
+		i += 2
+	}
+	if i < len(args) && strings.EqualFold(args[i], "PREFIX") {
+		if i+1 >= len(args) {
+			return nil, errors.New("Bad arguments for PREFIX: Expected an argument")
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 1 || i+2+n > len(args) {
+			return nil, errors.New("Bad arguments for PREFIX: Bad count")
+		}
+		idx.prefixes = args[i+2 : i+2+n]
+		i += 2 + n
+	}
+	if i >= len(args) || !strings.EqualFold(args[i], "SCHEMA") {
+		return nil, errors.New("No schema found")
+	}
+	fieldArgs := args[i+1:]
+	if len(fieldArgs) < 2 {
+		return nil, errors.New("Fields arguments are missing")
+	}
+	for j := 0; j < len(fieldArgs); j += 2 {
+		if j+1 >= len(fieldArgs) {
+			return nil, fmt.Errorf("Field type is missing for field `%s`", fieldArgs[j])
+		}
+		f := indexField{name: fieldArgs[j], typ: indexFieldType(slices.Index(indexFieldTypeNames, strings.ToUpper(fieldArgs[j+1])))}
+		if f.typ < 0 {
+			return nil, fmt.Errorf("Invalid field type for field `%s`", f.name)
+		}
+		if idx.field(f.name) >= 0 {
+			return nil, fmt.Errorf("Duplicate field in schema - %s", f.name)
+		}
+		if f.typ == indexVector {
+			params, n, err := parseVectorParams(f.name, fieldArgs[j+2:])
+			if err != nil {
+				return nil, err
+			}
+			f.vec = params
+			j += n
+		}
+		idx.fields = append(idx.fields, f)
+	}
+	idx.reset()
+	return idx, nil
+}
+
+func (idx *searchIndex) reset() {
+	idx.docs = make(map[string]*indexDoc)
+	idx.tags = make(map[int]map[string]map[string]struct{})
+	idx.graphs = make(map[int]*hnswGraph)
+	for i, f := range idx.fields {
+		switch {
+		case f.typ == indexTag:
+			idx.tags[i] = make(map[string]map[string]struct{})
+		case f.typ == indexVector && f.vec.hnsw:
+			idx.graphs[i] = newHNSWGraph(f.vec)
+		}
+	}
+}
+
+// field 返回字段的序号，不存在时返回 -1
+func (idx *searchIndex) field(name string) int {
+	return slices.IndexFunc(idx.fields, func(f indexField) bool { return f.name == name })
+}
+
+// covers 返回键是否属于这个索引，没有指定 PREFIX 时所有键都属于
+func (idx *searchIndex) covers(key string) bool {
+	if len(idx.prefixes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(idx.prefixes, func(p string) bool { return strings.HasPrefix(key, p) })
+}
+
+// update 按键当前的值更新索引，entry 为 nil 或者不是哈希时把键移出索引。调用方需持有键所在分片的锁
+func (idx *searchIndex) update(key string, entry *store.Entry) {
+	var doc *indexDoc
+	if entry != nil && entry.Type == store.HashType {
+		hash := entry.Value.(*store.HashObject)
+		doc = &indexDoc{expireAt: entry.ExpireAt, values: make([]indexValue, len(idx.fields))}
+		for i, f := range idx.fields {
+			s, ok := hash.Get(f.name)
+			if !ok {
+				continue
+			}
+			switch f.typ {
+			case indexTag:
+				doc.values[i] = indexValue{ok: true, tags: splitTags(s)}
+			case indexNumeric:
+				if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsNaN(n) {
+					doc.values[i] = indexValue{ok: true, num: n}
+				}
+			case indexVector:
+				if vec := decodeVector(s, f.vec.dim); vec != nil {
+					doc.values[i] = indexValue{ok: true, vec: vec}
+				}
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if old, ok := idx.docs[key]; ok {
+		for i, v := range old.values {
+			for _, tag := range v.tags {
+				if keys := idx.tags[i][tag]; keys != nil {
+					delete(keys, key)
+					if len(keys) == 0 {
+						delete(idx.tags[i], tag)
+					}
+				}
+			}
+			if v.vec != nil && idx.graphs[i] != nil {
+				idx.graphs[i].remove(key)
+			}
+		}
+		delete(idx.docs, key)
+	}
+	if doc == nil {
+		return
+	}
+	idx.docs[key] = doc
+	for i, v := range doc.values {
+		for _, tag := range v.tags {
+			keys := idx.tags[i][tag]
+			if keys == nil {
+				keys = make(map[string]struct{})
+				idx.tags[i][tag] = keys
+			}
+			keys[key] = struct{}{}
+		}
+		if v.vec != nil && idx.graphs[i] != nil {
+			idx.graphs[i].insert(key, v.vec)
+		}
+	}
+}
+
+// splitTags 把 TAG 字段的值按逗号拆分为标签，去掉首尾空白并转为小写
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// searchTerm 是查询中的一个条件
+type searchTerm struct {
+	field int
+	// TAG 条件：tags 中任意一个
+	tags []string
+	// NUMERIC 条件
+	min, max         float64
+	minExcl, maxExcl bool
+}
+
+func (t *searchTerm) match(doc *indexDoc) bool {
+	v := doc.values[t.field]
+	if !v.ok {
+		return false
+	}
+	if t.tags != nil {
+		return slices.ContainsFunc(v.tags, func(tag string) bool { return slices.Contains(t.tags, tag) })
+	}
+	if v.num < t.min || (t.minExcl && v.num == t.min) {
+		return false
+	}
+	return v.num < t.max || (!t.maxExcl && v.num == t.max)
+}
+
+// parseSearchQuery 解析查询，* 返回空的条件列表
+func (idx *searchIndex) parseSearchQuery(q string) ([]searchTerm, error) {
+	q = strings.TrimSpace(q)
+	if q == "*" {
+		return nil, nil
+	}
+	var terms []searchTerm
+	for pos := 0; ; {
+		for pos < len(q) && q[pos] == ' ' {
+			pos++
+		}
+		if pos == len(q) {
+			break
+		}
+		syntaxErr := fmt.Errorf("Syntax error at offset %d near %s", pos, q[pos:])
+		colon := strings.IndexByte(q[pos:], ':')
+		if q[pos] != '@' || colon < 2 || pos+colon+1 >= len(q) {
+			return nil, syntaxErr
+		}
+		name := q[pos+1 : pos+colon]
+		term := searchTerm{field: idx.field(name)}
+		if term.field < 0 {
+			return nil, fmt.Errorf("Unknown field `%s`", name)
+		}
+		pos += colon + 1
+		open := q[pos]
+		closing := map[byte]byte{'{': '}', '[': ']'}[open]
+		end := strings.IndexByte(q[pos:], closing)
+		if closing == 0 || end < 0 {
+			return nil, syntaxErr
+		}
+		body := q[pos+1 : pos+end]
+		pos += end + 1
+		switch typ := idx.fields[term.field].typ; {
+		case open == '{' && typ == indexTag:
+			for _, tag := range strings.Split(body, "|") {
+				if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+					term.tags = append(term.tags, tag)
+				}
+			}
+			if term.tags == nil {
+				return nil, syntaxErr
+			}
+		case open == '[' && typ == indexNumeric:
+			bounds := strings.Fields(body)
+			if len(bounds) != 2 {
+				return nil, syntaxErr
+			}
+			var ok1, ok2 bool
+			term.min, term.minExcl, ok1 = parseNumericBound(bounds[0])
+			term.max, term.maxExcl, ok2 = parseNumericBound(bounds[1])
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("Bad numeric range for field `%s`", name)
+			}
+		default:
+			return nil, fmt.Errorf("Field `%s` is not a %s field", name, map[byte]string{'{': "TAG", '[': "NUMERIC"}[open])
+		}
+		terms = append(terms, term)
+	}
+	if terms == nil {
+		return nil, errors.New("Syntax error: empty query")
+	}
+	return terms, nil
+}
+
+// parseNumericBound 解析数值范围的端点：数字、-inf、+inf，( 开头表示不包括端点
+func parseNumericBound(s string) (v float64, exclusive, ok bool) {
+	if strings.HasPrefix(s, "(") {
+		s, exclusive = s[1:], true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, exclusive, err == nil && !math.IsNaN(v)
+}
+
+// search 返回满足所有条件的键，按名称排序
+func (idx *searchIndex) search(terms []searchTerm) []string {
+	idx.mu.RLock()
+	keys := idx.searchLocked(terms)
+	idx.mu.RUnlock()
+	slices.Sort(keys)
+	return keys
+}
+
+// searchLocked 返回满足所有条件的键，不排序。调用方需持有 idx.mu
+func (idx *searchIndex) searchLocked(terms []searchTerm) []string {
+	matches := func(doc *indexDoc) bool {
+		if doc.expired() {
+			return false
+		}
+		for i := range terms {
+			if !terms[i].match(doc) {
+				return false
+			}
+		}
+		return true
+	}
+	var keys []string
+	// 有 TAG 条件时只检查倒排表中命中第一个 TAG 条件的键
+	if i := slices.IndexFunc(terms, func(t searchTerm) bool { return t.tags != nil }); i >= 0 {
+		seen := make(map[string]struct{})
+		for _, tag := range terms[i].tags {
+			for key := range idx.tags[terms[i].field][tag] {
+				if _, dup := seen[key]; !dup && matches(idx.docs[key]) {
+					seen[key] = struct{}{}
+					keys = append(keys, key)
+				}
+			}
+		}
+	} else {
+		for key, doc := range idx.docs {
+			if matches(doc) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// searchKeyEvent 在键被写入、删除或过期时更新包含这个键的索引，在分片锁内调用
+func (srv *Server) searchKeyEvent(event store.KeyEvent, key string) {
+	indexes := srv.search.indexes.Load()
+	if indexes == nil {
+		return
+	}
+	var entry *store.Entry
+	if event == store.KeyWritten {
+		entry, _ = srv.store.Load(key)
+	}
+	for _, idx := range *indexes {
+		if idx.covers(key) {
+			idx.update(key, entry)
+		}
+	}
+}
+
+// lookupIndex 返回名为 name 的索引
+func (srv *Server) lookupIndex(name string) *searchIndex {
+	if indexes := srv.search.indexes.Load(); indexes != nil {
+		for _, idx := range *indexes {
+			if idx.name == name {
+				return idx
+			}
+		}
+	}
+	return nil
+}
+
+// createIndex 添加一个索引并为已有的键建立索引。先发布索引再逐个分片扫描，
+// 扫描期间写入的键由键空间事件更新，扫描在分片锁内读取键的当前值，两者不会互相覆盖成旧值
+func (srv *Server) createIndex(name string, args []string) error {
+	idx, err := parseIndexDefinition(name, args)
+	if err != nil {
+		return err
+	}
+	srv.search.mu.Lock()
+	defer srv.search.mu.Unlock()
+	if srv.lookupIndex(name) != nil {
+		return errIndexExists
+	}
+	var indexes []*searchIndex
+	if old := srv.search.indexes.Load(); old != nil {
+		indexes = append(indexes, *old...)
+	}
+	indexes = append(indexes, idx)
+	srv.search.indexes.Store(&indexes)
+	for i := 0; i < store.ShardCount; i++ {
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			if idx.covers(key) {
+				idx.update(key, entry)
+			}
+		})
+	}
+	return nil
+}
+
+// searchIndexList 返回所有索引
+func (srv *Server) searchIndexList() []*searchIndex {
+	if indexes := srv.search.indexes.Load(); indexes != nil {
+		return *indexes
+	}
+	return nil
+}
+
+// FT.CREATE 命令：FT.CREATE index [ON HASH] [PREFIX count prefix ...] SCHEMA field TAG|NUMERIC ...
+func (srv *Server) handleFTCreate(w *resp.Writer, args []string) {
+	if err := srv.createIndex(args[1], append([]string(nil), args[2:]...)); err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// FT.DROPINDEX 命令：FT.DROPINDEX index，删除索引（不删除键）
+func (srv *Server) handleFTDropIndex(w *resp.Writer, args []string) {
+	srv.search.mu.Lock()
+	defer srv.search.mu.Unlock()
+	old := srv.searchIndexList()
+	i := slices.IndexFunc(old, func(idx *searchIndex) bool { return idx.name == args[1] })
+	if i < 0 {
+		w.WriteError("ERR " + errUnknownIndex.Error())
+		return
+	}
+	indexes := slices.Delete(slices.Clone(old), i, i+1)
+	srv.search.indexes.Store(&indexes)
+	w.WriteString("+OK\r\n")
+}
+
+// FT._LIST 命令：返回所有索引名
+func (srv *Server) handleFTList(w *resp.Writer, args []string) {
+	indexes := srv.searchIndexList()
+	w.WriteArrayHeader(len(indexes))
+	for _, idx := range indexes {
+		w.WriteBulk(idx.name)
+	}
+}
+
+// FT.INFO 命令：FT.INFO index，返回索引名、定义、字段和键数，名称和值交替排列
+func (srv *Server) handleFTInfo(w *resp.Writer, args []string) {
+	idx := srv.lookupIndex(args[1])
+	if idx == nil {
+		w.WriteError("ERR " + errUnknownIndex.Error())
+		return
+	}
+	idx.mu.RLock()
+	docs := len(idx.docs)
+	idx.mu.RUnlock()
+	w.WriteArrayHeader(8)
+	w.WriteBulk("index_name")
+	w.WriteBulk(idx.name)
+	w.WriteBulk("index_definition")
+	w.WriteArrayHeader(4)
+	w.WriteBulk("key_type")
+	w.WriteBulk("HASH")
+	w.WriteBulk("prefixes")
+	w.WriteArrayHeader(len(idx.prefixes))
+	for _, p := range idx.prefixes {
+		w.WriteBulk(p)
+	}
+	w.WriteBulk("attributes")
+	w.WriteArrayHeader(len(idx.fields))
+	for _, f := range idx.fields {
+		if f.vec == nil {
+			w.WriteArrayHeader(4)
+		} else {
+			w.WriteArrayHeader(10)
+		}
+		w.WriteBulk("identifier")
+		w.WriteBulk(f.name)
+		w.WriteBulk("type")
+		w.WriteBulk(indexFieldTypeNames[f.typ])
+		if f.vec != nil {
+			algorithm := "FLAT"
+			if f.vec.hnsw {
+				algorithm = "HNSW"
+			}
+			w.WriteBulk("algorithm")
+			w.WriteBulk(algorithm)
+			w.WriteBulk("dim")
+			w.WriteInteger(f.vec.dim)
+			w.WriteBulk("distance_metric")
+			w.WriteBulk(vectorMetricNames[f.vec.metric])
+		}
+	}
+	w.WriteBulk("num_docs")
+	w.WriteInteger(docs)
+}
+
+// FT.SEARCH 命令：FT.SEARCH index query [NOCONTENT] [LIMIT offset num] [PARAMS nargs name value ...] [DIALECT n]，
+// 返回匹配的键数以及按名称排序的键，LIMIT 默认为 0 10。普通查询只返回键名，NOCONTENT 为了兼容 RediSearch 的客户端而接受。
+// KNN 查询按距离从近到远返回键，每个键之后是 [分数字段名, 距离]（NOCONTENT 时省略），PARAMS 给出查询向量
+func (srv *Server) handleFTSearch(w *resp.Writer, args []string) {
+	offset, num := 0, 10
+	noContent := false
+	params := make(map[string]string)
+	for i := 3; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "NOCONTENT"):
+			noContent = true
+		case strings.EqualFold(args[i], "LIMIT") && i+2 < len(args):
+			o, err1 := strconv.Atoi(args[i+1])
+			n, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil || o < 0 || n < 0 {
+				w.WriteError("ERR LIMIT argument must be a non-negative integer")
+				return
+			}
+			offset, num = o, n
+			i += 2
+		case strings.EqualFold(args[i], "PARAMS") && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 || n%2 != 0 || i+1+n >= len(args) {
+				w.WriteError("ERR Bad arguments for PARAMS: Bad number of arguments")
+				return
+			}
+			for j := i + 2; j < i+2+n; j += 2 {
+				params[args[j]] = args[j+1]
+			}
+			i += 1 + n
+		case strings.EqualFold(args[i], "DIALECT") && i+1 < len(args):
+			i++
+		default:
+			w.WriteError(errSyntax)
+			return
+		}
+	}
+	idx := srv.lookupIndex(args[1])
+	if idx == nil {
+		w.WriteError("ERR " + errUnknownIndex.Error())
+		return
+	}
+	query, knnPart, isKNN := strings.Cut(args[2], "=>")
+	if query = strings.TrimSpace(query); strings.HasPrefix(query, "(") && strings.HasSuffix(query, ")") {
+		query = query[1 : len(query)-1]
+	}
+	terms, err := idx.parseSearchQuery(query)
+	if err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	if !isKNN {
+		keys := idx.search(terms)
+		start := min(offset, len(keys))
+		page := keys[start : start+min(num, len(keys)-start)]
+		w.WriteArrayHeader(1 + len(page))
+		w.WriteInteger(len(keys))
+		for _, key := range page {
+			w.WriteBulk(key)
+		}
+		return
+	}
+
+	knn, err := idx.parseKNN(knnPart)
+	if err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	blob, ok := params[knn.param]
+	if !ok {
+		w.WriteError("ERR No such parameter `" + knn.param + "`")
+		return
+	}
+	dim := idx.fields[knn.field].vec.dim
+	if knn.vec = decodeVector(blob, dim); knn.vec == nil {
+		w.WriteError(fmt.Sprintf("ERR Error parsing vector similarity query: query vector blob size (%d) does not match index's expected size (%d).",
+			len(blob), dim*4))
+		return
+	}
+	results := idx.knn(terms, knn)
+	start := min(offset, len(results))
+	page := results[start : start+min(num, len(results)-start)]
+	if noContent {
+		w.WriteArrayHeader(1 + len(page))
+	} else {
+		w.WriteArrayHeader(1 + 2*len(page))
+	}
+	w.WriteInteger(len(results))
+	for _, r := range page {
+		w.WriteBulk(r.key)
+		if !noContent {
+			w.WriteArrayHeader(2)
+			w.WriteBulk(knn.alias)
+			w.WriteBulk(strconv.FormatFloat(r.dist, 'g', -1, 32))
+		}
+	}
+}
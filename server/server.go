@@ -0,0 +1,629 @@
+// Package server 把键空间和排行榜包装成一个完整的 redis-easy 实例：RESP 连接、命令分发、快照持久化，
+// 以及 :8080 上的排行榜页面、HTTP API、实时推送、命令网关和管理后台
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// Options 是创建实例时的选项，零值即可使用
+type Options struct {
+	// Addr 是接受 RESP 连接的地址，例如 "127.0.0.1:6379" 或 ":0"（随机端口，启动后通过 Addr 方法查看），
+	// 为空时监听配置中的 port。eventloop 后端只使用其中的端口，总是监听所有地址
+	Addr string
+	// MaxClients 大于 0 时限制同时连接的客户端数，超出的连接收到错误回复后被关闭
+	MaxClients int
+	// Persistence 为 true 时，Start 先从 dir/dbfilename 载入快照，Stop 时保存快照
+	Persistence bool
+	// Logger 用于输出连接、快照等运行日志，为 nil 时使用 log 包的默认 Logger
+	Logger *log.Logger
+}
+
+// Server 是一个 redis-easy 实例，持有键空间、排行榜以及连接、慢查询等运行状态。
+// 可调参数统一从 config.Get() 读取
+type Server struct {
+	opts   Options
+	logger *log.Logger
+
+	store   *store.Store
+	board   *leaderboard.Board
+	seasons *leaderboard.Seasons
+	changes leaderboard.ChangeLog
+	history leaderboard.History
+
+	// feed 把排行榜的变化分发给所有 SSE 订阅者，见 leaderboard_feed.go
+	feed struct {
+		mu   sync.Mutex
+		subs map[chan leaderboard.Change]struct{}
+	}
+
+	clients struct {
+		mu   sync.Mutex
+		byID map[int64]*client
+	}
+	nextClientID atomic.Int64
+	// totalConnections 是启动以来接受的连接总数，outputLimitDisconnections 是因超过 client-output-buffer-limit 断开的连接数
+	totalConnections          atomic.Int64
+	outputLimitDisconnections atomic.Int64
+
+	slowlog struct {
+		mu      sync.Mutex
+		entries []slowlogEntry // 最新的记录在最前面
+		nextID  int64
+	}
+	// auditLog 是审计日志，见 audit.go
+	auditLog auditLog
+	// scheduler 保存 SCHEDULE 添加的定时任务，见 scheduler.go
+	scheduler schedulerState
+	// webhook 把键空间事件发送到 webhook-url，见 webhook.go
+	webhook webhookSink
+	// nats 把键空间事件发布到 nats-url，见 nats.go
+	nats webhookSink
+	// writeBehind 是等待同步到 write-behind-sink 的键，见 writebehind.go
+	writeBehind writeBehindQueue
+	// search 是 FT.CREATE 创建的二级索引，见 search.go
+	search searchIndexes
+	// loading 是进行中的 read-through 回源，httpLoader 是按当前 read-through-loader 地址建立的 HTTP loader，
+	// regenLocks 是 GET WITHLOCK 的重建锁，见 readthrough.go
+	loading struct {
+		mu    sync.Mutex
+		calls map[string]*loadCall
+	}
+	httpLoader atomic.Pointer[httpLoader]
+	regenLocks struct {
+		mu    sync.Mutex
+		until map[string]time.Time
+	}
+
+	// totalCommands 是启动以来执行的命令总数
+	totalCommands atomic.Int64
+
+	// loadingSnapshot 在启动时载入快照期间为 true；busyShards 是各分片上正在执行的 FCALL 的开始时间（unix 纳秒，0 表示没有）；
+	// rejectedBusy 和 rejectedOverloaded 是因此被拒绝的命令数，见 state.go
+	loadingSnapshot    atomic.Bool
+	busyShards         [store.ShardCount]atomic.Int64
+	rejectedBusy       atomic.Int64
+	rejectedOverloaded atomic.Int64
+	// probing 在 Responsive 的检查进行期间为 true
+	probing atomic.Bool
+
+	// snapshotInProgress 保证同一时间只有一个快照在进行；lastSaveUnix 是最近一次成功保存快照的时间；
+	// changesSinceSave 是此后数据集的修改次数，lastSaveFailed 和 lastSaveAttemptUnix 记录最近一次保存的结果和时间，见 savepoints.go
+	snapshotInProgress  atomic.Bool
+	lastSaveUnix        atomic.Int64
+	changesSinceSave    atomic.Int64
+	lastSaveFailed      atomic.Bool
+	lastSaveAttemptUnix atomic.Int64
+
+	// acceptPaused 为 true 时不接受新连接；draining 为 true 时连接处理完已收到的命令后关闭，
+	// drainForce 表示排空已经到期，剩余的连接直接断开。见 drain.go
+	acceptPaused atomic.Bool
+	draining     atomic.Bool
+	drainForce   atomic.Bool
+	drain        drainState
+
+	httpLimiter rateLimiter
+
+	// upgrading 在 Upgrade 进行期间为 true，handedOff 表示已经把数据集交给了新进程，Stop 时不再保存快照；
+	// handoff 在开始发送数据集时冻结数据集，见 upgrade.go
+	upgrading atomic.Bool
+	handedOff atomic.Bool
+	handoff   struct {
+		mu     sync.RWMutex
+		frozen atomic.Bool
+	}
+
+	// 以下字段由 Start / Stop 维护：started 是 Start 的时间，addr 是实际监听的地址，listeners 是 goroutine 后端的监听 socket（io-acceptors 个），
+	// stopping 在 Stop 时关闭，serving 等待接受连接的循环和所有连接处理完毕
+	started   time.Time
+	addr      string
+	listeners []net.Listener
+	listenFDs []int // eventloop 后端的监听 socket
+	stopping  chan struct{}
+	stopOnce  sync.Once
+	stopErr   error
+	serving   sync.WaitGroup
+}
+
+// New 按 opts 创建一个数据集为空的实例。排行榜的变更流和实时推送在这里注册为排行榜的观察者
+func New(opts Options) *Server {
+	srv := &Server{
+		opts:     opts,
+		logger:   opts.Logger,
+		store:    store.New(),
+		board:    leaderboard.NewBoard(),
+		stopping: make(chan struct{}),
+	}
+	if srv.logger == nil {
+		srv.logger = log.Default()
+	}
+	srv.seasons = leaderboard.NewSeasons(srv.board)
+	srv.feed.subs = make(map[chan leaderboard.Change]struct{})
+	srv.clients.byID = make(map[int64]*client)
+	srv.scheduler.jobs = make(map[string]*scheduledJob)
+	srv.webhook.queue = make(chan webhookEvent, webhookQueueLen)
+	srv.nats.queue = make(chan webhookEvent, webhookQueueLen)
+	srv.writeBehind.pending = make(map[string]struct{})
+	srv.writeBehind.full = make(chan struct{}, 1)
+	srv.loading.calls = make(map[string]*loadCall)
+	srv.regenLocks.until = make(map[string]time.Time)
+	srv.httpLimiter.buckets = make(map[string]*tokenBucket)
+	srv.board.Watch(func(c leaderboard.Change) {
+		srv.changes.Record(c, config.Get().LeaderboardChangesMaxLen)
+	})
+	srv.board.Watch(func(c leaderboard.Change) {
+		srv.history.Record(c, config.Get().LeaderboardHistoryMaxLen)
+	})
+	srv.board.Watch(srv.publishLeaderboardChange)
+	srv.board.Watch(func(leaderboard.Change) { srv.changesSinceSave.Add(1) })
+	return srv
+}
+
+// Store 返回实例的键空间
+func (srv *Server) Store() *store.Store {
+	return srv.store
+}
+
+// Leaderboard 返回实例的排行榜
+func (srv *Server) Leaderboard() *leaderboard.Board {
+	return srv.board
+}
+
+// LoadSnapshot 从 dir/dbfilename 载入上次保存的快照，需在 Start 之前调用。
+// 设置了 Options.Persistence 时 Start 会自动载入，无需再调用
+func (srv *Server) LoadSnapshot() error {
+	return srv.loadSnapshot(snapshotPath())
+}
+
+// SaveSnapshot 把当前数据集保存到 dir/dbfilename，与 SAVE 命令相同
+func (srv *Server) SaveSnapshot() error {
+	return srv.saveSnapshot(snapshotPath())
+}
+
+// ReadSnapshot 从 r 读取一份快照（例如从管道读入的备份）载入实例，需在 Start 之前调用，name 用于错误信息和日志
+func (srv *Server) ReadSnapshot(name string, r io.Reader) error {
+	return srv.restoreSnapshot(name, r)
+}
+
+// WriteSnapshot 把当前数据集以快照格式写入 w（例如标准输出），格式与 SAVE 保存的文件相同
+func (srv *Server) WriteSnapshot(w io.Writer) error {
+	return srv.writeSnapshot(w)
+}
+
+// startProcessTasks 保证进程级的后台任务（惰性释放、归还内存）只启动一次，同一进程中可以运行多个实例
+var startProcessTasks sync.Once
+
+// Start 开始在 Options.Addr 上接受 RESP 连接，载入快照后启动分片 worker 和后台任务，然后返回。
+// 载入快照期间访问数据集的命令返回 -LOADING，载入失败时停止接受连接并返回错误。
+// 键空间上的命令都交给键所在分片的 worker 串行执行。ctx 被取消时实例自动 Stop
+func (srv *Server) Start(ctx context.Context) error {
+	addr := srv.opts.Addr
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", config.Get().Port)
+	}
+	srv.started = time.Now()
+	srv.loadingSnapshot.Store(srv.opts.Persistence)
+	// 由 Upgrade 启动时继承上一个进程的监听 socket，数据集由上一个进程在排空连接后通过管道发送
+	inherited := takeInheritedFiles()
+	if inherited.snapshot != nil {
+		defer inherited.snapshot.Close()
+	}
+	var err error
+	if config.Get().IOBackend == "eventloop" {
+		err = srv.startEventLoop(addr, inherited.listeners)
+	} else {
+		err = srv.startListener(addr, inherited.listeners)
+	}
+	if err != nil {
+		return err
+	}
+	if srv.opts.Persistence {
+		if inherited.snapshot != nil {
+			err = srv.restoreSnapshot("upgrade pipe", inherited.snapshot)
+		} else {
+			err = srv.LoadSnapshot()
+		}
+		if err != nil {
+			srv.stopOnce.Do(func() {
+				srv.stopServing()
+				srv.stopErr = err
+			})
+			return err
+		}
+	}
+	// 在载入快照之后设置，载入的键不产生 write 事件
+	srv.store.SetKeyEventHandler(srv.keyEvent)
+	srv.changesSinceSave.Store(0)
+	srv.applyNamespaces()
+	srv.store.StartWorkers(config.Get().WorkerThreads)
+	srv.loadingSnapshot.Store(false)
+	startProcessTasks.Do(func() {
+		store.StartLazyFree()
+		startMemoryPurger()
+	})
+	srv.startLeaderboardSeasons()
+	srv.startScheduler()
+	srv.startWebhook()
+	srv.startNATS()
+	srv.startWriteBehind()
+	srv.startSavePoints()
+	inherited.notifyReady()
+	go func() {
+		select {
+		case <-ctx.Done():
+			srv.Stop()
+		case <-srv.stopping:
+		}
+	}()
+	return nil
+}
+
+// Addr 返回实例实际监听的地址，Start 成功之后才有值
+func (srv *Server) Addr() string {
+	return srv.addr
+}
+
+// Stop 停止接受新连接，在 shutdown-drain-timeout 内排空客户端连接（见 drain.go），关闭剩余的连接并等待正在执行的命令结束；
+// 设置了 Options.Persistence 时随后保存快照
+// （快照还没有载入完时不保存，避免用不完整的数据集覆盖快照文件）。
+// 可以多次调用，之后的调用返回第一次的结果。分片 worker 不会退出，通过 Store 直接访问键空间仍然可用
+func (srv *Server) Stop() error {
+	srv.stopOnce.Do(func() {
+		if timeout := config.Get().ShutdownDrainTimeout; timeout > 0 && !srv.loadingSnapshot.Load() {
+			<-srv.startDrain(time.Duration(timeout) * time.Millisecond)
+		}
+		srv.stopServing()
+		srv.logger.Println("Server stopped")
+		srv.flushWriteBehind()
+		if srv.opts.Persistence && !srv.loadingSnapshot.Load() && !srv.handedOff.Load() {
+			srv.stopErr = srv.saveSnapshot(snapshotPath())
+		}
+		srv.auditLog.mu.Lock()
+		srv.closeAuditFile()
+		srv.auditLog.mu.Unlock()
+	})
+	return srv.stopErr
+}
+
+// stopServing 停止接受新连接，关闭所有客户端连接并等待连接处理完毕
+func (srv *Server) stopServing() {
+	close(srv.stopping)
+	for _, l := range srv.listeners {
+		l.Close()
+	}
+	srv.closeClients()
+	srv.serving.Wait()
+}
+
+// startListener 启动 goroutine 后端：每个监听 socket 一个 goroutine 接受连接，每个连接一个 goroutine。
+// io-acceptors 大于 1 时以 SO_REUSEPORT 在同一端口上创建多个监听 socket；
+// inherited 不为空时改用从上一个进程继承的监听 socket（见 upgrade.go）
+func (srv *Server) startListener(addr string, inherited []*os.File) error {
+	n := config.Get().IOAcceptors
+	if len(inherited) > 0 {
+		n = len(inherited)
+	}
+	for i := 0; i < max(n, 1); i++ {
+		var listener net.Listener
+		var err error
+		if len(inherited) > 0 {
+			listener, err = net.FileListener(inherited[i])
+			inherited[i].Close()
+		} else if n > 1 {
+			listener, err = listenReusePort(addr)
+		} else {
+			listener, err = net.Listen("tcp", addr)
+		}
+		if err != nil {
+			for _, l := range srv.listeners {
+				l.Close()
+			}
+			for _, f := range inherited[min(i+1, len(inherited)):] {
+				f.Close()
+			}
+			srv.listeners = nil
+			return err
+		}
+		// 端口为 0 时之后的 socket 绑定第一个 socket 实际分配到的端口
+		addr = listener.Addr().String()
+		srv.listeners = append(srv.listeners, listener)
+	}
+	srv.addr = addr
+	if n > 1 {
+		srv.logger.Printf("Server is listening on %s (%d acceptors)\n", srv.addr, n)
+	} else {
+		srv.logger.Printf("Server is listening on %s\n", srv.addr)
+	}
+	for _, listener := range srv.listeners {
+		srv.serving.Add(1)
+		go srv.acceptLoop(listener)
+	}
+	return nil
+}
+
+// acceptLoop 在 listener 上接受连接，直到实例 Stop；暂停接受新连接期间不调用 Accept
+func (srv *Server) acceptLoop(listener net.Listener) {
+	defer srv.serving.Done()
+	for {
+		if srv.acceptPaused.Load() {
+			if !srv.waitAcceptResumed(listener) {
+				return
+			}
+			// 清除超时之后可能又被暂停，重新检查一次
+			continue
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-srv.stopping:
+				return
+			default:
+			}
+			if srv.acceptPaused.Load() {
+				continue
+			}
+			srv.logger.Println("Failed to accept connection:", err)
+			continue
+		}
+		if srv.tooManyClients() {
+			conn.Write([]byte("-ERR max number of clients reached\r\n"))
+			conn.Close()
+			continue
+		}
+		srv.logClient("New client connected:", conn.RemoteAddr())
+		srv.serving.Add(1)
+		go func() {
+			defer srv.serving.Done()
+			srv.handleConnection(conn)
+		}()
+	}
+}
+
+// HTTPHandler 返回 :8080 上的 HTTP 服务：排行榜页面、API 和实时推送，以及按配置开启的命令网关和管理后台，
+// 外层带有限流、CORS 和认证
+func (srv *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/leaderboard", srv.leaderboardSnapshotHandler)
+	mux.HandleFunc("/leaderboard/events", srv.leaderboardEventsHandler)
+	srv.registerLeaderboardAPI(mux)
+	if config.Get().HTTPGateway == "yes" {
+		srv.registerGateway(mux)
+	}
+	if config.Get().HTTPAdmin == "yes" {
+		srv.registerAdmin(mux)
+		srv.registerAdminTransfer(mux)
+	}
+	return srv.protectHTTP(mux)
+}
+
+func (srv *Server) handleConnection(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	c := srv.registerClient(conn.RemoteAddr().String(), conn)
+	dw := &deadlineWriter{srv: srv, conn: conn, c: c}
+	w := resp.NewWriter(dw)
+	defer func() {
+		srv.logClient("Closing connection:", conn.RemoteAddr())
+		srv.unregisterClient(c)
+		conn.Close()
+		w.Release()
+	}()
+	// 在 Stop 关闭所有连接之后才注册上的连接不会被关闭，需要自己退出
+	select {
+	case <-srv.stopping:
+		return
+	default:
+	}
+	for {
+		if reader.Buffered() == 0 {
+			// 排空时已收到的命令都已处理完、回复已经写出，可以关闭连接
+			if srv.draining.Load() {
+				srv.logClient("Closing connection for draining:", conn.RemoteAddr())
+				return
+			}
+		}
+		request, err := readClientCommand(conn, reader, c)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() && srv.draining.Load() {
+				srv.logClient("Closing connection for draining:", conn.RemoteAddr())
+			} else if ok && nerr.Timeout() {
+				srv.logClient("Client timed out:", conn.RemoteAddr())
+			} else if perr, ok := err.(resp.ProtocolError); ok {
+				// 协议错误：先把已有回复和错误信息发给客户端，再关闭连接
+				w.WriteError("ERR " + perr.Error())
+				w.Flush()
+				srv.logger.Println("Protocol error from client:", conn.RemoteAddr(), perr)
+			} else if errors.Is(err, net.ErrClosed) || err.Error() == "EOF" {
+				srv.logClient("Client disconnected:", conn.RemoteAddr())
+			} else {
+				srv.logger.Println("Error reading command:", err)
+			}
+			return
+		}
+		if request == nil || len(request) == 0 {
+			continue
+		}
+
+		keepOpen := srv.executeCommand(w, request, c)
+		c.touch(request[0])
+		if !keepOpen {
+			w.Flush()
+			return
+		}
+
+		// 客户端以管道方式一次发送多条命令时，等这一批命令全部处理完再统一下发回复，
+		// 避免每条回复都单独触发一次系统调用
+		if reader.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				srv.logger.Println("Error writing reply:", err)
+				return
+			}
+			dw.batchDone()
+		}
+	}
+}
+
+// executeCommand 执行一条已解析的命令并把回复写入 w，返回 false 表示客户端请求关闭连接（QUIT）。
+// 不同的网络后端都通过它分发命令；命令会在其涉及的键所在的分片上执行。c 是发送命令的客户端。
+// 返回时回复必须已经完整写入 w：两种网络后端都逐条调用它，依靠这一点保证同一连接上的回复严格按收到命令的顺序写出，
+// 管道中单分片的命令（交给 worker）与跨分片的命令（在当前 goroutine 上执行）交替时也是如此。
+// 以后增加异步执行的路径时，也要在这里等到回复写完再返回，或者按连接上的命令顺序排队写出回复。
+// ordering_test.go 在两种后端上检查这一点
+func (srv *Server) executeCommand(w *resp.Writer, request []string, c *client) bool {
+	start := time.Now()
+	keepOpen := true
+	if errMsg := srv.checkServerState(request); errMsg != "" {
+		w.WriteError(errMsg)
+	} else if loader, err := srv.readThroughLoader(request); err != nil {
+		w.WriteError("ERR " + err.Error())
+	} else if loader != nil {
+		srv.executeReadThrough(w, request, loader, c)
+	} else {
+		srv.runCommandKeys(request, func() {
+			keepOpen = srv.dispatchCommand(w, request, c)
+		})
+	}
+	srv.recordCommand(request, start, time.Since(start))
+	srv.auditCommand(c.caller, request, start)
+	return keepOpen
+}
+
+// runCommandKeys 在持有命令涉及的全部键所在分片锁的前提下执行 fn。命令声明了 extraKeys 时先锁住参数中的键取出其他键，
+// 再连同其他键一起加锁；两次加锁之间其他键发生了变化（例如 TS.CREATERULE 增加了规则）时重新取出
+func (srv *Server) runCommandKeys(request []string, fn func()) {
+	keys := commandKeys(request)
+	spec, _ := lookupCommand(request)
+	if spec == nil || spec.extraKeys == nil || spec.check(request) != "" {
+		srv.store.RunKeys(keys, fn)
+		return
+	}
+	var extra []string
+	srv.store.RunKeys(keys, func() { extra = spec.extraKeys(srv, request) })
+	for done := false; !done; {
+		srv.store.RunKeys(append(keys[:len(keys):len(keys)], extra...), func() {
+			current := spec.extraKeys(srv, request)
+			if slices.Equal(current, extra) {
+				fn()
+				done = true
+			}
+			extra = current
+		})
+	}
+}
+
+// dispatchCommand 按命令表检查参数并调用对应的处理函数，返回 false 表示客户端请求关闭连接（QUIT）
+func (srv *Server) dispatchCommand(w *resp.Writer, request []string, c *client) bool {
+	spec, errMsg := lookupCommand(request)
+	if spec == nil {
+		w.WriteError(errMsg)
+		return true
+	}
+	if errMsg := spec.check(request); errMsg != "" {
+		w.WriteError(errMsg)
+		return true
+	}
+	if spec.flags&CmdDenyOOM != 0 {
+		if errMsg := srv.checkNamespaceQuota(spec.extractKeys(request)); errMsg != "" {
+			w.WriteError(errMsg)
+			return true
+		}
+	}
+	if spec.clientHandler != nil {
+		spec.clientHandler(srv, c, w, request)
+	} else {
+		spec.handler(srv, w, request)
+	}
+	return spec.name != "quit"
+}
+
+// readClientCommand 在 resp.ReadCommand 外层加上读超时控制：等待下一条命令最多 timeout 秒，
+// 命令的第一个字节到达后，整条命令必须在 client-read-timeout 内读完，
+// 防止只发送半条命令的客户端长期占用连接。等待第一个字节期间 c.idle 为 true
+func readClientCommand(conn net.Conn, reader *bufio.Reader, c *client) ([]string, error) {
+	cfg := config.Get()
+	if reader.Buffered() == 0 {
+		c.idle.Store(true)
+		setReadDeadline(conn, time.Duration(cfg.Timeout)*time.Second)
+		_, err := reader.Peek(1)
+		c.idle.Store(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	setReadDeadline(conn, time.Duration(cfg.ClientReadTimeout)*time.Millisecond)
+	return resp.ReadCommand(reader, protoLimits(cfg))
+}
+
+// protoLimits 返回配置中解析请求的长度限制
+func protoLimits(cfg *config.Config) resp.Limits {
+	return resp.Limits{MaxMultibulkLen: cfg.ProtoMaxMultibulkLen, MaxBulkLen: cfg.ProtoMaxBulkLen}
+}
+
+// setReadDeadline 设置连接的读超时，d 为 0 表示不限时
+func setReadDeadline(conn net.Conn, d time.Duration) {
+	if d > 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// deadlineWriter 在每次向连接写数据前设置写超时。回复缓冲区写满或一批命令处理完时才会真正写连接，
+// 因此停止读取回复的客户端最多占用一个回复缓冲区的内存，并在 client-write-timeout 后被断开。
+//
+// 回复是流式写出的，client-output-buffer-limit 按这一批命令已经生成的回复字节数计算积压量，
+// 与 Redis 把一条命令的完整回复放进输出缓冲区后再检查相同：超过硬限制时立即断开；
+// 超过软限制后写超时缩短到软限制开始超过之后 soft-seconds 秒，到期仍没有写完时断开
+type deadlineWriter struct {
+	srv     *Server
+	conn    net.Conn
+	c       *client
+	pending int64 // 这一批命令已经生成的回复字节数
+}
+
+// errOutputLimit 表示回复超过了 client-output-buffer-limit，连接随后关闭
+var errOutputLimit = errors.New("client output buffer limit exceeded")
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	dw.pending += int64(len(p))
+	if dw.srv.outputLimitExceeded(dw.c, dw.pending, now) {
+		return 0, errOutputLimit
+	}
+	var deadline time.Time
+	if timeout := config.Get().ClientWriteTimeout; timeout > 0 {
+		deadline = now.Add(time.Duration(timeout) * time.Millisecond)
+	}
+	if since := dw.c.softLimitSince; !since.IsZero() {
+		limit := config.Get().ClientOutputBufferLimit[dw.c.class]
+		if soft := since.Add(time.Duration(limit.SoftSeconds) * time.Second); deadline.IsZero() || soft.Before(deadline) {
+			deadline = soft
+		}
+	}
+	// deadline 为零值时清除上一批回复可能设置的软限制超时
+	dw.conn.SetWriteDeadline(deadline)
+	return dw.conn.Write(p)
+}
+
+// batchDone 在一批命令的回复全部写完后调用，清空积压量
+func (dw *deadlineWriter) batchDone() {
+	dw.pending = 0
+	dw.c.omem.Store(0)
+	dw.c.softLimitSince = time.Time{}
+}
@@ -0,0 +1,84 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/server"
+)
+
+// backends 是测试时分别启动的 I/O 后端
+var backends = []string{"goroutine", "eventloop"}
+
+// startServer 以 backend 后端在随机端口上启动一个实例，测试结束时停止
+func startServer(t *testing.T, backend string) *server.Server {
+	t.Helper()
+	if backend == "eventloop" && runtime.GOOS != "linux" {
+		t.Skip("io-backend eventloop is only supported on Linux")
+	}
+	if err := config.Load([]string{"--io-backend", backend, "--shutdown-drain-timeout", "0"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(server.Options{Addr: "127.0.0.1:0", Logger: log.New(io.Discard, "", 0)})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Stop() })
+	return srv
+}
+
+// testConn 是测试用的 RESP 连接
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send 一次写出多条命令，不等待回复
+func (c *testConn) send(cmds ...[]string) {
+	c.t.Helper()
+	var buf []byte
+	for _, args := range cmds {
+		buf = append(buf, resp.EncodeCommand(args)...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read 读取一条回复，错误回复以 resp.Error 值返回
+func (c *testConn) read() interface{} {
+	c.t.Helper()
+	v, err := resp.ReadValue(c.r)
+	if e, ok := err.(resp.Error); ok {
+		return e
+	}
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return v
+}
+
+// do 发送一条命令并返回它的回复
+func (c *testConn) do(args ...string) interface{} {
+	c.t.Helper()
+	c.send(args)
+	return c.read()
+}
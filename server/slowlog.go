@@ -0,0 +1,123 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/resp"
+)
+
+// 慢查询日志（对应 Redis 的 SLOWLOG）。执行时间不少于 slowlog-log-slower-than 微秒的命令
+// 会被记录下来，最多保留最近的 slowlog-max-len 条；slowlog-log-level 不低于 loglevel 时同时写入运行日志
+
+// 与 Redis 相同，每条记录最多保存 32 个参数，每个参数最多 128 字节
+const (
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	ID       int64    `json:"id"`
+	Time     int64    `json:"time"`
+	Duration int64    `json:"duration"`
+	Args     []string `json:"args"`
+}
+
+// recordCommand 在每条命令执行完后调用，更新命令计数并按需写入慢查询日志
+func (srv *Server) recordCommand(request []string, start time.Time, elapsed time.Duration) {
+	srv.totalCommands.Add(1)
+	cfg := config.Get()
+	if cfg.SlowlogLogSlowerThan < 0 || elapsed.Microseconds() < int64(cfg.SlowlogLogSlowerThan) {
+		return
+	}
+	if config.ShouldLog(cfg.SlowlogLogLevel) {
+		srv.logger.Printf("Slow command (%d microseconds): %q\n", elapsed.Microseconds(), truncateArgs(request))
+	}
+	if cfg.SlowlogMaxLen == 0 {
+		return
+	}
+	srv.slowlog.mu.Lock()
+	defer srv.slowlog.mu.Unlock()
+	e := slowlogEntry{ID: srv.slowlog.nextID, Time: start.Unix(), Duration: elapsed.Microseconds(), Args: truncateArgs(request)}
+	srv.slowlog.nextID++
+	srv.slowlog.entries = append([]slowlogEntry{e}, srv.slowlog.entries...)
+	if len(srv.slowlog.entries) > cfg.SlowlogMaxLen {
+		srv.slowlog.entries = srv.slowlog.entries[:cfg.SlowlogMaxLen]
+	}
+}
+
+// truncateArgs 按 slowlogMaxArgc、slowlogMaxArgLen 截断命令参数，用于写入日志
+func truncateArgs(request []string) []string {
+	args := request
+	if len(args) > slowlogMaxArgc {
+		args = args[:slowlogMaxArgc-1]
+	}
+	out := make([]string, 0, len(args)+1)
+	for _, arg := range args {
+		if len(arg) > slowlogMaxArgLen {
+			arg = arg[:slowlogMaxArgLen] + "... (" + strconv.Itoa(len(arg)-slowlogMaxArgLen) + " more bytes)"
+		}
+		out = append(out, arg)
+	}
+	if len(request) > slowlogMaxArgc {
+		out = append(out, "... ("+strconv.Itoa(len(request)-slowlogMaxArgc+1)+" more arguments)")
+	}
+	return out
+}
+
+// slowlogGet 返回最新的 n 条慢查询记录，n 为负数时返回全部
+func (srv *Server) slowlogGet(n int) []slowlogEntry {
+	srv.slowlog.mu.Lock()
+	defer srv.slowlog.mu.Unlock()
+	if n < 0 || n > len(srv.slowlog.entries) {
+		n = len(srv.slowlog.entries)
+	}
+	return append([]slowlogEntry(nil), srv.slowlog.entries[:n]...)
+}
+
+func (srv *Server) slowlogReset() {
+	srv.slowlog.mu.Lock()
+	srv.slowlog.entries = nil
+	srv.slowlog.mu.Unlock()
+}
+
+// SLOWLOG GET 命令：SLOWLOG GET [count]，返回最新的 count 条（默认 10 条，-1 表示全部）慢查询，
+// 每条为 [id, 时间戳, 耗时微秒, [参数...]]
+func (srv *Server) handleSlowlogGet(w *resp.Writer, args []string) {
+	count := 10
+	if len(args) == 3 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < -1 {
+			w.WriteString("-ERR count should be greater than or equal to -1\r\n")
+			return
+		}
+		count = n
+	}
+	entries := srv.slowlogGet(count)
+	w.WriteArrayHeader(len(entries))
+	for _, e := range entries {
+		w.WriteArrayHeader(4)
+		w.WriteInteger(int(e.ID))
+		w.WriteInteger(int(e.Time))
+		w.WriteInteger(int(e.Duration))
+		w.WriteArrayHeader(len(e.Args))
+		for _, arg := range e.Args {
+			w.WriteBulk(arg)
+		}
+	}
+}
+
+// SLOWLOG LEN 命令：返回慢查询日志的条数
+func (srv *Server) handleSlowlogLen(w *resp.Writer, args []string) {
+	srv.slowlog.mu.Lock()
+	n := len(srv.slowlog.entries)
+	srv.slowlog.mu.Unlock()
+	w.WriteInteger(n)
+}
+
+// SLOWLOG RESET 命令：清空慢查询日志
+func (srv *Server) handleSlowlogReset(w *resp.Writer, args []string) {
+	srv.slowlogReset()
+	w.WriteString("+OK\r\n")
+}
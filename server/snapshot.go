@@ -0,0 +1,763 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 快照文件格式：
+//
+//	"REASYSNP" | 版本号(1 字节) | 记录 CRC32C(4 字节)... | opSnapshotEOF | CRC64(8 字节)
+//
+// 每条记录以 1 字节操作码开头。opSnapshotEntry 表示一个键：类型(1 字节)、过期时间（unix 毫秒，
+// 0 表示不过期，uvarint）、键，以及按类型编码的值；opSnapshotLeaderboard 表示排行榜中的一个用户及其分数；
+// opSnapshotSeason 是当前赛季名；opSnapshotArchive 是一个归档赛季：名称、归档时间（unix 秒）、
+// 用户数以及按名次排列的用户、分数和元数据。从版本 3 开始排行榜用户和归档中的用户都带有元数据（空字符串表示没有）。
+// opSnapshotIndex 是一个二级索引的定义：索引名以及 FT.CREATE 中索引名之后的参数，载入时重新建立索引。
+// 字符串一律编码为 uvarint(长度) + 数据，集合类值先写 uvarint(元素个数) 再依次写元素。
+//
+// 从版本 4 开始每条记录之后是这条记录（从操作码开始）的 CRC32C，opSnapshotEOF 之后是此前整个文件的 CRC64（ECMA），
+// 均为小端序。载入时逐条校验，校验通过的记录才会载入；snapshot-verify 为 no 时跳过校验。
+// 从版本 9 开始操作码之后是 uvarint(内容长度)，载入时先读出整条记录、校验通过后再从内存中解码，
+// 记录内容里被改动的元素个数或字符串长度不会在校验之前造成大量的循环或内存分配，解码时它们也不能超过记录剩余的字节数
+const (
+	snapshotMagic = "REASYSNP"
+	// 版本 2 增加了赛季记录；版本 3 增加了排行榜元数据，分数改为有符号 varint（分数下限可以配置为负数）；
+	// 版本 4 增加了校验和；版本 5 增加了布谷鸟过滤器类型，值是 CuckooObject.MarshalBinary 的结果，按字符串编码；
+	// 版本 6 增加了时间序列类型，值是 TimeSeriesObject.MarshalBinary 的结果；版本 7 增加了二级索引记录；
+	// 版本 8 增加了延迟队列类型，值是 QueueObject.MarshalBinary 的结果；版本 9 在记录前加上了内容长度。读取时兼容旧版本
+	snapshotVersion = 9
+	// snapshotChecksumVersion 是开始带有校验和的版本，snapshotFramedVersion 是记录开始带有长度的版本
+	snapshotChecksumVersion = 4
+	snapshotFramedVersion   = 9
+
+	opSnapshotEntry       = 0x01
+	opSnapshotLeaderboard = 0x02
+	opSnapshotSeason      = 0x03
+	opSnapshotArchive     = 0x04
+	opSnapshotIndex       = 0x05
+	opSnapshotEOF         = 0xFF
+)
+
+var (
+	snapshotCRC32Table = crc32.MakeTable(crc32.Castagnoli)
+	snapshotCRC64Table = crc64.MakeTable(crc64.ECMA)
+)
+
+// errSnapshotChecksum 表示快照内容与校验和不符
+var errSnapshotChecksum = errors.New("checksum mismatch")
+
+// snapshotRecordBufferKeep 是写完一条记录后保留的记录缓冲区的最大容量，写过大键之后不会一直占用同样大的内存
+const snapshotRecordBufferKeep = 1 << 20
+
+// snapshotWriter 在写出快照的同时计算校验和。记录的内容先写入 rec，endRecord 时才知道长度并写出
+type snapshotWriter struct {
+	w    *bufio.Writer
+	op   byte
+	rec  []byte
+	file uint64
+}
+
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	sw.rec = append(sw.rec, p...)
+	return len(p), nil
+}
+
+func (sw *snapshotWriter) WriteByte(b byte) error {
+	sw.rec = append(sw.rec, b)
+	return nil
+}
+
+func (sw *snapshotWriter) WriteString(s string) {
+	sw.rec = append(sw.rec, s...)
+}
+
+// raw 直接写入文件，只计入文件的校验和
+func (sw *snapshotWriter) raw(p []byte) {
+	sw.file = crc64.Update(sw.file, snapshotCRC64Table, p)
+	sw.w.Write(p)
+}
+
+// beginRecord 开始一条操作码为 op 的记录
+func (sw *snapshotWriter) beginRecord(op byte) {
+	sw.op = op
+	sw.rec = sw.rec[:0]
+}
+
+// endRecord 写出记录的操作码、内容长度和内容，之后是这三者的 CRC32C
+func (sw *snapshotWriter) endRecord() {
+	var head [1 + binary.MaxVarintLen64]byte
+	head[0] = sw.op
+	n := 1 + binary.PutUvarint(head[1:], uint64(len(sw.rec)))
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.Update(crc32.Checksum(head[:n], snapshotCRC32Table), snapshotCRC32Table, sw.rec))
+	sw.raw(head[:n])
+	sw.raw(sw.rec)
+	sw.raw(sum[:])
+	if cap(sw.rec) > snapshotRecordBufferKeep {
+		sw.rec = nil
+	}
+}
+
+// finish 写入 opSnapshotEOF 和文件末尾的 CRC64 并刷新缓冲区
+func (sw *snapshotWriter) finish() error {
+	sw.raw([]byte{opSnapshotEOF})
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], sw.file)
+	sw.w.Write(buf[:])
+	return sw.w.Flush()
+}
+
+// snapshotSource 是解码记录内容时的数据来源：版本 9 开始是一条已经通过校验的记录（snapshotPayload），
+// 之前的版本直接从文件中读取（snapshotReader）
+type snapshotSource interface {
+	io.Reader
+	io.ByteReader
+	// remaining 返回最多还能读出的字节数，元素个数和字符串长度在分配内存之前与它比较
+	remaining() uint64
+}
+
+// snapshotPayload 是一条记录的内容
+type snapshotPayload struct {
+	*bytes.Reader
+}
+
+func (p snapshotPayload) remaining() uint64 {
+	return uint64(p.Len())
+}
+
+// snapshotReader 在读取快照的同时计算校验和。版本 4 之前的快照没有校验和，verify 为 false
+type snapshotReader struct {
+	r      *bufio.Reader
+	verify bool
+	record uint32
+	file   uint64
+	one    [1]byte
+	// payload 是 readRecord 读出的记录内容，各条记录复用
+	payload bytes.Buffer
+}
+
+func (sr *snapshotReader) sum(p []byte) {
+	sr.record = crc32.Update(sr.record, snapshotCRC32Table, p)
+	sr.file = crc64.Update(sr.file, snapshotCRC64Table, p)
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.sum(p[:n])
+	return n, err
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.one[0] = b
+		sr.sum(sr.one[:])
+	}
+	return b, err
+}
+
+// remaining 无法预知，旧版本的快照没有记录长度
+func (sr *snapshotReader) remaining() uint64 {
+	return math.MaxUint64
+}
+
+// readRecord 在读出操作码之后读取记录的长度和内容并校验 CRC32C。内容随读取逐步分配，
+// 被改动的长度最多读到文件末尾，不会预先分配它声明的大小。返回的内容在读取下一条记录之前有效
+func (sr *snapshotReader) readRecord() (snapshotPayload, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil || n > math.MaxInt64 {
+		return snapshotPayload{}, errors.New("unexpected end of snapshot")
+	}
+	sr.payload.Reset()
+	if _, err := io.CopyN(&sr.payload, sr, int64(n)); err != nil {
+		return snapshotPayload{}, errors.New("unexpected end of snapshot")
+	}
+	if err := sr.endRecord(); err != nil {
+		return snapshotPayload{}, fmt.Errorf("record %v", err)
+	}
+	return snapshotPayload{bytes.NewReader(sr.payload.Bytes())}, nil
+}
+
+// endRecord 读取一条记录之后的 CRC32C 并与记录的内容比较
+func (sr *snapshotReader) endRecord() error {
+	want := sr.record
+	var buf [4]byte
+	if _, err := io.ReadFull(sr, buf[:]); err != nil {
+		return errors.New("unexpected end of snapshot")
+	}
+	sr.record = 0
+	if sr.verify && binary.LittleEndian.Uint32(buf[:]) != want {
+		return errSnapshotChecksum
+	}
+	return nil
+}
+
+// finish 读取文件末尾的 CRC64 并与此前的全部内容比较
+func (sr *snapshotReader) finish() error {
+	want := sr.file
+	var buf [8]byte
+	if _, err := io.ReadFull(sr.r, buf[:]); err != nil {
+		return errors.New("unexpected end of snapshot")
+	}
+	if sr.verify && binary.LittleEndian.Uint64(buf[:]) != want {
+		return errSnapshotChecksum
+	}
+	return nil
+}
+
+// snapshotPath 返回配置的快照文件路径
+func snapshotPath() string {
+	cfg := config.Get()
+	return filepath.Join(cfg.Dir, cfg.DBFilename)
+}
+
+// saveSnapshot 把当前数据集写入快照文件。先写入临时文件，成功后再原子地替换旧文件，
+// 保存过程中崩溃不会损坏已有的快照
+func (srv *Server) saveSnapshot(path string) error {
+	if !srv.snapshotInProgress.CompareAndSwap(false, true) {
+		return errors.New("Background save already in progress")
+	}
+	defer srv.snapshotInProgress.Store(false)
+
+	start := time.Now()
+	// 保存期间的修改不一定包含在快照中，只减去开始时的修改次数
+	changes := srv.changesSinceSave.Load()
+	srv.lastSaveAttemptUnix.Store(start.Unix())
+	if err := srv.writeSnapshotFile(path); err != nil {
+		srv.lastSaveFailed.Store(true)
+		return err
+	}
+	srv.changesSinceSave.Add(-changes)
+	srv.lastSaveFailed.Store(false)
+	srv.lastSaveUnix.Store(time.Now().Unix())
+	srv.logger.Printf("DB saved on disk: %s (%v)\n", path, time.Since(start))
+	return nil
+}
+
+// writeSnapshotFile 把快照写入 path 的临时文件，成功后改名为 path
+func (srv *Server) writeSnapshotFile(path string) error {
+	tmp := fmt.Sprintf("%s.tmp-%d", path, os.Getpid())
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := srv.writeSnapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeSnapshot 逐个分片写出数据集。每个分片只在复制条目指针时短暂加锁，
+// 序列化期间分片上的写命令照常执行，被修改的条目通过写时复制与快照隔离（见 LoadForWrite）
+func (srv *Server) writeSnapshot(out io.Writer) error {
+	w := &snapshotWriter{w: bufio.NewWriterSize(out, 64*1024)}
+	w.raw([]byte(snapshotMagic))
+	w.raw([]byte{snapshotVersion})
+	for i := 0; i < store.ShardCount; i++ {
+		if err := srv.writeSnapshotShard(w, i); err != nil {
+			return err
+		}
+	}
+	for _, e := range srv.board.Range(0, -1) {
+		w.beginRecord(opSnapshotLeaderboard)
+		writeSnapshotString(w, e.User)
+		writeSnapshotVarint(w, int64(e.Score))
+		writeSnapshotString(w, e.Meta)
+		w.endRecord()
+	}
+	srv.writeSnapshotSeasons(w)
+	for _, idx := range srv.searchIndexList() {
+		w.beginRecord(opSnapshotIndex)
+		writeSnapshotString(w, idx.name)
+		writeSnapshotUvarint(w, uint64(len(idx.args)))
+		for _, arg := range idx.args {
+			writeSnapshotString(w, arg)
+		}
+		w.endRecord()
+	}
+	return w.finish()
+}
+
+// writeSnapshotSeasons 写出当前赛季名和所有归档赛季。归档榜单不会再被修改，持锁期间只复制切片
+func (srv *Server) writeSnapshotSeasons(w *snapshotWriter) {
+	current, archives := srv.seasons.Current(), srv.seasons.Archives()
+	if current != "" {
+		w.beginRecord(opSnapshotSeason)
+		writeSnapshotString(w, current)
+		w.endRecord()
+	}
+	for _, a := range archives {
+		w.beginRecord(opSnapshotArchive)
+		writeSnapshotString(w, a.Name)
+		writeSnapshotUvarint(w, uint64(a.CreatedAt.Unix()))
+		writeSnapshotUvarint(w, uint64(len(a.Entries)))
+		for _, e := range a.Entries {
+			writeSnapshotString(w, e.User)
+			writeSnapshotVarint(w, int64(e.Score))
+			writeSnapshotString(w, e.Meta)
+		}
+		w.endRecord()
+	}
+}
+
+func (srv *Server) writeSnapshotShard(w *snapshotWriter, i int) error {
+	items := srv.store.BeginShardSnapshot(i)
+	defer srv.store.EndShardSnapshot(i)
+	for _, item := range items {
+		if item.Entry.IsExpired() {
+			continue
+		}
+		writeSnapshotEntry(w, item.Key, item.Entry)
+		w.endRecord()
+		// bufio.Writer 的错误是粘滞的，写一次空数据即可检查之前是否出错
+		if _, err := w.w.Write(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSnapshotEntry(w *snapshotWriter, key string, e *store.Entry) {
+	w.beginRecord(opSnapshotEntry)
+	w.WriteByte(byte(e.Type))
+	var expireMs uint64
+	if !e.ExpireAt.IsZero() {
+		expireMs = uint64(e.ExpireAt.UnixMilli())
+	}
+	writeSnapshotUvarint(w, expireMs)
+	writeSnapshotString(w, key)
+	switch v := e.Value.(type) {
+	case string:
+		writeSnapshotString(w, v)
+	case *store.ListObject:
+		writeSnapshotUvarint(w, uint64(v.Len()))
+		if v.Len() > 0 {
+			v.Range(0, v.Len()-1, func(s string) { writeSnapshotString(w, s) })
+		}
+	case *store.SetObject:
+		writeSnapshotUvarint(w, uint64(v.Len()))
+		v.ForEach(func(member string) { writeSnapshotString(w, member) })
+	case *store.HashObject:
+		writeSnapshotUvarint(w, uint64(v.Len()))
+		v.ForEach(func(field, value string) {
+			writeSnapshotString(w, field)
+			writeSnapshotString(w, value)
+		})
+	case *store.CuckooObject:
+		data, _ := v.MarshalBinary()
+		writeSnapshotString(w, string(data))
+	case *store.TimeSeriesObject:
+		data, _ := v.MarshalBinary()
+		writeSnapshotString(w, string(data))
+	case *store.QueueObject:
+		data, _ := v.MarshalBinary()
+		writeSnapshotString(w, string(data))
+	}
+}
+
+func writeSnapshotUvarint(w *snapshotWriter, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func writeSnapshotVarint(w *snapshotWriter, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func writeSnapshotString(w *snapshotWriter, s string) {
+	writeSnapshotUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+// loadSnapshot 在启动时把快照文件载入内存，文件不存在时什么也不做
+func (srv *Server) loadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return srv.restoreSnapshot(path, f)
+}
+
+// restoreSnapshot 从 in 读取快照载入实例，name 用于错误信息和日志。
+// 按 snapshot-verify 校验，snapshot-repair 为 yes 时快照损坏只记录警告
+func (srv *Server) restoreSnapshot(name string, in io.Reader) error {
+	start := time.Now()
+	cfg := config.Get()
+	cr := &countingReader{r: in}
+	r := bufio.NewReaderSize(cr, 64*1024)
+	keys, err := readSnapshot(r, cfg.SnapshotVerify == "yes", srv.restoreVisitor())
+	if err != nil {
+		if cfg.SnapshotRepair != "yes" {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		srv.logger.Printf("WARNING: snapshot %s is corrupted near offset %d (%v), loaded the %d keys before the first corrupt record\n",
+			name, cr.n-int64(r.Buffered()), err, keys)
+	}
+	srv.logger.Printf("DB loaded from %s: %d keys in %v\n", name, keys, time.Since(start))
+	return nil
+}
+
+// restoreVisitor 返回把快照中的记录载入实例的回调
+func (srv *Server) restoreVisitor() snapshotVisitor {
+	return snapshotVisitor{
+		// 启动时一边载入一边已经在接受连接，写入时加上分片锁
+		entry:   func(key string, e *store.Entry) { srv.store.RunKeys([]string{key}, func() { srv.store.Put(key, e) }) },
+		score:   func(e leaderboard.Entry) { srv.board.Restore(e.User, e.Score, e.Meta) },
+		season:  srv.seasons.Restore,
+		archive: srv.seasons.AddArchive,
+		index: func(name string, args []string) {
+			if err := srv.createIndex(name, args); err != nil {
+				srv.logger.Printf("WARNING: skipped index '%s' in snapshot: %v\n", name, err)
+			}
+		},
+	}
+}
+
+// RepairSnapshot 把快照文件 path 中第一条损坏的记录之前的所有数据写成新的快照文件 out，返回写出的键数。
+// 文件没有损坏时相当于复制一份（已经过期的键会被丢弃）
+func RepairSnapshot(path, out string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	srv := New(Options{Logger: log.New(io.Discard, "", 0)})
+	keys, _ := readSnapshot(bufio.NewReaderSize(f, 64*1024), true, srv.restoreVisitor())
+	if err := srv.saveSnapshot(out); err != nil {
+		return 0, err
+	}
+	return keys, nil
+}
+
+// snapshotVisitor 是 readSnapshot 解析出各类记录时的回调
+type snapshotVisitor struct {
+	entry func(key string, e *store.Entry)
+	// expired 在读到已经过期的键时调用，可以为 nil
+	expired func(key string, e *store.Entry)
+	score   func(e leaderboard.Entry)
+	season  func(name string)
+	archive func(a *leaderboard.Archive)
+	// index 在读到二级索引的定义时调用，可以为 nil
+	index func(name string, args []string)
+}
+
+// readSnapshot 解析快照，对每条记录调用 v 中对应的回调（过期的键会被跳过），返回载入的键数。
+// verify 为 true 时校验每条记录和整个文件的校验和，记录校验通过之后才调用回调，出错时之前的记录都已经交给了回调
+func readSnapshot(br *bufio.Reader, verify bool, v snapshotVisitor) (int, error) {
+	r := &snapshotReader{r: br}
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, errors.New("bad snapshot header")
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, errors.New("not a snapshot file")
+	}
+	version := header[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return 0, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	checksummed := version >= snapshotChecksumVersion
+	framed := version >= snapshotFramedVersion
+	r.verify = verify && checksummed
+	keys := 0
+	for {
+		r.record = 0
+		op, err := r.ReadByte()
+		if err != nil {
+			return keys, errors.New("unexpected end of snapshot")
+		}
+		if op == opSnapshotEOF {
+			if checksummed {
+				if err := r.finish(); err != nil {
+					return keys, fmt.Errorf("snapshot %v", err)
+				}
+			}
+			return keys, nil
+		}
+		// 版本 9 开始先读出整条记录并校验，再从 src 解码；之前的版本边读边解码，
+		// decode 在记录通过校验之后才解码不透明的值（布谷鸟过滤器等），被改动的字节因此报告为校验和不符，而不是某种值的编码错误
+		var src snapshotSource = r
+		if framed {
+			if src, err = r.readRecord(); err != nil {
+				return keys, err
+			}
+		}
+		var visit func()
+		var decode func() error
+		switch op {
+		case opSnapshotLeaderboard:
+			e, err := readSnapshotLeaderboardEntry(src, version)
+			if err != nil {
+				return keys, err
+			}
+			visit = func() { v.score(e) }
+		case opSnapshotSeason:
+			name, err := readSnapshotString(src)
+			if err != nil {
+				return keys, err
+			}
+			visit = func() { v.season(name) }
+		case opSnapshotArchive:
+			a, err := readSnapshotArchive(src, version)
+			if err != nil {
+				return keys, err
+			}
+			visit = func() { v.archive(a) }
+		case opSnapshotIndex:
+			name, err := readSnapshotString(src)
+			if err != nil {
+				return keys, err
+			}
+			var args []string
+			if err := readSnapshotElements(src, 1, func(elems []string) { args = append(args, elems[0]) }); err != nil {
+				return keys, err
+			}
+			visit = func() {
+				if v.index != nil {
+					v.index(name, args)
+				}
+			}
+		case opSnapshotEntry:
+			key, e, decodeValue, err := readSnapshotEntry(src)
+			if err != nil {
+				return keys, err
+			}
+			decode = decodeValue
+			visit = func() {
+				if !e.IsExpired() {
+					v.entry(key, e)
+					keys++
+				} else if v.expired != nil {
+					v.expired(key, e)
+				}
+			}
+		default:
+			return keys, fmt.Errorf("unknown opcode 0x%02x", op)
+		}
+		if checksummed && !framed {
+			if err := r.endRecord(); err != nil {
+				return keys, fmt.Errorf("record %v", err)
+			}
+		}
+		if decode != nil {
+			if err := decode(); err != nil {
+				return keys, err
+			}
+		}
+		visit()
+	}
+}
+
+// readSnapshotEntry 读取一个键。布谷鸟过滤器、时间序列和延迟队列的值先按字符串读出，
+// 返回的 decode 把它解码到 e.Value 中，其余类型的 decode 为 nil
+func readSnapshotEntry(r snapshotSource) (string, *store.Entry, func() error, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	expireMs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	key, err := readSnapshotString(r)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	e := &store.Entry{Type: store.DataType(t)}
+	if expireMs != 0 {
+		e.ExpireAt = time.UnixMilli(int64(expireMs))
+	}
+	var unmarshal func(data []byte) (interface{}, error)
+	switch e.Type {
+	case store.StringType:
+		e.Value, err = readSnapshotString(r)
+	case store.ListType:
+		list := store.NewListObject()
+		err = readSnapshotElements(r, 1, func(elems []string) { list.PushBack(elems) })
+		e.Value = list
+	case store.SetType:
+		set := store.NewSetObject()
+		err = readSnapshotElements(r, 1, func(elems []string) { set.Add(elems[0]) })
+		e.Value = set
+	case store.HashType:
+		hash := store.NewHashObject()
+		err = readSnapshotElements(r, 2, func(elems []string) { hash.Set(elems[0], elems[1]) })
+		e.Value = hash
+	case store.CuckooType:
+		unmarshal = func(data []byte) (interface{}, error) { return store.UnmarshalCuckoo(data) }
+	case store.TimeSeriesType:
+		unmarshal = func(data []byte) (interface{}, error) { return store.UnmarshalTimeSeries(data) }
+	case store.QueueType:
+		unmarshal = func(data []byte) (interface{}, error) { return store.UnmarshalQueue(data) }
+	default:
+		err = fmt.Errorf("unknown value type %d for key '%s'", t, key)
+	}
+	if err != nil || unmarshal == nil {
+		return key, e, nil, err
+	}
+	data, err := readSnapshotString(r)
+	if err != nil {
+		return key, e, nil, err
+	}
+	return key, e, func() (err error) {
+		e.Value, err = unmarshal([]byte(data))
+		return err
+	}, nil
+}
+
+// readSnapshotLeaderboardEntry 读取一个排行榜用户，版本 3 之前的快照分数为 uvarint 且没有元数据
+func readSnapshotLeaderboardEntry(r snapshotSource, version byte) (leaderboard.Entry, error) {
+	var e leaderboard.Entry
+	var err error
+	if e.User, err = readSnapshotString(r); err != nil {
+		return e, err
+	}
+	if version < 3 {
+		score, err := binary.ReadUvarint(r)
+		e.Score = int(score)
+		return e, err
+	}
+	score, err := binary.ReadVarint(r)
+	if err != nil {
+		return e, err
+	}
+	e.Score = int(score)
+	e.Meta, err = readSnapshotString(r)
+	return e, err
+}
+
+func readSnapshotArchive(r snapshotSource, version byte) (*leaderboard.Archive, error) {
+	name, err := readSnapshotString(r)
+	if err != nil {
+		return nil, err
+	}
+	created, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	// 每个用户至少占 2 个字节（用户名长度和分数）
+	if n > r.remaining()/2 {
+		return nil, fmt.Errorf("archive size %d exceeds the record", n)
+	}
+	a := &leaderboard.Archive{Name: name, CreatedAt: time.Unix(int64(created), 0)}
+	for i := uint64(0); i < n; i++ {
+		e, err := readSnapshotLeaderboardEntry(r, version)
+		if err != nil {
+			return nil, err
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return a, nil
+}
+
+// readSnapshotElements 读取元素个数以及随后的元素，每 group 个字符串调用一次 fn
+func readSnapshotElements(r snapshotSource, group int, fn func(elems []string)) error {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	// 每个字符串至少占 1 个字节（长度）
+	if n > r.remaining()/uint64(group) {
+		return fmt.Errorf("element count %d exceeds the record", n)
+	}
+	elems := make([]string, group)
+	for i := uint64(0); i < n; i++ {
+		for j := range elems {
+			if elems[j], err = readSnapshotString(r); err != nil {
+				return err
+			}
+		}
+		fn(elems)
+	}
+	return nil
+}
+
+func readSnapshotString(r snapshotSource) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > r.remaining() {
+		return "", fmt.Errorf("string length %d exceeds the record", n)
+	}
+	if n > uint64(config.Get().ProtoMaxBulkLen) {
+		return "", fmt.Errorf("string length %d exceeds proto-max-bulk-len", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// SAVE 命令：同步保存快照，保存完成后才回复。goroutine 后端只阻塞发送 SAVE 的连接，其他连接的命令照常执行；
+// eventloop 后端在事件循环上执行命令，保存期间同一个事件循环上的所有连接都会停顿，这时应当使用 BGSAVE
+func (srv *Server) handleSave(w *resp.Writer, args []string) {
+	if err := srv.saveSnapshot(snapshotPath()); err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// BGSAVE 命令：在后台 goroutine 中保存快照并立即返回
+func (srv *Server) handleBgSave(w *resp.Writer, args []string) {
+	if srv.snapshotInProgress.Load() {
+		w.WriteString("-ERR Background save already in progress\r\n")
+		return
+	}
+	go func() {
+		if err := srv.saveSnapshot(snapshotPath()); err != nil {
+			srv.logger.Println("Background saving error:", err)
+		}
+	}()
+	w.WriteString("+Background saving started\r\n")
+}
+
+// LASTSAVE 命令：返回最近一次成功保存快照的 unix 时间戳
+func (srv *Server) handleLastSave(w *resp.Writer, args []string) {
+	w.WriteInteger(int(srv.lastSaveUnix.Load()))
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/LikiosSedo/redis_easy/leaderboard"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// SnapshotKey 是快照中的一个键及其大小：字符串为字节数，列表、集合、哈希为元素个数，布谷鸟过滤器为加入的元素个数，时间序列为采样点个数，延迟队列为元素个数
+type SnapshotKey struct {
+	Key  string
+	Type store.DataType
+	Size int
+}
+
+// SnapshotReport 是 InspectSnapshot 对一个快照文件的检查结果
+type SnapshotReport struct {
+	Version byte
+	Size    int64 // 文件大小
+	// Keys 按类型统计未过期的键数，Expired 是已经过期、载入时会被丢弃的键数，WithTTL 是设置了过期时间的键数
+	Keys    [store.TypeCount]int
+	Expired int
+	WithTTL int
+	// Biggest 按类型保存最大的若干个键，从大到小排列
+	Biggest [store.TypeCount][]SnapshotKey
+
+	LeaderboardUsers int
+	Season           string
+	Archives         int
+	// Indexes 是快照中保存的二级索引名
+	Indexes []string
+
+	// Err 不为空表示文件损坏：Offset 是解析失败时读到的位置，GoodOffset 是最后一条完整记录结束的位置，
+	// 之前的内容都能正常解析
+	Err        error
+	Offset     int64
+	GoodOffset int64
+}
+
+// countingReader 记录已经从底层读出的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// InspectSnapshot 完整解析一个快照文件但不载入任何数据，统计各类型的键数并找出每种类型最大的 top 个键。
+// 文件无法打开时返回错误；文件损坏时返回的报告中 Err 不为空，统计的是损坏位置之前的内容
+func InspectSnapshot(path string, top int) (*SnapshotReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report := &SnapshotReport{}
+	if fi, err := f.Stat(); err == nil {
+		report.Size = fi.Size()
+	}
+
+	cr := &countingReader{r: f}
+	r := bufio.NewReaderSize(cr, 64*1024)
+	pos := func() int64 { return cr.n - int64(r.Buffered()) }
+	if header, err := r.Peek(len(snapshotMagic) + 1); err == nil {
+		report.Version = header[len(snapshotMagic)]
+	}
+	addKey := func(key string, e *store.Entry) {
+		if !e.ExpireAt.IsZero() {
+			report.WithTTL++
+		}
+		k := SnapshotKey{Key: key, Type: e.Type, Size: snapshotValueSize(e)}
+		if e.Type >= 0 && e.Type < store.TypeCount {
+			report.Keys[e.Type]++
+			report.Biggest[e.Type] = keepBiggest(report.Biggest[e.Type], k, top)
+		}
+		report.GoodOffset = pos()
+	}
+	_, report.Err = readSnapshot(r, true, snapshotVisitor{
+		entry: addKey,
+		expired: func(key string, e *store.Entry) {
+			report.Expired++
+			report.GoodOffset = pos()
+		},
+		score: func(leaderboard.Entry) {
+			report.LeaderboardUsers++
+			report.GoodOffset = pos()
+		},
+		season: func(name string) {
+			report.Season = name
+			report.GoodOffset = pos()
+		},
+		archive: func(*leaderboard.Archive) {
+			report.Archives++
+			report.GoodOffset = pos()
+		},
+		index: func(name string, args []string) {
+			report.Indexes = append(report.Indexes, name)
+			report.GoodOffset = pos()
+		},
+	})
+	if report.Err != nil {
+		report.Offset = pos()
+	}
+	return report, nil
+}
+
+// snapshotValueSize 返回值的大小：字符串为字节数，其他类型为元素个数
+func snapshotValueSize(e *store.Entry) int {
+	switch v := e.Value.(type) {
+	case string:
+		return len(v)
+	case *store.ListObject:
+		return v.Len()
+	case *store.SetObject:
+		return v.Len()
+	case *store.HashObject:
+		return v.Len()
+	case *store.CuckooObject:
+		return int(v.Items)
+	case *store.TimeSeriesObject:
+		return v.Len()
+	case *store.QueueObject:
+		return v.Len()
+	}
+	return 0
+}
+
+// keepBiggest 把 k 放入按大小降序排列的 keys 中，最多保留 top 个
+func keepBiggest(keys []SnapshotKey, k SnapshotKey, top int) []SnapshotKey {
+	if top <= 0 || (len(keys) == top && keys[top-1].Size >= k.Size) {
+		return keys
+	}
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Size < k.Size })
+	keys = append(keys, SnapshotKey{})
+	copy(keys[i+1:], keys[i:])
+	keys[i] = k
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	return keys
+}
@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/server"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// TestSnapshotCorruptValue 改动快照中布谷鸟过滤器编码的第一个字节（会让解码失败），
+// 检查载入和 inspect 都报告记录的校验和不符，而不是值的编码错误
+func TestSnapshotCorruptValue(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	c.do("SET", "before", "1")
+	c.do("CF.ADD", "cf", "item")
+	var buf bytes.Buffer
+	if err := srv.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 键 cf 之后是编码的长度（uvarint）和编码本身
+	i := bytes.Index(data, []byte("\x02cf"))
+	if i < 0 {
+		t.Fatal("key cf not found in the snapshot")
+	}
+	i += 3
+	_, n := binary.Uvarint(data[i:])
+	data[i+n] = 0
+
+	restored := server.New(server.Options{Logger: log.New(io.Discard, "", 0)})
+	err := restored.ReadSnapshot("corrupted", bytes.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("ReadSnapshot: err = %v, want a checksum mismatch", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "dump.reasy")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := server.InspectSnapshot(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Err == nil || !strings.Contains(report.Err.Error(), "checksum mismatch") {
+		t.Fatalf("InspectSnapshot: err = %v, want a checksum mismatch", report.Err)
+	}
+}
+
+// TestSnapshotCorruptLength 改动列表记录中的元素个数和记录本身的长度，检查前者报告为校验和不符，
+// 后者读到文件末尾就报错，两者都不会按被改动的数值循环或分配内存
+func TestSnapshotCorruptLength(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	c.do("RPUSH", "l", "a", "b", "c")
+	c.do("HSET", "h", "f", "v")
+	var buf bytes.Buffer
+	if err := srv.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	restored := server.New(server.Options{Logger: log.New(io.Discard, "", 0)})
+	if err := restored.ReadSnapshot("intact", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := restored.Store().Load("l"); !ok || e.Value.(*store.ListObject).Len() != 3 {
+		t.Fatal("list l was not restored")
+	}
+
+	// 记录是 操作码 | 长度 | 类型 | 过期时间(0) | 键 | 元素个数 | 元素...，这里的记录都不超过 127 字节，长度只占 1 个字节
+	i := bytes.Index(data, []byte("\x01l"))
+	if i < 0 {
+		t.Fatal("key l not found in the snapshot")
+	}
+	count := bytes.Clone(data)
+	count[i+2] = 0x7f
+	err := server.New(server.Options{Logger: log.New(io.Discard, "", 0)}).ReadSnapshot("count", bytes.NewReader(count))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("corrupt count: err = %v, want a checksum mismatch", err)
+	}
+
+	length := binary.AppendUvarint(bytes.Clone(data[:i-3]), 1<<62)
+	length = append(length, data[i-2:]...)
+	start := time.Now()
+	err = server.New(server.Options{Logger: log.New(io.Discard, "", 0)}).ReadSnapshot("length", bytes.NewReader(length))
+	if err == nil || !strings.Contains(err.Error(), "unexpected end of snapshot") {
+		t.Fatalf("corrupt length: err = %v, want unexpected end of snapshot", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("corrupt length took %v", d)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 实例状态。以下情况下命令不会排队等待或者悄悄变慢，而是立即返回错误，客户端可以据此退避重试或者换一个实例：
+//
+//	-LOADING     启动时正在载入快照，或者 Upgrade 正在把数据集交给新进程（见 upgrade.go），
+//	             只有带 CmdLoading 标志的命令（PING、INFO、CONFIG 等不访问数据集的命令）可以执行
+//	-BUSY        命令要访问的分片正被一个执行时间超过 busy-reply-threshold 毫秒的 FCALL 占用
+//	-OVERLOADED  命令要排入的分片 worker 队列中已经积压了 overload-queue-depth 条命令
+//
+// BUSY 只检查命令自己的键所在的分片：FCALL 在单个分片的 worker 上执行时，同一 worker 负责的其他分片上的命令
+// 也要等它结束，这时由 OVERLOADED 的队列深度检查兜底
+
+const (
+	errLoading    = "LOADING Redis is loading the dataset in memory"
+	errHandoff    = "LOADING dataset is being handed off to a new process, reconnect and retry"
+	errBusy       = "BUSY Redis is busy running a function on the keys of this command, try again later"
+	errOverloaded = "OVERLOADED command queue is too long, try again later"
+)
+
+// checkServerState 在执行命令之前检查实例的状态，命令不能执行时返回要回复的错误，否则返回空字符串
+func (srv *Server) checkServerState(request []string) string {
+	if loading, frozen := srv.loadingSnapshot.Load(), srv.handoff.frozen.Load(); loading || frozen {
+		// 未知命令交给 dispatchCommand 回复命令不存在
+		if spec, ok := commandTable[strings.ToUpper(request[0])]; ok && spec.flags&CmdLoading == 0 {
+			if frozen {
+				return errHandoff
+			}
+			return errLoading
+		}
+	}
+	keys := commandKeys(request)
+	if len(keys) == 0 {
+		return ""
+	}
+	cfg := config.Get()
+	shards := store.ShardsOf(keys)
+	if threshold := cfg.BusyReplyThreshold; threshold > 0 {
+		now := time.Now().UnixNano()
+		for _, i := range shards {
+			if since := srv.busyShards[i].Load(); since != 0 && now-since >= int64(threshold)*int64(time.Millisecond) {
+				srv.rejectedBusy.Add(1)
+				return errBusy
+			}
+		}
+	}
+	// 涉及多个分片的命令在连接所在的 goroutine 上执行，不经过 worker 队列
+	if depth := cfg.OverloadQueueDepth; depth > 0 && len(shards) == 1 && srv.store.QueueLen(shards[0]) >= depth {
+		srv.rejectedOverloaded.Add(1)
+		return errOverloaded
+	}
+	return ""
+}
+
+// markBusy 记录 FCALL 开始占用 keys 所在的分片，返回的函数在 FCALL 结束时调用。
+// 调用时已经持有这些分片的锁，同一分片上不会同时有两个 FCALL
+func (srv *Server) markBusy(keys []string) (done func()) {
+	shards := store.ShardsOf(keys)
+	start := time.Now().UnixNano()
+	for _, i := range shards {
+		srv.busyShards[i].Store(start)
+	}
+	return func() {
+		for _, i := range shards {
+			srv.busyShards[i].Store(0)
+		}
+	}
+}
+
+// Responsive 检查每个分片能否在 timeout 内执行命令（排在已经积压的命令之后），供进程管理器的看门狗判断实例是否卡死。
+// 上一次检查还没有结束时直接返回 false
+func (srv *Server) Responsive(timeout time.Duration) bool {
+	if !srv.probing.CompareAndSwap(false, true) {
+		return false
+	}
+	done := make(chan struct{})
+	go func() {
+		defer srv.probing.Store(false)
+		for i := 0; i < store.ShardCount; i++ {
+			srv.store.Run([]int{i}, func() {})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// THROTTLE 命令：THROTTLE key max_burst count period [quantity]，按 GCRA（通用信元速率算法）限流，
+// 允许每 period 秒 count 次、最多突发 max_burst + 1 次，一次消耗 quantity（默认 1）。回复与 redis-cell 的 CL.THROTTLE 相同：
+//
+//	[是否被限流(0/1), 上限(max_burst+1), 剩余次数, 多少秒后可以重试(未被限流时为 -1), 多少秒后完全恢复]
+//
+// 状态是理论到达时间（TAT，unix 纳秒），以字符串保存在 key 中，过期时间为完全恢复的时刻，
+// 一次调用完成判断和更新，多个网关实例共享同一个限流器时不需要额外的脚本或事务
+func (srv *Server) handleThrottle(w *resp.Writer, args []string) {
+	// 整数参数已由命令表检查
+	maxBurst, _ := strconv.ParseInt(args[2], 10, 64)
+	count, _ := strconv.ParseInt(args[3], 10, 64)
+	period, _ := strconv.ParseInt(args[4], 10, 64)
+	quantity := int64(1)
+	if len(args) == 6 {
+		quantity, _ = strconv.ParseInt(args[5], 10, 64)
+	}
+	switch {
+	case maxBurst < 0:
+		w.WriteString("-ERR max_burst must be non-negative\r\n")
+		return
+	case count <= 0 || period <= 0:
+		w.WriteString("-ERR count and period must be positive\r\n")
+		return
+	case quantity < 0:
+		w.WriteString("-ERR quantity must be non-negative\r\n")
+		return
+	case period > int64(24*365*time.Hour/time.Second):
+		w.WriteString("-ERR period is too large\r\n")
+		return
+	}
+
+	key := args[1]
+	now := time.Now()
+	entry, wrongType := srv.lookupTyped(key, store.StringType, false)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	tat := now
+	if entry != nil {
+		n, err := strconv.ParseInt(entry.Value.(string), 10, 64)
+		if err != nil {
+			w.WriteString("-ERR key does not hold a throttle state\r\n")
+			return
+		}
+		if t := time.Unix(0, n); t.After(now) {
+			tat = t
+		}
+	}
+
+	emission := time.Duration(period) * time.Second / time.Duration(count)
+	// 突发容量和一次消耗的时长都不能超过约 73 年，避免计算溢出
+	const maxSpan = time.Duration(math.MaxInt64 / 4)
+	if emission == 0 || maxBurst+1 > int64(maxSpan/emission) || quantity > int64(maxSpan/emission) {
+		w.WriteString("-ERR throttle parameters are out of range\r\n")
+		return
+	}
+	tolerance := emission * time.Duration(maxBurst+1)
+	newTAT := tat.Add(emission * time.Duration(quantity))
+	allowAt := newTAT.Add(-tolerance)
+
+	limited := now.Before(allowAt)
+	retryAfter := time.Duration(-1)
+	var ttl time.Duration
+	if limited {
+		// 一次消耗超过突发上限的请求永远不会被允许，不给出重试时间
+		if emission*time.Duration(quantity) <= tolerance {
+			retryAfter = allowAt.Sub(now)
+		}
+		ttl = tat.Sub(now)
+	} else {
+		ttl = newTAT.Sub(now)
+		if ttl > 0 {
+			srv.store.Put(key, &store.Entry{Type: store.StringType, Value: strconv.FormatInt(newTAT.UnixNano(), 10), ExpireAt: newTAT})
+		}
+	}
+	remaining := int64(0)
+	if next := tolerance - ttl; next > -emission {
+		remaining = int64(next / emission)
+	}
+
+	w.WriteArrayHeader(5)
+	if limited {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+	w.WriteInteger(int(maxBurst + 1))
+	w.WriteInteger(int(remaining))
+	if retryAfter < 0 {
+		w.WriteInteger(-1)
+	} else {
+		w.WriteInteger(int(ceilSeconds(retryAfter)))
+	}
+	w.WriteInteger(int(ceilSeconds(ttl)))
+}
+
+// ceilSeconds 把时长向上取整为秒，客户端按回复的秒数等待之后一定可以重试
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
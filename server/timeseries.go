@@ -0,0 +1,453 @@
+package server
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 时间序列命令，命令名和回复与 RedisTimeSeries 的 TS.* 相同，用于在缓存旁边保存少量监控指标：
+//
+//	TS.CREATE key [RETENTION ms] [LABELS label value ...]
+//	TS.ADD key timestamp|* value [RETENTION ms] [LABELS label value ...]   键不存在时按选项创建
+//	TS.GET key / TS.INFO key
+//	TS.RANGE key from|- to|+ [COUNT n] [AGGREGATION avg|sum|min|max|count|first|last|range bucket]
+//	TS.MRANGE from to [COUNT n] [AGGREGATION ...] [WITHLABELS] FILTER label=value ...
+//	TS.CREATERULE src dest AGGREGATION agg bucket / TS.DELETERULE src dest
+//
+// 降采样规则的目标键由源序列中保存的规则决定，TS.ADD 通过命令表的 extraKeys 同时锁住这些键，
+// 结束的桶聚合出的采样点与源序列的写入是原子的。目标序列不能再作为源序列（不支持链式规则）。
+// 源序列被删除后目标序列仍然记着源键，需要用 TS.DELETERULE 解除后才能作为其他规则的目标
+
+const (
+	errTSNoKey      = "ERR TSDB: the key does not exist"
+	errTSTimestamp  = "ERR TSDB: invalid timestamp"
+	errTSValue      = "ERR TSDB: invalid value"
+	errTSRetention  = "ERR TSDB: Couldn't parse RETENTION"
+	errTSBucket     = "ERR TSDB: bucketDuration must be greater than zero"
+	errTSAggregator = "ERR TSDB: Unknown aggregation type"
+)
+
+// tsCreateOptions 解析 TS.CREATE / TS.ADD 的 RETENTION 和 LABELS 选项，LABELS 之后的参数都是标签，出错时返回错误信息
+func tsCreateOptions(args []string) (retention int64, labels []string, errMsg string) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "RETENTION":
+			if i+1 >= len(args) {
+				return 0, nil, errTSRetention
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return 0, nil, errTSRetention
+			}
+			retention = n
+			i++
+		case "LABELS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return 0, nil, "ERR TSDB: Couldn't parse LABELS"
+			}
+			return retention, append([]string(nil), rest...), ""
+		default:
+			return 0, nil, errSyntax
+		}
+	}
+	return retention, nil, ""
+}
+
+// tsRangeOptions 是 TS.RANGE / TS.MRANGE 的选项
+type tsRangeOptions struct {
+	from, to   int64
+	count      int
+	agg        string
+	bucket     int64
+	withLabels bool
+	filters    []tsFilter
+}
+
+// tsFilter 是 TS.MRANGE 的一个标签条件：label=value、label!=value，值为空时表示没有（或者有）这个标签
+type tsFilter struct {
+	label, value string
+	not          bool
+}
+
+func (f tsFilter) match(ts *store.TimeSeriesObject) bool {
+	v, ok := ts.Label(f.label)
+	if f.value == "" {
+		return ok == f.not
+	}
+	return (ok && v == f.value) != f.not
+}
+
+// parseTSRangeOptions 解析 from、to 以及其后的选项，multi 为 true 时允许 WITHLABELS 和 FILTER（TS.MRANGE）
+func parseTSRangeOptions(args []string, multi bool) (opts tsRangeOptions, errMsg string) {
+	var ok bool
+	if opts.from, ok = parseTSBound(args[0], math.MinInt64); !ok {
+		return opts, "ERR TSDB: wrong fromTimestamp"
+	}
+	if opts.to, ok = parseTSBound(args[1], math.MaxInt64); !ok {
+		return opts, "ERR TSDB: wrong toTimestamp"
+	}
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return opts, "ERR TSDB: Couldn't parse COUNT"
+			}
+			opts.count = n
+			i++
+		case opt == "AGGREGATION" && i+2 < len(args):
+			opts.agg = strings.ToLower(args[i+1])
+			if !slices.Contains(store.TSAggregations, opts.agg) {
+				return opts, errTSAggregator
+			}
+			n, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil || n <= 0 {
+				return opts, errTSBucket
+			}
+			opts.bucket = n
+			i += 2
+		case opt == "WITHLABELS" && multi:
+			opts.withLabels = true
+		case opt == "FILTER" && multi:
+			for _, expr := range args[i+1:] {
+				label, value, found := strings.Cut(expr, "=")
+				if !found || label == "" {
+					return opts, "ERR TSDB: failed parsing labels"
+				}
+				f := tsFilter{label: label, value: value}
+				if strings.HasSuffix(label, "!") {
+					f.label, f.not = strings.TrimSuffix(label, "!"), true
+				}
+				opts.filters = append(opts.filters, f)
+			}
+			i = len(args)
+		default:
+			return opts, errSyntax
+		}
+	}
+	return opts, ""
+}
+
+// parseTSBound 解析时间戳，- 和 + 表示最早和最新，分别返回 unbounded
+func parseTSBound(s string, unbounded int64) (int64, bool) {
+	if (s == "-" && unbounded < 0) || (s == "+" && unbounded > 0) {
+		return unbounded, true
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// writeTSSample 写出一个采样点 [timestamp, value]
+func writeTSSample(w *resp.Writer, s store.TSSample) {
+	w.WriteArrayHeader(2)
+	w.WriteInteger(int(s.Time))
+	w.WriteBulk(strconv.FormatFloat(s.Value, 'f', -1, 64))
+}
+
+func writeTSSamples(w *resp.Writer, samples []store.TSSample) {
+	w.WriteArrayHeader(len(samples))
+	for _, s := range samples {
+		writeTSSample(w, s)
+	}
+}
+
+// writeTSLabels 写出标签 [[label, value] ...]
+func writeTSLabels(w *resp.Writer, labels []string) {
+	w.WriteArrayHeader(len(labels) / 2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		w.WriteArrayHeader(2)
+		w.WriteBulk(labels[i])
+		w.WriteBulk(labels[i+1])
+	}
+}
+
+// TS.CREATE 命令：TS.CREATE key [RETENTION ms] [LABELS label value ...]，创建一个空的时间序列，键已存在时返回错误
+func (srv *Server) handleTSCreate(w *resp.Writer, args []string) {
+	retention, labels, errMsg := tsCreateOptions(args[2:])
+	if errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if entry, ok := srv.store.Load(args[1]); ok {
+		if !entry.IsExpired() {
+			w.WriteString("-ERR TSDB: key already exists\r\n")
+			return
+		}
+		srv.store.Delete(args[1])
+	}
+	srv.store.Put(args[1], &store.Entry{Type: store.TimeSeriesType, Value: store.NewTimeSeriesObject(retention, labels)})
+	w.WriteString("+OK\r\n")
+}
+
+// TS.ADD 命令：TS.ADD key timestamp|* value [RETENTION ms] [LABELS label value ...]，写入一个采样点并返回它的时间戳，
+// * 表示当前时间。键不存在时按选项创建时间序列，已存在时忽略选项。写入使源序列的桶结束时，聚合出的采样点写入规则的目标序列
+func (srv *Server) handleTSAdd(w *resp.Writer, args []string) {
+	key := args[1]
+	var t int64
+	if args[2] == "*" {
+		t = time.Now().UnixMilli()
+	} else {
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || n < 0 {
+			w.WriteError(errTSTimestamp)
+			return
+		}
+		t = n
+	}
+	v, err := strconv.ParseFloat(args[3], 64)
+	if err != nil || math.IsNaN(v) {
+		w.WriteError(errTSValue)
+		return
+	}
+	retention, labels, errMsg := tsCreateOptions(args[4:])
+	if errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+
+	entry, wrongType := srv.lookupTyped(key, store.TimeSeriesType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	created := entry == nil
+	if created {
+		entry = &store.Entry{Type: store.TimeSeriesType, Value: store.NewTimeSeriesObject(retention, labels)}
+	}
+	ts := entry.Value.(*store.TimeSeriesObject)
+	closed, err := ts.Add(t, v)
+	if err != nil {
+		w.WriteError("ERR " + err.Error())
+		return
+	}
+	srv.store.PutOrUpdate(key, entry, !created)
+	for i, s := range closed {
+		if s == nil {
+			continue
+		}
+		// 目标序列被删除或者改成了其他类型时跳过，其中已有的同一时间戳（例如手动写入的）保持不变
+		dest := ts.Rules[i].Dest
+		if destEntry, _ := srv.lookupTyped(dest, store.TimeSeriesType, true); destEntry != nil {
+			if _, err := destEntry.Value.(*store.TimeSeriesObject).Add(s.Time, s.Value); err == nil {
+				srv.store.Updated(dest)
+			}
+		}
+	}
+	w.WriteInteger(int(t))
+}
+
+// tsAddExtraKeys 返回 TS.ADD 写入时可能访问的降采样目标键
+func tsAddExtraKeys(srv *Server, request []string) []string {
+	entry, ok := srv.store.Load(request[1])
+	if !ok || entry.Type != store.TimeSeriesType {
+		return nil
+	}
+	var dests []string
+	for _, r := range entry.Value.(*store.TimeSeriesObject).Rules {
+		dests = append(dests, r.Dest)
+	}
+	return dests
+}
+
+// lookupTimeSeries 返回 key 上的时间序列，键不存在或类型不对时回复错误并返回 nil
+func (srv *Server) lookupTimeSeries(w *resp.Writer, key string, forWrite bool) *store.TimeSeriesObject {
+	entry, wrongType := srv.lookupTyped(key, store.TimeSeriesType, forWrite)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return nil
+	}
+	if entry == nil {
+		w.WriteError(errTSNoKey)
+		return nil
+	}
+	return entry.Value.(*store.TimeSeriesObject)
+}
+
+// TS.GET 命令：TS.GET key，返回最新的采样点，序列为空时返回空数组
+func (srv *Server) handleTSGet(w *resp.Writer, args []string) {
+	ts := srv.lookupTimeSeries(w, args[1], false)
+	if ts == nil {
+		return
+	}
+	s, ok := ts.Last()
+	if !ok {
+		w.WriteArrayHeader(0)
+		return
+	}
+	writeTSSample(w, s)
+}
+
+// TS.INFO 命令：TS.INFO key，返回采样点个数、最早和最新的时间戳、保留时间、标签、源键和降采样规则，名称和值交替排列
+func (srv *Server) handleTSInfo(w *resp.Writer, args []string) {
+	ts := srv.lookupTimeSeries(w, args[1], false)
+	if ts == nil {
+		return
+	}
+	first, _ := ts.First()
+	last, _ := ts.Last()
+	w.WriteArrayHeader(14)
+	w.WriteBulk("totalSamples")
+	w.WriteInteger(ts.Len())
+	w.WriteBulk("firstTimestamp")
+	w.WriteInteger(int(first.Time))
+	w.WriteBulk("lastTimestamp")
+	w.WriteInteger(int(last.Time))
+	w.WriteBulk("retentionTime")
+	w.WriteInteger(int(ts.Retention))
+	w.WriteBulk("labels")
+	writeTSLabels(w, ts.Labels)
+	w.WriteBulk("sourceKey")
+	if ts.Source == "" {
+		w.WriteString("$-1\r\n")
+	} else {
+		w.WriteBulk(ts.Source)
+	}
+	w.WriteBulk("rules")
+	w.WriteArrayHeader(len(ts.Rules))
+	for _, r := range ts.Rules {
+		w.WriteArrayHeader(3)
+		w.WriteBulk(r.Dest)
+		w.WriteInteger(int(r.Bucket))
+		w.WriteBulk(r.Agg)
+	}
+}
+
+// TS.RANGE 命令：TS.RANGE key from to [COUNT n] [AGGREGATION agg bucket]，返回时间范围内（包括两端）的采样点，
+// 指定 AGGREGATION 时每 bucket 毫秒聚合为一个采样点
+func (srv *Server) handleTSRange(w *resp.Writer, args []string) {
+	opts, errMsg := parseTSRangeOptions(args[2:], false)
+	if errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	ts := srv.lookupTimeSeries(w, args[1], false)
+	if ts == nil {
+		return
+	}
+	writeTSSamples(w, ts.Range(opts.from, opts.to, opts.agg, opts.bucket, opts.count))
+}
+
+// TS.MRANGE 命令：TS.MRANGE from to [COUNT n] [AGGREGATION agg bucket] [WITHLABELS] FILTER label=value ...，
+// 对标签满足所有条件的每个时间序列执行 TS.RANGE，按键名排序返回 [key, labels, samples]，
+// 不指定 WITHLABELS 时 labels 为空数组。条件中至少要有一个 label=value。
+// 命令不声明键，逐个分片扫描键空间，结果不是所有序列在同一时刻的快照
+func (srv *Server) handleTSMRange(w *resp.Writer, args []string) {
+	opts, errMsg := parseTSRangeOptions(args[1:], true)
+	if errMsg != "" {
+		w.WriteError(errMsg)
+		return
+	}
+	if !slices.ContainsFunc(opts.filters, func(f tsFilter) bool { return !f.not && f.value != "" }) {
+		w.WriteError("ERR TSDB: please provide at least one matcher")
+		return
+	}
+	type series struct {
+		key     string
+		labels  []string
+		samples []store.TSSample
+	}
+	var result []series
+	for i := 0; i < store.ShardCount; i++ {
+		srv.store.ScanShard(i, func(key string, entry *store.Entry) {
+			ts, ok := entry.Value.(*store.TimeSeriesObject)
+			if !ok {
+				return
+			}
+			for _, f := range opts.filters {
+				if !f.match(ts) {
+					return
+				}
+			}
+			s := series{key: key, samples: ts.Range(opts.from, opts.to, opts.agg, opts.bucket, opts.count)}
+			if opts.withLabels {
+				s.labels = append([]string(nil), ts.Labels...)
+			}
+			result = append(result, s)
+		})
+	}
+	slices.SortFunc(result, func(a, b series) int { return strings.Compare(a.key, b.key) })
+	w.WriteArrayHeader(len(result))
+	for _, s := range result {
+		w.WriteArrayHeader(3)
+		w.WriteBulk(s.key)
+		writeTSLabels(w, s.labels)
+		writeTSSamples(w, s.samples)
+	}
+}
+
+// TS.CREATERULE 命令：TS.CREATERULE src dest AGGREGATION agg bucket，把 src 之后写入的采样点按 bucket 毫秒聚合后写入 dest。
+// 两个键都必须是已存在的时间序列
+func (srv *Server) handleTSCreateRule(w *resp.Writer, args []string) {
+	if !strings.EqualFold(args[3], "AGGREGATION") {
+		w.WriteError(errSyntax)
+		return
+	}
+	agg := strings.ToLower(args[4])
+	if !slices.Contains(store.TSAggregations, agg) {
+		w.WriteError(errTSAggregator)
+		return
+	}
+	bucket, _ := strconv.ParseInt(args[5], 10, 64)
+	if bucket <= 0 {
+		w.WriteError(errTSBucket)
+		return
+	}
+	if args[1] == args[2] {
+		w.WriteString("-ERR TSDB: the source key and destination key should be different\r\n")
+		return
+	}
+	src := srv.lookupTimeSeries(w, args[1], true)
+	if src == nil {
+		return
+	}
+	dest := srv.lookupTimeSeries(w, args[2], true)
+	if dest == nil {
+		return
+	}
+	if dest.Source != "" {
+		w.WriteString("-ERR TSDB: the destination key already has a src rule\r\n")
+		return
+	}
+	if src.Source != "" || len(dest.Rules) > 0 {
+		w.WriteString("-ERR TSDB: chained compaction rules are not supported\r\n")
+		return
+	}
+	src.AddRule(args[2], agg, bucket)
+	dest.Source = args[1]
+	srv.store.Updated(args[1])
+	srv.store.Updated(args[2])
+	w.WriteString("+OK\r\n")
+}
+
+// TS.DELETERULE 命令：TS.DELETERULE src dest，删除 src 到 dest 的降采样规则。src 已被删除时只解除 dest 与它的关联
+func (srv *Server) handleTSDeleteRule(w *resp.Writer, args []string) {
+	srcEntry, wrongType := srv.lookupTyped(args[1], store.TimeSeriesType, true)
+	if wrongType {
+		w.WriteError(errWrongType)
+		return
+	}
+	deleted := false
+	if srcEntry != nil && srcEntry.Value.(*store.TimeSeriesObject).DeleteRule(args[2]) {
+		srv.store.Updated(args[1])
+		deleted = true
+	}
+	if destEntry, _ := srv.lookupTyped(args[2], store.TimeSeriesType, true); destEntry != nil {
+		if dest := destEntry.Value.(*store.TimeSeriesObject); dest.Source == args[1] && (deleted || srcEntry == nil) {
+			dest.Source = ""
+			srv.store.Updated(args[2])
+			deleted = true
+		}
+	}
+	if !deleted {
+		w.WriteString("-ERR TSDB: compaction rule does not exist\r\n")
+		return
+	}
+	w.WriteString("+OK\r\n")
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/resp"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// TestCollectionWritesKeepTTL 检查 LPUSH、RPUSH、SADD、HSET 原地修改已有的键时保留原来的过期时间，
+// 键已经过期时则按不存在处理，新建的键没有过期时间
+func TestCollectionWritesKeepTTL(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	tests := []struct {
+		name           string
+		key            string
+		create, update []string
+	}{
+		{"LPUSH", "list:l", []string{"LPUSH", "list:l", "a"}, []string{"LPUSH", "list:l", "b"}},
+		{"RPUSH", "list:r", []string{"RPUSH", "list:r", "a"}, []string{"RPUSH", "list:r", "b"}},
+		{"SADD", "set", []string{"SADD", "set", "a"}, []string{"SADD", "set", "b"}},
+		{"HSET", "hash", []string{"HSET", "hash", "f", "1"}, []string{"HSET", "hash", "g", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.do(tt.create...)
+			if !srv.Store().Expire(tt.key, time.Hour) {
+				t.Fatalf("key %s was not created", tt.key)
+			}
+			before, _ := srv.Store().TTL(tt.key)
+			if got := c.do(tt.update...); got != int64(2) && got != int64(1) {
+				t.Fatalf("%s = %v", tt.name, got)
+			}
+			after, ok := srv.Store().TTL(tt.key)
+			if !ok || after == store.NoExpire || after > before || before-after > time.Second {
+				t.Fatalf("PTTL after %s = %v, want about %v", tt.name, after, before)
+			}
+
+			// 过期的键按不存在处理：新建一个只有本次写入内容、没有过期时间的键
+			srv.Store().Expire(tt.key, time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+			if got := c.do(tt.update...); got != int64(1) {
+				t.Fatalf("%s on an expired key = %v, want 1", tt.name, got)
+			}
+			if ttl, ok := srv.Store().TTL(tt.key); !ok || ttl != store.NoExpire {
+				t.Fatalf("PTTL after %s on an expired key = %v (exists %v), want no expiry", tt.name, ttl, ok)
+			}
+		})
+	}
+}
+
+// TestSetExpireOverflow 检查 SET 的 EX/PX 换算后溢出或者加上当前时间后溢出时与 Redis 一样返回错误，而不是悄悄丢掉过期时间
+func TestSetExpireOverflow(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	for _, args := range [][]string{
+		{"EX", "9223372036854775807"},
+		{"PX", "9223372036854775807"},
+		{"EX", "9223372036"},
+		{"PX", "9223372036854"},
+	} {
+		want := resp.Error("ERR invalid expire time in 'set' command")
+		if got := c.do("SET", "k", "v", args[0], args[1]); got != want {
+			t.Fatalf("SET k v %s %s = %v, want %v", args[0], args[1], got, want)
+		}
+	}
+	if _, ok := srv.Store().TTL("k"); ok {
+		t.Fatal("SET with an invalid expire time created the key")
+	}
+	if got := c.do("SET", "k", "v", "EX", "100"); got != resp.Status("OK") {
+		t.Fatalf("SET k v EX 100 = %v", got)
+	}
+	if ttl, ok := srv.Store().TTL("k"); !ok || ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Fatalf("PTTL after SET EX 100 = %v", ttl)
+	}
+}
+
+// TestCASExpireOverflow 检查 CAS 的 EX/PX 溢出时返回错误并且不修改键
+func TestCASExpireOverflow(t *testing.T) {
+	srv := startServer(t, "goroutine")
+	c := dial(t, srv.Addr())
+	c.do("SET", "k", "old")
+	want := resp.Error("ERR invalid expire time in 'cas' command")
+	for _, unit := range []string{"EX", "PX"} {
+		if got := c.do("CAS", "k", "old", "new", unit, "9223372036854775807"); got != want {
+			t.Fatalf("CAS k old new %s 9223372036854775807 = %v, want %v", unit, got, want)
+		}
+	}
+	if got := c.do("GET", "k"); got != "old" {
+		t.Fatalf("GET k = %v, want old", got)
+	}
+	if got := c.do("CAS", "k", "old", "new", "PX", "100000"); got != int64(1) {
+		t.Fatalf("CAS k old new PX 100000 = %v", got)
+	}
+	if ttl, ok := srv.Store().TTL("k"); !ok || ttl <= 99*time.Second || ttl > 100*time.Second {
+		t.Fatalf("PTTL after CAS PX 100000 = %v", ttl)
+	}
+}
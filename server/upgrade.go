@@ -0,0 +1,233 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 不停机升级：用磁盘上新的可执行文件替换正在运行的实例，监听端口一直可以连接，内存中的数据集不丢失。
+// cmd/redis-easy 收到 SIGUSR2 时调用 Upgrade：
+//
+//  1. 以相同的命令行参数启动新进程，监听 socket 的副本作为 fd 3、4、... 传给新进程，
+//     另外附带通知启动完成的管道，设置了 Options.Persistence 时再附带发送数据集的管道，都通过环境变量告诉新进程
+//  2. 新进程直接在继承的 socket 上开始接受连接，然后从管道读入数据集，读完之前访问数据集的命令返回 -LOADING
+//  3. 本进程暂停接受新连接并按 shutdown-drain-timeout 排空现有连接（见 drain.go），然后冻结数据集：
+//     等待进行中的后台写入（定时任务、赛季轮换、自动保存、HTTP 的写请求）结束，此后它们和网关、定时任务发出的命令
+//     都被拒绝（命令返回 -LOADING，HTTP 写请求返回 503），再把数据集以快照格式写入管道
+//  4. 新进程载入数据集后通知本进程，本进程 Stop 后退出，不再保存快照，之后由新进程负责持久化
+//
+// 已经建立的连接不能迁移，排空时处理完已收到的命令后关闭，客户端重连到新进程。
+// 新进程在通知启动完成之前退出时（例如新版本不认识快照格式），本进程解除冻结、恢复接受新连接，继续提供服务
+
+const (
+	// envUpgradeListenFDs 是新进程继承的监听 socket 个数，从 fd 3 开始
+	envUpgradeListenFDs = "REDIS_EASY_UPGRADE_LISTEN_FDS"
+	// envUpgradeSnapshotFD 是新进程读取数据集的管道 fd
+	envUpgradeSnapshotFD = "REDIS_EASY_UPGRADE_SNAPSHOT_FD"
+	// envUpgradeReadyFD 是新进程载入数据集后写入一个字节通知启动完成的管道 fd
+	envUpgradeReadyFD = "REDIS_EASY_UPGRADE_READY_FD"
+)
+
+// inheritedFiles 是上一个进程交接过来的文件
+type inheritedFiles struct {
+	listeners []*os.File
+	snapshot  *os.File // 为 nil 时照常从 dir/dbfilename 载入快照
+	ready     *os.File
+}
+
+var takeInheritedOnce sync.Once
+
+// takeInheritedFiles 返回上一个进程交接过来的文件，不是由 Upgrade 启动的进程返回零值。
+// 只有进程中第一个调用的实例拿到它们，环境变量随即清除，不会再传给之后的子进程
+func takeInheritedFiles() (inherited inheritedFiles) {
+	takeInheritedOnce.Do(func() {
+		if n, err := strconv.Atoi(os.Getenv(envUpgradeListenFDs)); err == nil && n > 0 {
+			for i := 0; i < n; i++ {
+				inherited.listeners = append(inherited.listeners, os.NewFile(uintptr(3+i), "listener"))
+			}
+		}
+		if fd, err := strconv.Atoi(os.Getenv(envUpgradeSnapshotFD)); err == nil && fd >= 3 {
+			inherited.snapshot = os.NewFile(uintptr(fd), "upgrade pipe")
+		}
+		if fd, err := strconv.Atoi(os.Getenv(envUpgradeReadyFD)); err == nil && fd >= 3 {
+			inherited.ready = os.NewFile(uintptr(fd), "upgrade ready pipe")
+		}
+		os.Unsetenv(envUpgradeListenFDs)
+		os.Unsetenv(envUpgradeSnapshotFD)
+		os.Unsetenv(envUpgradeReadyFD)
+	})
+	return inherited
+}
+
+// notifyReady 通知上一个进程本进程已经启动完成
+func (in inheritedFiles) notifyReady() {
+	if in.ready != nil {
+		in.ready.Write([]byte{1})
+		in.ready.Close()
+	}
+}
+
+// listenFiles 返回所有监听 socket 的副本，用于传给新进程
+func (srv *Server) listenFiles() ([]*os.File, error) {
+	var files []*os.File
+	fail := func(err error) ([]*os.File, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	for _, l := range srv.listeners {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fail(fmt.Errorf("listener %s cannot be handed off", l.Addr()))
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fail(err)
+		}
+		files = append(files, f)
+	}
+	for _, fd := range srv.listenFDs {
+		f, err := dupListenFD(fd)
+		if err != nil {
+			return fail(err)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no listening sockets to hand off")
+	}
+	return files, nil
+}
+
+// beginBackgroundWrite 在不经过客户端连接修改数据集（后台任务、HTTP 写请求）之前调用，数据集已经冻结时返回 false；
+// 返回 true 时修改结束后要调用 endBackgroundWrite
+func (srv *Server) beginBackgroundWrite() bool {
+	srv.handoff.mu.RLock()
+	if srv.handoff.frozen.Load() {
+		srv.handoff.mu.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (srv *Server) endBackgroundWrite() {
+	srv.handoff.mu.RUnlock()
+}
+
+// freeze 冻结数据集，返回时进行中的后台写入都已经结束；unfreeze 解除冻结
+func (srv *Server) freeze() {
+	srv.handoff.mu.Lock()
+	srv.handoff.frozen.Store(true)
+	srv.handoff.mu.Unlock()
+}
+
+func (srv *Server) unfreeze() {
+	srv.handoff.frozen.Store(false)
+}
+
+// Upgrade 启动新的进程接替本实例，成功返回后调用方应 Stop 实例并退出进程。
+// beforeHandoff 在本进程排空连接之后、发送数据集之前调用，调用方在这里释放新进程启动后需要绑定的其他资源（例如 HTTP 端口）；
+// 返回错误时本实例已经恢复接受新连接，但 beforeHandoff 释放的资源需要调用方自己恢复
+func (srv *Server) Upgrade(beforeHandoff func()) error {
+	if !srv.upgrading.CompareAndSwap(false, true) {
+		return errors.New("upgrade already in progress")
+	}
+	defer srv.upgrading.Store(false)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	files, err := srv.listenFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), envUpgradeListenFDs+"="+strconv.Itoa(len(files)))
+	var pipes []*os.File
+	defer func() {
+		for _, f := range pipes {
+			f.Close()
+		}
+	}()
+	// addPipe 创建一个管道，一端传给新进程，返回本进程的一端；childReads 表示新进程读取管道
+	addPipe := func(env string, childReads bool) (*os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		pipes = append(pipes, r, w)
+		child, own := w, r
+		if childReads {
+			child, own = r, w
+		}
+		cmd.Env = append(cmd.Env, env+"="+strconv.Itoa(3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, child)
+		return own, nil
+	}
+	ready, err := addPipe(envUpgradeReadyFD, false)
+	if err != nil {
+		return err
+	}
+	var snapshot *os.File
+	if srv.opts.Persistence {
+		if snapshot, err = addPipe(envUpgradeSnapshotFD, true); err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// 关闭传给新进程的一端，新进程退出时本进程读到文件结尾或者写入出错
+	for _, f := range cmd.ExtraFiles[len(files):] {
+		f.Close()
+	}
+	srv.logger.Printf("Started new process %d, handing off %d listening sockets\n", cmd.Process.Pid, len(files))
+	go cmd.Wait()
+	abort := func(err error) error {
+		srv.unfreeze()
+		srv.cancelDrain()
+		srv.logger.Println("Upgrade aborted, accepting new connections again:", err)
+		return err
+	}
+
+	<-srv.startDrain(time.Duration(config.Get().ShutdownDrainTimeout) * time.Millisecond)
+	// 发送数据集之后的写入不会出现在新进程中，成功交接后不再解除冻结
+	srv.freeze()
+	if beforeHandoff != nil {
+		beforeHandoff()
+	}
+	if snapshot != nil {
+		start := time.Now()
+		if err := srv.writeSnapshot(snapshot); err != nil {
+			return abort(fmt.Errorf("sending dataset to new process: %v", err))
+		}
+		// 关闭写端，新进程读到文件结尾
+		if err := snapshot.Close(); err != nil {
+			return abort(err)
+		}
+		srv.logger.Printf("Dataset sent to new process (%v)\n", time.Since(start))
+	}
+	if _, err := io.ReadFull(ready, make([]byte, 1)); err != nil {
+		return abort(errors.New("new process exited before it was ready"))
+	}
+	srv.handedOff.Store(true)
+	srv.logger.Println("Upgrade handed off to new process")
+	return nil
+}
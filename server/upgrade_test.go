@@ -0,0 +1,58 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// TestFreezeRejectsWrites 检查数据集冻结期间网关、HTTP 写请求和定时任务都不会修改数据集，解除冻结后恢复
+func TestFreezeRejectsWrites(t *testing.T) {
+	if err := config.Load([]string{"--io-backend", "goroutine", "--http-gateway", "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.Load([]string{"--http-gateway", "no"}) })
+	srv := New(Options{Logger: log.New(io.Discard, "", 0)})
+	handler := srv.HTTPHandler()
+	put := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/v1/keys/k", strings.NewReader(`{"value":"v"}`)))
+		return rec.Code
+	}
+	job := &scheduledJob{id: "job", args: []string{"SET", "j", "v"}}
+
+	srv.freeze()
+	if code := put(); code != http.StatusServiceUnavailable {
+		t.Fatalf("PUT while frozen = %d, want 503", code)
+	}
+	if msg := srv.checkServerState([]string{"SET", "k", "v"}); msg != errHandoff {
+		t.Fatalf("SET while frozen = %q, want %q", msg, errHandoff)
+	}
+	if msg := srv.checkServerState([]string{"PING"}); msg != "" {
+		t.Fatalf("PING while frozen = %q", msg)
+	}
+	srv.runScheduledJob(job)
+	if job.lastResult != errHandoff {
+		t.Fatalf("scheduled job while frozen: result = %q", job.lastResult)
+	}
+	for _, key := range []string{"k", "j"} {
+		if _, ok := srv.store.Load(key); ok {
+			t.Fatalf("key %s was written while frozen", key)
+		}
+	}
+
+	srv.unfreeze()
+	if code := put(); code != http.StatusOK {
+		t.Fatalf("PUT after unfreeze = %d, want 200", code)
+	}
+	srv.runScheduledJob(job)
+	if e, ok := srv.store.Load("j"); !ok || e.Type != store.StringType {
+		t.Fatalf("scheduled job after unfreeze did not run: %q", job.lastResult)
+	}
+}
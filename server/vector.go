@@ -0,0 +1,378 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 向量字段和 KNN 查询，语法与 RediSearch 相同：
+//
+//	FT.CREATE idx SCHEMA embedding VECTOR FLAT|HNSW nargs TYPE FLOAT32 DIM n DISTANCE_METRIC L2|IP|COSINE [M m] [EF_CONSTRUCTION n] [EF_RUNTIME n]
+//	FT.SEARCH idx "(*|条件)=>[KNN k @embedding $blob [AS score]]" PARAMS 2 blob <向量>
+//
+// 哈希字段中的向量是 DIM 个小端序 float32 的原始字节，长度不对的值不会被索引。
+// 距离越小越相似：L2 为欧氏距离的平方，IP 为 1 - 内积，COSINE 为 1 - 余弦相似度。
+// FLAT 逐个计算距离，结果是精确的；HNSW 在多层近邻图上搜索，结果是近似的。
+// 带有过滤条件的 KNN 查询先按条件筛选，再在筛选出的键中精确计算，不经过 HNSW 图
+
+// 向量距离
+const (
+	vectorL2 = iota
+	vectorIP
+	vectorCosine
+)
+
+var vectorMetricNames = []string{"L2", "IP", "COSINE"}
+
+// vectorParams 是向量字段的参数
+type vectorParams struct {
+	hnsw           bool
+	dim            int
+	metric         int
+	m              int
+	efConstruction int
+	efRuntime      int
+}
+
+const (
+	hnswDefaultM              = 16
+	hnswDefaultEFConstruction = 200
+	hnswDefaultEFRuntime      = 10
+	// vectorMaxDim 限制向量的维数
+	vectorMaxDim = 32768
+)
+
+// parseVectorParams 解析 VECTOR 之后的算法和属性，返回参数以及用掉的参数个数
+func parseVectorParams(field string, args []string) (*vectorParams, int, error) {
+	if len(args) < 2 {
+		return nil, 0, fmt.Errorf("Bad arguments for vector similarity algorithm of field `%s`", field)
+	}
+	p := &vectorParams{m: hnswDefaultM, efConstruction: hnswDefaultEFConstruction, efRuntime: hnswDefaultEFRuntime, metric: -1}
+	switch strings.ToUpper(args[0]) {
+	case "FLAT":
+	case "HNSW":
+		p.hnsw = true
+	default:
+		return nil, 0, fmt.Errorf("Bad arguments for vector similarity algorithm of field `%s`", field)
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 || n%2 != 0 || 2+n > len(args) {
+		return nil, 0, fmt.Errorf("Bad number of arguments for vector similarity index of field `%s`", field)
+	}
+	for i := 2; i < 2+n; i += 2 {
+		name, value := strings.ToUpper(args[i]), args[i+1]
+		var target *int
+		switch name {
+		case "TYPE":
+			if !strings.EqualFold(value, "FLOAT32") {
+				return nil, 0, fmt.Errorf("Only FLOAT32 vectors are supported, got %s", value)
+			}
+			continue
+		case "DISTANCE_METRIC":
+			if p.metric = slices.Index(vectorMetricNames, strings.ToUpper(value)); p.metric < 0 {
+				return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: %s", name, value)
+			}
+			continue
+		case "DIM":
+			target = &p.dim
+		case "M":
+			target = &p.m
+		case "EF_CONSTRUCTION":
+			target = &p.efConstruction
+		case "EF_RUNTIME":
+			target = &p.efRuntime
+		case "INITIAL_CAP", "BLOCK_SIZE", "EPSILON":
+			// 预分配等调优参数，没有作用
+			continue
+		default:
+			return nil, 0, fmt.Errorf("Bad arguments for vector similarity index: unknown argument %s", args[i])
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 {
+			return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: %s", name, value)
+		}
+		*target = v
+	}
+	if p.dim == 0 || p.dim > vectorMaxDim {
+		return nil, 0, fmt.Errorf("Bad or missing DIM for vector field `%s`", field)
+	}
+	if p.metric < 0 {
+		return nil, 0, fmt.Errorf("Missing DISTANCE_METRIC for vector field `%s`", field)
+	}
+	return p, 2 + n, nil
+}
+
+// decodeVector 把小端序 float32 的原始字节解码为向量，长度不对时返回 nil
+func decodeVector(s string, dim int) []float32 {
+	if len(s) != dim*4 {
+		return nil
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(s[i*4 : i*4+4])))
+	}
+	return vec
+}
+
+// vectorDistance 返回两个向量的距离
+func vectorDistance(metric int, a, b []float32) float64 {
+	var dot, na, nb, l2 float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		switch metric {
+		case vectorL2:
+			l2 += (x - y) * (x - y)
+		default:
+			dot += x * y
+			na += x * x
+			nb += y * y
+		}
+	}
+	switch metric {
+	case vectorL2:
+		return l2
+	case vectorIP:
+		return 1 - dot
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+// knnQuery 是查询中的 =>[KNN k @field $param AS alias]
+type knnQuery struct {
+	k     int
+	field int
+	param string
+	alias string
+	vec   []float32
+}
+
+// parseKNN 解析 => 之后的部分
+func (idx *searchIndex) parseKNN(s string) (*knnQuery, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("Syntax error near %s", s)
+	}
+	parts := strings.Fields(s[1 : len(s)-1])
+	if len(parts) != 4 && !(len(parts) == 6 && strings.EqualFold(parts[4], "AS")) || !strings.EqualFold(parts[0], "KNN") {
+		return nil, fmt.Errorf("Syntax error near %s", s)
+	}
+	k, err := strconv.Atoi(parts[1])
+	if err != nil || k < 0 {
+		return nil, errors.New("Invalid K value")
+	}
+	if !strings.HasPrefix(parts[2], "@") || !strings.HasPrefix(parts[3], "$") {
+		return nil, fmt.Errorf("Syntax error near %s", s)
+	}
+	q := &knnQuery{k: k, field: idx.field(parts[2][1:]), param: parts[3][1:], alias: "__" + parts[2][1:] + "_score"}
+	if q.field < 0 || idx.fields[q.field].typ != indexVector {
+		return nil, fmt.Errorf("Field `%s` is not a VECTOR field", parts[2][1:])
+	}
+	if len(parts) == 6 {
+		q.alias = parts[5]
+	}
+	return q, nil
+}
+
+// knnResult 是 KNN 查询的一个结果
+type knnResult struct {
+	key  string
+	dist float64
+}
+
+// knn 返回满足条件的键中与查询向量最近的 k 个，按距离从近到远排列
+func (idx *searchIndex) knn(terms []searchTerm, q *knnQuery) []knnResult {
+	params := idx.fields[q.field].vec
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var results []knnResult
+	if g := idx.graphs[q.field]; g != nil && terms == nil {
+		for _, r := range g.search(q.vec, max(q.k, params.efRuntime)) {
+			if doc := idx.docs[r.node.key]; doc != nil && !doc.expired() {
+				results = append(results, knnResult{r.node.key, r.dist})
+			}
+		}
+	} else {
+		for _, key := range idx.searchLocked(terms) {
+			if vec := idx.docs[key].values[q.field].vec; vec != nil {
+				results = append(results, knnResult{key, vectorDistance(params.metric, q.vec, vec)})
+			}
+		}
+	}
+	slices.SortFunc(results, func(a, b knnResult) int {
+		if a.dist != b.dist {
+			return cmpFloat(a.dist, b.dist)
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	return results[:min(q.k, len(results))]
+}
+
+func cmpFloat(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// hnswGraph 是一个向量字段的 HNSW（分层可导航小世界）近邻图。
+// 删除的节点只做标记，仍然参与导航但不出现在结果中，标记的节点多于存活的节点时用存活的节点重建整个图
+type hnswGraph struct {
+	params  *vectorParams
+	nodes   map[string]*hnswNode // 存活的节点
+	entry   *hnswNode
+	deleted int
+}
+
+type hnswNode struct {
+	key       string
+	vec       []float32
+	neighbors [][]*hnswNode // 每层的邻居，长度为节点的层数 + 1
+	deleted   bool
+}
+
+type hnswCandidate struct {
+	node *hnswNode
+	dist float64
+}
+
+func newHNSWGraph(params *vectorParams) *hnswGraph {
+	return &hnswGraph{params: params, nodes: make(map[string]*hnswNode)}
+}
+
+// randomLevel 按 1/ln(M) 的几何分布为新节点选择层数
+func (g *hnswGraph) randomLevel() int {
+	ml := 1 / math.Log(float64(max(g.params.m, 2)))
+	return int(-math.Log(1-rand.Float64()) * ml)
+}
+
+// insertSorted 把候选按距离插入有序的列表
+func insertSorted(list []hnswCandidate, c hnswCandidate) []hnswCandidate {
+	i, _ := slices.BinarySearchFunc(list, c.dist, func(e hnswCandidate, d float64) int { return cmpFloat(e.dist, d) })
+	return slices.Insert(list, i, c)
+}
+
+// searchLayer 从 ep 出发在第 level 层贪心搜索，返回最近的 ef 个节点（包括已删除的），按距离从近到远排列
+func (g *hnswGraph) searchLayer(q []float32, ep *hnswNode, ef, level int) []hnswCandidate {
+	d := vectorDistance(g.params.metric, q, ep.vec)
+	visited := map[*hnswNode]bool{ep: true}
+	candidates := []hnswCandidate{{ep, d}}
+	results := []hnswCandidate{{ep, d}}
+	for len(candidates) > 0 {
+		c := candidates[0]
+		candidates = candidates[1:]
+		if len(results) >= ef && c.dist > results[len(results)-1].dist {
+			break
+		}
+		for _, nb := range c.node.neighbors[level] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := vectorDistance(g.params.metric, q, nb.vec)
+			if len(results) < ef || d < results[len(results)-1].dist {
+				candidates = insertSorted(candidates, hnswCandidate{nb, d})
+				results = insertSorted(results, hnswCandidate{nb, d})
+				if len(results) > ef {
+					results = results[:ef]
+				}
+			}
+		}
+	}
+	return results
+}
+
+// descend 从入口节点逐层向下贪心搜索到第 level 层之上，返回第 level 层的起点
+func (g *hnswGraph) descend(q []float32, level int) *hnswNode {
+	ep := g.entry
+	for l := len(g.entry.neighbors) - 1; l > level; l-- {
+		ep = g.searchLayer(q, ep, 1, l)[0].node
+	}
+	return ep
+}
+
+// insert 加入一个节点，键已存在时先删除原来的节点
+func (g *hnswGraph) insert(key string, vec []float32) {
+	g.remove(key)
+	level := g.randomLevel()
+	n := &hnswNode{key: key, vec: vec, neighbors: make([][]*hnswNode, level+1)}
+	g.nodes[key] = n
+	if g.entry == nil {
+		g.entry = n
+		return
+	}
+	top := len(g.entry.neighbors) - 1
+	ep := g.descend(vec, level)
+	for l := min(level, top); l >= 0; l-- {
+		found := g.searchLayer(vec, ep, g.params.efConstruction, l)
+		maxConn := g.params.m
+		if l == 0 {
+			maxConn *= 2
+		}
+		for _, c := range found[:min(g.params.m, len(found))] {
+			n.neighbors[l] = append(n.neighbors[l], c.node)
+			c.node.neighbors[l] = append(c.node.neighbors[l], n)
+			if len(c.node.neighbors[l]) > maxConn {
+				g.prune(c.node, l, maxConn)
+			}
+		}
+		ep = found[0].node
+	}
+	if level > top {
+		g.entry = n
+	}
+}
+
+// prune 只保留节点在第 level 层最近的 maxConn 个邻居
+func (g *hnswGraph) prune(n *hnswNode, level, maxConn int) {
+	nbs := n.neighbors[level]
+	dist := make(map[*hnswNode]float64, len(nbs))
+	for _, nb := range nbs {
+		dist[nb] = vectorDistance(g.params.metric, n.vec, nb.vec)
+	}
+	slices.SortFunc(nbs, func(a, b *hnswNode) int { return cmpFloat(dist[a], dist[b]) })
+	n.neighbors[level] = nbs[:maxConn]
+}
+
+// remove 标记删除键对应的节点
+func (g *hnswGraph) remove(key string) {
+	n, ok := g.nodes[key]
+	if !ok {
+		return
+	}
+	n.deleted = true
+	delete(g.nodes, key)
+	g.deleted++
+	if g.deleted > len(g.nodes) {
+		g.rebuild()
+	}
+}
+
+// rebuild 用存活的节点重新建图，清除已删除的节点
+func (g *hnswGraph) rebuild() {
+	nodes := g.nodes
+	g.nodes, g.entry, g.deleted = make(map[string]*hnswNode, len(nodes)), nil, 0
+	for key, n := range nodes {
+		g.insert(key, n.vec)
+	}
+}
+
+// search 返回与 q 最近的 ef 个存活节点，按距离从近到远排列
+func (g *hnswGraph) search(q []float32, ef int) []hnswCandidate {
+	if g.entry == nil {
+		return nil
+	}
+	found := g.searchLayer(q, g.descend(q, 0), ef, 0)
+	return slices.DeleteFunc(found, func(c hnswCandidate) bool { return c.node.deleted })
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// 版本信息，发布构建时通过 -ldflags 写入，例如：
+//
+//	go build -ldflags "-X github.com/LikiosSedo/redis_easy/server.Version=1.4.0 \
+//	    -X github.com/LikiosSedo/redis_easy/server.GitCommit=$(git rev-parse --short HEAD) \
+//	    -X github.com/LikiosSedo/redis_easy/server.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/redis-easy
+//
+// 没有写入 GitCommit、BuildDate 时，使用 go build 在 git 仓库中构建时自动记录的提交和提交时间。
+// 启动日志、redis-easy --version、INFO server 和 HELLO 的回复中都带有这些信息
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value[:min(len(s.Value), 12)]
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = s.Value
+			}
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if GitCommit == "" && revision != "" {
+		GitCommit = revision
+		// 从有未提交修改的工作区构建，只看提交号区分不出来
+		if modified == "true" {
+			GitCommit += "-dirty"
+		}
+	}
+}
+
+// VersionString 返回一行版本信息，例如 "redis-easy 1.4.0 (git 3f2c1ab, built 2026-10-16T08:00:00Z, go1.22.5 linux/amd64)"
+func VersionString() string {
+	return fmt.Sprintf("redis-easy %s (git %s, built %s, %s %s/%s)", Version, orUnknown(GitCommit), orUnknown(BuildDate),
+		runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// 键空间事件的 webhook，供没有 RESP 客户端的系统感知缓存的变化。配置 webhook-url 后，
+// webhook-events 中列出的事件里键名匹配 webhook-key-pattern 的会被批量 POST 到该地址，请求体为
+//
+//	{"events": [{"event": "expired", "key": "session:42", "time": 1700000000123}, ...]}
+//
+// time 为事件发生时的 Unix 毫秒时间戳。过期事件在访问到已过期的键时产生（键是惰性删除的）。
+// 网络错误、429 和 5xx 响应会按指数退避重试，重试 webhook-max-retries 次仍然失败的一批事件被丢弃；
+// 事件在内存队列中排队，队列满时丢弃新的事件。发送、失败、丢弃的事件数见 INFO stats
+
+const (
+	webhookQueueLen   = 10000
+	webhookBatchSize  = 100
+	webhookTimeout    = 5 * time.Second
+	webhookMinBackoff = 100 * time.Millisecond
+	webhookMaxBackoff = 10 * time.Second
+)
+
+type webhookEvent struct {
+	Event string `json:"event"`
+	Key   string `json:"key"`
+	Time  int64  `json:"time"`
+}
+
+// webhookSink 把事件从分片 worker 转交给发送 goroutine，并统计发送结果，NATS 发布（见 nats.go）也使用它
+type webhookSink struct {
+	queue   chan webhookEvent
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+}
+
+// keyEvent 是键空间事件的回调，在持有分片锁时调用，计入上次保存快照以来的修改次数，并把事件交给 webhook、NATS（见 nats.go）和 write-behind（见 writebehind.go），
+// 三者都只做过滤和入队；二级索引（见 search.go）在这里同步更新
+func (srv *Server) keyEvent(event store.KeyEvent, key string) {
+	cfg := config.Get()
+	srv.changesSinceSave.Add(1)
+	srv.webhookKeyEvent(cfg, event, key)
+	srv.natsKeyEvent(cfg, event, key)
+	srv.writeBehindKeyEvent(cfg, key)
+	srv.searchKeyEvent(event, key)
+}
+
+func (srv *Server) webhookKeyEvent(cfg *config.Config, event store.KeyEvent, key string) {
+	if cfg.WebhookURL == "" || !config.HasListItem(cfg.WebhookEvents, event.String()) {
+		return
+	}
+	if ok, _ := path.Match(cfg.WebhookKeyPattern, key); !ok {
+		return
+	}
+	select {
+	case srv.webhook.queue <- webhookEvent{Event: event.String(), Key: key, Time: time.Now().UnixMilli()}:
+	default:
+		srv.webhook.dropped.Add(1)
+	}
+}
+
+// startWebhook 启动发送 goroutine，每次取出队列中已有的事件（最多 webhookBatchSize 个）作为一批发送，实例 Stop 时退出
+func (srv *Server) startWebhook() {
+	client := &http.Client{Timeout: webhookTimeout}
+	go func() {
+		batch := make([]webhookEvent, 0, webhookBatchSize)
+		for {
+			select {
+			case ev := <-srv.webhook.queue:
+				batch = append(batch[:0], ev)
+			case <-srv.stopping:
+				return
+			}
+		drain:
+			for len(batch) < webhookBatchSize {
+				select {
+				case ev := <-srv.webhook.queue:
+					batch = append(batch, ev)
+				default:
+					break drain
+				}
+			}
+			if err := srv.postWebhook(client, batch); err != nil {
+				srv.webhook.failed.Add(int64(len(batch)))
+				srv.logger.Printf("Webhook: dropping %d events: %v\n", len(batch), err)
+			} else {
+				srv.webhook.sent.Add(int64(len(batch)))
+			}
+		}
+	}()
+}
+
+// postWebhook 发送一批事件，可以重试的错误按指数退避重试
+func (srv *Server) postWebhook(client *http.Client, batch []webhookEvent) error {
+	body, err := json.Marshal(map[string]interface{}{"events": batch})
+	if err != nil {
+		return err
+	}
+	backoff := webhookMinBackoff
+	for attempt := 0; ; attempt++ {
+		cfg := config.Get()
+		if cfg.WebhookURL == "" {
+			return fmt.Errorf("webhook-url was cleared")
+		}
+		retry, err := sendWebhook(client, cfg.WebhookURL, body)
+		if err == nil || !retry || attempt >= cfg.WebhookMaxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-srv.stopping:
+			return err
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
+
+// sendWebhook POST 一次请求，返回的 retry 表示失败是否值得重试
+func sendWebhook(client *http.Client, url string, body []byte) (retry bool, err error) {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("server replied %s", resp.Status)
+	}
+	return false, fmt.Errorf("server replied %s", resp.Status)
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// write-behind：把键空间的修改异步同步到外部数据库，redis-easy 作为数据库前面的缓存。
+// 键名匹配 write-behind-key-pattern 的键被写入、删除或过期后记入待同步集合，同一个键的多次修改会合并，
+// 同步时读取键当时的最新值，每隔 write-behind-flush-interval 毫秒或积累了 write-behind-batch-size 个键时
+// 分批推送给 write-behind-sink，失败时按指数退避重试 write-behind-max-retries 次，仍然失败的键放回待同步集合，
+// 下一次同步时再试，因此 sink 暂时不可用时不会丢失修改。
+//
+// write-behind-sink 为 http:// 或 https:// 地址时，每批以 {"changes": [KeyChange, ...]} POST 到该地址，
+// 2xx 响应表示成功；其他取值是扩展模块通过 RegisterWriteBehindSink 注册的 sink 名称，例如写入 SQL 数据库的模块。
+// Stop 时会在保存快照之前再同步一次
+
+// KeyChange 是推送给 sink 的一个键的最新状态。Deleted 为 true 表示键已被删除或过期，sink 应删除对应的记录，
+// 此时其余字段为空；否则 Value 的格式与 HTTP 网关相同：字符串为字符串，列表和集合为数组，哈希为对象，TTL 为剩余秒数，不过期时为 -1
+type KeyChange struct {
+	Key     string      `json:"key"`
+	Deleted bool        `json:"deleted"`
+	Type    string      `json:"type,omitempty"`
+	TTL     int         `json:"ttl"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+// WriteBehindSink 接收 write-behind 推送的修改。Write 返回错误时整批会被重试，因此实现需要是幂等的（例如 UPSERT）
+type WriteBehindSink interface {
+	Write(changes []KeyChange) error
+}
+
+// writeBehindSinks 保存扩展模块注册的 sink，只在开始处理命令之前修改
+var writeBehindSinks = make(map[string]WriteBehindSink)
+
+// RegisterWriteBehindSink 注册一个 write-behind sink，配置 write-behind-sink 为 name 时使用。
+// 与 RegisterCommand 相同，只能在开始处理命令之前调用（通常在扩展模块的 init 中）
+func RegisterWriteBehindSink(name string, sink WriteBehindSink) error {
+	if name == "" || isHTTPURL(name) {
+		return fmt.Errorf("invalid write-behind sink name '%s'", name)
+	}
+	if _, ok := writeBehindSinks[name]; ok {
+		return fmt.Errorf("write-behind sink '%s' is already registered", name)
+	}
+	writeBehindSinks[name] = sink
+	return nil
+}
+
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// httpWriteBehindSink 把修改 POST 到一个 HTTP 地址
+type httpWriteBehindSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpWriteBehindSink) Write(changes []KeyChange) error {
+	body, err := json.Marshal(map[string]interface{}{"changes": changes})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server replied %s", resp.Status)
+	}
+	return nil
+}
+
+// writeBehindQueue 是待同步的键。键空间事件在持有分片锁时把键加入 pending，同步时整体取出，
+// 因此记录事件的一方不会等待 sink
+type writeBehindQueue struct {
+	mu      sync.Mutex
+	pending map[string]struct{}
+	// full 在 pending 达到 write-behind-batch-size 时通知同步 goroutine 提前同步
+	full chan struct{}
+	// flushMu 保证同一时间只有一次同步，Stop 时的最后一次同步与后台 goroutine 不会同时进行
+	flushMu sync.Mutex
+
+	flushed atomic.Int64 // 成功推送的键数
+	failed  atomic.Int64 // 重试后仍然失败的批次数
+}
+
+// writeBehindKeyEvent 把匹配 write-behind-key-pattern 的键加入待同步集合
+func (srv *Server) writeBehindKeyEvent(cfg *config.Config, key string) {
+	if cfg.WriteBehindSink == "" {
+		return
+	}
+	if ok, _ := path.Match(cfg.WriteBehindKeyPattern, key); !ok {
+		return
+	}
+	q := &srv.writeBehind
+	q.mu.Lock()
+	q.pending[key] = struct{}{}
+	n := len(q.pending)
+	q.mu.Unlock()
+	if n >= cfg.WriteBehindBatchSize {
+		select {
+		case q.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startWriteBehind 启动同步 goroutine，实例 Stop 时退出
+func (srv *Server) startWriteBehind() {
+	go func() {
+		for {
+			interval := time.Duration(config.Get().WriteBehindFlushInterval) * time.Millisecond
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+			case <-srv.writeBehind.full:
+				timer.Stop()
+			case <-srv.stopping:
+				timer.Stop()
+				return
+			}
+			srv.flushWriteBehind()
+		}
+	}()
+}
+
+// flushWriteBehind 把当前所有待同步的键分批推送给 sink
+func (srv *Server) flushWriteBehind() {
+	q := &srv.writeBehind
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	cfg := config.Get()
+	if cfg.WriteBehindSink == "" {
+		return
+	}
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = make(map[string]struct{})
+	q.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+
+	sink, err := srv.writeBehindSink(cfg.WriteBehindSink)
+	for len(keys) > 0 && err == nil {
+		n := min(len(keys), cfg.WriteBehindBatchSize)
+		if err = srv.writeBehindBatch(sink, keys[:n], cfg.WriteBehindMaxRetries); err == nil {
+			q.flushed.Add(int64(n))
+			keys = keys[n:]
+		}
+	}
+	if err != nil {
+		q.failed.Add(1)
+		srv.logger.Printf("Write-behind: %d keys not synced, will retry: %v\n", len(keys), err)
+		q.mu.Lock()
+		for _, key := range keys {
+			q.pending[key] = struct{}{}
+		}
+		q.mu.Unlock()
+	}
+}
+
+// writeBehindSink 按 write-behind-sink 的取值返回 sink
+func (srv *Server) writeBehindSink(name string) (WriteBehindSink, error) {
+	if isHTTPURL(name) {
+		return &httpWriteBehindSink{url: name, client: &http.Client{Timeout: webhookTimeout}}, nil
+	}
+	sink, ok := writeBehindSinks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown write-behind sink '%s'", name)
+	}
+	return sink, nil
+}
+
+// writeBehindBatch 读取一批键的最新状态并推送，失败时按指数退避重试
+func (srv *Server) writeBehindBatch(sink WriteBehindSink, keys []string, retries int) error {
+	changes := make([]KeyChange, len(keys))
+	for i, key := range keys {
+		if k, ok := srv.lookupKeyJSON(key); ok {
+			changes[i] = KeyChange{Key: key, Type: k.Type, TTL: k.TTL, Value: k.Value}
+		} else {
+			changes[i] = KeyChange{Key: key, Deleted: true}
+		}
+	}
+	backoff := webhookMinBackoff
+	for attempt := 0; ; attempt++ {
+		err := sink.Write(changes)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-srv.stopping:
+			return err
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
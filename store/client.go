@@ -0,0 +1,325 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// 本文件是供 Go 程序直接嵌入使用的进程内接口：与同名命令语义相同，但返回类型化的结果，
+// 不经过 TCP 连接和 RESP 编解码。这些方法自己通过 Run 取得分片锁，
+// 因此不能在 Run 执行的函数（例如命令处理函数）内部调用
+
+// ErrWrongType 是对类型不匹配的键执行操作时返回的错误
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// NoExpire 是 TTL 对没有过期时间的键返回的值
+const NoExpire time.Duration = -1
+
+// lookup 返回键对应的未过期条目，已过期的条目会被顺便删除。键不存在时返回 nil，
+// 类型不是 t 时返回 ErrWrongType；forWrite 为 true 时按 LoadForWrite 取出，调用方随后可以原地修改。
+// 调用方需持有键所在分片的锁
+func (ks *Store) lookup(key string, t DataType, forWrite bool) (*Entry, error) {
+	var entry *Entry
+	var ok bool
+	if forWrite {
+		entry, ok = ks.LoadForWrite(key)
+	} else {
+		entry, ok = ks.Load(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if entry.IsExpired() {
+		ks.Delete(key)
+		return nil, nil
+	}
+	if entry.Type != t {
+		return nil, ErrWrongType
+	}
+	return entry, nil
+}
+
+// runKey 在持有 key 所在分片锁的前提下执行 fn
+func (ks *Store) runKey(key string, fn func()) {
+	ks.RunKeys([]string{key}, fn)
+}
+
+// Get 返回字符串键的值，键不存在时 ok 为 false
+func (ks *Store) Get(key string) (value string, ok bool, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, StringType, false); entry != nil {
+			value, ok = entry.Value.(string), true
+		}
+	})
+	return value, ok, err
+}
+
+// Set 设置字符串键的值，ttl 大于 0 时键在 ttl 之后过期
+func (ks *Store) Set(key, value string, ttl time.Duration) {
+	entry := &Entry{Type: StringType, Value: value}
+	if ttl > 0 {
+		entry.ExpireAt = time.Now().Add(ttl)
+	}
+	ks.runKey(key, func() { ks.Put(key, entry) })
+}
+
+// Del 删除一个或多个键，返回实际删除的（未过期的）键数
+func (ks *Store) Del(keys ...string) int {
+	count := 0
+	ks.RunKeys(keys, func() {
+		for _, key := range keys {
+			if entry, ok := ks.Load(key); ok {
+				if !entry.IsExpired() {
+					count++
+				}
+				ks.Delete(key)
+			}
+		}
+	})
+	return count
+}
+
+// TTL 返回键剩余的生存时间，键没有过期时间时返回 NoExpire，键不存在时 ok 为 false
+func (ks *Store) TTL(key string) (ttl time.Duration, ok bool) {
+	ks.runKey(key, func() {
+		entry, exists := ks.Load(key)
+		if !exists {
+			return
+		}
+		if entry.IsExpired() {
+			ks.Delete(key)
+			return
+		}
+		ok = true
+		if entry.ExpireAt.IsZero() {
+			ttl = NoExpire
+		} else {
+			ttl = max(time.Until(entry.ExpireAt), 0)
+		}
+	})
+	return ttl, ok
+}
+
+// Expire 设置键的过期时间，ttl 小于等于 0 时移除过期时间。键不存在时返回 false
+func (ks *Store) Expire(key string, ttl time.Duration) (ok bool) {
+	ks.runKey(key, func() {
+		entry, exists := ks.LoadForWrite(key)
+		if !exists {
+			return
+		}
+		if entry.IsExpired() {
+			ks.Delete(key)
+			return
+		}
+		ok = true
+		if ttl > 0 {
+			ks.SetExpireAt(key, entry, time.Now().Add(ttl))
+		} else {
+			ks.SetExpireAt(key, entry, time.Time{})
+		}
+	})
+	return ok
+}
+
+// LPush 向列表头部插入元素，返回列表的新长度
+func (ks *Store) LPush(key string, values ...string) (int, error) {
+	return ks.push(key, values, true)
+}
+
+// RPush 向列表尾部追加元素，返回列表的新长度
+func (ks *Store) RPush(key string, values ...string) (int, error) {
+	return ks.push(key, values, false)
+}
+
+func (ks *Store) push(key string, values []string, left bool) (n int, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, ListType, true); err != nil {
+			return
+		}
+		exists := entry != nil
+		if !exists {
+			entry = &Entry{Type: ListType, Value: NewListObject()}
+		}
+		list := entry.Value.(*ListObject)
+		if left {
+			list.PushFront(values)
+		} else {
+			list.PushBack(values)
+		}
+		ks.PutOrUpdate(key, entry, exists)
+		n = list.Len()
+	})
+	return n, err
+}
+
+// LPop 弹出列表头部的元素，列表不存在时 ok 为 false
+func (ks *Store) LPop(key string) (string, bool, error) {
+	return ks.pop(key, true)
+}
+
+// RPop 弹出列表尾部的元素，列表不存在时 ok 为 false
+func (ks *Store) RPop(key string) (string, bool, error) {
+	return ks.pop(key, false)
+}
+
+func (ks *Store) pop(key string, left bool) (value string, ok bool, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, ListType, true); entry == nil {
+			return
+		}
+		list := entry.Value.(*ListObject)
+		if left {
+			value, ok = list.PopFront()
+		} else {
+			value, ok = list.PopBack()
+		}
+		if list.Len() == 0 {
+			ks.Delete(key)
+		} else {
+			ks.Updated(key)
+		}
+	})
+	return value, ok, err
+}
+
+// LRange 返回列表中下标在 [start, stop] 之间的元素，负数下标表示从末尾倒数
+func (ks *Store) LRange(key string, start, stop int) (items []string, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, ListType, false); entry == nil {
+			return
+		}
+		list := entry.Value.(*ListObject)
+		n := list.Len()
+		if start < 0 {
+			start += n
+		}
+		if stop < 0 {
+			stop += n
+		}
+		start, stop = max(start, 0), min(stop, n-1)
+		if start > stop {
+			return
+		}
+		items = make([]string, 0, stop-start+1)
+		list.Range(start, stop, func(item string) {
+			items = append(items, item)
+		})
+	})
+	return items, err
+}
+
+// SAdd 向集合添加成员，返回新增的成员数
+func (ks *Store) SAdd(key string, members ...string) (added int, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, SetType, true); err != nil {
+			return
+		}
+		exists := entry != nil
+		if !exists {
+			entry = &Entry{Type: SetType, Value: NewSetObject()}
+		}
+		set := entry.Value.(*SetObject)
+		for _, member := range members {
+			if set.Add(member) {
+				added++
+			}
+		}
+		ks.PutOrUpdate(key, entry, exists)
+	})
+	return added, err
+}
+
+// SRem 从集合删除成员，返回删除的成员数，集合被删空时同时删除键
+func (ks *Store) SRem(key string, members ...string) (removed int, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, SetType, true); entry == nil {
+			return
+		}
+		set := entry.Value.(*SetObject)
+		for _, member := range members {
+			if set.Remove(member) {
+				removed++
+			}
+		}
+		if set.Len() == 0 {
+			ks.Delete(key)
+		} else {
+			ks.Updated(key)
+		}
+	})
+	return removed, err
+}
+
+// SMembers 返回集合的所有成员
+func (ks *Store) SMembers(key string) (members []string, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, SetType, false); entry == nil {
+			return
+		}
+		set := entry.Value.(*SetObject)
+		members = make([]string, 0, set.Len())
+		set.ForEach(func(member string) {
+			members = append(members, member)
+		})
+	})
+	return members, err
+}
+
+// HSet 设置哈希字段的值，字段是新增的时返回 true
+func (ks *Store) HSet(key, field, value string) (isNew bool, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, HashType, true); err != nil {
+			return
+		}
+		exists := entry != nil
+		if !exists {
+			entry = &Entry{Type: HashType, Value: NewHashObject()}
+		}
+		hash := entry.Value.(*HashObject)
+		isNew = hash.Set(field, value)
+		ks.PutOrUpdate(key, entry, exists)
+	})
+	return isNew, err
+}
+
+// HGet 返回哈希字段的值，键或字段不存在时 ok 为 false
+func (ks *Store) HGet(key, field string) (value string, ok bool, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, HashType, false); entry == nil {
+			return
+		}
+		value, ok = entry.Value.(*HashObject).Get(field)
+	})
+	return value, ok, err
+}
+
+// HDel 删除哈希字段，返回删除的字段数，哈希被删空时同时删除键
+func (ks *Store) HDel(key string, fields ...string) (deleted int, err error) {
+	ks.runKey(key, func() {
+		var entry *Entry
+		if entry, err = ks.lookup(key, HashType, true); entry == nil {
+			return
+		}
+		hash := entry.Value.(*HashObject)
+		for _, field := range fields {
+			if hash.Del(field) {
+				deleted++
+			}
+		}
+		if hash.Len() == 0 {
+			ks.Delete(key)
+		} else {
+			ks.Updated(key)
+		}
+	})
+	return deleted, err
+}
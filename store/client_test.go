@@ -0,0 +1,54 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LikiosSedo/redis_easy/store"
+)
+
+// TestWritesKeepTTL 检查嵌入接口的 LPush、RPush、SAdd、HSet 原地修改已有的键时保留原来的过期时间，
+// 键已经过期时新建一个没有过期时间的键
+func TestWritesKeepTTL(t *testing.T) {
+	ks := store.New()
+	tests := []struct {
+		name  string
+		key   string
+		write func() (int, error)
+	}{
+		{"LPush", "list:l", func() (int, error) { return ks.LPush("list:l", "a") }},
+		{"RPush", "list:r", func() (int, error) { return ks.RPush("list:r", "a") }},
+		{"SAdd", "set", func() (int, error) { return ks.SAdd("set", "a", "b") }},
+		{"HSet", "hash", func() (int, error) {
+			isNew, err := ks.HSet("hash", "f", "1")
+			if isNew {
+				return 1, err
+			}
+			return 0, err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			ks.Expire(tt.key, time.Hour)
+			before, _ := ks.TTL(tt.key)
+			if _, err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			if after, ok := ks.TTL(tt.key); !ok || after == store.NoExpire || after > before || before-after > time.Second {
+				t.Fatalf("TTL after %s = %v, want about %v", tt.name, after, before)
+			}
+
+			ks.Expire(tt.key, time.Millisecond)
+			time.Sleep(5 * time.Millisecond)
+			if n, err := tt.write(); err != nil || n == 0 {
+				t.Fatalf("%s on an expired key = %d, %v; want a new key", tt.name, n, err)
+			}
+			if ttl, ok := ks.TTL(tt.key); !ok || ttl != store.NoExpire {
+				t.Fatalf("TTL after %s on an expired key = %v (exists %v), want no expiry", tt.name, ttl, ok)
+			}
+		})
+	}
+}
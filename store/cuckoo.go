@@ -0,0 +1,299 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math/bits"
+	"math/rand/v2"
+)
+
+// 布谷鸟过滤器（cuckoo filter）。与布隆过滤器一样用很少的内存回答“某个元素是否可能存在”，
+// 不同的是可以删除元素，并且能统计元素被加入的次数（近似值）。
+//
+// 每个元素按 64 位 FNV-1a 哈希得到一个 8 位指纹和两个候选桶：i1 = hash & mask，i2 = i1 ^ (fp * 0x5bd1e995 & mask)，
+// 两个候选桶互为对方，因此只凭指纹就能找到另一个候选桶。插入时两个桶都满了就随机踢出一个指纹到它的另一个候选桶，
+// 最多踢 MaxIterations 次；仍然失败时撤销这些踢出，并按 Expansion 追加一个更大的子过滤器（Expansion 为 0 时返回已满）。
+// 查询和删除要检查所有子过滤器。桶数取 2 的幂，哈希与桶数无关，序列化后重新载入结果不变
+
+const (
+	// CuckooDefaultCapacity 等是 CF.ADD 自动创建过滤器时使用的参数，与 RedisBloom 相同
+	CuckooDefaultCapacity      = 1024
+	CuckooDefaultBucketSize    = 2
+	CuckooDefaultMaxIterations = 20
+	CuckooDefaultExpansion     = 1
+
+	// CuckooMaxFilters 是子过滤器个数的上限
+	CuckooMaxFilters = 32
+	// cuckooMaxBuckets 限制单个子过滤器的桶数，防止 CF.RESERVE 一次分配过多内存
+	cuckooMaxBuckets = 1 << 30
+)
+
+// ErrCuckooFull 表示过滤器已满且不能再扩展
+var ErrCuckooFull = errors.New("Filter is full")
+
+// cuckooFilter 是一个子过滤器，buckets 中每 bucketSize 个字节是一个桶，0 表示空位
+type cuckooFilter struct {
+	numBuckets uint64
+	buckets    []byte
+}
+
+// CuckooObject 是布谷鸟过滤器类型的值
+type CuckooObject struct {
+	BucketSize    int
+	MaxIterations int
+	Expansion     int
+	// Items 是加入的元素个数减去删除的个数，Deletes 是累计删除的个数
+	Items   int64
+	Deletes int64
+
+	filters []*cuckooFilter
+}
+
+// NewCuckooObject 创建一个至少能容纳 capacity 个元素的过滤器
+func NewCuckooObject(capacity, bucketSize, maxIterations, expansion int) *CuckooObject {
+	cf := &CuckooObject{BucketSize: bucketSize, MaxIterations: maxIterations, Expansion: expansion}
+	cf.addFilter(cuckooBucketCount(uint64(capacity), bucketSize))
+	return cf
+}
+
+// cuckooBucketCount 返回容纳 capacity 个元素需要的桶数，取不小于它的 2 的幂
+func cuckooBucketCount(capacity uint64, bucketSize int) uint64 {
+	n := (capacity + uint64(bucketSize) - 1) / uint64(bucketSize)
+	if n <= 1 {
+		return 1
+	}
+	return min(uint64(1)<<bits.Len64(n-1), cuckooMaxBuckets)
+}
+
+func (cf *CuckooObject) addFilter(numBuckets uint64) {
+	cf.filters = append(cf.filters, &cuckooFilter{numBuckets: numBuckets, buckets: make([]byte, numBuckets*uint64(cf.BucketSize))})
+}
+
+func (cf *CuckooObject) clone() *CuckooObject {
+	c := *cf
+	c.filters = make([]*cuckooFilter, len(cf.filters))
+	for i, f := range cf.filters {
+		c.filters[i] = &cuckooFilter{numBuckets: f.numBuckets, buckets: append([]byte(nil), f.buckets...)}
+	}
+	return &c
+}
+
+// cuckooHash 返回元素的哈希和指纹，指纹取值为 1 到 255
+func cuckooHash(item string) (uint64, byte) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	return sum, byte(sum%255 + 1)
+}
+
+// altIndex 返回桶 i 中的指纹 fp 的另一个候选桶
+func (f *cuckooFilter) altIndex(i uint64, fp byte) uint64 {
+	return (i ^ uint64(fp)*0x5bd1e995) & (f.numBuckets - 1)
+}
+
+func (f *cuckooFilter) bucket(i uint64, bucketSize int) []byte {
+	return f.buckets[i*uint64(bucketSize) : (i+1)*uint64(bucketSize)]
+}
+
+// insertEmpty 把 fp 放进桶 i 的空位，返回是否成功
+func (f *cuckooFilter) insertEmpty(i uint64, fp byte, bucketSize int) bool {
+	b := f.bucket(i, bucketSize)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// insert 把指纹放进子过滤器，必要时踢出已有的指纹，失败时子过滤器保持原样
+func (f *cuckooFilter) insert(hash uint64, fp byte, bucketSize, maxIterations int) bool {
+	i1 := hash & (f.numBuckets - 1)
+	i2 := f.altIndex(i1, fp)
+	if f.insertEmpty(i1, fp, bucketSize) || f.insertEmpty(i2, fp, bucketSize) {
+		return true
+	}
+	// 记录每次踢出的位置和原来的指纹，失败时按相反的顺序换回去
+	type kick struct {
+		pos int
+		fp  byte
+	}
+	kicks := make([]kick, 0, maxIterations)
+	i := i1
+	if rand.IntN(2) == 1 {
+		i = i2
+	}
+	for n := 0; n < maxIterations; n++ {
+		pos := int(i)*bucketSize + rand.IntN(bucketSize)
+		kicks = append(kicks, kick{pos, f.buckets[pos]})
+		fp, f.buckets[pos] = f.buckets[pos], fp
+		i = f.altIndex(i, fp)
+		if f.insertEmpty(i, fp, bucketSize) {
+			return true
+		}
+	}
+	for n := len(kicks) - 1; n >= 0; n-- {
+		f.buckets[kicks[n].pos] = kicks[n].fp
+	}
+	return false
+}
+
+// count 返回子过滤器中与元素指纹相同的个数
+func (f *cuckooFilter) count(hash uint64, fp byte, bucketSize int) int {
+	i1 := hash & (f.numBuckets - 1)
+	i2 := f.altIndex(i1, fp)
+	n := 0
+	for _, b := range f.bucket(i1, bucketSize) {
+		if b == fp {
+			n++
+		}
+	}
+	if i2 != i1 {
+		for _, b := range f.bucket(i2, bucketSize) {
+			if b == fp {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// remove 删除子过滤器中的一个相同指纹，返回是否找到
+func (f *cuckooFilter) remove(hash uint64, fp byte, bucketSize int) bool {
+	i1 := hash & (f.numBuckets - 1)
+	for _, i := range [2]uint64{i1, f.altIndex(i1, fp)} {
+		b := f.bucket(i, bucketSize)
+		for j := range b {
+			if b[j] == fp {
+				b[j] = 0
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Add 加入一个元素（同一元素可以加入多次），过滤器已满且不能再扩展时返回 ErrCuckooFull
+func (cf *CuckooObject) Add(item string) error {
+	hash, fp := cuckooHash(item)
+	// 优先放进最新的子过滤器，较早的子过滤器通常已经接近满载
+	last := cf.filters[len(cf.filters)-1]
+	if !last.insert(hash, fp, cf.BucketSize, cf.MaxIterations) {
+		if cf.Expansion == 0 || len(cf.filters) >= CuckooMaxFilters {
+			return ErrCuckooFull
+		}
+		cf.addFilter(min(last.numBuckets*cuckooBucketCount(uint64(cf.Expansion), 1), cuckooMaxBuckets))
+		cf.filters[len(cf.filters)-1].insert(hash, fp, cf.BucketSize, cf.MaxIterations)
+	}
+	cf.Items++
+	return nil
+}
+
+// Exists 返回元素是否可能存在：false 表示一定不存在，true 表示可能存在
+func (cf *CuckooObject) Exists(item string) bool {
+	hash, fp := cuckooHash(item)
+	for _, f := range cf.filters {
+		if f.count(hash, fp, cf.BucketSize) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 返回元素可能被加入的次数，结果可能偏大
+func (cf *CuckooObject) Count(item string) int {
+	hash, fp := cuckooHash(item)
+	n := 0
+	for _, f := range cf.filters {
+		n += f.count(hash, fp, cf.BucketSize)
+	}
+	return n
+}
+
+// Delete 删除元素的一次加入，返回是否找到。只应删除确实加入过的元素，否则可能误删指纹相同的其他元素
+func (cf *CuckooObject) Delete(item string) bool {
+	hash, fp := cuckooHash(item)
+	for i := len(cf.filters) - 1; i >= 0; i-- {
+		if cf.filters[i].remove(hash, fp, cf.BucketSize) {
+			// 删除从未加入过、只是指纹相同的元素时计数可能对不上，不让它变成负数
+			cf.Items = max(cf.Items-1, 0)
+			cf.Deletes++
+			return true
+		}
+	}
+	return false
+}
+
+// Filters 返回子过滤器的个数
+func (cf *CuckooObject) Filters() int {
+	return len(cf.filters)
+}
+
+// Buckets 返回所有子过滤器的桶数之和
+func (cf *CuckooObject) Buckets() int64 {
+	var n uint64
+	for _, f := range cf.filters {
+		n += f.numBuckets
+	}
+	return int64(n)
+}
+
+// Bytes 返回所有桶占用的字节数
+func (cf *CuckooObject) Bytes() int {
+	n := 0
+	for _, f := range cf.filters {
+		n += len(f.buckets)
+	}
+	return n
+}
+
+// MarshalBinary 把过滤器编码为字节串，用于快照：各参数和计数为 uvarint，随后是每个子过滤器的桶数和桶的原始字节
+func (cf *CuckooObject) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, 8*binary.MaxVarintLen64+cf.Bytes()+len(cf.filters)*binary.MaxVarintLen64)
+	for _, v := range []uint64{uint64(cf.BucketSize), uint64(cf.MaxIterations), uint64(cf.Expansion),
+		uint64(cf.Items), uint64(cf.Deletes), uint64(len(cf.filters))} {
+		buf = binary.AppendUvarint(buf, v)
+	}
+	for _, f := range cf.filters {
+		buf = binary.AppendUvarint(buf, f.numBuckets)
+		buf = append(buf, f.buckets...)
+	}
+	return buf, nil
+}
+
+// UnmarshalCuckoo 解码 MarshalBinary 的结果
+func UnmarshalCuckoo(data []byte) (*CuckooObject, error) {
+	errBad := errors.New("invalid cuckoo filter encoding")
+	var fields [6]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errBad
+		}
+		fields[i], data = v, data[n:]
+	}
+	cf := &CuckooObject{BucketSize: int(fields[0]), MaxIterations: int(fields[1]), Expansion: int(fields[2]),
+		Items: int64(fields[3]), Deletes: int64(fields[4])}
+	if cf.BucketSize < 1 || cf.BucketSize > 255 || fields[5] < 1 || fields[5] > CuckooMaxFilters {
+		return nil, errBad
+	}
+	for i := uint64(0); i < fields[5]; i++ {
+		numBuckets, n := binary.Uvarint(data)
+		if n <= 0 || numBuckets == 0 || numBuckets&(numBuckets-1) != 0 || numBuckets > cuckooMaxBuckets {
+			return nil, errBad
+		}
+		data = data[n:]
+		size := numBuckets * uint64(cf.BucketSize)
+		if uint64(len(data)) < size {
+			return nil, errBad
+		}
+		cf.filters = append(cf.filters, &cuckooFilter{numBuckets: numBuckets, buckets: append([]byte(nil), data[:size]...)})
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return nil, errBad
+	}
+	return cf, nil
+}
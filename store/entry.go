@@ -0,0 +1,93 @@
+package store
+
+import "time"
+
+// DataType 是条目值的类型
+type DataType int
+
+const (
+	StringType DataType = iota
+	ListType
+	SetType
+	HashType
+	CuckooType
+	TimeSeriesType
+	QueueType
+
+	TypeCount // 类型个数，新增类型需加在它之前
+)
+
+var dataTypeNames = [TypeCount]string{"string", "list", "set", "hash", "cuckoo", "timeseries", "queue"}
+
+func (t DataType) String() string {
+	if t >= 0 && t < TypeCount {
+		return dataTypeNames[t]
+	}
+	return "unknown"
+}
+
+// Entry 表示存储在缓存中的一个条目，包含数据类型、实际值以及过期时间（ExpireAt 为零值表示不过期）
+type Entry struct {
+	Type     DataType
+	Value    interface{}
+	ExpireAt time.Time
+
+	// epoch 记录条目写入时所在分片的快照轮次，用于判断条目是否被进行中的快照引用（见 LoadForWrite）
+	epoch uint64
+	// size 是条目当前计入内存统计的估算字节数（见 entryMemoryUsage）
+	size int64
+}
+
+// clone 复制条目及其值，复制出的条目可以独立修改
+func (e *Entry) clone() *Entry {
+	c := *e
+	switch v := e.Value.(type) {
+	case *ListObject:
+		c.Value = v.clone()
+	case *SetObject:
+		c.Value = v.clone()
+	case *HashObject:
+		c.Value = v.clone()
+	case *CuckooObject:
+		c.Value = v.clone()
+	case *TimeSeriesObject:
+		c.Value = v.clone()
+	case *QueueObject:
+		c.Value = v.clone()
+	}
+	return &c
+}
+
+// IsExpired 判断当前条目是否已过期
+func (e *Entry) IsExpired() bool {
+	if e.ExpireAt.IsZero() {
+		return false
+	}
+	return time.Now().After(e.ExpireAt)
+}
+
+// Size 返回条目计入内存统计的估算字节数
+func (e *Entry) Size() int64 {
+	return e.size
+}
+
+// Len 返回值的元素个数：字符串为字节数，列表、集合、哈希、队列为元素个数，时间序列为样本数，布谷鸟过滤器为加入的元素个数
+func (e *Entry) Len() int64 {
+	switch v := e.Value.(type) {
+	case string:
+		return int64(len(v))
+	case *ListObject:
+		return int64(v.Len())
+	case *SetObject:
+		return int64(v.Len())
+	case *HashObject:
+		return int64(v.Len())
+	case *CuckooObject:
+		return v.Items
+	case *TimeSeriesObject:
+		return int64(v.Len())
+	case *QueueObject:
+		return int64(v.Len())
+	}
+	return 0
+}
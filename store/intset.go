@@ -0,0 +1,55 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+)
+
+// intset 是只包含整数的小集合的编码：成员按升序存放在 []int64 中，查找用二分，
+// 每个成员只占 8 字节，没有字符串和哈希桶的开销
+type intset struct {
+	vals []int64
+}
+
+func (is *intset) Len() int {
+	return len(is.vals)
+}
+
+func (is *intset) search(v int64) (int, bool) {
+	i := sort.Search(len(is.vals), func(i int) bool { return is.vals[i] >= v })
+	return i, i < len(is.vals) && is.vals[i] == v
+}
+
+// add 插入整数，返回此前是否不存在
+func (is *intset) add(v int64) bool {
+	i, ok := is.search(v)
+	if ok {
+		return false
+	}
+	is.vals = append(is.vals, 0)
+	copy(is.vals[i+1:], is.vals[i:])
+	is.vals[i] = v
+	return true
+}
+
+// remove 删除整数，返回此前是否存在
+func (is *intset) remove(v int64) bool {
+	i, ok := is.search(v)
+	if ok {
+		is.vals = append(is.vals[:i], is.vals[i+1:]...)
+	}
+	return ok
+}
+
+// parseIntsetMember 判断成员能否以整数形式保存：必须是十进制 int64 的规范写法，
+// 例如 "12"、"-3" 可以，"012"、"+3"、" 1" 不行，否则取出时无法还原成原字符串
+func parseIntsetMember(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != s {
+		return 0, false
+	}
+	return v, true
+}
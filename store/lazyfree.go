@@ -0,0 +1,91 @@
+package store
+
+import (
+	"sync/atomic"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 惰性释放（对应 Redis 的 lazyfree）。删除或覆盖一个大的列表、集合或哈希时，
+// 把拆解旧值的工作交给后台 goroutine：清空 map、断开 quicklist 节点之间的引用，
+// 这部分开销与元素个数成正比，放在后台做就不会占用执行命令的分片 worker。
+// 元素个数不超过 lazyfree-threshold 的值直接丢弃引用，由 GC 正常回收
+
+// lazyfreeQueueSize 是后台待释放队列的长度，队列满时退回到直接丢弃引用
+const lazyfreeQueueSize = 1024
+
+var (
+	lazyfreeQueue = make(chan interface{}, lazyfreeQueueSize)
+
+	// lazyfreePendingObjects 是已经入队但还没有被后台拆解的值的个数，lazyfreedObjects 是累计拆解的个数
+	lazyfreePendingObjects atomic.Int64
+	lazyfreedObjects       atomic.Int64
+)
+
+// LazyfreeStats 返回待释放和累计释放的值的个数
+func LazyfreeStats() (pending, freed int64) {
+	return lazyfreePendingObjects.Load(), lazyfreedObjects.Load()
+}
+
+// StartLazyFree 启动后台释放 goroutine
+func StartLazyFree() {
+	go func() {
+		for v := range lazyfreeQueue {
+			dismantleValue(v)
+			lazyfreePendingObjects.Add(-1)
+			lazyfreedObjects.Add(1)
+		}
+	}()
+}
+
+// freeEffort 估算拆解一个值需要做的工作量：map 编码按元素个数计，quicklist 按节点个数计，
+// 字符串、listpack、intset 都是单块内存，工作量为 1
+func freeEffort(v interface{}) int {
+	switch v := v.(type) {
+	case *ListObject:
+		if v.ql != nil {
+			return v.ql.nodes
+		}
+	case *SetObject:
+		if v.members != nil {
+			return len(v.members)
+		}
+	case *HashObject:
+		if v.fields != nil {
+			return len(v.fields)
+		}
+	}
+	return 1
+}
+
+// freeValue 在值被删除或覆盖后调用。调用方需保证已经没有其他地方引用这个值
+func freeValue(v interface{}) {
+	threshold := config.Get().LazyfreeThreshold
+	if threshold <= 0 || freeEffort(v) <= threshold {
+		return
+	}
+	select {
+	case lazyfreeQueue <- v:
+		lazyfreePendingObjects.Add(1)
+	default:
+	}
+}
+
+// dismantleValue 拆解一个已经不再被引用的值
+func dismantleValue(v interface{}) {
+	switch v := v.(type) {
+	case *ListObject:
+		if v.ql != nil {
+			for node := v.ql.head; node != nil; {
+				next := node.next
+				node.prev, node.next, node.lp = nil, nil, nil
+				node = next
+			}
+			v.ql.head, v.ql.tail, v.ql.count = nil, nil, 0
+		}
+	case *SetObject:
+		clear(v.members)
+	case *HashObject:
+		clear(v.fields)
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import "encoding/binary"
+
+// listpack 把若干个短字符串紧凑地存放在一块连续的 []byte 中，每个元素编码为 uvarint(长度) + 数据。
+// 与 map / []string 相比没有每个元素的字符串头和哈希桶开销，适合元素少、元素短的小对象；
+// 代价是查找和中间插入删除都是 O(n)，因此只在元素数量和长度不超过配置阈值时使用
+type listpack struct {
+	buf   []byte
+	count int
+}
+
+// Len 返回元素个数
+func (lp *listpack) Len() int {
+	return lp.count
+}
+
+// Bytes 返回编码后占用的字节数
+func (lp *listpack) Bytes() int {
+	return len(lp.buf)
+}
+
+func (lp *listpack) clone() *listpack {
+	return &listpack{buf: append([]byte(nil), lp.buf...), count: lp.count}
+}
+
+func appendListpackEntry(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// pushBack 在末尾追加一个元素
+func (lp *listpack) pushBack(s string) {
+	lp.buf = appendListpackEntry(lp.buf, s)
+	lp.count++
+}
+
+// pushFront 与 LPUSH 相同，把元素依次插入到开头，插入后的顺序与 elems 相反
+func (lp *listpack) pushFront(elems []string) {
+	var head []byte
+	for i := len(elems) - 1; i >= 0; i-- {
+		head = appendListpackEntry(head, elems[i])
+	}
+	lp.buf = append(head, lp.buf...)
+	lp.count += len(elems)
+}
+
+// entryAt 解码 off 处的元素，返回元素内容和下一个元素的偏移
+func (lp *listpack) entryAt(off int) ([]byte, int) {
+	l, n := binary.Uvarint(lp.buf[off:])
+	start := off + n
+	end := start + int(l)
+	return lp.buf[start:end], end
+}
+
+// forEach 按顺序遍历元素，fn 返回 false 时停止。elem 指向内部缓冲区，fn 返回后不能再持有
+func (lp *listpack) forEach(fn func(elem []byte) bool) {
+	for off := 0; off < len(lp.buf); {
+		elem, next := lp.entryAt(off)
+		if !fn(elem) {
+			return
+		}
+		off = next
+	}
+}
+
+// find 从 off 开始每隔 step 个元素比较一次，返回与 s 相等的元素的偏移。
+// 集合和列表 step 为 1；哈希按 field、value 交替存放，查找字段时 step 为 2
+func (lp *listpack) find(s string, step int) (int, bool) {
+	i := 0
+	for off := 0; off < len(lp.buf); i++ {
+		elem, next := lp.entryAt(off)
+		if i%step == 0 && string(elem) == s {
+			return off, true
+		}
+		off = next
+	}
+	return 0, false
+}
+
+// removeAt 删除从 off 开始的 n 个元素
+func (lp *listpack) removeAt(off int, n int) {
+	end := off
+	for i := 0; i < n; i++ {
+		_, end = lp.entryAt(end)
+	}
+	lp.buf = append(lp.buf[:off], lp.buf[end:]...)
+	lp.count -= n
+}
+
+// replaceAt 把 off 处的元素替换为 s
+func (lp *listpack) replaceAt(off int, s string) {
+	_, end := lp.entryAt(off)
+	tail := append([]byte(nil), lp.buf[end:]...)
+	lp.buf = append(appendListpackEntry(lp.buf[:off], s), tail...)
+}
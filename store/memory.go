@@ -0,0 +1,57 @@
+package store
+
+// 内存估算使用的常量，取值参考 64 位平台上 Go 运行时的实际布局，只求数量级正确
+const (
+	// entryOverhead 是每个键的固定开销：Entry 结构体、分片 map 中的槽位以及键的字符串头
+	entryOverhead = 96
+	// stringOverhead 是装箱到 interface 中的字符串头
+	stringOverhead = 16
+	// objectOverhead 是列表、集合、哈希对象本身以及其中 listpack / intset 结构体的开销
+	objectOverhead = 48
+	// quicklistNodeOverhead 是每个 quicklist 节点的链表指针和 listpack 结构体
+	quicklistNodeOverhead = 56
+	// setMemberOverhead 和 hashFieldOverhead 是 hashtable 编码下每个元素在 map 中的开销
+	setMemberOverhead = 32
+	hashFieldOverhead = 48
+)
+
+// entryMemoryUsage 估算一个键值对占用的字节数。各种编码都维护了自己的字节计数，因此估算是 O(1) 的
+func entryMemoryUsage(key string, e *Entry) int64 {
+	return int64(entryOverhead+len(key)) + valueMemoryUsage(e.Value)
+}
+
+func valueMemoryUsage(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(stringOverhead + len(v))
+	case *ListObject:
+		if v.lp != nil {
+			return int64(objectOverhead + v.lp.Bytes())
+		}
+		return int64(objectOverhead + v.ql.nodes*quicklistNodeOverhead + v.ql.bytes)
+	case *SetObject:
+		switch {
+		case v.is != nil:
+			return int64(objectOverhead + 8*v.is.Len())
+		case v.lp != nil:
+			return int64(objectOverhead + v.lp.Bytes())
+		}
+		return int64(objectOverhead + len(v.members)*setMemberOverhead + v.bytes)
+	case *HashObject:
+		if v.lp != nil {
+			return int64(objectOverhead + v.lp.Bytes())
+		}
+		return int64(objectOverhead + len(v.fields)*hashFieldOverhead + v.bytes)
+	case *CuckooObject:
+		return int64(objectOverhead + len(v.filters)*objectOverhead + v.Bytes())
+	case *TimeSeriesObject:
+		n := objectOverhead + 16*cap(v.samples) + len(v.Rules)*objectOverhead*2
+		for _, s := range v.Labels {
+			n += stringOverhead + len(s)
+		}
+		return int64(n)
+	case *QueueObject:
+		return int64(objectOverhead + len(v.items)*(objectOverhead+stringOverhead+hashFieldOverhead) + v.payload)
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Namespace 是按键名前缀划分的命名空间，记录其中的键数（包括已过期但尚未删除的键）和估算的内存占用。
+// 一个键属于前缀最长的那个匹配的命名空间，不匹配任何前缀的键不属于任何命名空间
+type Namespace struct {
+	Name   string
+	Prefix string
+	// MaxKeys、MaxMemory 是配额，0 表示不限制。存储本身只负责统计，配额由执行命令的一方检查
+	MaxKeys   int64
+	MaxMemory int64
+
+	keys   atomic.Int64
+	memory atomic.Int64
+}
+
+// Keys 返回命名空间中的键数
+func (ns *Namespace) Keys() int64 {
+	return ns.keys.Load()
+}
+
+// Memory 返回命名空间中所有条目估算占用的字节数
+func (ns *Namespace) Memory() int64 {
+	return ns.memory.Load()
+}
+
+// SetNamespaces 替换命名空间的定义，并在锁住所有分片的情况下重新统计每个命名空间的键数和内存，
+// 期间所有命令都会等待，因此只应在启动或修改配置时调用
+func (ks *Store) SetNamespaces(list []*Namespace) {
+	sorted := append([]*Namespace(nil), list...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+	all := make([]int, ShardCount)
+	for i := range all {
+		all[i] = i
+	}
+	ks.Run(all, func() {
+		for _, ns := range sorted {
+			ns.keys.Store(0)
+			ns.memory.Store(0)
+		}
+		ks.namespaces.Store(&sorted)
+		for i := range ks.shards {
+			for key, entry := range ks.shards[i].items {
+				if ns := ks.NamespaceOf(key); ns != nil {
+					ns.keys.Add(1)
+					ns.memory.Add(entry.size)
+				}
+			}
+		}
+	})
+}
+
+// Namespaces 返回当前的命名空间，按前缀从长到短排列
+func (ks *Store) Namespaces() []*Namespace {
+	if list := ks.namespaces.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+// NamespaceOf 返回 key 所属的命名空间，不属于任何命名空间时返回 nil
+func (ks *Store) NamespaceOf(key string) *Namespace {
+	list := ks.namespaces.Load()
+	if list == nil {
+		return nil
+	}
+	for _, ns := range *list {
+		if strings.HasPrefix(key, ns.Prefix) {
+			return ns
+		}
+	}
+	return nil
+}
+
+// accountNamespace 在键被加入（keys 为 1）、删除（keys 为 -1）或者大小改变（keys 为 0）时更新所属命名空间的统计。
+// 调用方需持有键所在分片的锁
+func (ks *Store) accountNamespace(key string, keys, memory int64) {
+	if ns := ks.NamespaceOf(key); ns != nil {
+		ns.keys.Add(keys)
+		ns.memory.Add(memory)
+	}
+}
@@ -0,0 +1,455 @@
+package store
+
+import (
+	"strconv"
+
+	"github.com/LikiosSedo/redis_easy/config"
+)
+
+// 列表、集合、哈希对象。元素较少且较短时使用 listpack 紧凑编码，
+// 超过 *-max-listpack-* 配置的阈值后透明地转换为 quicklist / map，转换后不再转回
+
+// listpackWithinLimit 按 list-max-listpack-size 的约定检查 listpack 是否超出限制：
+// 正数表示最多元素个数，-1 到 -5 分别表示最多 4KB、8KB、16KB、32KB、64KB
+func listpackWithinLimit(entries, bytes, limit int) bool {
+	if limit >= 0 {
+		return entries <= limit
+	}
+	maxBytes := 4096
+	for i := -1; i > limit && i > -5; i-- {
+		maxBytes *= 2
+	}
+	return bytes <= maxBytes
+}
+
+// ListObject 是列表类型的值。小列表是单个 listpack，超过 list-max-listpack-size 后转换为 quicklist
+type ListObject struct {
+	lp *listpack
+	ql *quicklist
+}
+
+func NewListObject() *ListObject {
+	return &ListObject{lp: &listpack{}}
+}
+
+func (l *ListObject) Encoding() string {
+	if l.lp != nil {
+		return "listpack"
+	}
+	return "quicklist"
+}
+
+func (l *ListObject) clone() *ListObject {
+	if l.lp != nil {
+		return &ListObject{lp: l.lp.clone()}
+	}
+	ql := &quicklist{}
+	for node := l.ql.head; node != nil; node = node.next {
+		n := &quicklistNode{lp: node.lp.clone(), prev: ql.tail}
+		if ql.tail != nil {
+			ql.tail.next = n
+		} else {
+			ql.head = n
+		}
+		ql.tail = n
+	}
+	ql.count, ql.nodes, ql.bytes = l.ql.count, l.ql.nodes, l.ql.bytes
+	return &ListObject{ql: ql}
+}
+
+func (l *ListObject) Len() int {
+	if l.lp != nil {
+		return l.lp.Len()
+	}
+	return l.ql.Len()
+}
+
+func (l *ListObject) convert() {
+	ql := &quicklist{}
+	l.lp.forEach(func(elem []byte) bool {
+		ql.pushBack(string(elem))
+		return true
+	})
+	l.ql, l.lp = ql, nil
+}
+
+// fitsListpack 判断再加入 elems 后是否仍可以保持 listpack 编码
+func (l *ListObject) fitsListpack(elems []string) bool {
+	added := 0
+	for _, s := range elems {
+		added += len(s) + 2
+	}
+	return listpackWithinLimit(l.lp.Len()+len(elems), l.lp.Bytes()+added, config.Get().ListMaxListpackSize)
+}
+
+// PushFront 与 LPUSH 相同，把元素依次插入到列表头部，插入后的顺序与 elems 相反
+func (l *ListObject) PushFront(elems []string) {
+	if l.lp != nil {
+		if l.fitsListpack(elems) {
+			l.lp.pushFront(elems)
+			return
+		}
+		l.convert()
+	}
+	for _, s := range elems {
+		l.ql.pushFront(s)
+	}
+}
+
+// pushBack 依次把元素追加到列表尾部
+func (l *ListObject) PushBack(elems []string) {
+	if l.lp != nil {
+		if l.fitsListpack(elems) {
+			for _, s := range elems {
+				l.lp.pushBack(s)
+			}
+			return
+		}
+		l.convert()
+	}
+	for _, s := range elems {
+		l.ql.pushBack(s)
+	}
+}
+
+// popFront 弹出列表头部的元素
+func (l *ListObject) PopFront() (string, bool) {
+	if l.lp == nil {
+		return l.ql.popFront()
+	}
+	if l.lp.Len() == 0 {
+		return "", false
+	}
+	elem, _ := l.lp.entryAt(0)
+	s := string(elem)
+	l.lp.removeAt(0, 1)
+	return s, true
+}
+
+// popBack 弹出列表尾部的元素
+func (l *ListObject) PopBack() (string, bool) {
+	if l.lp == nil {
+		return l.ql.popBack()
+	}
+	if l.lp.Len() == 0 {
+		return "", false
+	}
+	off := 0
+	for i := 0; i < l.lp.Len()-1; i++ {
+		_, off = l.lp.entryAt(off)
+	}
+	elem, _ := l.lp.entryAt(off)
+	s := string(elem)
+	l.lp.removeAt(off, 1)
+	return s, true
+}
+
+// rangeItems 依次以 [start, stop] 范围内的元素调用 fn，调用方保证下标合法
+func (l *ListObject) Range(start, stop int, fn func(s string)) {
+	if l.lp == nil {
+		l.ql.rangeItems(start, stop, fn)
+		return
+	}
+	i := 0
+	l.lp.forEach(func(elem []byte) bool {
+		if i >= start {
+			fn(string(elem))
+		}
+		i++
+		return i <= stop
+	})
+}
+
+// SetObject 是集合类型的值。新集合从 intset 编码开始，加入非整数成员或整数过多时转换为
+// listpack（仍然足够小时）或 hashtable
+type SetObject struct {
+	is      *intset
+	lp      *listpack
+	members map[string]struct{}
+
+	// bytes 是 hashtable 编码下所有成员的总长度，用于内存统计
+	bytes int
+}
+
+func NewSetObject() *SetObject {
+	return &SetObject{is: &intset{}}
+}
+
+func (s *SetObject) Encoding() string {
+	switch {
+	case s.is != nil:
+		return "intset"
+	case s.lp != nil:
+		return "listpack"
+	}
+	return "hashtable"
+}
+
+func (s *SetObject) clone() *SetObject {
+	switch {
+	case s.is != nil:
+		return &SetObject{is: &intset{vals: append([]int64(nil), s.is.vals...)}}
+	case s.lp != nil:
+		return &SetObject{lp: s.lp.clone()}
+	}
+	members := make(map[string]struct{}, len(s.members))
+	for m := range s.members {
+		members[m] = struct{}{}
+	}
+	return &SetObject{members: members, bytes: s.bytes}
+}
+
+func (s *SetObject) Len() int {
+	switch {
+	case s.is != nil:
+		return s.is.Len()
+	case s.lp != nil:
+		return s.lp.Len()
+	}
+	return len(s.members)
+}
+
+// convert 把 intset / listpack 编码转换为 hashtable
+func (s *SetObject) convert() {
+	members := make(map[string]struct{}, s.Len())
+	s.bytes = 0
+	s.ForEach(func(member string) {
+		members[member] = struct{}{}
+		s.bytes += len(member)
+	})
+	s.members, s.is, s.lp = members, nil, nil
+}
+
+// convertIntsetToListpack 把 intset 转换为 listpack，用于加入第一个非整数成员且集合仍然较小时
+func (s *SetObject) convertIntsetToListpack() {
+	lp := &listpack{}
+	for _, v := range s.is.vals {
+		lp.pushBack(strconv.FormatInt(v, 10))
+	}
+	s.lp, s.is = lp, nil
+}
+
+// add 添加成员，返回成员此前是否不存在
+func (s *SetObject) Add(member string) bool {
+	cfg := config.Get()
+	if s.is != nil {
+		if v, ok := parseIntsetMember(member); ok {
+			if _, exists := s.is.search(v); exists {
+				return false
+			}
+			if s.is.Len() < cfg.SetMaxIntsetEntries {
+				return s.is.add(v)
+			}
+			s.convert()
+		} else if s.is.Len() < cfg.SetMaxListpackEntries && len(member) <= cfg.SetMaxListpackValue {
+			s.convertIntsetToListpack()
+		} else {
+			s.convert()
+		}
+	}
+	if s.lp != nil {
+		if _, ok := s.lp.find(member, 1); ok {
+			return false
+		}
+		if s.lp.Len() < cfg.SetMaxListpackEntries && len(member) <= cfg.SetMaxListpackValue {
+			s.lp.pushBack(member)
+			return true
+		}
+		s.convert()
+	}
+	if _, ok := s.members[member]; ok {
+		return false
+	}
+	s.members[member] = struct{}{}
+	s.bytes += len(member)
+	return true
+}
+
+// Contains 返回成员是否在集合中
+func (s *SetObject) Contains(member string) bool {
+	if s.is != nil {
+		v, ok := parseIntsetMember(member)
+		if !ok {
+			return false
+		}
+		_, found := s.is.search(v)
+		return found
+	}
+	if s.lp != nil {
+		_, ok := s.lp.find(member, 1)
+		return ok
+	}
+	_, ok := s.members[member]
+	return ok
+}
+
+// remove 删除成员，返回成员此前是否存在
+func (s *SetObject) Remove(member string) bool {
+	if s.is != nil {
+		v, ok := parseIntsetMember(member)
+		return ok && s.is.remove(v)
+	}
+	if s.lp != nil {
+		off, ok := s.lp.find(member, 1)
+		if ok {
+			s.lp.removeAt(off, 1)
+		}
+		return ok
+	}
+	if _, ok := s.members[member]; !ok {
+		return false
+	}
+	delete(s.members, member)
+	s.bytes -= len(member)
+	return true
+}
+
+// forEach 遍历所有成员
+func (s *SetObject) ForEach(fn func(member string)) {
+	if s.is != nil {
+		for _, v := range s.is.vals {
+			fn(strconv.FormatInt(v, 10))
+		}
+		return
+	}
+	if s.lp != nil {
+		s.lp.forEach(func(elem []byte) bool {
+			fn(string(elem))
+			return true
+		})
+		return
+	}
+	for member := range s.members {
+		fn(member)
+	}
+}
+
+// HashObject 是哈希类型的值，listpack 编码时 field 与 value 交替存放
+type HashObject struct {
+	lp     *listpack
+	fields map[string]string
+
+	// bytes 是 hashtable 编码下所有字段名和值的总长度，用于内存统计
+	bytes int
+}
+
+func NewHashObject() *HashObject {
+	return &HashObject{lp: &listpack{}}
+}
+
+func (h *HashObject) Encoding() string {
+	if h.lp != nil {
+		return "listpack"
+	}
+	return "hashtable"
+}
+
+func (h *HashObject) clone() *HashObject {
+	if h.lp != nil {
+		return &HashObject{lp: h.lp.clone()}
+	}
+	fields := make(map[string]string, len(h.fields))
+	for f, v := range h.fields {
+		fields[f] = v
+	}
+	return &HashObject{fields: fields, bytes: h.bytes}
+}
+
+func (h *HashObject) Len() int {
+	if h.lp != nil {
+		return h.lp.Len() / 2
+	}
+	return len(h.fields)
+}
+
+func (h *HashObject) convert() {
+	fields := make(map[string]string, h.lp.Len()/2)
+	h.bytes = 0
+	h.ForEach(func(field, value string) {
+		fields[field] = value
+		h.bytes += len(field) + len(value)
+	})
+	h.fields, h.lp = fields, nil
+}
+
+func (h *HashObject) Get(field string) (string, bool) {
+	if h.lp != nil {
+		off, ok := h.lp.find(field, 2)
+		if !ok {
+			return "", false
+		}
+		_, next := h.lp.entryAt(off)
+		value, _ := h.lp.entryAt(next)
+		return string(value), true
+	}
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// set 设置字段的值，返回字段此前是否不存在
+func (h *HashObject) Set(field, value string) bool {
+	if h.lp != nil {
+		cfg := config.Get()
+		if len(field) <= cfg.HashMaxListpackValue && len(value) <= cfg.HashMaxListpackValue {
+			if off, ok := h.lp.find(field, 2); ok {
+				_, next := h.lp.entryAt(off)
+				h.lp.replaceAt(next, value)
+				return false
+			}
+			if h.Len() < cfg.HashMaxListpackEntries {
+				h.lp.pushBack(field)
+				h.lp.pushBack(value)
+				return true
+			}
+		}
+		h.convert()
+	}
+	old, exists := h.fields[field]
+	if exists {
+		h.bytes -= len(old)
+	} else {
+		h.bytes += len(field)
+	}
+	h.fields[field] = value
+	h.bytes += len(value)
+	return !exists
+}
+
+// del 删除字段，返回字段此前是否存在
+func (h *HashObject) Del(field string) bool {
+	if h.lp != nil {
+		off, ok := h.lp.find(field, 2)
+		if ok {
+			h.lp.removeAt(off, 2)
+		}
+		return ok
+	}
+	value, ok := h.fields[field]
+	if !ok {
+		return false
+	}
+	delete(h.fields, field)
+	h.bytes -= len(field) + len(value)
+	return true
+}
+
+// forEach 遍历所有字段
+func (h *HashObject) ForEach(fn func(field, value string)) {
+	if h.lp != nil {
+		var field string
+		i := 0
+		h.lp.forEach(func(elem []byte) bool {
+			if i%2 == 0 {
+				field = string(elem)
+			} else {
+				fn(field, string(elem))
+			}
+			i++
+			return true
+		})
+		return
+	}
+	for field, value := range h.fields {
+		fn(field, value)
+	}
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+)
+
+// 延迟队列：元素按可见时间（unix 毫秒）排序，可见时间相同时按加入顺序。
+// 元素只有在可见时间到达之后才能弹出，可见时间也就是元素的优先级，越早越先出队。
+// 元素以最小堆保存，加入和弹出都是 O(log n)。
+//
+// 除了直接弹出，元素也可以被认领（Claim）：认领把元素的可见时间推迟到认领超时之后并增加投递次数，
+// 元素仍留在队列中，确认（Ack）后才删除；超时前没有确认的元素重新可见，可以再被认领，实现至少一次投递
+
+// QueueItem 是队列中的一个元素
+type QueueItem struct {
+	ID        int64
+	Payload   string
+	VisibleAt int64
+	// Deliveries 是元素被认领的次数
+	Deliveries int64
+
+	index int // 在堆中的位置
+}
+
+// queueHeap 实现 heap.Interface，按 (VisibleAt, ID) 排序
+type queueHeap []*QueueItem
+
+func (h queueHeap) Len() int { return len(h) }
+
+func (h queueHeap) Less(i, j int) bool {
+	if h[i].VisibleAt != h[j].VisibleAt {
+		return h[i].VisibleAt < h[j].VisibleAt
+	}
+	return h[i].ID < h[j].ID
+}
+
+func (h queueHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *queueHeap) Push(x interface{}) {
+	item := x.(*QueueItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *queueHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// QueueObject 是延迟队列类型的值
+type QueueObject struct {
+	// NextID 是下一个元素的编号，单调递增，弹出元素后也不会复用
+	NextID int64
+
+	items   queueHeap
+	byID    map[int64]*QueueItem
+	payload int // 全部元素内容的字节数，用于估算内存
+}
+
+// NewQueueObject 创建一个空的延迟队列
+func NewQueueObject() *QueueObject {
+	return &QueueObject{NextID: 1, byID: make(map[int64]*QueueItem)}
+}
+
+func (q *QueueObject) clone() *QueueObject {
+	c := *q
+	c.items = make(queueHeap, len(q.items))
+	c.byID = make(map[int64]*QueueItem, len(q.items))
+	for i, item := range q.items {
+		it := *item
+		c.items[i] = &it
+		c.byID[it.ID] = &it
+	}
+	return &c
+}
+
+// Len 返回元素个数，包括还不可见的元素
+func (q *QueueObject) Len() int {
+	return len(q.items)
+}
+
+// Push 加入一个在 visibleAt 之后可见的元素
+func (q *QueueObject) Push(payload string, visibleAt int64) *QueueItem {
+	item := &QueueItem{ID: q.NextID, Payload: payload, VisibleAt: visibleAt}
+	q.NextID++
+	heap.Push(&q.items, item)
+	q.byID[item.ID] = item
+	q.payload += len(payload)
+	return item
+}
+
+// Peek 返回最早可见的元素（不论是否已经可见），队列为空时返回 nil
+func (q *QueueObject) Peek() *QueueItem {
+	if len(q.items) == 0 {
+		return nil
+	}
+	return q.items[0]
+}
+
+// Pop 弹出在 now 时已经可见的最早的元素，没有可见的元素时返回 nil
+func (q *QueueObject) Pop(now int64) *QueueItem {
+	if len(q.items) == 0 || q.items[0].VisibleAt > now {
+		return nil
+	}
+	return q.Remove(q.items[0].ID)
+}
+
+// Claim 认领在 now 时已经可见的最早的元素：可见时间推迟到 now + timeout，投递次数加一。
+// 没有可见的元素时返回 nil
+func (q *QueueObject) Claim(now, timeout int64) *QueueItem {
+	if len(q.items) == 0 || q.items[0].VisibleAt > now {
+		return nil
+	}
+	item := q.items[0]
+	item.VisibleAt = now + timeout
+	item.Deliveries++
+	heap.Fix(&q.items, 0)
+	return item
+}
+
+// Remove 删除编号为 id 的元素并返回它，元素不存在时返回 nil。确认认领的元素就是删除它
+func (q *QueueObject) Remove(id int64) *QueueItem {
+	item := q.byID[id]
+	if item == nil {
+		return nil
+	}
+	heap.Remove(&q.items, item.index)
+	delete(q.byID, id)
+	q.payload -= len(item.Payload)
+	return item
+}
+
+// MarshalBinary 把队列编码为字节串，用于快照：下一个编号，然后是每个元素的编号、可见时间、投递次数和内容
+func (q *QueueObject) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendVarint(nil, q.NextID)
+	buf = binary.AppendUvarint(buf, uint64(len(q.items)))
+	for _, item := range q.items {
+		buf = binary.AppendVarint(buf, item.ID)
+		buf = binary.AppendVarint(buf, item.VisibleAt)
+		buf = binary.AppendVarint(buf, item.Deliveries)
+		buf = appendTSString(buf, item.Payload)
+	}
+	return buf, nil
+}
+
+var errBadQueue = errors.New("invalid queue encoding")
+
+// UnmarshalQueue 解码 MarshalBinary 的结果
+func UnmarshalQueue(data []byte) (*QueueObject, error) {
+	d := &tsDecoder{data: data}
+	q := &QueueObject{NextID: d.varint(), byID: make(map[int64]*QueueItem)}
+	if n := d.count(4); n > 0 {
+		q.items = make(queueHeap, n)
+		for i := range q.items {
+			item := &QueueItem{ID: d.varint(), VisibleAt: d.varint(), Deliveries: d.varint(), index: i}
+			item.Payload = d.string()
+			q.items[i] = item
+			q.payload += len(item.Payload)
+			if item.ID >= q.NextID || q.byID[item.ID] != nil {
+				return nil, errBadQueue
+			}
+			q.byID[item.ID] = item
+		}
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return nil, errBadQueue
+	}
+	// 编码时按堆的顺序写出，这里重新整理一次，防止损坏的数据破坏堆的性质
+	heap.Init(&q.items)
+	return q, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import "github.com/LikiosSedo/redis_easy/config"
+
+// quicklistNode 是 quicklist 中的一个节点，节点内的元素以 listpack 编码连续存放
+type quicklistNode struct {
+	prev, next *quicklistNode
+	lp         *listpack
+}
+
+// quicklist 是大列表的编码：由若干 listpack 节点组成的双向链表，每个节点的大小受
+// list-max-listpack-size 限制。在两端插入或弹出元素只会改动头尾节点，
+// 代价与节点大小有关而与列表总长度无关，因此是 O(1) 的；按下标访问时先按节点整体跳过
+type quicklist struct {
+	head, tail *quicklistNode
+	count      int
+
+	// nodes 和 bytes 记录节点个数以及所有节点 listpack 的总字节数，用于内存统计
+	nodes int
+	bytes int
+}
+
+func (ql *quicklist) Len() int {
+	return ql.count
+}
+
+// nodeHasRoom 判断节点再放入 s 后是否仍不超过 list-max-listpack-size
+func nodeHasRoom(node *quicklistNode, s string) bool {
+	return listpackWithinLimit(node.lp.Len()+1, node.lp.Bytes()+len(s)+2, config.Get().ListMaxListpackSize)
+}
+
+// pushFront 在列表头部插入一个元素
+func (ql *quicklist) pushFront(s string) {
+	if ql.head == nil || !nodeHasRoom(ql.head, s) {
+		node := &quicklistNode{lp: &listpack{}, next: ql.head}
+		if ql.head != nil {
+			ql.head.prev = node
+		} else {
+			ql.tail = node
+		}
+		ql.head = node
+		ql.nodes++
+	}
+	before := ql.head.lp.Bytes()
+	ql.head.lp.pushFront([]string{s})
+	ql.bytes += ql.head.lp.Bytes() - before
+	ql.count++
+}
+
+// pushBack 在列表尾部追加一个元素
+func (ql *quicklist) pushBack(s string) {
+	if ql.tail == nil || !nodeHasRoom(ql.tail, s) {
+		node := &quicklistNode{lp: &listpack{}, prev: ql.tail}
+		if ql.tail != nil {
+			ql.tail.next = node
+		} else {
+			ql.head = node
+		}
+		ql.tail = node
+		ql.nodes++
+	}
+	before := ql.tail.lp.Bytes()
+	ql.tail.lp.pushBack(s)
+	ql.bytes += ql.tail.lp.Bytes() - before
+	ql.count++
+}
+
+// unlink 从链表中摘除已经为空的节点
+func (ql *quicklist) unlink(node *quicklistNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		ql.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		ql.tail = node.prev
+	}
+	ql.nodes--
+}
+
+// popFront 弹出列表头部的元素
+func (ql *quicklist) popFront() (string, bool) {
+	if ql.head == nil {
+		return "", false
+	}
+	node := ql.head
+	elem, _ := node.lp.entryAt(0)
+	s := string(elem)
+	before := node.lp.Bytes()
+	node.lp.removeAt(0, 1)
+	ql.bytes -= before - node.lp.Bytes()
+	if node.lp.Len() == 0 {
+		ql.unlink(node)
+	}
+	ql.count--
+	return s, true
+}
+
+// popBack 弹出列表尾部的元素
+func (ql *quicklist) popBack() (string, bool) {
+	if ql.tail == nil {
+		return "", false
+	}
+	node := ql.tail
+	off, i := 0, 0
+	for ; i < node.lp.Len()-1; i++ {
+		_, off = node.lp.entryAt(off)
+	}
+	elem, _ := node.lp.entryAt(off)
+	s := string(elem)
+	before := node.lp.Bytes()
+	node.lp.removeAt(off, 1)
+	ql.bytes -= before - node.lp.Bytes()
+	if node.lp.Len() == 0 {
+		ql.unlink(node)
+	}
+	ql.count--
+	return s, true
+}
+
+// rangeItems 依次以 [start, stop] 范围内的元素调用 fn，调用方保证下标合法
+func (ql *quicklist) rangeItems(start, stop int, fn func(s string)) {
+	i := 0
+	for node := ql.head; node != nil && i <= stop; node = node.next {
+		n := node.lp.Len()
+		if i+n <= start {
+			i += n
+			continue
+		}
+		node.lp.forEach(func(elem []byte) bool {
+			if i >= start {
+				fn(string(elem))
+			}
+			i++
+			return i <= stop
+		})
+	}
+}
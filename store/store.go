@@ -0,0 +1,320 @@
+// Package store 实现 redis-easy 的键空间：按键哈希分片的存储、字符串/列表/集合/哈希对象及其内存统计。
+// 除了供 server 包执行命令使用，Get/Set/LPush 等方法也可以直接嵌入到 Go 程序中使用（见 client.go）
+package store
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardCount 是键空间的分片数。分片数固定，与 worker 数量无关：分片 i 始终由 worker i%N 执行
+const ShardCount = 256
+
+// shard 是键空间的一个分片。正常情况下只有负责该分片的 worker 会访问它，
+// mu 主要用于让多键命令等少数跨分片的访问与 worker 互斥，因此几乎不会发生竞争
+type shard struct {
+	mu    sync.Mutex
+	items map[string]*Entry
+
+	// cowEpoch 在每次快照复制该分片时加一；snapshotting 为 true 表示快照仍在读取该分片复制出的条目，
+	// 此时修改 epoch 小于 cowEpoch 的条目前必须先复制一份（写时复制）
+	cowEpoch     uint64
+	snapshotting bool
+
+	// memory 按类型记录分片中所有条目的估算字节数。只在持有分片锁时修改，
+	// 但 INFO 等命令会在不持锁的情况下读取，因此使用原子变量
+	memory [TypeCount]atomic.Int64
+
+	// expires 是设置了过期时间的条目数，expireSum 是这些条目的过期时间（相对 expireBase 的毫秒数）之和，
+	// 用于计算平均 TTL；expired 是过期后被删除的键数。与 memory 相同，只在持有分片锁时修改
+	expires   atomic.Int64
+	expireSum atomic.Int64
+	expired   atomic.Int64
+}
+
+// expireBase 是 expireSum 中过期时间的起点，以进程启动时间为起点使累加的毫秒数不会溢出
+var expireBase = time.Now()
+
+// trackExpire 把条目的过期时间计入（sign 为 1）或移出（sign 为 -1）分片的统计
+func (s *shard) trackExpire(entry *Entry, sign int64) {
+	if entry.ExpireAt.IsZero() {
+		return
+	}
+	s.expires.Add(sign)
+	s.expireSum.Add(sign * entry.ExpireAt.Sub(expireBase).Milliseconds())
+}
+
+// Store 是按键哈希分片的存储。Load/Put/Delete 本身不加锁，
+// 调用方必须已经持有键所在分片的锁（通过 Run 执行的函数会自动持有）
+type Store struct {
+	shards  [ShardCount]shard
+	workers []*shardWorker
+
+	// onKeyEvent 不为空时在键被写入、删除、过期时调用，见 SetKeyEventHandler
+	onKeyEvent func(event KeyEvent, key string)
+	// namespaces 是按前缀从长到短排列的命名空间，见 namespace.go
+	namespaces atomic.Pointer[[]*Namespace]
+}
+
+// KeyEvent 是键空间中一个键发生的变化
+type KeyEvent int
+
+const (
+	KeyWritten KeyEvent = iota // Put 写入或者原地修改后调用 Updated
+	KeyDeleted                 // 删除未过期的键，包括集合类型删空后删除键，以及 Take 取出键
+	KeyExpired                 // 删除已经过期的键
+)
+
+var keyEventNames = [...]string{"write", "del", "expired"}
+
+func (e KeyEvent) String() string {
+	return keyEventNames[e]
+}
+
+// SetKeyEventHandler 设置键空间事件的回调，需在开始处理命令之前调用。
+// 回调在持有键所在分片锁的情况下同步执行，不能阻塞，也不能访问键空间
+func (ks *Store) SetKeyEventHandler(fn func(event KeyEvent, key string)) {
+	ks.onKeyEvent = fn
+}
+
+func (ks *Store) notify(event KeyEvent, key string) {
+	if ks.onKeyEvent != nil {
+		ks.onKeyEvent(event, key)
+	}
+}
+
+// New 创建一个空的存储。调用 StartWorkers 之前，Run 直接在调用方的 goroutine 上执行
+func New() *Store {
+	ks := &Store{}
+	for i := range ks.shards {
+		ks.shards[i].items = make(map[string]*Entry)
+	}
+	return ks
+}
+
+// shardIndex 使用 FNV-1a 计算键所属的分片
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % ShardCount)
+}
+
+func (ks *Store) Load(key string) (*Entry, bool) {
+	entry, ok := ks.shards[shardIndex(key)].items[key]
+	return entry, ok
+}
+
+// LoadForWrite 与 Load 相同，但用于随后要原地修改值的场景：如果条目正被进行中的快照引用，
+// 先复制一份替换它再返回，保证快照读到的仍是它开始复制分片时的内容
+func (ks *Store) LoadForWrite(key string) (*Entry, bool) {
+	s := &ks.shards[shardIndex(key)]
+	entry, ok := s.items[key]
+	if ok && s.snapshotting && entry.epoch < s.cowEpoch {
+		entry = entry.clone()
+		entry.epoch = s.cowEpoch
+		s.items[key] = entry
+	}
+	return entry, ok
+}
+
+func (ks *Store) Put(key string, entry *Entry) {
+	s := &ks.shards[shardIndex(key)]
+	old, exists := s.items[key]
+	if exists {
+		s.memory[old.Type].Add(-old.size)
+		s.trackExpire(old, -1)
+		if old.Value != entry.Value {
+			s.release(old)
+		}
+	}
+	entry.epoch = s.cowEpoch
+	entry.size = entryMemoryUsage(key, entry)
+	s.memory[entry.Type].Add(entry.size)
+	s.trackExpire(entry, 1)
+	if exists {
+		ks.accountNamespace(key, 0, entry.size-old.size)
+	} else {
+		ks.accountNamespace(key, 1, entry.size)
+	}
+	s.items[key] = entry
+	ks.notify(KeyWritten, key)
+}
+
+func (ks *Store) Delete(key string) {
+	s := &ks.shards[shardIndex(key)]
+	if old, ok := s.items[key]; ok {
+		delete(s.items, key)
+		s.memory[old.Type].Add(-old.size)
+		s.trackExpire(old, -1)
+		ks.accountNamespace(key, -1, -old.size)
+		s.release(old)
+		if old.IsExpired() {
+			s.expired.Add(1)
+			ks.notify(KeyExpired, key)
+		} else {
+			ks.notify(KeyDeleted, key)
+		}
+	}
+}
+
+// Take 从分片中取出键的条目并返回，与 Delete 不同，取出的值不会被回收，调用方可以把它 Put 到另一个键下（RENAME、LMOVE 等）。
+// 条目正被进行中的快照引用时返回的是它的副本
+func (ks *Store) Take(key string) (*Entry, bool) {
+	entry, ok := ks.LoadForWrite(key)
+	if ok {
+		s := &ks.shards[shardIndex(key)]
+		delete(s.items, key)
+		s.memory[entry.Type].Add(-entry.size)
+		s.trackExpire(entry, -1)
+		ks.accountNamespace(key, -1, -entry.size)
+		ks.notify(KeyDeleted, key)
+	}
+	return entry, ok
+}
+
+// Updated 在原地修改了键的值之后调用，重新估算条目占用的内存
+func (ks *Store) Updated(key string) {
+	s := &ks.shards[shardIndex(key)]
+	if entry, ok := s.items[key]; ok {
+		size := entryMemoryUsage(key, entry)
+		s.memory[entry.Type].Add(size - entry.size)
+		ks.accountNamespace(key, 0, size-entry.size)
+		entry.size = size
+		ks.notify(KeyWritten, key)
+	}
+}
+
+// PutOrUpdate 保存修改后的集合类型条目：exists 为 true 时条目已在键空间中并且是原地修改的，只需重新估算内存，
+// 这样也保留了原来的过期时间；否则是新建的条目，通过 Put 加入。调用方需持有键所在分片的锁
+func (ks *Store) PutOrUpdate(key string, entry *Entry, exists bool) {
+	if exists {
+		ks.Updated(key)
+	} else {
+		ks.Put(key, entry)
+	}
+}
+
+// SetExpireAt 修改已经存在的键的过期时间，at 为零值表示不过期。调用方需持有分片锁，
+// 并且 entry 是经 LoadForWrite 取出的该键的条目。已经存入的条目不能直接修改 ExpireAt，否则过期统计会不准确
+func (ks *Store) SetExpireAt(key string, entry *Entry, at time.Time) {
+	s := &ks.shards[shardIndex(key)]
+	s.trackExpire(entry, -1)
+	entry.ExpireAt = at
+	s.trackExpire(entry, 1)
+}
+
+// ExpireStats 返回设置了过期时间的键数、这些键的平均剩余 TTL，以及累计过期删除的键数。
+// 已过期但尚未删除的键也计算在平均 TTL 中（剩余 TTL 为负），平均值小于 0 或者没有设置过期时间的键时为 0
+func (ks *Store) ExpireStats() (expires int64, avgTTL time.Duration, expired int64) {
+	var sum int64
+	for i := range ks.shards {
+		s := &ks.shards[i]
+		expires += s.expires.Load()
+		sum += s.expireSum.Load()
+		expired += s.expired.Load()
+	}
+	if expires > 0 {
+		avgTTL = max(0, time.Duration(sum/expires)*time.Millisecond-time.Since(expireBase))
+	}
+	return expires, avgTTL, expired
+}
+
+// UsedMemory 返回每种类型的条目估算占用的总字节数
+func (ks *Store) UsedMemory() [TypeCount]int64 {
+	var total [TypeCount]int64
+	for i := range ks.shards {
+		for t := range total {
+			total[t] += ks.shards[i].memory[t].Load()
+		}
+	}
+	return total
+}
+
+// release 回收被删除或覆盖的条目。进行中的快照可能还在读取这个条目，这种情况下只丢弃引用
+func (s *shard) release(old *Entry) {
+	if s.snapshotting && old.epoch < s.cowEpoch {
+		return
+	}
+	freeValue(old.Value)
+}
+
+// ScanShard 在持有分片锁的情况下按键名顺序遍历分片 i 中所有未过期的条目
+func (ks *Store) ScanShard(i int, fn func(key string, entry *Entry)) {
+	s := &ks.shards[i]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.items))
+	for key, entry := range s.items {
+		if !entry.IsExpired() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(key, s.items[key])
+	}
+}
+
+// KeyCount 返回键空间中的键数（包括已过期但尚未删除的键）
+func (ks *Store) KeyCount() int {
+	n := 0
+	for i := range ks.shards {
+		s := &ks.shards[i]
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// ShardsOf 返回一组键涉及的分片编号，按升序去重。
+// 需要同时锁住多个分片时一律按这个顺序加锁，避免死锁
+func ShardsOf(keys []string) []int {
+	idx := make([]int, 0, len(keys))
+	for _, key := range keys {
+		idx = append(idx, shardIndex(key))
+	}
+	sort.Ints(idx)
+	n := 0
+	for i, v := range idx {
+		if i == 0 || v != idx[n-1] {
+			idx[n] = v
+			n++
+		}
+	}
+	return idx[:n]
+}
+
+// SnapshotItem 是快照复制出的一个键值对
+type SnapshotItem struct {
+	Key   string
+	Entry *Entry
+}
+
+// BeginShardSnapshot 在持有分片锁的短时间内复制分片中所有条目的指针并开启写时复制，
+// 之后快照可以在不持锁的情况下慢慢读取这些条目，分片上的写命令不受影响
+func (ks *Store) BeginShardSnapshot(i int) []SnapshotItem {
+	s := &ks.shards[i]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]SnapshotItem, 0, len(s.items))
+	for key, entry := range s.items {
+		items = append(items, SnapshotItem{key, entry})
+	}
+	s.cowEpoch++
+	s.snapshotting = true
+	return items
+}
+
+// EndShardSnapshot 在快照读完分片后关闭写时复制
+func (ks *Store) EndShardSnapshot(i int) {
+	s := &ks.shards[i]
+	s.mu.Lock()
+	s.snapshotting = false
+	s.mu.Unlock()
+}
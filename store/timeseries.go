@@ -0,0 +1,397 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// 时间序列：按时间戳（毫秒）排序的 float64 采样点，附带标签和降采样规则。
+//
+// Retention 大于 0 时只保留最新的采样点之前 Retention 毫秒内的数据，更早的采样点在写入时删除，
+// 也不能再写入。同一时间戳只能写入一次。降采样规则把源序列的采样点按 Bucket 毫秒分桶聚合后写入目标序列：
+// 每个规则记录当前未结束的桶，写入下一个桶的采样点时把结束的桶聚合为一个采样点交给调用方写入目标键。
+// 比当前桶更早的乱序采样点不参与降采样
+
+// TSAggregations 是支持的聚合方式
+var TSAggregations = []string{"avg", "sum", "min", "max", "count", "first", "last", "range"}
+
+var (
+	// ErrTSDuplicate 表示时间戳已经存在
+	ErrTSDuplicate = errors.New("TSDB: duplicate sample, update is not supported")
+	// ErrTSTooOld 表示时间戳早于保留时间
+	ErrTSTooOld = errors.New("TSDB: Timestamp is older than retention")
+)
+
+// TSSample 是一个采样点
+type TSSample struct {
+	Time  int64
+	Value float64
+}
+
+// TSRule 是一条降采样规则
+type TSRule struct {
+	Dest   string
+	Agg    string
+	Bucket int64
+
+	// open 为 true 时 start 是当前未结束的桶的起始时间，acc 是桶中已有采样点的聚合状态
+	open  bool
+	start int64
+	acc   tsAccumulator
+}
+
+// TimeSeriesObject 是时间序列类型的值
+type TimeSeriesObject struct {
+	Retention int64
+	// Labels 是标签名和值交替排列的列表，按 TS.CREATE / TS.ADD 中的顺序
+	Labels []string
+	// Source 不为空时表示这是降采样规则的目标序列，值为源序列的键
+	Source string
+	Rules  []*TSRule
+
+	samples []TSSample
+}
+
+// NewTimeSeriesObject 创建一个空的时间序列
+func NewTimeSeriesObject(retention int64, labels []string) *TimeSeriesObject {
+	return &TimeSeriesObject{Retention: retention, Labels: labels}
+}
+
+func (ts *TimeSeriesObject) clone() *TimeSeriesObject {
+	c := *ts
+	c.Labels = append([]string(nil), ts.Labels...)
+	c.Rules = make([]*TSRule, len(ts.Rules))
+	for i, r := range ts.Rules {
+		rule := *r
+		c.Rules[i] = &rule
+	}
+	c.samples = append([]TSSample(nil), ts.samples...)
+	return &c
+}
+
+// Len 返回采样点个数
+func (ts *TimeSeriesObject) Len() int {
+	return len(ts.samples)
+}
+
+// Label 返回标签的值
+func (ts *TimeSeriesObject) Label(name string) (string, bool) {
+	for i := 0; i+1 < len(ts.Labels); i += 2 {
+		if ts.Labels[i] == name {
+			return ts.Labels[i+1], true
+		}
+	}
+	return "", false
+}
+
+// First 和 Last 返回最早和最新的采样点，序列为空时 ok 为 false
+func (ts *TimeSeriesObject) First() (s TSSample, ok bool) {
+	if len(ts.samples) == 0 {
+		return s, false
+	}
+	return ts.samples[0], true
+}
+
+func (ts *TimeSeriesObject) Last() (s TSSample, ok bool) {
+	if len(ts.samples) == 0 {
+		return s, false
+	}
+	return ts.samples[len(ts.samples)-1], true
+}
+
+// Add 写入一个采样点，返回各规则结束的桶聚合出的采样点（与 Rules 一一对应，没有结束的桶时为 nil）
+func (ts *TimeSeriesObject) Add(t int64, v float64) ([]*TSSample, error) {
+	n := len(ts.samples)
+	if n > 0 && ts.Retention > 0 && t < ts.samples[n-1].Time-ts.Retention {
+		return nil, ErrTSTooOld
+	}
+	i := sort.Search(n, func(i int) bool { return ts.samples[i].Time >= t })
+	if i < n && ts.samples[i].Time == t {
+		return nil, ErrTSDuplicate
+	}
+	if i == n {
+		ts.samples = append(ts.samples, TSSample{t, v})
+	} else {
+		ts.samples = append(ts.samples, TSSample{})
+		copy(ts.samples[i+1:], ts.samples[i:])
+		ts.samples[i] = TSSample{t, v}
+	}
+	ts.trim()
+
+	var closed []*TSSample
+	for i, r := range ts.Rules {
+		if s := r.add(t, v); s != nil {
+			if closed == nil {
+				closed = make([]*TSSample, len(ts.Rules))
+			}
+			closed[i] = s
+		}
+	}
+	return closed, nil
+}
+
+// trim 删除早于保留时间的采样点
+func (ts *TimeSeriesObject) trim() {
+	n := len(ts.samples)
+	if ts.Retention <= 0 || n == 0 {
+		return
+	}
+	oldest := ts.samples[n-1].Time - ts.Retention
+	i := sort.Search(n, func(i int) bool { return ts.samples[i].Time >= oldest })
+	if i > 0 {
+		ts.samples = append(ts.samples[:0], ts.samples[i:]...)
+	}
+}
+
+// AddRule 增加一条降采样规则，之后写入的采样点才会参与聚合
+func (ts *TimeSeriesObject) AddRule(dest, agg string, bucket int64) {
+	ts.Rules = append(ts.Rules, &TSRule{Dest: dest, Agg: agg, Bucket: bucket})
+}
+
+// DeleteRule 删除目标为 dest 的规则，返回是否找到
+func (ts *TimeSeriesObject) DeleteRule(dest string) bool {
+	for i, r := range ts.Rules {
+		if r.Dest == dest {
+			ts.Rules = append(ts.Rules[:i], ts.Rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// add 把采样点计入规则的当前桶，采样点属于之后的桶时返回结束的桶聚合出的采样点
+func (r *TSRule) add(t int64, v float64) *TSSample {
+	start := tsBucketStart(t, r.Bucket)
+	var closed *TSSample
+	switch {
+	case !r.open:
+		r.open, r.start = true, start
+	case start < r.start:
+		return nil
+	case start > r.start:
+		closed = &TSSample{r.start, r.acc.value(r.Agg)}
+		r.start, r.acc = start, tsAccumulator{}
+	}
+	r.acc.add(v)
+	return closed
+}
+
+// tsBucketStart 返回时间戳所在的桶的起始时间
+func tsBucketStart(t, bucket int64) int64 {
+	start := t - t%bucket
+	if t < 0 && t%bucket != 0 {
+		start -= bucket
+	}
+	return start
+}
+
+// Range 返回 [from, to] 内的采样点。bucket 大于 0 时按 bucket 毫秒分桶，每个桶聚合为一个时间戳为桶起始时间的采样点；
+// count 大于 0 时最多返回 count 个
+func (ts *TimeSeriesObject) Range(from, to int64, agg string, bucket int64, count int) []TSSample {
+	lo := sort.Search(len(ts.samples), func(i int) bool { return ts.samples[i].Time >= from })
+	hi := sort.Search(len(ts.samples), func(i int) bool { return ts.samples[i].Time > to })
+	if lo >= hi {
+		return nil
+	}
+	samples := ts.samples[lo:hi]
+	var out []TSSample
+	if bucket <= 0 {
+		out = append(out, samples...)
+	} else {
+		var acc tsAccumulator
+		start := tsBucketStart(samples[0].Time, bucket)
+		for _, s := range samples {
+			if b := tsBucketStart(s.Time, bucket); b != start {
+				out = append(out, TSSample{start, acc.value(agg)})
+				if count > 0 && len(out) >= count {
+					return out
+				}
+				start, acc = b, tsAccumulator{}
+			}
+			acc.add(s.Value)
+		}
+		out = append(out, TSSample{start, acc.value(agg)})
+	}
+	if count > 0 && len(out) > count {
+		out = out[:count]
+	}
+	return out
+}
+
+// tsAccumulator 是一个桶中采样点的聚合状态
+type tsAccumulator struct {
+	count                      int64
+	sum, min, max, first, last float64
+}
+
+func (a *tsAccumulator) add(v float64) {
+	if a.count == 0 {
+		a.min, a.max, a.first = v, v, v
+	}
+	a.count++
+	a.sum += v
+	a.min = math.Min(a.min, v)
+	a.max = math.Max(a.max, v)
+	a.last = v
+}
+
+func (a *tsAccumulator) value(agg string) float64 {
+	switch agg {
+	case "avg":
+		return a.sum / float64(a.count)
+	case "sum":
+		return a.sum
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "count":
+		return float64(a.count)
+	case "first":
+		return a.first
+	case "last":
+		return a.last
+	case "range":
+		return a.max - a.min
+	}
+	return 0
+}
+
+// MarshalBinary 把时间序列编码为字节串，用于快照：保留时间、标签、源键、规则（包括未结束的桶）和全部采样点，
+// 字符串为 uvarint 长度加内容，时间戳为相对前一个采样点的 varint 差值，值为 float64 的 IEEE 754 位
+func (ts *TimeSeriesObject) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendVarint(nil, ts.Retention)
+	buf = binary.AppendUvarint(buf, uint64(len(ts.Labels)))
+	for _, s := range ts.Labels {
+		buf = appendTSString(buf, s)
+	}
+	buf = appendTSString(buf, ts.Source)
+	buf = binary.AppendUvarint(buf, uint64(len(ts.Rules)))
+	for _, r := range ts.Rules {
+		buf = appendTSString(buf, r.Dest)
+		buf = appendTSString(buf, r.Agg)
+		buf = binary.AppendVarint(buf, r.Bucket)
+		if !r.open {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		buf = binary.AppendVarint(buf, r.start)
+		buf = binary.AppendVarint(buf, r.acc.count)
+		for _, f := range []float64{r.acc.sum, r.acc.min, r.acc.max, r.acc.first, r.acc.last} {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(ts.samples)))
+	var prev int64
+	for _, s := range ts.samples {
+		buf = binary.AppendVarint(buf, s.Time-prev)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(s.Value))
+		prev = s.Time
+	}
+	return buf, nil
+}
+
+func appendTSString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// tsDecoder 按 MarshalBinary 的格式读取字段，出错后的读取都返回零值，最后检查 err
+type tsDecoder struct {
+	data []byte
+	err  error
+}
+
+var errBadTimeSeries = errors.New("invalid time series encoding")
+
+func (d *tsDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err, d.data = errBadTimeSeries, nil
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *tsDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err, d.data = errBadTimeSeries, nil
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *tsDecoder) bytes(n uint64) []byte {
+	if uint64(len(d.data)) < n {
+		d.err, d.data = errBadTimeSeries, nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *tsDecoder) string() string {
+	return string(d.bytes(d.uvarint()))
+}
+
+func (d *tsDecoder) float() float64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// count 读取元素个数，每个元素至少 minSize 个字节，个数超过剩余数据能容纳的数量时视为损坏，避免按损坏的个数分配内存
+func (d *tsDecoder) count(minSize int) int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)/minSize) {
+		d.err, d.data = errBadTimeSeries, nil
+		return 0
+	}
+	return int(n)
+}
+
+// UnmarshalTimeSeries 解码 MarshalBinary 的结果
+func UnmarshalTimeSeries(data []byte) (*TimeSeriesObject, error) {
+	d := &tsDecoder{data: data}
+	ts := &TimeSeriesObject{Retention: d.varint()}
+	if n := d.count(1); n > 0 {
+		ts.Labels = make([]string, n)
+		for i := range ts.Labels {
+			ts.Labels[i] = d.string()
+		}
+	}
+	ts.Source = d.string()
+	for n := d.count(4); n > 0; n-- {
+		r := &TSRule{Dest: d.string(), Agg: d.string(), Bucket: d.varint()}
+		if open := d.bytes(1); open != nil && open[0] == 1 {
+			r.open, r.start = true, d.varint()
+			r.acc.count = d.varint()
+			r.acc.sum, r.acc.min, r.acc.max, r.acc.first, r.acc.last = d.float(), d.float(), d.float(), d.float(), d.float()
+		}
+		if r.Bucket <= 0 {
+			return nil, errBadTimeSeries
+		}
+		ts.Rules = append(ts.Rules, r)
+	}
+	if n := d.count(9); n > 0 {
+		ts.samples = make([]TSSample, n)
+		var prev int64
+		for i := range ts.samples {
+			prev += d.varint()
+			ts.samples[i] = TSSample{prev, d.float()}
+		}
+	}
+	if d.err != nil || len(d.data) != 0 {
+		return nil, errBadTimeSeries
+	}
+	return ts, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import "sync"
+
+// shardWorker 串行执行落在其负责分片上的命令。同一个分片上的命令总是由同一个 worker 执行，
+// 因此单键命令天然是原子的，执行期间持有的分片锁也几乎不会被争用
+type shardWorker struct {
+	jobs chan *shardJob
+}
+
+type shardJob struct {
+	shard int
+	fn    func()
+	done  chan struct{}
+}
+
+var shardJobPool = sync.Pool{
+	New: func() interface{} { return &shardJob{done: make(chan struct{}, 1)} },
+}
+
+// StartWorkers 启动 n 个分片 worker；n 为 0 时命令直接在连接所在的 goroutine 上执行
+func (ks *Store) StartWorkers(n int) {
+	ks.workers = make([]*shardWorker, n)
+	for i := range ks.workers {
+		sw := &shardWorker{jobs: make(chan *shardJob, 1024)}
+		ks.workers[i] = sw
+		go sw.loop(ks)
+	}
+}
+
+func (sw *shardWorker) loop(ks *Store) {
+	for job := range sw.jobs {
+		s := &ks.shards[job.shard]
+		s.mu.Lock()
+		job.fn()
+		s.mu.Unlock()
+		job.done <- struct{}{}
+	}
+}
+
+// Run 在持有给定分片锁的前提下执行 fn，shards 必须是 ShardsOf 返回的有序结果：
+// 只涉及一个分片时交给该分片的 worker 执行；涉及多个分片时在当前 goroutine 上按顺序加锁后执行；
+// 不涉及任何键的命令直接执行
+func (ks *Store) Run(shards []int, fn func()) {
+	switch {
+	case len(shards) == 0:
+		fn()
+	case len(shards) == 1 && len(ks.workers) > 0:
+		job := shardJobPool.Get().(*shardJob)
+		job.shard, job.fn = shards[0], fn
+		ks.workers[shards[0]%len(ks.workers)].jobs <- job
+		<-job.done
+		job.fn = nil
+		shardJobPool.Put(job)
+	default:
+		for _, i := range shards {
+			ks.shards[i].mu.Lock()
+		}
+		fn()
+		for i := len(shards) - 1; i >= 0; i-- {
+			ks.shards[shards[i]].mu.Unlock()
+		}
+	}
+}
+
+// RunKeys 在持有 keys 所在的全部分片锁的前提下执行 fn，是多键命令的原子执行原语。
+// 多个分片总是按分片号从小到大加锁，任意两个多键操作之间不会因为加锁顺序相反而死锁，
+// 因此 RENAME、MSETNX 等需要同时修改多个键的操作都应通过它执行。
+// fn 只能访问 keys 中的键，并且不能再调用 Run、RunKeys 或 client.go 中自行加锁的方法
+func (ks *Store) RunKeys(keys []string, fn func()) {
+	ks.Run(ShardsOf(keys), fn)
+}
+
+// QueueLen 返回负责分片 shard 的 worker 队列中等待执行的命令数，没有启动 worker 时返回 0
+func (ks *Store) QueueLen(shard int) int {
+	if len(ks.workers) == 0 {
+		return 0
+	}
+	return len(ks.workers[shard%len(ks.workers)].jobs)
+}